@@ -45,6 +45,8 @@ class ApiClient {
         page?: number
         limit?: number
         filter?: string
+        search?: string
+        sort?: 'created_at' | 'last_sync' | 'transaction_count'
     }) {
         const response = await this.client.get('/api/v1/admin/users', { params })
         return response.data
@@ -0,0 +1,263 @@
+// Command loadgen simulates devices registering and syncing transactions
+// against a Kwacha Tracker environment and reports latency and error rates.
+//
+//	go run ./cmd/loadgen -target https://staging.example.com -devices 200 -rate 20 -duration 5m
+//
+// The API rate-limits per client IP, so raise the limit on the target (or run
+// loadgen from several hosts) when testing above ~100 requests per minute.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/synthetic"
+)
+
+type device struct {
+	id    string
+	token string
+	gen   *synthetic.Generator
+}
+
+// stats collects latencies and outcomes per endpoint
+type stats struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	statuses  map[string]map[int]int
+	errors    map[string]int
+}
+
+func newStats() *stats {
+	return &stats{
+		latencies: make(map[string][]time.Duration),
+		statuses:  make(map[string]map[int]int),
+		errors:    make(map[string]int),
+	}
+}
+
+func (s *stats) record(endpoint string, latency time.Duration, status int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors[endpoint]++
+		return
+	}
+	s.latencies[endpoint] = append(s.latencies[endpoint], latency)
+	if s.statuses[endpoint] == nil {
+		s.statuses[endpoint] = make(map[int]int)
+	}
+	s.statuses[endpoint][status]++
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "Base URL of the API")
+	devices := flag.Int("devices", 50, "Number of simulated devices")
+	rate := flag.Float64("rate", 5, "Sync requests per second across all devices")
+	duration := flag.Duration("duration", time.Minute, "How long to send syncs")
+	batch := flag.Int("batch", 50, "Transactions per sync request")
+	historyDays := flag.Int("history-days", 30, "Days of history each device uploads in its first sync (0 to skip)")
+	concurrency := flag.Int("concurrency", 50, "Maximum in-flight requests")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Random seed")
+	flag.Parse()
+
+	if *devices < 1 || *rate <= 0 || *batch < 1 {
+		log.Fatal("devices, rate and batch must be positive")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	results := newStats()
+	sem := make(chan struct{}, *concurrency)
+	base := strings.TrimRight(*target, "/")
+	runID := fmt.Sprintf("loadgen-%d", *seed)
+	rng := rand.New(rand.NewSource(*seed))
+
+	// Register every device first
+	log.Printf("📱 Registering %d devices against %s", *devices, base)
+	fleet := make([]*device, *devices)
+	var wg sync.WaitGroup
+	for i := range fleet {
+		d := &device{
+			id:  fmt.Sprintf("%s-%05d", runID, i),
+			gen: synthetic.NewGenerator(rng.Int63(), fmt.Sprintf("%s-%05d", runID, i)),
+		}
+		fleet[i] = d
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			register(client, base, d, results)
+		}()
+	}
+	wg.Wait()
+
+	registered := fleet[:0]
+	for _, d := range fleet {
+		if d.token != "" {
+			registered = append(registered, d)
+		}
+	}
+	if len(registered) == 0 {
+		report(results, 0)
+		log.Fatal("❌ No devices registered; is the target up?")
+	}
+	log.Printf("✅ %d/%d devices registered", len(registered), *devices)
+
+	// Then sync at a fixed rate, round-robin across devices. Each device's first
+	// sync uploads its history, like a fresh install would
+	log.Printf("🔄 Syncing at %.1f req/s for %s (batch %d)", *rate, *duration, *batch)
+	interval := time.Duration(float64(time.Second) / *rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	deadline := start.Add(*duration)
+	firstSync := make(map[*device]bool)
+	sent := 0
+	for now := range ticker.C {
+		if now.After(deadline) {
+			break
+		}
+
+		d := registered[sent%len(registered)]
+		var txns []models.TransactionInput
+		if !firstSync[d] && *historyDays > 0 {
+			txns = d.gen.History(*historyDays, 3)
+			firstSync[d] = true
+		} else {
+			txns = d.gen.Batch(*batch)
+		}
+		sent++
+
+		wg.Add(1)
+		select {
+		case sem <- struct{}{}:
+		default:
+			// Every slot is busy: the target can't keep up with the requested rate
+			results.record("sync", 0, 0, fmt.Errorf("client saturated"))
+			wg.Done()
+			continue
+		}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			syncBatch(client, base, d, txns, results)
+		}()
+	}
+	wg.Wait()
+
+	report(results, time.Since(start))
+}
+
+func register(client *http.Client, base string, d *device, results *stats) {
+	body, _ := json.Marshal(map[string]string{
+		"device_id": d.id,
+		"operator":  d.gen.Operator(),
+		"language":  d.gen.Language(),
+	})
+
+	start := time.Now()
+	resp, err := client.Post(base+"/api/v1/register", "application/json", bytes.NewReader(body))
+	if err != nil {
+		results.record("register", 0, 0, err)
+		return
+	}
+	defer resp.Body.Close()
+	results.record("register", time.Since(start), resp.StatusCode, nil)
+
+	var out struct {
+		Token string `json:"token"`
+	}
+	if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&out) == nil {
+		d.token = out.Token
+	}
+}
+
+func syncBatch(client *http.Client, base string, d *device, txns []models.TransactionInput, results *stats) {
+	body, _ := json.Marshal(models.SyncRequest{DeviceID: d.id, Transactions: txns})
+
+	req, err := http.NewRequest(http.MethodPost, base+"/api/v1/sync", bytes.NewReader(body))
+	if err != nil {
+		results.record("sync", 0, 0, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+d.token)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		results.record("sync", 0, 0, err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	results.record("sync", time.Since(start), resp.StatusCode, nil)
+}
+
+// report prints latency percentiles and status breakdowns per endpoint
+func report(results *stats, elapsed time.Duration) {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	endpoints := []string{"register", "sync"}
+	fmt.Fprintln(os.Stdout)
+	fmt.Fprintf(os.Stdout, "%-10s %7s %7s %9s %9s %9s %9s %9s  %s\n",
+		"endpoint", "reqs", "err%", "p50", "p90", "p95", "p99", "max", "statuses")
+
+	for _, endpoint := range endpoints {
+		latencies := results.latencies[endpoint]
+		failed := results.errors[endpoint]
+		for status, count := range results.statuses[endpoint] {
+			if status >= 400 {
+				failed += count
+			}
+		}
+		total := len(latencies) + results.errors[endpoint]
+		if total == 0 {
+			continue
+		}
+
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		var statuses []string
+		for status, count := range results.statuses[endpoint] {
+			statuses = append(statuses, fmt.Sprintf("%d×%d", status, count))
+		}
+		if n := results.errors[endpoint]; n > 0 {
+			statuses = append(statuses, fmt.Sprintf("err×%d", n))
+		}
+		sort.Strings(statuses)
+
+		fmt.Fprintf(os.Stdout, "%-10s %7d %6.1f%% %9s %9s %9s %9s %9s  %s\n",
+			endpoint, total, float64(failed)/float64(total)*100,
+			percentile(latencies, 0.50), percentile(latencies, 0.90), percentile(latencies, 0.95),
+			percentile(latencies, 0.99), percentile(latencies, 1), strings.Join(statuses, " "))
+	}
+
+	if elapsed > 0 {
+		syncs := len(results.latencies["sync"])
+		fmt.Fprintf(os.Stdout, "\nsync throughput: %.1f req/s over %s\n", float64(syncs)/elapsed.Seconds(), elapsed.Round(time.Second))
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) string {
+	if len(sorted) == 0 {
+		return "-"
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i].Round(time.Millisecond).String()
+}
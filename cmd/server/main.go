@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,9 +16,22 @@ import (
 	"github.com/kwachatracker/backend/internal/database"
 	"github.com/kwachatracker/backend/internal/handlers"
 	"github.com/kwachatracker/backend/internal/middleware"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
 	"github.com/kwachatracker/backend/internal/services"
 )
 
+// Request deadlines. Past one the request's context is cancelled and the
+// client gets a 504. Each also sets the connection's write deadline, so
+// routes given longer than the servers' 15s write timeout aren't cut off
+const (
+	requestTimeout       = 10 * time.Second
+	authRequestTimeout   = 5 * time.Second  // Registration and admin login
+	syncRequestTimeout   = 14 * time.Second // Bulk syncs and export downloads
+	reportRequestTimeout = 30 * time.Second // Admin report queries
+	exportRequestTimeout = 5 * time.Minute  // Admin CSV/JSON exports
+)
+
 func main() {
 	// Load configuration
 	cfg := config.Load()
@@ -27,15 +42,28 @@ func main() {
 	}
 
 	// Connect to database
-	if err := database.Connect(cfg.DatabaseURL); err != nil {
+	db, err := database.Connect(cfg.DatabaseURL, database.PoolOptions{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: time.Duration(cfg.DBConnMaxLifetime) * time.Minute,
+		ConnMaxIdleTime: time.Duration(cfg.DBConnMaxIdleTime) * time.Minute,
+	}, database.QueryOptions{
+		Timeout:       time.Duration(cfg.DBQueryTimeout) * time.Second,
+		SlowThreshold: time.Duration(cfg.DBSlowQueryMillis) * time.Millisecond,
+	})
+	if err != nil {
 		log.Fatalf("❌ Failed to connect to database: %v", err)
 	}
-	defer database.Close()
+	defer db.Close()
 
 	// Run migrations
-	if err := database.Migrate(); err != nil {
+	dbFeatures, err := database.Migrate(db)
+	if err != nil {
 		log.Fatalf("❌ Failed to run migrations: %v", err)
 	}
+	if n := dbFeatures.CriticalSchemaIssues(); n > 0 && cfg.Environment == "production" {
+		log.Fatalf("❌ Refusing to start: %d tables or columns are missing (see schema drift above)", n)
+	}
 
 	// Initialize Firebase Cloud Messaging (optional - fails gracefully)
 	// Supports both FIREBASE_CREDENTIALS_BASE64 env var and file path
@@ -49,35 +77,260 @@ func main() {
 		fcmService = nil
 	}
 
+	// Noise for aggregates that leave the company (partner API, benchmarks)
+	privacyKey := cfg.PrivacyNoiseKey
+	if privacyKey == "" {
+		privacyKey = cfg.JWTSecret
+	}
+	privacy := services.NewPrivacyPolicy(privacyKey, cfg.PrivacyEpsilon, cfg.PrivacyMaxTransactions, cfg.PrivacyMaxVolume)
+
 	// Initialize Gemini AI Service (optional - fails gracefully)
-	var geminiService *services.GeminiService
-	geminiService, err := services.NewGeminiService()
+	aiUsage := services.NewAIUsageTracker(db, cfg.GeminiDailyBudget, cfg.GeminiMonthlyBudget)
+	geminiService, err := services.NewGeminiService(aiUsage, services.NewAdviceGuard(db, cfg.GeminiSafetyModel))
 	if err != nil {
 		log.Printf("⚠️ Gemini AI initialization failed (AI insights disabled): %v", err)
 	} else {
 		log.Println("✅ Gemini AI service initialized")
 	}
 
+	// Object storage for receipt photos (optional - receipts disabled without it)
+	var storage services.ObjectStorage
+	if localStorage, err := services.NewLocalStorage(cfg.StorageDir); err != nil {
+		log.Printf("⚠️ Storage initialization failed (receipts disabled): %v", err)
+	} else {
+		storage = localStorage
+	}
+
+	// Background goroutines (job workers, monitors, scheduler) stop on shutdown
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Redis carries realtime events and the event bus across replicas
+	redisClient, err := services.NewRedisClient(cfg.RedisURL)
+	if err != nil {
+		log.Fatalf("❌ REDIS_URL: %v", err)
+	}
+	if redisClient != nil {
+		defer redisClient.Close()
+	}
+
+	// Push events to connected app sessions, across replicas when Redis is set
+	realtimeHub := services.NewRealtimeHub(redisClient)
+	realtimeHub.Start(bgCtx)
+
+	// Runtime settings admins change without a restart (rate limits, maintenance...)
+	settings := services.NewSettings(db)
+	if err := settings.DisableFeatures(cfg.DisabledFeatures); err != nil {
+		log.Fatalf("❌ DISABLED_FEATURES: %v", err)
+	}
+	if len(cfg.DisabledFeatures) > 0 {
+		log.Printf("⚠️ Disabled by config: %s", strings.Join(cfg.DisabledFeatures, ", "))
+	}
+	if err := settings.Load(bgCtx); err != nil {
+		log.Printf("⚠️ Failed to load settings (using defaults): %v", err)
+	}
+	settings.Start(bgCtx)
+
+	// Push notifications are queued with the writes that trigger them and sent
+	// from the outbox; everything sends through the notifier, which applies
+	// each user's preferences and keeps their inbox
+	outbox := services.NewNotificationOutbox(db, fcmService, settings)
+	outbox.Start(bgCtx)
+	notifier := notifications.NewService(db, outbox, settings)
+
+	// Start background job workers (exports, imports, backfills)
+	jobService := services.NewJobService(db, notifier, realtimeHub, cfg.JobWorkers)
+	jobService.Register(handlers.DataExportJob(db))
+	jobService.Register(handlers.ReconciliationJob(db))
+	jobService.Register(handlers.CategoryRemapJob(db))
+	jobService.Register(handlers.GroupMatchingJob(db))
+	jobService.Register(handlers.HookDeliveryJob(db))
+	jobService.Register(handlers.AlertRulesJob(db, notifier))
+	jobService.Register(handlers.NotificationCampaignJob(db, notifier))
+	jobService.Register(handlers.ReaggregateJob(db, jobService))
+	if geminiService != nil && dbFeatures.Vector {
+		jobService.Register(handlers.TransactionEmbeddingsJob(db, geminiService))
+	}
+	if geminiService != nil && storage != nil {
+		jobService.Register(handlers.ReceiptExtractionJob(db, geminiService, storage))
+	}
+	jobService.Start(bgCtx)
+
+	// Dependency health for the public status endpoint
+	statusMonitor := services.NewStatusMonitor(db, geminiService, fcmService, aiUsage)
+	statusMonitor.Start(bgCtx)
+
+	// Side effects of syncs, insights and consent changes run off the request path
+	funnel := services.NewFunnelTracker(db)
+	eventBus := services.NewEventBus(redisClient)
+	subscribeEvents(eventBus, funnel, jobService, realtimeHub)
+	eventBus.Start(bgCtx)
+
 	// Initialize handlers
-	authHandler := &handlers.AuthHandler{Config: cfg}
-	syncHandler := &handlers.SyncHandler{}
-	analyticsHandler := &handlers.AnalyticsHandler{}
+	authHandler := &handlers.AuthHandler{DB: db, Config: cfg, Funnel: funnel, Events: eventBus, Storage: storage, Settings: settings}
+	syncHandler := &handlers.SyncHandler{DB: db, Events: eventBus, Settings: settings}
+	reconciliationHandler := &handlers.ReconciliationHandler{DB: db}
+	savingsHandler := &handlers.SavingsHandler{DB: db}
+	groupsHandler := &handlers.GroupsHandler{DB: db}
+	noticesHandler := &handlers.NoticesHandler{DB: db}
+	savingGoalsHandler := &handlers.SavingGoalsHandler{DB: db}
+	recurringEntriesHandler := &handlers.RecurringEntriesHandler{DB: db, Events: eventBus, Settings: settings}
+	integrationsHandler := &handlers.IntegrationsHandler{DB: db}
+	alertRulesHandler := &handlers.AlertRulesHandler{DB: db}
+	categoriesHandler := &handlers.CategoriesHandler{DB: db}
+	notificationsHandler := &handlers.NotificationsHandler{DB: db}
+	accountsHandler := &handlers.AccountsHandler{DB: db}
+	partnerSharingHandler := &handlers.PartnerSharingHandler{DB: db}
+	accountingHandler := &handlers.AccountingHandler{DB: db}
+	lessonsHandler := &handlers.LessonsHandler{DB: db, Notifier: notifier}
+	analyticsHandler := &handlers.AnalyticsHandler{DB: db, Funnel: funnel}
+	jobsHandler := &handlers.JobsHandler{DB: db, Jobs: jobService}
+
+	// Recurring work; it runs on one replica only, or users would get every
+	// insight (and cost a Gemini call) once per instance
+	scheduler := services.NewScheduler(db)
+	scheduler.Register(services.ScheduledJob{
+		Name:     "group_reminders",
+		Schedule: "daily at group_reminders_hour",
+		Next:     settings.DailyAt(services.SettingGroupRemindersHour),
+		Run: func(ctx context.Context, at time.Time) error {
+			return handlers.SendGroupReminders(ctx, db, notifier)
+		},
+	})
+	scheduler.Register(services.ScheduledJob{
+		Name:     "saving_reminders",
+		Schedule: "hourly",
+		Next:     services.Hourly,
+		Run: func(ctx context.Context, at time.Time) error {
+			return handlers.SendSavingReminders(ctx, db, notifier, at)
+		},
+	})
+	scheduler.Register(services.ScheduledJob{
+		Name:     "recurring_entries",
+		Schedule: "hourly",
+		Next:     services.Hourly,
+		Run: func(ctx context.Context, at time.Time) error {
+			return handlers.CreateRecurringEntries(ctx, db, notifier, at)
+		},
+	})
+	scheduler.Register(services.ScheduledJob{
+		Name:     "notification_campaigns",
+		Schedule: "every minute",
+		Next:     services.Every(time.Minute),
+		Run: func(ctx context.Context, at time.Time) error {
+			return handlers.DispatchCampaigns(ctx, db, jobService, at)
+		},
+	})
+	scheduler.Register(services.ScheduledJob{
+		Name:     "notification_inbox_prune",
+		Schedule: "daily at 03:00",
+		Next:     services.DailyAt(3),
+		Run: func(ctx context.Context, at time.Time) error {
+			return notifier.Prune(ctx)
+		},
+	})
+	scheduler.Register(services.ScheduledJob{
+		Name:     "cost_metering",
+		Schedule: "daily at 02:00",
+		Next:     services.DailyAt(2),
+		Run: func(ctx context.Context, at time.Time) error {
+			return handlers.MeterCosts(ctx, db, at)
+		},
+	})
+	scheduler.Register(services.ScheduledJob{
+		Name:     "insight_review_sample",
+		Schedule: "daily at 04:00",
+		Next:     services.DailyAt(4),
+		Run: func(ctx context.Context, at time.Time) error {
+			_, err := handlers.SampleInsightsForReview(ctx, db, at.AddDate(0, 0, -1), handlers.InsightReviewSampleSize)
+			return err
+		},
+	})
+	scheduler.Register(services.ScheduledJob{
+		Name:     "spending_benchmarks",
+		Schedule: "daily at spending_benchmarks_hour",
+		Next:     settings.DailyAt(services.SettingBenchmarksHour),
+		Run: func(ctx context.Context, at time.Time) error {
+			return handlers.ComputeSpendingBenchmarks(ctx, db, privacy, at)
+		},
+	})
+	scheduler.Register(services.ScheduledJob{
+		Name:     "partner_webhooks",
+		Schedule: "daily at 05:00",
+		Next:     services.DailyAt(5),
+		Run: func(ctx context.Context, at time.Time) error {
+			return handlers.DeliverPartnerWebhooks(ctx, db, at)
+		},
+	})
 
 	// Initialize insights handler if Gemini is available
 	var insightsHandler *handlers.InsightsHandler
 	if geminiService != nil {
-		insightsHandler = handlers.NewInsightsHandler(geminiService, fcmService)
+		insightsHandler = handlers.NewInsightsHandler(db, geminiService, notifier, eventBus, jobService, handlers.InsightsOptions{
+			PushWindow:          time.Duration(cfg.InsightPushWindow) * time.Minute,
+			DryRun:              cfg.InsightDryRun,
+			DryRunSamplePercent: cfg.InsightDryRunSample,
+		})
+		jobService.Register(handlers.AnalysisDryRunJob(insightsHandler, jobService))
+		jobService.Register(handlers.InsightGenerationJob(insightsHandler))
+		if cfg.InsightDryRun {
+			log.Printf("🧪 Insight analysis runs are dry runs: nothing is stored or sent, %d%% of users go to Gemini", cfg.InsightDryRunSample)
+		}
 
-		// Start daily analysis scheduler
-		go startDailyScheduler(insightsHandler)
+		// Insights are delivered hourly to the users whose preferred window
+		// starts then, and the windows are recomputed daily before that
+		// hour's analysis. Each hour's run covers different users, so a slow
+		// one mustn't hold up the next
+		scheduler.Register(services.ScheduledJob{
+			Name:     "delivery_windows",
+			Schedule: "daily at delivery_windows_hour",
+			Next:     settings.DailyAt(services.SettingDeliveryWindowsHour),
+			Run: func(ctx context.Context, at time.Time) error {
+				insightsHandler.UpdateDeliveryWindows()
+				return nil
+			},
+		})
+		scheduler.Register(services.ScheduledJob{
+			Name:     "insight_analysis",
+			Schedule: "hourly",
+			Next:     services.Hourly,
+			Overlap:  true,
+			After:    "delivery_windows",
+			Run: func(ctx context.Context, at time.Time) error {
+				if !settings.FeatureEnabled(services.FeatureInsights) {
+					log.Printf("⚠️ Insights are switched off, skipping the %02d:00 analysis", at.Hour())
+					return nil
+				}
+				insightsHandler.RunScheduledAnalysis(at.Hour())
+				return nil
+			},
+		})
 	}
+	scheduler.Start(bgCtx)
+
+	// Create router; gin's default logger prints raw paths and query strings, so
+	// requests go through the redacting access log instead
+	accessLog := middleware.AccessLog(slog.New(slog.NewJSONHandler(os.Stdout, nil)), middleware.AccessLogOptions{
+		SkipPaths: []string{"/health", "/metrics"},
+		Headers:   cfg.LogRequestHeaders,
+		Bodies:    cfg.LogRequestBodies,
+	})
+	r := gin.New()
+	r.Use(accessLog, gin.Recovery())
 
-	// Create router
-	r := gin.Default()
+	configureClientIP(r, cfg)
 
 	// Apply global middleware
+	securityOptions := middleware.SecurityOptions{
+		HSTS:       cfg.HSTS,
+		ForceHTTPS: cfg.ForceHTTPS,
+		SkipPaths:  []string{"/health"},
+	}
+	r.Use(middleware.SecurityHeaders(securityOptions))
 	r.Use(middleware.CORSMiddleware())
-	r.Use(middleware.RateLimiter(100)) // 100 requests per minute
+	r.Use(middleware.DynamicRateLimiter(func() int { return settings.Int(services.SettingRateLimit) }))
+	r.Use(middleware.Maintenance(settings, "/health", "/status", "/metrics", "/api/v1/admin"))
+	r.Use(middleware.Timeout(requestTimeout))
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -87,77 +340,247 @@ func main() {
 			"time":         time.Now().Format(time.RFC3339),
 			"ai_enabled":   geminiService != nil,
 			"push_enabled": fcmService != nil,
+			"features":     settings.Features(),
 		})
 	})
 
-	// Public routes
-	r.POST("/api/v1/register", authHandler.Register)
+	// Service status with incident flags (polled by the app for banners)
+	r.GET("/status", func(c *gin.Context) {
+		c.JSON(http.StatusOK, statusMonitor.Report())
+	})
 
-	// Admin login (public)
-	adminAuthHandler := &handlers.AdminAuthHandler{JWTSecret: cfg.JWTSecret}
-	r.POST("/api/v1/admin/login", adminAuthHandler.AdminLogin)
+	// Public routes
+	r.POST("/api/v1/register", middleware.Timeout(authRequestTimeout), registrationGuard(cfg), authHandler.Register)
+	r.GET("/api/v1/app-config", authHandler.GetAppConfig)
 
 	// Protected routes
 	protected := r.Group("/api/v1")
 	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	protected.Use(middleware.ActivityTracker(db, funnel))
 	{
 		// User management
+		protected.GET("/profile", authHandler.GetProfile)
+		protected.GET("/me", authHandler.GetMe)
+		protected.PATCH("/me", authHandler.UpdateMe)
 		protected.PUT("/consent", authHandler.UpdateConsent)
+		protected.GET("/ai/excluded-categories", authHandler.GetAIExclusions)
+		protected.PUT("/ai/excluded-categories", authHandler.UpdateAIExclusions)
+		protected.GET("/ai/activity", authHandler.GetAIActivity)
 		protected.DELETE("/data", authHandler.DeleteData)
+		protected.POST("/data/export", jobsHandler.RequestDataExport)
+
+		// Background jobs
+		protected.GET("/jobs/:id", jobsHandler.GetJob)
+		protected.GET("/jobs/:id/download", middleware.Timeout(syncRequestTimeout), jobsHandler.DownloadExport)
+
+		// Realtime events (insights, finished jobs) over WebSocket
+		realtimeHandler := &handlers.RealtimeHandler{Hub: realtimeHub}
+		protected.GET("/ws", middleware.Timeout(0), realtimeHandler.Connect)
+
+		// Features that can be switched off on their own during an incident
+		syncEnabled := middleware.Feature(settings, services.FeatureSync)
+		insightsEnabled := middleware.Feature(settings, services.FeatureInsights)
+		notificationsEnabled := middleware.Feature(settings, services.FeatureNotifications)
 
 		// Transaction sync
-		protected.POST("/sync", syncHandler.Sync)
+		syncTimeout := middleware.Timeout(syncRequestTimeout)
+		protected.POST("/sync", syncTimeout, syncEnabled, syncHandler.Sync)
+		protected.GET("/sync/status", syncEnabled, syncHandler.GetSyncStatus)
+		protected.POST("/sync/bank-sms", syncTimeout, syncEnabled, syncHandler.SyncBankSMS)
+		protected.POST("/sync/aggregates", syncTimeout, syncEnabled, syncHandler.SyncAggregates)
+		protected.GET("/sync/mode", syncEnabled, syncHandler.GetSyncMode)
+		protected.PUT("/sync/mode", syncEnabled, syncHandler.UpdateSyncMode)
+		protected.GET("/sync/recipient-salt", syncEnabled, syncHandler.GetRecipientSalt)
+		protected.POST("/parse-failures", syncHandler.ReportParseFailures)
+		protected.GET("/notices", noticesHandler.GetNotices)
+		protected.GET("/sync/reconciliation", reconciliationHandler.GetReconciliation)
 		protected.GET("/transactions", syncHandler.GetTransactions)
+		protected.POST("/transactions", syncHandler.CreateTransaction)
+		protected.PUT("/transactions/:id/account", accountsHandler.SetTransactionAccount)
+		protected.GET("/transactions/recurring", recurringEntriesHandler.GetRecurringEntries)
+		protected.POST("/transactions/recurring", recurringEntriesHandler.CreateRecurringEntry)
+		protected.DELETE("/transactions/recurring/:id", recurringEntriesHandler.DeleteRecurringEntry)
+		protected.GET("/transactions/pending", recurringEntriesHandler.GetPendingEntries)
+		protected.POST("/transactions/pending/:id/confirm", recurringEntriesHandler.ConfirmPendingEntry)
+		protected.POST("/transactions/pending/:id/dismiss", recurringEntriesHandler.DismissPendingEntry)
+
+		// Wallets, bank accounts and cash
+		protected.GET("/accounts", accountsHandler.GetAccounts)
+		protected.POST("/accounts", accountsHandler.CreateAccount)
+		protected.PUT("/accounts/:id", accountsHandler.UpdateAccount)
+		protected.DELETE("/accounts/:id", accountsHandler.DeleteAccount)
+
+		// Semantic search (needs Gemini embeddings and pgvector)
+		if geminiService != nil && dbFeatures.Vector {
+			searchHandler := &handlers.SearchHandler{DB: db, Gemini: geminiService}
+			protected.GET("/transactions/search", searchHandler.Search)
+			protected.GET("/transactions/:id/similar", searchHandler.GetSimilar)
+		}
+
+		// Receipt photos (extraction runs in the background when Gemini is available)
+		if storage != nil {
+			receiptsHandler := &handlers.ReceiptsHandler{DB: db, Storage: storage, Jobs: jobService}
+			protected.POST("/transactions/:id/receipt", receiptsHandler.UploadReceipt)
+			protected.GET("/transactions/:id/receipt", receiptsHandler.GetReceipt)
+			protected.GET("/transactions/:id/receipt/image", receiptsHandler.GetReceiptImage)
+
+			backupHandler := &handlers.BackupHandler{DB: db, Storage: storage}
+			protected.GET("/backup", backupHandler.GetBackups)
+			protected.PUT("/backup/:device_id", backupHandler.UploadBackup)
+			protected.GET("/backup/:device_id", backupHandler.DownloadBackup)
+			protected.DELETE("/backup/:device_id", backupHandler.DeleteBackups)
+		}
+
+		// Savings products (MoKash, Airtel savings) and saving goals
+		protected.GET("/savings", savingsHandler.GetSavings)
+		protected.GET("/savings/goals", savingGoalsHandler.GetSavingGoals)
+		protected.POST("/savings/goals", savingGoalsHandler.CreateSavingGoal)
+		protected.DELETE("/savings/goals/:id", savingGoalsHandler.DeleteSavingGoal)
+		protected.POST("/savings/goals/:id/snooze", savingGoalsHandler.SnoozeSavingGoal)
+
+		// Category icons, colors and names for display
+		protected.GET("/categories", categoriesHandler.GetCategories)
+
+		// Spending alerts, checked after each sync
+		protected.GET("/alerts/rules", alertRulesHandler.GetAlertRules)
+		protected.POST("/alerts/rules", alertRulesHandler.CreateAlertRule)
+		protected.DELETE("/alerts/rules/:id", alertRulesHandler.DeleteAlertRule)
+
+		// Notification inbox and preferences
+		protected.GET("/notifications", notificationsEnabled, notificationsHandler.GetNotifications)
+		protected.GET("/notifications/preferences", notificationsEnabled, notificationsHandler.GetNotificationPreferences)
+		protected.PUT("/notifications/preferences", notificationsEnabled, notificationsHandler.UpdateNotificationPreferences)
+
+		// Chilimba / village banking groups
+		protected.GET("/groups", groupsHandler.GetGroups)
+		protected.POST("/groups", groupsHandler.CreateGroup)
+		protected.GET("/groups/:id", groupsHandler.GetGroup)
+		protected.DELETE("/groups/:id", groupsHandler.DeleteGroup)
+		protected.POST("/groups/:id/members", groupsHandler.AddGroupMembers)
+		protected.POST("/groups/:id/payments", groupsHandler.RecordGroupPayment)
+
+		// Learning section
+		protected.GET("/lessons", lessonsHandler.GetLessons)
+		protected.POST("/lessons/:id/complete", lessonsHandler.CompleteLesson)
+
+		// Budget suggestions from spending history, refined by Gemini when available
+		budgetsHandler := &handlers.BudgetsHandler{DB: db, Gemini: geminiService}
+		protected.GET("/budgets", budgetsHandler.GetBudgets)
+		protected.PUT("/budgets", budgetsHandler.SetBudgets)
+		protected.POST("/budgets/suggest", budgetsHandler.SuggestBudgets)
 
 		// Analytics
 		protected.GET("/analytics/summary", analyticsHandler.GetSummary)
 		protected.GET("/analytics/trends", analyticsHandler.GetTrends)
-
-		// AI Insights (if Gemini is available)
-		if insightsHandler != nil {
-			protected.POST("/insights/generate", insightsHandler.GenerateInsights)
-			protected.GET("/insights", insightsHandler.GetUserInsights)
+		protected.GET("/analytics/safe-to-spend", analyticsHandler.GetSafeToSpend)
+		protected.GET("/analytics/benchmarks", analyticsHandler.GetBenchmarks)
+		protected.GET("/analytics/highlights", analyticsHandler.GetHighlights)
+		protected.GET("/analytics/accounts", analyticsHandler.GetAccountAnalytics)
+		protected.GET("/analytics/budget-variance", analyticsHandler.GetBudgetVariance)
+		protected.GET("/score/affordability", analyticsHandler.GetAffordabilityScore)
+		protected.PUT("/score/affordability/consent", analyticsHandler.UpdateAffordabilityConsent)
+		protected.POST("/events", analyticsHandler.TrackEvent)
+
+		// API keys for Zapier / IFTTT
+		protected.GET("/integrations/keys", integrationsHandler.GetIntegrationKeys)
+		protected.POST("/integrations/keys", integrationsHandler.CreateIntegrationKey)
+		protected.DELETE("/integrations/keys/:id", integrationsHandler.DeleteIntegrationKey)
+
+		// Daily spend summaries shared with financial partners
+		protected.GET("/sharing/partners", partnerSharingHandler.GetSharingPartners)
+		protected.PUT("/sharing/partners/:id", partnerSharingHandler.GrantPartnerSharing)
+		protected.DELETE("/sharing/partners/:id", partnerSharingHandler.RevokePartnerSharing)
+		protected.GET("/sharing/deliveries", partnerSharingHandler.GetPartnerDeliveries)
+
+		// Business mode (accounting exports)
+		protected.PUT("/business/mode", accountingHandler.SetBusinessMode)
+		protected.GET("/business/account-mappings", accountingHandler.GetAccountMappings)
+		protected.PUT("/business/account-mappings", accountingHandler.UpdateAccountMappings)
+
+		// AI Insights; without Gemini the history is still served and
+		// generating answers AI_DISABLED
+		insightRoutes := insightsHandler
+		if insightRoutes == nil {
+			insightRoutes = handlers.NewInsightsHandler(db, nil, notifier, eventBus, jobService, handlers.InsightsOptions{})
 		}
+		protected.POST("/insights/generate", insightsEnabled, insightRoutes.GenerateInsights)
+		protected.GET("/insights", insightsEnabled, insightRoutes.GetUserInsights)
 
-		// Push notifications (admin only)
+		// Test push to the caller's own device
 		if fcmService != nil {
-			protected.POST("/notify", func(c *gin.Context) {
-				var req struct {
-					Token string `json:"token" binding:"required"`
-					Title string `json:"title" binding:"required"`
-					Body  string `json:"body" binding:"required"`
-				}
+			protected.POST("/notify", notificationsEnabled, func(c *gin.Context) {
+				var req models.PushNotification
 				if err := c.ShouldBindJSON(&req); err != nil {
 					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 					return
 				}
-				err := fcmService.SendNotification(context.Background(), req.Token, req.Title, req.Body, nil)
+				if err := handlers.ValidateNotification(req); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				err := notifier.SendNow(c.Request.Context(), c.GetString("user_id"), models.Notification{
+					Type: models.NotificationUpdates,
+					Push: req,
+				})
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send notification"})
 					return
 				}
-				c.JSON(http.StatusOK, gin.H{"message": "Notification sent"})
+				c.JSON(http.StatusOK, gin.H{"message": "Notification queued"})
 			})
 		}
 	}
 
-	// Admin routes (protected with admin middleware)
+	// No-code integrations authenticate with an API key instead of the app's token
+	hooks := r.Group("/api/v1/hooks")
+	hooks.Use(middleware.IntegrationKeyAuth(db))
+	{
+		hooks.GET("/me", integrationsHandler.Me)
+		hooks.GET("/triggers/:event", integrationsHandler.PollTrigger)
+		hooks.POST("/subscriptions", integrationsHandler.Subscribe)
+		hooks.DELETE("/subscriptions/:id", integrationsHandler.Unsubscribe)
+	}
+
+	// Anonymized market data for partners, metered against each key's plan
+	partnerHandler := &handlers.PartnerHandler{DB: db, Privacy: privacy}
+	partner := r.Group("/api/v1/partner")
+	partner.Use(middleware.PartnerKeyAuth(db))
+	{
+		partner.GET("/usage", partnerHandler.GetUsage)
+		partner.GET("/market/share", partnerHandler.GetMarketShare)
+		partner.GET("/market/categories", partnerHandler.GetMarketCategories)
+		partner.GET("/market/fees", partnerHandler.GetMarketFees)
+	}
+
+	// Admin routes live on their own router with their own middleware stack.
+	// With ADMIN_PORT set they are served on a separate listener and the public
+	// API never exposes /api/v1/admin
 	adminHandler := &handlers.AdminHandler{
+		DB:              db,
 		FCMService:      fcmService,
 		GeminiService:   geminiService,
 		InsightsHandler: insightsHandler,
+		AIUsage:         aiUsage,
+		Scheduler:       scheduler,
+		Jobs:            jobService,
+		Settings:        settings,
+		Notifier:        notifier,
 	}
+	adminAuthHandler := &handlers.AdminAuthHandler{JWTSecret: cfg.JWTSecret}
 
-	admin := r.Group("/api/v1/admin")
-	admin.Use(middleware.AuthMiddleware(cfg.JWTSecret)) // TODO: Add admin-only middleware
-	{
-		admin.GET("/stats", adminHandler.GetStats)
-		admin.GET("/users", adminHandler.GetUsers)
-		admin.GET("/insights", adminHandler.GetInsights)
-		admin.POST("/insights/trigger", adminHandler.TriggerInsights)
-		admin.POST("/broadcast", adminHandler.Broadcast)
-		admin.GET("/transactions", adminHandler.GetTransactions)
+	adminRouter := r
+	if cfg.AdminPort != "" {
+		adminRouter = gin.New()
+		adminRouter.Use(accessLog, gin.Recovery())
+		configureClientIP(adminRouter, cfg)
+		// The internal port is usually reached without the TLS-terminating proxy
+		adminSecurity := securityOptions
+		adminSecurity.ForceHTTPS = false
+		adminRouter.Use(middleware.SecurityHeaders(adminSecurity))
+		adminRouter.Use(middleware.CORSMiddleware())
+		adminRouter.Use(middleware.Timeout(requestTimeout))
 	}
+	registerAdminRoutes(adminRouter, cfg, adminHandler, adminAuthHandler, &handlers.MetricsHandler{DB: db})
 
 	// Create server
 	srv := &http.Server{
@@ -176,16 +599,39 @@ func main() {
 		}
 	}()
 
+	var adminSrv *http.Server
+	if cfg.AdminPort != "" {
+		adminSrv = &http.Server{
+			Addr:         ":" + cfg.AdminPort,
+			Handler:      adminRouter,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 5 * time.Minute, // CSV exports stream for a while
+			IdleTimeout:  60 * time.Second,
+		}
+		go func() {
+			log.Printf("🔒 Admin server starting on port %s", cfg.AdminPort)
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("❌ Admin server failed: %v", err)
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Println("🛑 Shutting down server...")
+	stopBackground()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			log.Printf("⚠️ Admin server forced to shutdown: %v", err)
+		}
+	}
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("❌ Server forced to shutdown: %v", err)
 	}
@@ -193,26 +639,198 @@ func main() {
 	log.Println("✅ Server exited gracefully")
 }
 
-// startDailyScheduler runs AI analysis daily at 6 AM
-func startDailyScheduler(handler *handlers.InsightsHandler) {
-	log.Println("📅 Daily AI analysis scheduler started")
+// configureClientIP trusts X-Forwarded-For only from TRUSTED_PROXIES (private
+// ranges by default), and CF-Connecting-IP only when those are Cloudflare's;
+// gin would otherwise trust them from anyone
+func configureClientIP(r *gin.Engine, cfg *config.Config) {
+	if err := middleware.ConfigureClientIP(r, cfg.TrustedProxies, cfg.RealIPHeaders); err != nil {
+		log.Fatalf("❌ Invalid TRUSTED_PROXIES: %v", err)
+	}
+}
 
-	for {
-		// Calculate time until next 6 AM
-		now := time.Now()
-		next := time.Date(now.Year(), now.Month(), now.Day(), 6, 0, 0, 0, now.Location())
-		if next.Before(now) {
-			next = next.Add(24 * time.Hour)
+// registrationGuard builds the datacenter / geo filter for /register
+func registrationGuard(cfg *config.Config) gin.HandlerFunc {
+	blocked, err := middleware.ParseCIDRs(cfg.RegisterBlockedCIDRs)
+	if err != nil {
+		log.Fatalf("❌ Invalid REGISTER_BLOCKED_CIDRS: %v", err)
+	}
+	if cfg.RegisterBlocklistFile != "" {
+		fileRanges, err := middleware.LoadCIDRFile(cfg.RegisterBlocklistFile)
+		if err != nil {
+			log.Fatalf("❌ Failed to load REGISTER_BLOCKLIST_FILE: %v", err)
 		}
-		duration := time.Until(next)
+		blocked = append(blocked, fileRanges...)
+	}
+	if len(blocked) > 0 {
+		log.Printf("🛡️ Blocking registration from %d network ranges", len(blocked))
+	}
 
-		log.Printf("⏰ Next AI analysis scheduled in %v", duration.Round(time.Minute))
+	trusted, err := middleware.TrustedProxyNets(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("❌ Invalid TRUSTED_PROXIES: %v", err)
+	}
 
-		// Wait until scheduled time
-		time.Sleep(duration)
+	return middleware.RegistrationGuard(blocked, trusted, cfg.RegisterAllowedCountries, cfg.GeoCountryHeader)
+}
 
-		// Run daily analysis
-		log.Println("🤖 Running scheduled AI analysis...")
-		handler.RunDailyAnalysis()
+// registerAdminRoutes mounts the admin API and metrics on r with a stricter middleware stack
+func registerAdminRoutes(r *gin.Engine, cfg *config.Config, adminHandler *handlers.AdminHandler, adminAuthHandler *handlers.AdminAuthHandler, metricsHandler *handlers.MetricsHandler) {
+	allowlist, err := middleware.ParseCIDRs(cfg.AdminIPAllowlist)
+	if err != nil {
+		log.Fatalf("❌ Invalid ADMIN_IP_ALLOWLIST: %v", err)
 	}
+
+	// Scraped by Prometheus without a token, so only the allowlist protects it
+	r.GET("/metrics", middleware.IPAllowlist(allowlist), metricsHandler.GetMetrics)
+
+	adminPublic := r.Group("/api/v1/admin")
+	adminPublic.Use(middleware.IPAllowlist(allowlist))
+	adminPublic.Use(middleware.Timeout(authRequestTimeout))
+	adminPublic.Use(middleware.DynamicRateLimiter(func() int { // Slow down credential guessing
+		return adminHandler.Settings.Int(services.SettingAdminLoginRateLimit)
+	}))
+	adminPublic.POST("/login", adminAuthHandler.AdminLogin)
+
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.IPAllowlist(allowlist))
+	admin.Use(middleware.DynamicRateLimiter(func() int {
+		return adminHandler.Settings.Int(services.SettingAdminRateLimit)
+	}))
+	admin.Use(middleware.AdminAuthMiddleware(cfg.JWTSecret))
+	{
+		admin.GET("/stats", adminHandler.GetStats)
+		admin.GET("/users", adminHandler.GetUsers)
+		admin.GET("/insights", adminHandler.GetInsights)
+		admin.POST("/insights/trigger", adminHandler.TriggerInsights)
+		admin.GET("/insights/dry-runs/:id", adminHandler.GetAnalysisDryRun)
+		admin.GET("/insight-reviews", adminHandler.GetInsightReviews)
+		admin.GET("/insight-reviews/summary", adminHandler.GetInsightReviewSummary)
+		admin.POST("/insight-reviews/sample", adminHandler.SampleInsightReviews)
+		admin.PUT("/insight-reviews/:id", adminHandler.ReviewInsight)
+		admin.GET("/insight-blocks", adminHandler.GetInsightBlocks)
+		admin.POST("/broadcast", adminHandler.Broadcast)
+		admin.GET("/campaigns", adminHandler.GetCampaigns)
+		admin.POST("/campaigns", adminHandler.CreateCampaign)
+		admin.PUT("/campaigns/:id", adminHandler.UpdateCampaign)
+		admin.DELETE("/campaigns/:id", adminHandler.DeleteCampaign)
+		admin.POST("/campaigns/:id/run", adminHandler.RunCampaign)
+		admin.GET("/tips", adminHandler.GetTips)
+		admin.PUT("/tips", adminHandler.SaveTip)
+		admin.GET("/lessons", adminHandler.GetLessons)
+		admin.PUT("/lessons/:id", adminHandler.SaveLesson)
+		admin.DELETE("/lessons/:id", adminHandler.DeleteLesson)
+		admin.GET("/transactions", adminHandler.GetTransactions)
+		admin.POST("/transactions/:id/correct", adminHandler.CorrectTransaction)
+		admin.GET("/audit-log", adminHandler.GetAuditLog)
+		admin.GET("/data-quality", adminHandler.GetDataQuality)
+		admin.GET("/sms-templates", adminHandler.GetSMSTemplates)
+		admin.GET("/sms-templates/:id/reports", adminHandler.GetSMSTemplateReports)
+		admin.PUT("/sms-templates/:id", adminHandler.UpdateSMSTemplate)
+		exportTimeout := middleware.Timeout(exportRequestTimeout)
+		admin.GET("/export/users", exportTimeout, adminHandler.ExportUsers)
+		admin.GET("/export/transactions", exportTimeout, adminHandler.ExportTransactions)
+		admin.GET("/export/insights", exportTimeout, adminHandler.ExportInsights)
+		admin.GET("/market/share", adminHandler.GetMarketShare)
+		admin.GET("/market/categories", adminHandler.GetMarketCategories)
+		admin.GET("/market/fees", adminHandler.GetMarketFees)
+		admin.POST("/reports/query", middleware.Timeout(reportRequestTimeout), adminHandler.QueryReport)
+		admin.GET("/partners/plans", adminHandler.GetPartnerPlans)
+		admin.PUT("/partners/plans/:name", adminHandler.UpdatePartnerPlan)
+		admin.GET("/partners/keys", adminHandler.GetPartnerKeys)
+		admin.POST("/partners/keys", adminHandler.CreatePartnerKey)
+		admin.PUT("/partners/keys/:id", adminHandler.UpdatePartnerKey)
+		admin.DELETE("/partners/keys/:id", adminHandler.RevokePartnerKey)
+		admin.GET("/partners/usage", adminHandler.GetPartnerUsage)
+		admin.GET("/financial-partners", adminHandler.GetFinancialPartners)
+		admin.POST("/financial-partners", adminHandler.CreateFinancialPartner)
+		admin.PUT("/financial-partners/:id", adminHandler.UpdateFinancialPartner)
+		admin.GET("/funnel", adminHandler.GetFunnel)
+		admin.GET("/ai/budget", adminHandler.GetAIBudget)
+		admin.GET("/metering", adminHandler.GetCostMetering)
+		admin.PUT("/ai/budget", adminHandler.UpdateAIBudget)
+		admin.GET("/settings", adminHandler.GetSettings)
+		admin.PUT("/settings", adminHandler.UpdateSettings)
+		admin.GET("/settings/history", adminHandler.GetSettingsHistory)
+		admin.GET("/categories", adminHandler.GetCategories)
+		admin.PUT("/categories/:code", adminHandler.SaveCategory)
+		admin.DELETE("/categories/:code", adminHandler.DeleteCategory)
+		admin.GET("/categories/mappings", adminHandler.GetCategoryMappings)
+		admin.POST("/categories/mappings", adminHandler.CreateCategoryMapping)
+		admin.POST("/categories/remap", adminHandler.RemapCategories)
+		admin.POST("/reaggregate", adminHandler.Reaggregate)
+		admin.GET("/reaggregate/:id", adminHandler.GetReaggregation)
+		admin.GET("/jobs", adminHandler.GetScheduledJobs)
+		admin.POST("/jobs/:name/pause", adminHandler.PauseScheduledJob)
+		admin.POST("/jobs/:name/resume", adminHandler.ResumeScheduledJob)
+		admin.POST("/jobs/:name/run", adminHandler.RunScheduledJob)
+	}
+}
+
+// subscribeEvents registers the subscribers for each domain event
+func subscribeEvents(bus *services.EventBus, funnel *services.FunnelTracker, jobs *services.JobService, realtime *services.RealtimeHub) {
+	bus.Subscribe(services.EventTransactionsSynced, "funnel", func(ctx context.Context, e services.Event) error {
+		var synced services.TransactionsSynced
+		if e.Decode(&synced) == nil && synced.Manual {
+			return nil // A cash entry isn't a sync
+		}
+		funnel.Record(e.UserID, models.FunnelFirstSync)
+		return nil
+	})
+
+	// Index new transactions for similarity search
+	bus.Subscribe(services.EventTransactionsSynced, "embeddings", func(ctx context.Context, e services.Event) error {
+		if !jobs.Registered(handlers.JobTypeTransactionEmbeddings) {
+			return nil
+		}
+		_, err := jobs.EnqueueUnique(e.UserID, handlers.JobTypeTransactionEmbeddings, gin.H{})
+		return err
+	})
+
+	// Re-check SMS balances against the synced transactions
+	bus.Subscribe(services.EventTransactionsSynced, "reconciliation", func(ctx context.Context, e services.Event) error {
+		_, err := jobs.EnqueueUnique(e.UserID, handlers.JobTypeReconciliation, gin.H{})
+		return err
+	})
+
+	// Match incoming contributions to the groups the user organizes
+	bus.Subscribe(services.EventTransactionsSynced, "group_matching", func(ctx context.Context, e services.Event) error {
+		_, err := jobs.EnqueueUnique(e.UserID, handlers.JobTypeGroupMatching, gin.H{})
+		return err
+	})
+
+	// Check the user's spending alerts against the new transactions
+	bus.Subscribe(services.EventTransactionsSynced, "alert_rules", func(ctx context.Context, e services.Event) error {
+		_, err := jobs.EnqueueUnique(e.UserID, handlers.JobTypeAlertRules, gin.H{})
+		return err
+	})
+
+	// Send new transactions and insights to Zapier / IFTTT hooks
+	bus.Subscribe(services.EventTransactionsSynced, "hooks", func(ctx context.Context, e services.Event) error {
+		_, err := jobs.EnqueueUnique(e.UserID, handlers.JobTypeHookDelivery, gin.H{})
+		return err
+	})
+	bus.Subscribe(services.EventInsightGenerated, "hooks", func(ctx context.Context, e services.Event) error {
+		_, err := jobs.EnqueueUnique(e.UserID, handlers.JobTypeHookDelivery, gin.H{})
+		return err
+	})
+
+	bus.Subscribe(services.EventConsentChanged, "funnel", func(ctx context.Context, e services.Event) error {
+		var consent services.ConsentChanged
+		if err := e.Decode(&consent); err != nil {
+			return err
+		}
+		if consent.ConsentGiven {
+			funnel.Record(e.UserID, models.FunnelConsented)
+		}
+		return nil
+	})
+
+	bus.Subscribe(services.EventInsightGenerated, "realtime", func(ctx context.Context, e services.Event) error {
+		var insight services.InsightGenerated
+		if err := e.Decode(&insight); err != nil {
+			return err
+		}
+		realtime.Publish(e.UserID, services.RealtimeInsightCreated, insight)
+		return nil
+	})
 }
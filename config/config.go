@@ -3,18 +3,26 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config holds all configuration for the application
 type Config struct {
 	// Server
 	Port        string
+	AdminPort   string // Serve admin routes on a separate (internal) port when set
 	Environment string
 
 	// Database
-	DatabaseURL string
+	DatabaseURL       string
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime int // minutes
+	DBConnMaxIdleTime int // minutes
+	DBQueryTimeout    int // seconds, for queries without their own deadline
+	DBSlowQueryMillis int // log queries slower than this (0 = off)
 
-	// Redis
+	// Redis fans realtime events out across replicas (empty = single instance)
 	RedisURL string
 
 	// JWT
@@ -26,19 +34,101 @@ type Config struct {
 
 	// Encryption
 	EncryptionKey string
+
+	// Transport security (default on in production)
+	HSTS       bool
+	ForceHTTPS bool
+
+	// Network access control
+	TrustedProxies           []string // Proxies allowed to set the client IP headers (empty = private ranges)
+	RealIPHeaders            []string // Headers carrying the client IP, in order of preference
+	AdminIPAllowlist         []string // CIDRs allowed to reach admin routes (empty = all)
+	RegisterBlockedCIDRs     []string // e.g. datacenter ranges used for fake sign-ups
+	RegisterBlocklistFile    string   // File with one blocked CIDR per line
+	RegisterAllowedCountries []string // ISO country codes (empty = all)
+	GeoCountryHeader         string   // Header carrying the client's country, set by the CDN
+
+	// Access logging; headers and bodies are redacted but still off by default
+	LogRequestHeaders bool
+	LogRequestBodies  bool
+
+	// Background jobs
+	JobWorkers int
+
+	// Minutes over which an analysis run's insight pushes are spread, so
+	// they don't all hit FCM at once (0 = send as soon as stored)
+	InsightPushWindow int
+
+	// Staging: analysis runs store and send nothing, send this percentage of
+	// users to Gemini and log a report of what they would have done
+	InsightDryRun       bool
+	InsightDryRunSample int // percent
+
+	// Features (sync, insights, notifications) kept off whatever their
+	// runtime settings say
+	DisabledFeatures []string
+
+	// Object storage for uploaded files (receipt photos)
+	StorageDir string
+
+	// Gemini spend budget in USD (0 = unlimited)
+	GeminiDailyBudget   float64
+	GeminiMonthlyBudget float64
+
+	// Gemini model that double-checks insights for harmful advice (empty = patterns only)
+	GeminiSafetyModel string
+
+	// Differential privacy for aggregates shared outside the company
+	PrivacyNoiseKey        string  // Seeds the noise (empty = JWTSecret)
+	PrivacyEpsilon         float64 // Per released figure; lower is noisier
+	PrivacyMaxTransactions int
+	PrivacyMaxVolume       float64 // Kwacha one user can add to a figure
 }
 
 // Load reads configuration from environment variables
 func Load() *Config {
+	environment := getEnv("ENVIRONMENT", "development")
+
 	return &Config{
-		Port:                    getEnv("PORT", "8080"),
-		Environment:             getEnv("ENVIRONMENT", "development"),
-		DatabaseURL:             getEnv("DATABASE_URL", "postgres://localhost:5432/kwachatracker?sslmode=disable"),
-		RedisURL:                getEnv("REDIS_URL", "redis://localhost:6379"),
-		JWTSecret:               getEnv("JWT_SECRET", "change-me-in-production"),
-		JWTExpiration:           getEnvInt("JWT_EXPIRATION_HOURS", 720), // 30 days
-		FirebaseCredentialsPath: getEnv("FIREBASE_CREDENTIALS", "./firebase-credentials.json"),
-		EncryptionKey:           getEnv("ENCRYPTION_KEY", "32-byte-key-for-aes-256-gcm!!!"),
+		Port:                     getEnv("PORT", "8080"),
+		AdminPort:                getEnv("ADMIN_PORT", ""),
+		Environment:              environment,
+		HSTS:                     getEnvBool("HSTS", environment == "production"),
+		ForceHTTPS:               getEnvBool("FORCE_HTTPS", environment == "production"),
+		DatabaseURL:              getEnv("DATABASE_URL", "postgres://localhost:5432/kwachatracker?sslmode=disable"),
+		DBMaxOpenConns:           getEnvInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:           getEnvInt("DB_MAX_IDLE_CONNS", 5),
+		DBConnMaxLifetime:        getEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", 30),
+		DBConnMaxIdleTime:        getEnvInt("DB_CONN_MAX_IDLE_MINUTES", 5),
+		DBQueryTimeout:           getEnvInt("DB_QUERY_TIMEOUT_SECONDS", 15),
+		DBSlowQueryMillis:        getEnvInt("DB_SLOW_QUERY_MS", 500),
+		RedisURL:                 getEnv("REDIS_URL", ""),
+		JWTSecret:                getEnv("JWT_SECRET", "change-me-in-production"),
+		JWTExpiration:            getEnvInt("JWT_EXPIRATION_HOURS", 720), // 30 days
+		FirebaseCredentialsPath:  getEnv("FIREBASE_CREDENTIALS", "./firebase-credentials.json"),
+		EncryptionKey:            getEnv("ENCRYPTION_KEY", "32-byte-key-for-aes-256-gcm!!!"),
+		TrustedProxies:           getEnvList("TRUSTED_PROXIES"),
+		RealIPHeaders:            getEnvList("REAL_IP_HEADERS"),
+		AdminIPAllowlist:         getEnvList("ADMIN_IP_ALLOWLIST"),
+		RegisterBlockedCIDRs:     getEnvList("REGISTER_BLOCKED_CIDRS"),
+		RegisterBlocklistFile:    getEnv("REGISTER_BLOCKLIST_FILE", ""),
+		RegisterAllowedCountries: getEnvList("REGISTER_ALLOWED_COUNTRIES"),
+		GeoCountryHeader:         getEnv("GEO_COUNTRY_HEADER", "CF-IPCountry"),
+		LogRequestHeaders:        getEnvBool("LOG_REQUEST_HEADERS", false),
+		LogRequestBodies:         getEnvBool("LOG_REQUEST_BODIES", false),
+		JobWorkers:               getEnvInt("JOB_WORKERS", 2),
+		InsightPushWindow:        getEnvInt("INSIGHT_PUSH_WINDOW_MINUTES", 30),
+		InsightDryRun:            getEnvBool("INSIGHT_DRY_RUN", false),
+		InsightDryRunSample:      getEnvInt("INSIGHT_DRY_RUN_SAMPLE_PERCENT", 10),
+		DisabledFeatures:         getEnvList("DISABLED_FEATURES"),
+		StorageDir:               getEnv("STORAGE_DIR", "./data/uploads"),
+		GeminiDailyBudget:        getEnvFloat("GEMINI_DAILY_BUDGET_USD", 0),
+		GeminiMonthlyBudget:      getEnvFloat("GEMINI_MONTHLY_BUDGET_USD", 0),
+		GeminiSafetyModel:        getEnv("GEMINI_SAFETY_MODEL", ""),
+		PrivacyNoiseKey:          getEnv("PRIVACY_NOISE_KEY", ""),
+		PrivacyEpsilon:           getEnvFloat("PRIVACY_EPSILON", 1.0),
+		PrivacyMaxTransactions:   getEnvInt("PRIVACY_MAX_TRANSACTIONS", 100),
+		PrivacyMaxVolume:         getEnvFloat("PRIVACY_MAX_VOLUME", 20000),
 	}
 }
 
@@ -57,3 +147,32 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma-separated list, dropping empty entries
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
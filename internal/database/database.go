@@ -1,38 +1,70 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/kwachatracker/backend/internal/services"
+	"github.com/lib/pq"
 )
 
-// DB is the global database connection
-var DB *sql.DB
+// migrationTimeout bounds the whole migration run; index builds on large tables exceed the query timeout
+const migrationTimeout = 10 * time.Minute
 
-// Connect initializes the database connection
-func Connect(databaseURL string) error {
-	var err error
-	DB, err = sql.Open("postgres", databaseURL)
+// Features reports optional database capabilities detected during migration
+type Features struct {
+	Vector       bool          // pgvector is available (semantic search)
+	SchemaIssues []SchemaIssue // Where the database differs from what the migrations create
+}
+
+// CriticalSchemaIssues counts the missing tables and columns
+func (f *Features) CriticalSchemaIssues() int {
+	n := 0
+	for _, issue := range f.SchemaIssues {
+		if issue.Critical {
+			n++
+		}
+	}
+	return n
+}
+
+// PoolOptions sizes the connection pool
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration // Recycle connections so failovers and proxy restarts are picked up
+	ConnMaxIdleTime time.Duration // Release idle connections after sync spikes
+}
+
+// Connect opens the connection pool and verifies it. Every query on the pool
+// gets opts.Timeout unless its context already has a deadline
+func Connect(databaseURL string, pool PoolOptions, opts QueryOptions) (*sql.DB, error) {
+	connector, err := pq.NewConnector(databaseURL)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db := sql.OpenDB(&instrumentedConnector{Connector: connector, opts: opts})
 
-	if err = DB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	// Connection pool settings
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(5)
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
 
 	log.Println("✅ Database connected successfully")
-	return nil
+	return db, nil
 }
 
 // Migrate runs database migrations
-func Migrate() error {
+func Migrate(db *sql.DB) (*Features, error) {
 	migrations := []string{
 		`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`,
 
@@ -83,21 +115,916 @@ func Migrate() error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_insights_user_id ON user_insights(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_insights_generated_at ON user_insights(generated_at)`,
+
+		// Stable SMS fingerprints (sms_hash is a 32-bit hashCode and collides)
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS sms_fingerprint VARCHAR(80)`,
+		`UPDATE transactions SET sms_fingerprint = 'legacy:' || sms_hash WHERE sms_fingerprint IS NULL`,
+		`ALTER TABLE transactions ALTER COLUMN sms_fingerprint SET NOT NULL`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_user_fingerprint ON transactions(user_id, sms_fingerprint)`,
+		`ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_user_id_sms_hash_key`,
+		`ALTER TABLE transactions ALTER COLUMN sms_hash DROP NOT NULL`,
+
+		// Background jobs (exports, imports, backfills)
+		`CREATE TABLE IF NOT EXISTS jobs (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			type VARCHAR(50) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			params JSONB NOT NULL DEFAULT '{}',
+			result JSONB,
+			error TEXT,
+			attempts INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			started_at TIMESTAMP,
+			completed_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_status_created ON jobs(status, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id)`,
+
+		// User attributes used for broadcast segmentation
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS consent_analytics BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS consent_ai BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS language VARCHAR(10) DEFAULT 'en'`,
+
+		// App activity by hour of day, used to time insight pushes
+		`CREATE TABLE IF NOT EXISTS user_activity_hours (
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			hour SMALLINT NOT NULL,
+			hits INT NOT NULL DEFAULT 0,
+			last_seen_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, hour)
+		)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_push_hour SMALLINT`,
+
+		// Gemini usage and spend budget controls
+		`CREATE TABLE IF NOT EXISTS ai_usage (
+			id BIGSERIAL PRIMARY KEY,
+			purpose VARCHAR(50) NOT NULL,
+			model VARCHAR(50) NOT NULL,
+			prompt_tokens INT NOT NULL DEFAULT 0,
+			output_tokens INT NOT NULL DEFAULT 0,
+			cost_usd DECIMAL(12, 6) NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_ai_usage_created_at ON ai_usage(created_at)`,
+		`CREATE TABLE IF NOT EXISTS ai_budget_controls (
+			id INT PRIMARY KEY CHECK (id = 1),
+			kill_switch BOOLEAN NOT NULL DEFAULT FALSE,
+			override_until TIMESTAMP,
+			daily_budget_usd DECIMAL(10, 2),
+			monthly_budget_usd DECIMAL(10, 2),
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`INSERT INTO ai_budget_controls (id) VALUES (1) ON CONFLICT (id) DO NOTHING`,
+
+		// Insight generation metadata
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS source VARCHAR(20)`,
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS model VARCHAR(50)`,
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS prompt_version VARCHAR(50)`,
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS finish_reason VARCHAR(30)`,
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS latency_ms INT`,
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS prompt_tokens INT`,
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS output_tokens INT`,
+
+		// Receipt photos attached to transactions, with extracted line items
+		`CREATE TABLE IF NOT EXISTS receipts (
+			transaction_id UUID PRIMARY KEY REFERENCES transactions(id) ON DELETE CASCADE,
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			image_key VARCHAR(255) NOT NULL,
+			content_type VARCHAR(50) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			merchant VARCHAR(255),
+			receipt_date VARCHAR(10),
+			currency VARCHAR(10),
+			total DECIMAL(15,2),
+			tax DECIMAL(15,2),
+			line_items JSONB,
+			error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_receipts_user_id ON receipts(user_id)`,
+
+		// Onboarding funnel steps; each step is recorded once per user
+		`CREATE TABLE IF NOT EXISTS funnel_events (
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			event VARCHAR(50) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, event)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_funnel_events_event_created ON funnel_events(event, created_at)`,
+		// One-off backfills of each step, skipped once the step has been
+		// recorded; from then on steps are recorded as they happen
+		`INSERT INTO funnel_events (user_id, event, created_at)
+			SELECT id, 'registered', created_at FROM users
+			WHERE NOT EXISTS (SELECT 1 FROM funnel_events WHERE event = 'registered')
+			ON CONFLICT DO NOTHING`,
+		`INSERT INTO funnel_events (user_id, event, created_at)
+			SELECT id, 'consented', consent_date FROM users WHERE consent_given AND consent_date IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM funnel_events WHERE event = 'consented')
+			ON CONFLICT DO NOTHING`,
+		`INSERT INTO funnel_events (user_id, event, created_at)
+			SELECT user_id, 'first_sync', MIN(created_at) FROM transactions WHERE user_id IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM funnel_events WHERE event = 'first_sync')
+			GROUP BY user_id
+			ON CONFLICT DO NOTHING`,
+
+		// Per-user counters for the admin user list, kept up to date on sync and
+		// insight insert instead of aggregating every transaction per page
+		`CREATE TABLE IF NOT EXISTS user_stats (
+			user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			last_sync TIMESTAMP,
+			transaction_count INTEGER NOT NULL DEFAULT 0,
+			insights_count INTEGER NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_stats_last_sync ON user_stats(last_sync)`,
+		// One-off backfill while the table is still empty; after that the
+		// counters are maintained as rows change
+		`INSERT INTO user_stats (user_id, last_sync, transaction_count, insights_count)
+			SELECT u.id,
+				(SELECT MAX(created_at) FROM transactions WHERE user_id = u.id),
+				(SELECT COUNT(*) FROM transactions WHERE user_id = u.id),
+				(SELECT COUNT(*) FROM user_insights WHERE user_id = u.id)
+			FROM users u
+			WHERE NOT EXISTS (SELECT 1 FROM user_stats)
+			ON CONFLICT DO NOTHING`,
+		`CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_user_created ON transactions(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_user_date ON transactions(user_id, date)`,
+		`CREATE INDEX IF NOT EXISTS idx_insights_user_generated ON user_insights(user_id, generated_at)`,
+
+		// Push notifications written in the same transaction as the insight or
+		// job result they announce, and sent by the outbox dispatcher
+		`CREATE TABLE IF NOT EXISTS notification_outbox (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			notification JSONB NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			sent_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_notification_outbox_status_next ON notification_outbox(status, next_attempt_at)`,
+
+		// Users already given their daily insights, so a rerun after a crash or
+		// on another instance skips them
+		`CREATE TABLE IF NOT EXISTS analysis_log (
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			run_date DATE NOT NULL,
+			insights_count INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, run_date)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_analysis_log_run_date ON analysis_log(run_date)`,
+
+		// Scheduled job state shared by all instances: admin pause and run-now
+		// requests, and the outcome of the last run
+		`CREATE TABLE IF NOT EXISTS scheduled_jobs (
+			name VARCHAR(100) PRIMARY KEY,
+			paused BOOLEAN NOT NULL DEFAULT FALSE,
+			run_requested_at TIMESTAMP,
+			running_since TIMESTAMP,
+			last_run_at TIMESTAMP,
+			last_status VARCHAR(20),
+			last_error TEXT,
+			last_duration_ms BIGINT,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Latest balance reconciliation per user (see the reconciliation job)
+		`CREATE TABLE IF NOT EXISTS reconciliation_reports (
+			user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			coverage_score DOUBLE PRECISION,
+			checked_pairs INTEGER NOT NULL DEFAULT 0,
+			gap_count INTEGER NOT NULL DEFAULT 0,
+			gaps JSONB NOT NULL DEFAULT '[]',
+			computed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Category taxonomy changes: transactions dated before effective_from in
+		// from_category belong in to_category. A split (PAYMENT into BILLS and
+		// SHOPPING) is several mappings, with match_pattern (a case-insensitive
+		// regex on recipient and description) picking each part; a mapping
+		// without a pattern takes the rest
+		`CREATE TABLE IF NOT EXISTS category_mappings (
+			id SERIAL PRIMARY KEY,
+			from_category VARCHAR(50) NOT NULL,
+			to_category VARCHAR(50) NOT NULL,
+			match_pattern TEXT,
+			effective_from TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_category_mappings_from ON category_mappings(from_category)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS original_category VARCHAR(50)`,
+		// Category a transaction belongs in under the current taxonomy, so
+		// analytics stay correct before the remap job has rewritten old rows
+		`CREATE OR REPLACE FUNCTION mapped_category(category TEXT, tx_date TIMESTAMP, recipient TEXT, description TEXT)
+		RETURNS TEXT AS $$
+			SELECT COALESCE((
+				SELECT m.to_category FROM category_mappings m
+				WHERE m.from_category = $1 AND $2 < m.effective_from
+				AND (m.match_pattern IS NULL OR COALESCE($3, '') || ' ' || COALESCE($4, '') ~* m.match_pattern)
+				ORDER BY m.match_pattern IS NULL, m.id
+				LIMIT 1
+			), $1)
+		$$ LANGUAGE sql STABLE`,
+
+		// Chilimba / village banking groups run by a user. Members aren't app
+		// users; the organizer tracks who has paid for each cycle
+		`CREATE TABLE IF NOT EXISTS contribution_groups (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			organizer_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			contribution_amount DECIMAL(15, 2) NOT NULL,
+			cycle VARCHAR(10) NOT NULL,
+			start_date DATE NOT NULL,
+			reminded_cycle DATE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_contribution_groups_organizer ON contribution_groups(organizer_id)`,
+		`CREATE TABLE IF NOT EXISTS group_members (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			group_id UUID REFERENCES contribution_groups(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			phone VARCHAR(20),
+			reference VARCHAR(100),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_group_members_group ON group_members(group_id)`,
+		// Expected amount per member per cycle, created as each cycle starts
+		`CREATE TABLE IF NOT EXISTS group_contributions (
+			member_id UUID REFERENCES group_members(id) ON DELETE CASCADE,
+			cycle_start DATE NOT NULL,
+			expected_amount DECIMAL(15, 2) NOT NULL,
+			PRIMARY KEY (member_id, cycle_start)
+		)`,
+		// Payments towards a contribution, matched from synced income or logged by hand
+		`CREATE TABLE IF NOT EXISTS group_payments (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			member_id UUID REFERENCES group_members(id) ON DELETE CASCADE,
+			cycle_start DATE NOT NULL,
+			amount DECIMAL(15, 2) NOT NULL,
+			transaction_id UUID UNIQUE REFERENCES transactions(id) ON DELETE SET NULL,
+			paid_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_group_payments_member ON group_payments(member_id, cycle_start)`,
+
+		// Saving targets such as "K100 every Friday". due_day is the weekday
+		// (0 = Sunday) for weekly goals and the day of the month for monthly ones
+		`CREATE TABLE IF NOT EXISTS saving_goals (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			amount DECIMAL(15, 2) NOT NULL,
+			cadence VARCHAR(10) NOT NULL,
+			due_day SMALLINT NOT NULL,
+			current_streak INTEGER DEFAULT 0,
+			best_streak INTEGER DEFAULT 0,
+			evaluated_through DATE,
+			reminded_for DATE,
+			snoozed_until TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_saving_goals_user ON saving_goals(user_id)`,
+
+		// Typical weekly spend per category across users who opted into
+		// analytics; cohorts under the k-anonymity minimum are never stored
+		`CREATE TABLE IF NOT EXISTS spending_benchmarks (
+			category VARCHAR(50) PRIMARY KEY,
+			users INT NOT NULL,
+			p25_weekly DECIMAL(15, 2) NOT NULL,
+			median_weekly DECIMAL(15, 2) NOT NULL,
+			p75_weekly DECIMAL(15, 2) NOT NULL,
+			window_start TIMESTAMP NOT NULL,
+			window_end TIMESTAMP NOT NULL,
+			computed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// API keys for no-code integrations (Zapier, IFTTT); only a hash is stored
+		`CREATE TABLE IF NOT EXISTS integration_keys (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			key_hash CHAR(64) UNIQUE NOT NULL,
+			key_prefix VARCHAR(12) NOT NULL,
+			last_used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_integration_keys_user ON integration_keys(user_id)`,
+		// REST hook subscriptions; (delivered_through, delivered_id) is the
+		// created_at and id of the last item sent, as rows share timestamps
+		`CREATE TABLE IF NOT EXISTS hook_subscriptions (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			event VARCHAR(30) NOT NULL,
+			target_url TEXT NOT NULL,
+			min_amount DECIMAL(15, 2),
+			delivered_through TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_id UUID,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_hook_subscriptions_user ON hook_subscriptions(user_id)`,
+
+		// Business mode unlocks accounting exports; account_mappings overrides
+		// the account a category is posted to in each export format
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS business_mode BOOLEAN DEFAULT FALSE`,
+		`CREATE TABLE IF NOT EXISTS account_mappings (
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			format VARCHAR(20) NOT NULL,
+			category VARCHAR(50) NOT NULL,
+			account VARCHAR(100) NOT NULL,
+			PRIMARY KEY (user_id, format, category)
+		)`,
+
+		// Partner API: each key is on a plan capping daily requests and the
+		// aggregate fields returned; partner_usage meters requests per key per UTC day
+		`CREATE TABLE IF NOT EXISTS partner_plans (
+			name VARCHAR(50) PRIMARY KEY,
+			requests_per_day INTEGER NOT NULL,
+			fields TEXT[] NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS partner_keys (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			name VARCHAR(100) NOT NULL,
+			plan VARCHAR(50) NOT NULL REFERENCES partner_plans(name) ON UPDATE CASCADE,
+			key_hash CHAR(64) UNIQUE NOT NULL,
+			key_prefix VARCHAR(12) NOT NULL,
+			last_used_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS partner_usage (
+			key_id UUID REFERENCES partner_keys(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0, -- Every authenticated request, served or not
+			rejected INTEGER NOT NULL DEFAULT 0, -- Refused with 429 once the quota ran out
+			PRIMARY KEY (key_id, day)
+		)`,
+
+		// Recurring broadcasts; each due run is handed to the job queue
+		`CREATE TABLE IF NOT EXISTS notification_campaigns (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			name VARCHAR(100) NOT NULL,
+			cron VARCHAR(100) NOT NULL,
+			audience JSONB NOT NULL,
+			template JSONB NOT NULL,
+			enabled BOOLEAN DEFAULT TRUE,
+			next_run_at TIMESTAMP,
+			last_run_at TIMESTAMP,
+			last_job_id UUID,
+			last_recipients INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_notification_campaigns_due ON notification_campaigns(next_run_at) WHERE enabled`,
+
+		// Curated financial literacy tips blended into insights. Translations
+		// share a tip_key, and user_tips records which tips each user was shown
+		`CREATE TABLE IF NOT EXISTS financial_tips (
+			id SERIAL PRIMARY KEY,
+			tip_key VARCHAR(50) NOT NULL,
+			language VARCHAR(10) NOT NULL DEFAULT 'en',
+			topic VARCHAR(50) NOT NULL,
+			title VARCHAR(255) NOT NULL,
+			message TEXT NOT NULL,
+			active BOOLEAN DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (tip_key, language)
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_tips (
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			tip_key VARCHAR(50) NOT NULL,
+			shown_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, tip_key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_tips_shown ON user_tips(user_id, shown_at)`,
+		`INSERT INTO financial_tips (tip_key, topic, title, message) VALUES
+			('emergency-fund', 'savings', '💡 Start an emergency fund', 'Put aside a small amount every week, even K20, until you have one month of expenses saved for surprises.'),
+			('pay-yourself-first', 'savings', '💡 Pay yourself first', 'When money comes in, move your savings first and budget with what is left, not the other way round.'),
+			('bundle-vs-airtime', 'airtime', '💡 Bundles beat airtime', 'Calling and browsing on plain airtime costs far more than a bundle. Pick the bundle that matches how much you actually use.'),
+			('check-charges', 'fees', '💡 Know your charges', 'Sending and withdrawing mobile money both carry fees. Fewer, larger transfers usually cost less than many small ones.'),
+			('50-30-20', 'budgeting', '💡 Try the 50/30/20 rule', 'Aim to spend about half your income on needs, 30% on wants and keep 20% for savings and paying off debt.'),
+			('track-small-spends', 'budgeting', '💡 Small spends add up', 'K10 a day is K300 a month. Look at your smallest daily purchases to find easy savings.'),
+			('borrow-carefully', 'debt', '💡 Borrow carefully', 'Before taking a mobile loan, check the total you will repay, not just the fee, and plan where the repayment will come from.'),
+			('save-windfalls', 'income', '💡 Save part of every windfall', 'When you receive more than usual, save a fixed share of it before it blends into everyday spending.')
+		ON CONFLICT (tip_key, language) DO NOTHING`,
+
+		// Learning section: lesson content ships with the app, the server keeps
+		// the admin-managed metadata and each user's completions
+		`CREATE TABLE IF NOT EXISTS lessons (
+			id VARCHAR(50) PRIMARY KEY,
+			title VARCHAR(255) NOT NULL,
+			topic VARCHAR(50) NOT NULL,
+			position INTEGER NOT NULL DEFAULT 0,
+			duration_minutes SMALLINT NOT NULL DEFAULT 5,
+			published BOOLEAN DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS lesson_completions (
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			lesson_id VARCHAR(50) REFERENCES lessons(id) ON DELETE CASCADE,
+			completed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, lesson_id)
+		)`,
+
+		// Categories the user keeps out of Gemini prompts, and the ones left
+		// out of each stored insight
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS ai_excluded_categories TEXT[] NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS excluded_categories TEXT[]`,
+
+		// Metadata-only sync: the app keeps transactions on the device and
+		// sends daily totals per category instead
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS sync_mode VARCHAR(20) NOT NULL DEFAULT 'full'`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS sync_mode_acknowledged_at TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS daily_aggregates (
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			category VARCHAR(50) NOT NULL,
+			total DECIMAL(15, 2) NOT NULL,
+			entries INTEGER NOT NULL DEFAULT 1,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, day, type, category)
+		)`,
+
+		// Recipients sent as salted hashes: the transaction keeps the hash and
+		// a display alias, never the phone number
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS recipient_salt VARCHAR(64)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS recipient_hash VARCHAR(64)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_recipient_hash ON transactions(user_id, recipient_hash) WHERE recipient_hash IS NOT NULL`,
+
+		// Client-encrypted app backups; the blobs live in object storage and
+		// the server never has the key
+		`CREATE TABLE IF NOT EXISTS client_backups (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			device_id VARCHAR(100) NOT NULL,
+			version INTEGER NOT NULL,
+			storage_key TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			sha256 VARCHAR(64) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, device_id, version)
+		)`,
+
+		// Parser data quality: the app version each transaction was synced
+		// from, and daily counts of SMS the app couldn't parse. The counts
+		// aren't tied to users
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS app_version VARCHAR(30)`,
+		`CREATE TABLE IF NOT EXISTS parse_failure_counts (
+			day DATE NOT NULL,
+			operator VARCHAR(50) NOT NULL,
+			app_version VARCHAR(30) NOT NULL DEFAULT '',
+			failures INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (day, operator, app_version)
+		)`,
+
+		// SMS the app couldn't parse, redacted and clustered by template so
+		// the parser can be taught the formats that fail most
+		`CREATE TABLE IF NOT EXISTS sms_templates (
+			id SERIAL PRIMARY KEY,
+			operator VARCHAR(50) NOT NULL,
+			template TEXT NOT NULL,
+			template_hash VARCHAR(64) UNIQUE NOT NULL,
+			sample TEXT NOT NULL,
+			reports INTEGER NOT NULL DEFAULT 0,
+			status VARCHAR(20) NOT NULL DEFAULT 'new',
+			notes TEXT,
+			first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS parse_failure_reports (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			template_id INTEGER REFERENCES sms_templates(id) ON DELETE CASCADE,
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			app_version VARCHAR(30),
+			snippet TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_parse_failure_reports_template ON parse_failure_reports(template_id, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_parse_failure_reports_user ON parse_failure_reports(user_id, created_at)`,
+
+		// Operator announcements (fee changes, maintenance) recognized among
+		// unparsed SMS. A notice is only shown once several users reported it
+		`CREATE TABLE IF NOT EXISTS operator_notices (
+			id SERIAL PRIMARY KEY,
+			operator VARCHAR(50) NOT NULL,
+			kind VARCHAR(20) NOT NULL,
+			message TEXT NOT NULL,
+			template_hash VARCHAR(64) UNIQUE NOT NULL,
+			reporters INTEGER NOT NULL DEFAULT 0,
+			first_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS operator_notice_reporters (
+			notice_id INTEGER REFERENCES operator_notices(id) ON DELETE CASCADE,
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			PRIMARY KEY (notice_id, user_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_notices (
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			notice_id INTEGER REFERENCES operator_notices(id) ON DELETE CASCADE,
+			shown_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, notice_id)
+		)`,
+
+		// What admins changed in users' data, with the before and after values
+		// and the support ticket the user consented through
+		`CREATE TABLE IF NOT EXISTS admin_audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			actor VARCHAR(100) NOT NULL,
+			action VARCHAR(50) NOT NULL,
+			user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+			target_id VARCHAR(100),
+			ticket VARCHAR(100),
+			before JSONB,
+			after JSONB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_admin_audit_log_user ON admin_audit_log(user_id, created_at DESC)`,
+
+		// Progress reported by long-running jobs; reporting also keeps a
+		// running job from being reclaimed as stale
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS progress JSONB`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS progress_at TIMESTAMP`,
+
+		// Insight history: the period each set analyzed. Paging by date reads
+		// idx_insights_user_generated backwards
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS period VARCHAR(20) DEFAULT 'daily'`,
+
+		// Opt-in to the affordability score, which is only ever shown to the user
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS consent_scoring BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS consent_scoring_date TIMESTAMP`,
+
+		// Monthly spending limits the user has set, one per category
+		`CREATE TABLE IF NOT EXISTS budgets (
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			category VARCHAR(50) NOT NULL,
+			amount DECIMAL(15, 2) NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, category)
+		)`,
+
+		// Spending alerts the user set. Rules are checked against transactions
+		// synced after checked_through / checked_id; fired_for is the start of
+		// the last period a period_spend rule fired for, so it fires once per period
+		`CREATE TABLE IF NOT EXISTS alert_rules (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			kind VARCHAR(20) NOT NULL,
+			category VARCHAR(50),
+			period VARCHAR(10),
+			threshold DECIMAL(15, 2) NOT NULL,
+			checked_through TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			checked_id UUID,
+			fired_for DATE,
+			last_fired_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_rules_user ON alert_rules(user_id)`,
+
+		// Display metadata for the canonical categories, so the app and the
+		// admin dashboard render them the same way. Names are per language,
+		// like tips, and fall back to English
+		`CREATE TABLE IF NOT EXISTS categories (
+			code VARCHAR(50) PRIMARY KEY,
+			type VARCHAR(10) NOT NULL,
+			icon VARCHAR(50) NOT NULL,
+			color VARCHAR(7) NOT NULL,
+			position INTEGER NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS category_names (
+			category VARCHAR(50) REFERENCES categories(code) ON DELETE CASCADE,
+			language VARCHAR(10) NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			PRIMARY KEY (category, language)
+		)`,
+		`INSERT INTO categories (code, type, icon, color, position) VALUES
+			('AIRTIME', 'EXPENSE', 'phone', '#E53935', 1),
+			('DATA', 'EXPENSE', 'wifi', '#1E88E5', 2),
+			('PAYMENT', 'EXPENSE', 'shopping_cart', '#8E24AA', 3),
+			('BILLS', 'EXPENSE', 'receipt', '#3949AB', 4),
+			('TRANSFER', 'EXPENSE', 'send', '#FB8C00', 5),
+			('WITHDRAWAL', 'EXPENSE', 'cash', '#6D4C41', 6),
+			('FEES', 'EXPENSE', 'percent', '#757575', 7),
+			('SAVINGS', 'EXPENSE', 'piggy_bank', '#43A047', 8),
+			('SALARY', 'INCOME', 'work', '#2E7D32', 9),
+			('RECEIVED', 'INCOME', 'call_received', '#00897B', 10),
+			('OTHER', 'EXPENSE', 'category', '#9E9E9E', 11)
+		ON CONFLICT (code) DO NOTHING`,
+		`INSERT INTO category_names (category, language, name) VALUES
+			('AIRTIME', 'en', 'Airtime'),
+			('DATA', 'en', 'Data bundles'),
+			('PAYMENT', 'en', 'Merchant payments'),
+			('BILLS', 'en', 'Bills'),
+			('TRANSFER', 'en', 'Money sent'),
+			('WITHDRAWAL', 'en', 'Cash out'),
+			('FEES', 'en', 'Fees'),
+			('SAVINGS', 'en', 'Savings'),
+			('SALARY', 'en', 'Salary'),
+			('RECEIVED', 'en', 'Money received'),
+			('OTHER', 'en', 'Other')
+		ON CONFLICT (category, language) DO NOTHING`,
+
+		// Richer transaction kinds (CASH_IN, P2P_SENT, BILL_PAY...) than the
+		// INCOME / EXPENSE type. Rows synced before kinds existed, and daily
+		// totals, derive theirs with services.TransactionKind's mapping
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS kind VARCHAR(20)`,
+		services.TransactionKindFunctionSQL(),
+
+		// Runtime settings admins change without a redeploy (see
+		// services.Settings); keys missing here use their defaults
+		`CREATE TABLE IF NOT EXISTS settings (
+			key VARCHAR(100) PRIMARY KEY,
+			value JSONB NOT NULL,
+			updated_by VARCHAR(255),
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS settings_history (
+			id BIGSERIAL PRIMARY KEY,
+			key VARCHAR(100) NOT NULL,
+			old_value JSONB,
+			new_value JSONB NOT NULL,
+			changed_by VARCHAR(255),
+			changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_settings_history_key ON settings_history(key, changed_at DESC)`,
+
+		// Notification preferences, and every notification a user is sent,
+		// pushed or not, for their in-app inbox and the daily push cap; see
+		// the notifications package
+		`CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			muted TEXT[] NOT NULL DEFAULT '{}',
+			quiet_start SMALLINT,
+			quiet_end SMALLINT,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS notifications (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			type VARCHAR(30) NOT NULL,
+			notification JSONB NOT NULL,
+			delivery VARCHAR(20) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications(user_id, created_at DESC)`,
+		// Briefly used by the push cap before it counted notifications
+		`DROP INDEX IF EXISTS idx_notification_outbox_user_created`,
+
+		// Name the app greets the user by, and every consent the user changed
+		// from their profile with what it was changed to
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(50)`,
+		`CREATE TABLE IF NOT EXISTS consent_log (
+			id BIGSERIAL PRIMARY KEY,
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			consent VARCHAR(20) NOT NULL,
+			granted BOOLEAN NOT NULL,
+			source VARCHAR(20) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_consent_log_user_created ON consent_log(user_id, created_at DESC)`,
+
+		// Cost metering: Gemini usage charged to the users it was for, and a
+		// daily snapshot of each segment's cost drivers
+		`ALTER TABLE ai_usage ADD COLUMN IF NOT EXISTS user_id UUID REFERENCES users(id) ON DELETE SET NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_ai_usage_user_created ON ai_usage(user_id, created_at) WHERE user_id IS NOT NULL`,
+		`CREATE TABLE IF NOT EXISTS cost_meter (
+			day DATE NOT NULL,
+			segment VARCHAR(30) NOT NULL,
+			users INTEGER NOT NULL,
+			rows_stored BIGINT NOT NULL,
+			ai_prompt_tokens BIGINT NOT NULL,
+			ai_output_tokens BIGINT NOT NULL,
+			ai_cost_usd DECIMAL(12, 6) NOT NULL,
+			pushes INTEGER NOT NULL,
+			PRIMARY KEY (day, segment)
+		)`,
+
+		// Financial partners users can opt in to sharing daily spend summaries
+		// with. Each grant is one opt-in, kept after it's revoked; deliveries
+		// keep what was sent so the user can see it
+		`CREATE TABLE IF NOT EXISTS financial_partners (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			name VARCHAR(100) NOT NULL,
+			webhook_url TEXT NOT NULL,
+			signing_secret VARCHAR(100) NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS partner_grants (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			partner_id UUID REFERENCES financial_partners(id) ON DELETE CASCADE,
+			reference VARCHAR(100),
+			delivered_through DATE NOT NULL,
+			granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			revoked_at TIMESTAMP
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_partner_grants_active ON partner_grants(user_id, partner_id) WHERE revoked_at IS NULL`,
+		`CREATE TABLE IF NOT EXISTS partner_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			grant_id UUID REFERENCES partner_grants(id) ON DELETE CASCADE,
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			partner_id UUID REFERENCES financial_partners(id) ON DELETE CASCADE,
+			date_from DATE NOT NULL,
+			date_to DATE NOT NULL,
+			payload JSONB NOT NULL,
+			status_code INTEGER,
+			error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_partner_deliveries_user_created ON partner_deliveries(user_id, created_at DESC)`,
+
+		// Accounts money moves through: operator wallets, bank accounts and
+		// cash. A deleted account leaves its transactions unassigned
+		`CREATE TABLE IF NOT EXISTS accounts (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			type VARCHAR(10) NOT NULL,
+			name VARCHAR(50) NOT NULL,
+			operator VARCHAR(20),
+			institution VARCHAR(100),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_accounts_user ON accounts(user_id)`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS account_id UUID REFERENCES accounts(id) ON DELETE SET NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_account ON transactions(account_id) WHERE account_id IS NOT NULL`,
+
+		// Bank SMS show the last digits of the account they're about
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS number_suffix VARCHAR(4)`,
+
+		// Where a transaction came from: an SMS, or entered by hand (cash)
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS source VARCHAR(10) NOT NULL DEFAULT 'sms'`,
+
+		// Recurring manual entries, like rent paid in cash, and the entries
+		// they create on each due date for the user to confirm or dismiss
+		`CREATE TABLE IF NOT EXISTS recurring_entries (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			amount DECIMAL(15,2) NOT NULL,
+			type VARCHAR(10) NOT NULL,
+			category VARCHAR(50) NOT NULL,
+			kind VARCHAR(20) NOT NULL,
+			description VARCHAR(200),
+			account_id UUID REFERENCES accounts(id) ON DELETE SET NULL,
+			cadence VARCHAR(10) NOT NULL,
+			due_day INTEGER NOT NULL,
+			next_due DATE NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_recurring_entries_user ON recurring_entries(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_recurring_entries_next_due ON recurring_entries(next_due)`,
+		`CREATE TABLE IF NOT EXISTS pending_entries (
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			recurring_id UUID REFERENCES recurring_entries(id) ON DELETE CASCADE,
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			due DATE NOT NULL,
+			status VARCHAR(10) NOT NULL DEFAULT 'pending',
+			transaction_id UUID REFERENCES transactions(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			resolved_at TIMESTAMP,
+			UNIQUE(recurring_id, due)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_pending_entries_user_status ON pending_entries(user_id, status)`,
+
+		// The insights last generated on request for each user, reused for
+		// the rest of the day while the data they came from is unchanged
+		`CREATE TABLE IF NOT EXISTS insight_cache (
+			user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			fingerprint VARCHAR(64) NOT NULL,
+			insights JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Fingerprint of the aggregates a user's daily insights came from, so
+		// the next run can skip Gemini when nothing changed
+		`ALTER TABLE analysis_log ADD COLUMN IF NOT EXISTS fingerprint VARCHAR(64)`,
+		// Each Gemini call, the fields of the user's data it sent and the
+		// insights it produced, for the user's AI activity
+		`ALTER TABLE ai_usage ADD COLUMN IF NOT EXISTS call_id UUID`,
+		`ALTER TABLE ai_usage ADD COLUMN IF NOT EXISTS fields TEXT[]`,
+		`ALTER TABLE user_insights ADD COLUMN IF NOT EXISTS ai_call_id UUID`,
+		`CREATE INDEX IF NOT EXISTS idx_user_insights_ai_call ON user_insights(ai_call_id) WHERE ai_call_id IS NOT NULL`,
+
+		// The privacy policy version each consent was given to. Consents from
+		// before versioning were to the first
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS consent_policy_version INT`,
+		`UPDATE users SET consent_policy_version = 1 WHERE consent_given AND consent_policy_version IS NULL`,
+		`ALTER TABLE consent_log ADD COLUMN IF NOT EXISTS policy_version INT`,
+
+		// Country each user lives in, for currency, operators and prompts,
+		// and spending benchmarks per country rather than one cohort
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS country VARCHAR(2) NOT NULL DEFAULT 'ZM'`,
+		`ALTER TABLE spending_benchmarks ADD COLUMN IF NOT EXISTS country VARCHAR(2) NOT NULL DEFAULT 'ZM'`,
+		`ALTER TABLE spending_benchmarks DROP CONSTRAINT IF EXISTS spending_benchmarks_pkey`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_benchmarks_country_category ON spending_benchmarks(country, category)`,
+
+		// AI insights sampled each day for admins to rate. The prompt version
+		// is copied so ratings still count once a user deletes their data
+		`CREATE TABLE IF NOT EXISTS insight_reviews (
+			id BIGSERIAL PRIMARY KEY,
+			insight_id UUID UNIQUE REFERENCES user_insights(id) ON DELETE SET NULL,
+			sample_date DATE NOT NULL,
+			source VARCHAR(20),
+			model VARCHAR(50),
+			prompt_version VARCHAR(50),
+			rating SMALLINT CHECK (rating BETWEEN 1 AND 5),
+			flags TEXT[] NOT NULL DEFAULT '{}',
+			notes TEXT,
+			reviewed_by VARCHAR(100),
+			reviewed_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_insight_reviews_pending ON insight_reviews(sample_date) WHERE reviewed_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_insight_reviews_prompt_version ON insight_reviews(prompt_version)`,
+
+		// Generated insights the advice guard kept from users, for review
+		`CREATE TABLE IF NOT EXISTS insight_blocks (
+			id BIGSERIAL PRIMARY KEY,
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			title TEXT NOT NULL,
+			message TEXT NOT NULL,
+			reason VARCHAR(30) NOT NULL,
+			blocked_by VARCHAR(20) NOT NULL,
+			model VARCHAR(50),
+			prompt_version VARCHAR(50),
+			ai_call_id UUID,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_insight_blocks_created ON insight_blocks(created_at DESC)`,
+
+		// Scheduled job runs going at once, for jobs whose runs may overlap
+		`ALTER TABLE scheduled_jobs ADD COLUMN IF NOT EXISTS runs_in_progress INT NOT NULL DEFAULT 0`,
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
 	for _, migration := range migrations {
-		if _, err := DB.Exec(migration); err != nil {
-			return fmt.Errorf("migration failed: %w", err)
+		if _, err := db.ExecContext(ctx, migration); err != nil {
+			return nil, fmt.Errorf("migration failed: %w", err)
 		}
 	}
 
-	log.Println("✅ Database migrations completed")
-	return nil
-}
+	// pgvector isn't installed on every Postgres host, so embedding storage is
+	// optional: if the extension can't be created, semantic search stays disabled
+	vectorMigrations := []string{
+		`CREATE EXTENSION IF NOT EXISTS vector`,
+		`CREATE TABLE IF NOT EXISTS transaction_embeddings (
+			transaction_id UUID PRIMARY KEY REFERENCES transactions(id) ON DELETE CASCADE,
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			embedding vector(768) NOT NULL,
+			model VARCHAR(50) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_transaction_embeddings_user_id ON transaction_embeddings(user_id)`,
+	}
+
+	features := &Features{Vector: true}
+	for _, migration := range vectorMigrations {
+		if _, err := db.ExecContext(ctx, migration); err != nil {
+			log.Printf("⚠️ pgvector unavailable (semantic search disabled): %v", err)
+			features.Vector = false
+			break
+		}
+	}
 
-// Close closes the database connection
-func Close() {
-	if DB != nil {
-		DB.Close()
+	// IF NOT EXISTS can't tell a current table from one an older version
+	// created, so compare the result with what the migrations describe
+	expected := migrations
+	if features.Vector {
+		expected = append(expected, vectorMigrations...)
 	}
+	issues, err := checkSchema(ctx, db, expected)
+	if err != nil {
+		log.Printf("⚠️ Schema check failed: %v", err)
+	}
+	features.SchemaIssues = issues
+	for _, issue := range issues {
+		prefix := "⚠️"
+		if issue.Critical {
+			prefix = "❌"
+		}
+		if issue.Fix != "" {
+			log.Printf("%s Schema drift: %s; to fix: %s", prefix, issue.Problem, issue.Fix)
+		} else {
+			log.Printf("%s Schema drift: %s", prefix, issue.Problem)
+		}
+	}
+
+	log.Println("✅ Database migrations completed")
+	return features, nil
 }
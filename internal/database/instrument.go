@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryOptions configures the deadline and slow-query logging applied to every query
+type QueryOptions struct {
+	Timeout       time.Duration // Deadline for queries whose context has none (0 = no limit)
+	SlowThreshold time.Duration // Log queries slower than this (0 = never)
+}
+
+const maxLoggedQuery = 500
+
+// instrumentedConnector wraps the Postgres connector so every query on the
+// pool, including those inside transactions, gets a deadline and is timed.
+// Callers that need longer (exports, migrations) pass a context with their
+// own deadline, which is left alone
+type instrumentedConnector struct {
+	driver.Connector
+	opts QueryOptions
+}
+
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, opts: c.opts}, nil
+}
+
+// instrumentedConn forwards to the pq connection. Prepared statements are
+// passed through untimed; the app only uses one-shot queries
+type instrumentedConn struct {
+	driver.Conn
+	opts QueryOptions
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		c.logIfSlow(query, len(args), time.Since(start), ctx.Err() == context.DeadlineExceeded)
+		cancel()
+		return nil, err
+	}
+
+	// The deadline has to outlive this call: pq reads rows lazily and aborts
+	// the query as soon as the context is cancelled
+	return &instrumentedRows{Rows: rows, conn: c, ctx: ctx, query: query, args: len(args), start: start, cancel: cancel}, nil
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	c.logIfSlow(query, len(args), time.Since(start), err != nil && ctx.Err() == context.DeadlineExceeded)
+	return result, err
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *instrumentedConn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || c.opts.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.opts.Timeout)
+}
+
+// logIfSlow logs the statement text only: parameters can hold user data, so just their count is kept
+func (c *instrumentedConn) logIfSlow(query string, args int, elapsed time.Duration, timedOut bool) {
+	if timedOut {
+		log.Printf("⏱️ Query timed out after %s (%d args elided): %s", elapsed.Round(time.Millisecond), args, compactQuery(query))
+		return
+	}
+	if c.opts.SlowThreshold > 0 && elapsed >= c.opts.SlowThreshold {
+		log.Printf("🐢 Slow query %s (%d args elided): %s", elapsed.Round(time.Millisecond), args, compactQuery(query))
+	}
+}
+
+// instrumentedRows times a query up to its first row, which covers the
+// server-side work (joins, sorts, aggregates) but not how slowly the caller
+// consumes a long result
+type instrumentedRows struct {
+	driver.Rows
+	conn   *instrumentedConn
+	ctx    context.Context
+	query  string
+	args   int
+	start  time.Time
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	r.once.Do(r.logIfSlow)
+	return err
+}
+
+func (r *instrumentedRows) Close() error {
+	r.once.Do(r.logIfSlow)
+	err := r.Rows.Close()
+	r.cancel()
+	return err
+}
+
+func (r *instrumentedRows) logIfSlow() {
+	r.conn.logIfSlow(r.query, r.args, time.Since(r.start), r.ctx.Err() == context.DeadlineExceeded)
+}
+
+// compactQuery collapses whitespace and truncates long statements for logging
+func compactQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxLoggedQuery {
+		query = query[:maxLoggedQuery] + "…"
+	}
+	return query
+}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SchemaIssue is a difference between the database and the schema the
+// migrations describe. CREATE TABLE IF NOT EXISTS leaves a table created by
+// an older version as it was, so a column added to the statement later, or a
+// migration run by hand and stopped halfway, only shows up here
+type SchemaIssue struct {
+	Critical bool   // A missing table or column: queries using it will fail
+	Problem  string // e.g. "column transactions.kind is missing"
+	Fix      string // Statement that would repair it, when there is one
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`(?is)^\s*CREATE TABLE (?:IF NOT EXISTS )?(\w+)\s*\((.*)\)\s*$`)
+	alterTablePattern  = regexp.MustCompile(`(?i)^\s*ALTER TABLE (?:IF EXISTS )?(\w+)\s`)
+	addColumnPattern   = regexp.MustCompile(`(?i)ADD COLUMN (?:IF NOT EXISTS )?(\w+)\s+(\S+(?: PRECISION| WITH TIME ZONE)?)`)
+	createIndexPattern = regexp.MustCompile(`(?i)^\s*CREATE (?:UNIQUE )?INDEX (?:CONCURRENTLY )?(?:IF NOT EXISTS )?(\w+)\s+ON\s+(\w+)`)
+	dropIndexPattern   = regexp.MustCompile(`(?i)^\s*DROP INDEX (?:CONCURRENTLY )?(?:IF EXISTS )?(\w+)`)
+	sqlCommentPattern  = regexp.MustCompile(`--[^\n]*`)
+)
+
+// udtNames maps the column types used in migrations to information_schema's udt_name
+var udtNames = map[string]string{
+	"UUID":        "uuid",
+	"VARCHAR":     "varchar",
+	"CHAR":        "bpchar",
+	"TEXT":        "text",
+	"INT":         "int4",
+	"INTEGER":     "int4",
+	"SERIAL":      "int4",
+	"SMALLINT":    "int2",
+	"BIGINT":      "int8",
+	"BIGSERIAL":   "int8",
+	"BOOLEAN":     "bool",
+	"BOOL":        "bool",
+	"TIMESTAMP":   "timestamp",
+	"TIMESTAMPTZ": "timestamptz",
+	"DATE":        "date",
+	"DECIMAL":     "numeric",
+	"NUMERIC":     "numeric",
+	"JSON":        "json",
+	"JSONB":       "jsonb",
+	"REAL":        "float4",
+	"VECTOR":      "vector",
+}
+
+// expectedColumn is a column the migrations create
+type expectedColumn struct {
+	udtName string // Empty when the type isn't one udtNames knows
+	fix     string
+}
+
+// expectedSchema is what a list of migrations leaves behind
+type expectedSchema struct {
+	tables  map[string]map[string]expectedColumn
+	indexes map[string]string // Index name to the statement creating it
+	order   []string          // Tables in creation order, for stable reports
+}
+
+// udtName returns the udt_name for a column definition's type, or "" if unknown
+func udtName(definition string) string {
+	def := strings.ToUpper(strings.Join(strings.Fields(definition), " "))
+	if strings.HasPrefix(def, "TIMESTAMP WITH TIME ZONE") {
+		return "timestamptz"
+	}
+	if strings.HasPrefix(def, "DOUBLE PRECISION") {
+		return "float8"
+	}
+
+	typ := strings.FieldsFunc(def, func(r rune) bool { return r == ' ' || r == '(' || r == ',' })[0]
+	array := strings.HasSuffix(typ, "[]")
+	udt, ok := udtNames[strings.TrimSuffix(typ, "[]")]
+	if !ok {
+		return ""
+	}
+	if array {
+		return "_" + udt
+	}
+	return udt
+}
+
+// splitTopLevel splits a table body on the commas outside parentheses
+func splitTopLevel(body string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range body {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, body[start:])
+}
+
+// parseSchema works out the tables, columns and indexes a list of migrations creates
+func parseSchema(migrations []string) expectedSchema {
+	schema := expectedSchema{
+		tables:  make(map[string]map[string]expectedColumn),
+		indexes: make(map[string]string),
+	}
+	table := func(name string) map[string]expectedColumn {
+		name = strings.ToLower(name)
+		if schema.tables[name] == nil {
+			schema.tables[name] = make(map[string]expectedColumn)
+			schema.order = append(schema.order, name)
+		}
+		return schema.tables[name]
+	}
+
+	for _, migration := range migrations {
+		stmt := sqlCommentPattern.ReplaceAllString(migration, "")
+		oneLine := strings.Join(strings.Fields(stmt), " ")
+
+		if m := createTablePattern.FindStringSubmatch(stmt); m != nil {
+			columns := table(m[1])
+			for _, item := range splitTopLevel(m[2]) {
+				fields := strings.Fields(item)
+				if len(fields) < 2 {
+					continue
+				}
+				switch strings.ToUpper(strings.SplitN(fields[0], "(", 2)[0]) {
+				case "PRIMARY", "UNIQUE", "FOREIGN", "CONSTRAINT", "CHECK", "EXCLUDE":
+					continue
+				}
+				definition := strings.Join(fields[1:], " ")
+				columns[strings.ToLower(fields[0])] = expectedColumn{
+					udtName: udtName(definition),
+					fix:     fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s", strings.ToLower(m[1]), strings.Join(fields, " ")),
+				}
+			}
+			continue
+		}
+
+		if m := createIndexPattern.FindStringSubmatch(stmt); m != nil {
+			schema.indexes[strings.ToLower(m[1])] = oneLine
+			continue
+		}
+		if m := dropIndexPattern.FindStringSubmatch(stmt); m != nil {
+			delete(schema.indexes, strings.ToLower(m[1]))
+			continue
+		}
+
+		if m := alterTablePattern.FindStringSubmatch(stmt); m != nil {
+			for _, clause := range addColumnPattern.FindAllStringSubmatch(oneLine, -1) {
+				table(m[1])[strings.ToLower(clause[1])] = expectedColumn{
+					udtName: udtName(clause[2]),
+					fix:     oneLine,
+				}
+			}
+		}
+	}
+	return schema
+}
+
+// checkSchema compares the database with what migrations create
+func checkSchema(ctx context.Context, db *sql.DB, migrations []string) ([]SchemaIssue, error) {
+	expected := parseSchema(migrations)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT table_name, column_name, udt_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema()
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actual := make(map[string]map[string]string)
+	for rows.Next() {
+		var table, column, udt string
+		if err := rows.Scan(&table, &column, &udt); err != nil {
+			return nil, err
+		}
+		if actual[table] == nil {
+			actual[table] = make(map[string]string)
+		}
+		actual[table][column] = udt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	indexRows, err := db.QueryContext(ctx, "SELECT indexname FROM pg_indexes WHERE schemaname = current_schema()")
+	if err != nil {
+		return nil, err
+	}
+	defer indexRows.Close()
+
+	indexes := make(map[string]bool)
+	for indexRows.Next() {
+		var name string
+		if err := indexRows.Scan(&name); err != nil {
+			return nil, err
+		}
+		indexes[name] = true
+	}
+	if err := indexRows.Err(); err != nil {
+		return nil, err
+	}
+
+	var issues []SchemaIssue
+	for _, table := range expected.order {
+		columns, ok := actual[table]
+		if !ok {
+			issues = append(issues, SchemaIssue{Critical: true, Problem: fmt.Sprintf("table %s is missing", table)})
+			continue
+		}
+
+		names := make([]string, 0, len(expected.tables[table]))
+		for name := range expected.tables[table] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			want := expected.tables[table][name]
+			got, ok := columns[name]
+			switch {
+			case !ok:
+				issues = append(issues, SchemaIssue{
+					Critical: true,
+					Problem:  fmt.Sprintf("column %s.%s is missing", table, name),
+					Fix:      want.fix,
+				})
+			case want.udtName != "" && got != want.udtName:
+				issues = append(issues, SchemaIssue{
+					Problem: fmt.Sprintf("column %s.%s is %s, expected %s", table, name, got, want.udtName),
+				})
+			}
+		}
+	}
+
+	names := make([]string, 0, len(expected.indexes))
+	for name := range expected.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !indexes[name] {
+			issues = append(issues, SchemaIssue{
+				Problem: fmt.Sprintf("index %s is missing", name),
+				Fix:     expected.indexes[name],
+			})
+		}
+	}
+	return issues, nil
+}
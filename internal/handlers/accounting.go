@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// AccountingHandler manages business mode and the account mappings used by accounting exports
+type AccountingHandler struct {
+	DB *sql.DB
+}
+
+// SetBusinessMode turns business mode, and with it accounting exports, on or off
+func (h *AccountingHandler) SetBusinessMode(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.DB.Exec("UPDATE users SET business_mode = $1, updated_at = $2 WHERE id = $3", req.Enabled, time.Now(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update business mode"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"business_mode": req.Enabled})
+}
+
+// accountingFormat looks up an accounting export format, answering 400 when it isn't supported
+func accountingFormat(c *gin.Context, format string) (services.AccountingProfile, bool) {
+	profile, ok := services.AccountingProfiles[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be quickbooks or xero"})
+	}
+	return profile, ok
+}
+
+// loadAccountMappings returns the user's category to account overrides for a format
+func loadAccountMappings(ctx context.Context, db *sql.DB, userID, format string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT category, account FROM account_mappings WHERE user_id = $1 AND format = $2",
+		userID, format,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappings := make(map[string]string)
+	for rows.Next() {
+		var category, account string
+		if err := rows.Scan(&category, &account); err != nil {
+			return nil, err
+		}
+		mappings[category] = account
+	}
+	return mappings, rows.Err()
+}
+
+// GetAccountMappings lists the account each of the user's categories is
+// exported to in a format (?format=quickbooks or xero), marking defaults
+func (h *AccountingHandler) GetAccountMappings(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	format := c.Query("format")
+	profile, ok := accountingFormat(c, format)
+	if !ok {
+		return
+	}
+
+	mappings, err := loadAccountMappings(ctx, h.DB, userID, format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch account mappings"})
+		return
+	}
+
+	// Every category the user has, plus any they've mapped ahead of time
+	types := make(map[string]string)
+	rows, err := h.DB.QueryContext(ctx, `
+		SELECT DISTINCT `+mappedCategorySQL+`, type FROM transactions WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+	for rows.Next() {
+		var category, txType string
+		if rows.Scan(&category, &txType) == nil && types[category] != "EXPENSE" {
+			types[category] = txType
+		}
+	}
+	rows.Close()
+	for category := range mappings {
+		if _, ok := types[category]; !ok {
+			types[category] = "EXPENSE"
+		}
+	}
+
+	result := []gin.H{}
+	for category, txType := range types {
+		_, custom := mappings[category]
+		result = append(result, gin.H{
+			"category": category,
+			"account":  profile.Account(category, txType, mappings),
+			"default":  !custom,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["category"].(string) < result[j]["category"].(string)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"format": format, "mappings": result})
+}
+
+// UpdateAccountMappings sets the accounts categories are exported to. An
+// empty account restores the default
+func (h *AccountingHandler) UpdateAccountMappings(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Format   string            `json:"format" binding:"required"`
+		Mappings map[string]string `json:"mappings" binding:"required"` // Category to account
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := accountingFormat(c, req.Format); !ok {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account mappings"})
+		return
+	}
+	defer tx.Rollback()
+
+	for category, account := range req.Mappings {
+		category = strings.ToUpper(strings.TrimSpace(category))
+		account = strings.TrimSpace(account)
+		if category == "" || len(category) > 50 || len(account) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping for " + category})
+			return
+		}
+
+		if account == "" {
+			_, err = tx.Exec(
+				"DELETE FROM account_mappings WHERE user_id = $1 AND format = $2 AND category = $3",
+				userID, req.Format, category,
+			)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO account_mappings (user_id, format, category, account)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (user_id, format, category) DO UPDATE SET account = EXCLUDED.account
+			`, userID, req.Format, category, account)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account mappings"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account mappings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account mappings updated"})
+}
+
+// runAccountingExport renders the user's transactions as an accounting
+// import CSV. The file is kept in the job result for the download endpoint
+func runAccountingExport(ctx context.Context, db *sql.DB, userID, format string) (interface{}, error) {
+	profile := services.AccountingProfiles[format]
+
+	mappings, err := loadAccountMappings(ctx, db, userID, format)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT amount, type, `+mappedCategorySQL+`, operator, recipient, reference, description, date
+		FROM transactions
+		WHERE user_id = $1
+		ORDER BY date ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		var t models.Transaction
+		if err := rows.Scan(&t.Amount, &t.Type, &t.Category, &t.Operator, &t.Recipient, &t.Reference, &t.Description, &t.Date); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	file, err := profile.BuildCSV(transactions, mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"format":       format,
+		"filename":     services.ExportFilename(format, time.Now()),
+		"content_type": "text/csv",
+		"rows":         len(transactions),
+		"csv":          string(file),
+	}, nil
+}
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// maxAccounts is how many accounts a user can have
+const maxAccounts = 20
+
+// AccountsHandler manages the wallets, bank accounts and cash a user's
+// transactions are kept in
+type AccountsHandler struct {
+	DB *sql.DB
+}
+
+const accountColumns = "id, type, name, operator, institution, number_suffix, created_at, updated_at"
+
+func scanAccount(row interface{ Scan(...interface{}) error }) (models.Account, error) {
+	var a models.Account
+	err := row.Scan(&a.ID, &a.Type, &a.Name, &a.Operator, &a.Institution, &a.NumberSuffix, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+// loadAccounts returns the user's accounts, oldest first
+func loadAccounts(ctx context.Context, db *sql.DB, userID string) ([]models.Account, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+accountColumns+" FROM accounts WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// GetAccounts lists the user's accounts
+func (h *AccountsHandler) GetAccounts(c *gin.Context) {
+	accounts, err := loadAccounts(c.Request.Context(), h.DB, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// CreateAccount adds an account. Wallets name their operator, and synced
+// transactions that don't name an account go to the wallet on theirs
+func (h *AccountsHandler) CreateAccount(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req struct {
+		Type         string  `json:"type" binding:"required,oneof=wallet bank cash"`
+		Name         string  `json:"name" binding:"required,max=50"`
+		Operator     *string `json:"operator"`
+		Institution  *string `json:"institution" binding:"omitempty,max=100"`
+		NumberSuffix *string `json:"number_suffix" binding:"omitempty,len=4,numeric"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.Join(strings.Fields(req.Name), " ")
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	switch req.Type {
+	case models.AccountTypeWallet:
+		if req.Operator == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "operator is required for wallets"})
+			return
+		}
+		operator := strings.ToUpper(strings.TrimSpace(*req.Operator))
+		if country := loadCountry(ctx, h.DB, userID); !country.HasOperator(operator) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "operator must be one of " + strings.Join(country.Operators, ", ")})
+			return
+		}
+		req.Operator = &operator
+		req.Institution, req.NumberSuffix = nil, nil
+	case models.AccountTypeBank:
+		req.Operator = nil
+	default:
+		req.Operator, req.Institution, req.NumberSuffix = nil, nil, nil
+	}
+
+	var count int
+	h.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM accounts WHERE user_id = $1", userID).Scan(&count)
+	if count >= maxAccounts {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You can have at most %d accounts", maxAccounts)})
+		return
+	}
+
+	a, err := scanAccount(h.DB.QueryRowContext(ctx, `
+		INSERT INTO accounts (user_id, type, name, operator, institution, number_suffix)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+accountColumns,
+		userID, req.Type, req.Name, req.Operator, req.Institution, req.NumberSuffix,
+	))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+// UpdateAccount renames an account or, for bank accounts, changes the bank
+// or account number suffix. An account's type and operator are fixed
+func (h *AccountsHandler) UpdateAccount(c *gin.Context) {
+	var req struct {
+		Name         *string `json:"name" binding:"omitempty,max=50"`
+		Institution  *string `json:"institution" binding:"omitempty,max=100"`
+		NumberSuffix *string `json:"number_suffix" binding:"omitempty,len=4,numeric"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != nil {
+		name := strings.Join(strings.Fields(*req.Name), " ")
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name can't be empty"})
+			return
+		}
+		req.Name = &name
+	}
+
+	a, err := scanAccount(h.DB.QueryRowContext(c.Request.Context(), `
+		UPDATE accounts SET
+			name = COALESCE($3, name),
+			institution = CASE WHEN type = $5 THEN COALESCE($4, institution) ELSE institution END,
+			number_suffix = CASE WHEN type = $5 THEN COALESCE($6, number_suffix) ELSE number_suffix END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+accountColumns,
+		c.Param("id"), c.GetString("user_id"), req.Name, req.Institution, models.AccountTypeBank, req.NumberSuffix,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+// DeleteAccount removes an account. Its transactions are kept, in no account
+func (h *AccountsHandler) DeleteAccount(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM accounts WHERE id = $1 AND user_id = $2", c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// SetTransactionAccount moves a transaction to another of the user's
+// accounts; account_id null takes it out of any account
+func (h *AccountsHandler) SetTransactionAccount(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		AccountID *string `json:"account_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	transactionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	var accountID *uuid.UUID
+	if req.AccountID != nil {
+		id, err := uuid.Parse(*req.AccountID)
+		var exists bool
+		if err == nil {
+			h.DB.QueryRow(
+				"SELECT EXISTS (SELECT 1 FROM accounts WHERE id = $1 AND user_id = $2)", id, userID,
+			).Scan(&exists)
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown account"})
+			return
+		}
+		accountID = &id
+	}
+
+	result, err := h.DB.Exec(
+		"UPDATE transactions SET account_id = $3 WHERE id = $1 AND user_id = $2",
+		transactionID, userID, accountID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": transactionID, "account_id": accountID})
+}
+
+// syncAccounts is what a sync batch needs to know of the user's accounts
+type syncAccounts struct {
+	ids     map[string]bool
+	wallets map[string]string // Operator -> the oldest wallet on it
+	banks   []syncBankAccount
+	cash    string // The oldest cash account
+}
+
+// syncBankAccount is a bank account whose institution is one of services.Banks
+type syncBankAccount struct {
+	id, bank, suffix string
+}
+
+func loadSyncAccounts(ctx context.Context, db *sql.DB, userID string) (syncAccounts, error) {
+	accounts := syncAccounts{ids: make(map[string]bool), wallets: make(map[string]string)}
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, type, COALESCE(operator, ''), COALESCE(institution, ''), COALESCE(number_suffix, '')
+		FROM accounts WHERE user_id = $1 ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return accounts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, accountType, operator, institution, suffix string
+		if err := rows.Scan(&id, &accountType, &operator, &institution, &suffix); err != nil {
+			return accounts, err
+		}
+		accounts.ids[id] = true
+		switch accountType {
+		case models.AccountTypeWallet:
+			if _, ok := accounts.wallets[operator]; !ok {
+				accounts.wallets[operator] = id
+			}
+		case models.AccountTypeBank:
+			if bank := services.BankOf(institution); bank != "" {
+				accounts.banks = append(accounts.banks, syncBankAccount{id: id, bank: bank, suffix: suffix})
+			}
+		case models.AccountTypeCash:
+			if accounts.cash == "" {
+				accounts.cash = id
+			}
+		}
+	}
+	return accounts, rows.Err()
+}
+
+// resolve returns the account a synced transaction goes in: the one it
+// names, or else the user's wallet on its operator, if they have one
+func (a syncAccounts) resolve(t models.TransactionInput) (*string, error) {
+	if t.AccountID != nil {
+		id := strings.ToLower(strings.TrimSpace(*t.AccountID))
+		if !a.ids[id] {
+			return nil, fmt.Errorf("account_id is not one of the user's accounts")
+		}
+		return &id, nil
+	}
+	if id, ok := a.wallets[strings.ToUpper(t.Operator)]; ok {
+		return &id, nil
+	}
+	return nil, nil
+}
+
+// resolveBank returns the bank account a bank SMS is about: the account at
+// its bank with the number it ends in or, failing that, the user's only
+// account at the bank whose number isn't set
+func (a syncAccounts) resolveBank(sms services.BankSMS) *string {
+	var match *string
+	unnumbered := 0
+	for i := range a.banks {
+		account := &a.banks[i]
+		if account.bank != sms.Bank {
+			continue
+		}
+		if sms.AccountSuffix != "" && account.suffix == sms.AccountSuffix {
+			return &account.id
+		}
+		if account.suffix == "" {
+			unnumbered++
+			match = &account.id
+		}
+	}
+	if unnumbered == 1 {
+		return match
+	}
+	return nil
+}
+
+// GetAccountAnalytics returns each account's income, expenses and latest
+// balance for the period (week, month, year or all), plus the transactions
+// in no account. Empty for metadata-only users, whose totals carry no account
+func (h *AnalyticsHandler) GetAccountAnalytics(c *gin.Context) {
+	userID := c.GetString("user_id")
+	period := c.DefaultQuery("period", "month")
+
+	var since time.Time
+	now := time.Now()
+	switch period {
+	case "week":
+		since = now.AddDate(0, 0, -7)
+	case "month":
+		since = now.AddDate(0, -1, 0)
+	case "year":
+		since = now.AddDate(-1, 0, 0)
+	default:
+		period = "all"
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT a.id, a.type, a.name, COALESCE(t.income, 0), COALESCE(t.expenses, 0), COALESCE(t.n, 0),
+			b.balance, b.date
+		FROM accounts a
+		LEFT JOIN (
+			SELECT account_id,
+				SUM(CASE WHEN type = 'INCOME' THEN amount ELSE 0 END) AS income,
+				SUM(CASE WHEN type = 'EXPENSE' THEN amount ELSE 0 END) AS expenses,
+				COUNT(*) AS n
+			FROM transactions
+			WHERE user_id = $1 AND date >= $2 AND account_id IS NOT NULL
+			GROUP BY account_id
+		) t ON t.account_id = a.id
+		LEFT JOIN LATERAL (
+			SELECT balance, date FROM transactions
+			WHERE account_id = a.id AND balance IS NOT NULL
+			ORDER BY date DESC
+			LIMIT 1
+		) b ON TRUE
+		WHERE a.user_id = $1
+		ORDER BY a.created_at
+	`, userID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate account analytics"})
+		return
+	}
+	defer rows.Close()
+
+	summaries := []models.AccountSummary{}
+	for rows.Next() {
+		var s models.AccountSummary
+		var id uuid.UUID
+		var balance sql.NullFloat64
+		var balanceAt sql.NullTime
+		if err := rows.Scan(&id, &s.Type, &s.Name, &s.Income, &s.Expenses, &s.Transactions, &balance, &balanceAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate account analytics"})
+			return
+		}
+		s.AccountID = &id
+		s.Net = s.Income - s.Expenses
+		if balance.Valid && balanceAt.Valid {
+			s.Balance, s.BalanceAt = &balance.Float64, &balanceAt.Time
+		}
+		summaries = append(summaries, s)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate account analytics"})
+		return
+	}
+
+	unassigned := models.AccountSummary{Name: "Unassigned"}
+	err = h.DB.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN type = 'INCOME' THEN amount ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN type = 'EXPENSE' THEN amount ELSE 0 END), 0),
+			COUNT(*)
+		FROM transactions
+		WHERE user_id = $1 AND date >= $2 AND account_id IS NULL
+	`, userID, since).Scan(&unassigned.Income, &unassigned.Expenses, &unassigned.Transactions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate account analytics"})
+		return
+	}
+	if unassigned.Transactions > 0 {
+		unassigned.Net = unassigned.Income - unassigned.Expenses
+		summaries = append(summaries, unassigned)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"period": period, "accounts": summaries})
+}
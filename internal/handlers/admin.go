@@ -1,21 +1,33 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"log"
 	"net/http"
-	"strconv"
+	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
-	"github.com/kwachatracker/backend/internal/database"
 	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
 	"github.com/kwachatracker/backend/internal/services"
+	"github.com/lib/pq"
 )
 
 type AdminHandler struct {
+	DB              *sql.DB
 	FCMService      *services.FCMService
 	GeminiService   *services.GeminiService
 	InsightsHandler *InsightsHandler
+	AIUsage         *services.AIUsageTracker
+	Scheduler       *services.Scheduler
+	Jobs            *services.JobService
+	Settings        *services.Settings
+	Notifier        *notifications.Service
 }
 
 // GetStats returns dashboard statistics
@@ -23,74 +35,78 @@ func (h *AdminHandler) GetStats(c *gin.Context) {
 	var stats models.AdminStats
 
 	// Total users
-	database.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&stats.TotalUsers)
+	h.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&stats.TotalUsers)
 
 	// Active users (synced in last 7 days)
 	activeThreshold := time.Now().AddDate(0, 0, -7)
-	database.DB.QueryRow(
-		"SELECT COUNT(DISTINCT user_id) FROM transactions WHERE created_at >= $1",
+	h.DB.QueryRow(
+		"SELECT COUNT(*) FROM user_stats WHERE last_sync >= $1",
 		activeThreshold,
 	).Scan(&stats.ActiveUsers7d)
 
 	// Insights today
 	todayStart := time.Now().Truncate(24 * time.Hour)
-	database.DB.QueryRow(
+	h.DB.QueryRow(
 		"SELECT COUNT(*) FROM user_insights WHERE generated_at >= $1",
 		todayStart,
 	).Scan(&stats.InsightsToday)
 
 	// Total transactions
-	database.DB.QueryRow("SELECT COUNT(*) FROM transactions").Scan(&stats.TotalTransactions)
+	h.DB.QueryRow("SELECT COALESCE(SUM(transaction_count), 0) FROM user_stats").Scan(&stats.TotalTransactions)
 
 	// Notifications sent today (if we track them)
 	stats.NotificationsSentToday = 0 // TODO: implement when we add notifications table
 
-	// API usage estimate
-	stats.APIUsage.GeminiRequestsToday = stats.InsightsToday
-	stats.APIUsage.EstimatedCost = float64(stats.InsightsToday) * 0.003 // rough estimate
+	// API usage from the AI usage tracker
+	if budget, err := h.AIUsage.Status(c.Request.Context()); err == nil {
+		stats.APIUsage.GeminiRequestsToday = budget.RequestsToday
+		stats.APIUsage.EstimatedCost = budget.SpentToday
+	}
 
 	c.JSON(http.StatusOK, stats)
 }
 
-// GetUsers returns paginated user list
-func (h *AdminHandler) GetUsers(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	filter := c.Query("filter") // "synced", "all"
-
-	offset := (page - 1) * limit
-
-	// Build query
-	query := `
-		SELECT 
-			u.id, 
-			u.device_id, 
-			u.fcm_token,
-			u.consent_given,
-			u.created_at,
-			MAX(t.created_at) as last_sync,
-			COUNT(t.id) as transaction_count,
-			COUNT(DISTINCT i.id) as insights_count
-		FROM users u
-		LEFT JOIN transactions t ON u.id = t.user_id
-		LEFT JOIN user_insights i ON u.id = i.user_id
-	`
-
-	if filter == "synced" {
-		query += " WHERE t.created_at >= $3"
-	}
-
-	query += " GROUP BY u.id ORDER BY u.created_at DESC LIMIT $1 OFFSET $2"
-
-	var rows *sql.Rows
-	var err error
-
-	if filter == "synced" {
-		rows, err = database.DB.Query(query, limit, offset, time.Now().AddDate(0, 0, -7))
-	} else {
-		rows, err = database.DB.Query(query, limit, offset)
+// GetAIBudget returns Gemini spend, remaining budget and kill switch state
+func (h *AdminHandler) GetAIBudget(c *gin.Context) {
+	status, err := h.AIUsage.Status(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch AI budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// UpdateAIBudget changes budgets, toggles the kill switch or overrides an exhausted budget
+func (h *AdminHandler) UpdateAIBudget(c *gin.Context) {
+	var req services.AIBudgetUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
+	status, err := h.updateAIBudget(c.Request.Context(), req, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update AI budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetUsers returns paginated user list, optionally searched and sorted
+func (h *AdminHandler) GetUsers(c *gin.Context) {
+	page := adminPagination(c)
+	filter := adminUserFilters(c)
+	listing := adminUsersListing.sortedBy(c, adminUserSorts)
+
+	// Counts come from user_stats, which sync and insight generation keep current
+	query, queryArgs := listing.selectPage(`
+		u.id, u.device_id, u.fcm_token, u.consent_given, u.created_at,
+		s.last_sync, COALESCE(s.transaction_count, 0), COALESCE(s.insights_count, 0)
+	`, filter, page)
+
+	rows, err := h.DB.Query(query, queryArgs...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
@@ -129,61 +145,27 @@ func (h *AdminHandler) GetUsers(c *gin.Context) {
 
 	// Get total count
 	var total int
-	countQuery := "SELECT COUNT(*) FROM users"
-	if filter == "synced" {
-		countQuery += " WHERE EXISTS (SELECT 1 FROM transactions WHERE user_id = users.id AND created_at >= $1)"
-		database.DB.QueryRow(countQuery, time.Now().AddDate(0, 0, -7)).Scan(&total)
-	} else {
-		database.DB.QueryRow(countQuery).Scan(&total)
-	}
+	countQuery, countArgs := listing.count(filter)
+	h.DB.QueryRow(countQuery, countArgs...).Scan(&total)
 
 	c.JSON(http.StatusOK, gin.H{
 		"users": users,
 		"total": total,
-		"page":  page,
+		"page":  page.Page,
 	})
 }
 
 // GetInsights returns paginated insights
 func (h *AdminHandler) GetInsights(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	userID := c.Query("user_id")
-	dateFrom := c.Query("date_from")
-
-	offset := (page - 1) * limit
+	page := adminPagination(c)
+	filter := adminInsightFilters(c)
 
-	// filters first
-	query := `
-		SELECT id, user_id, category, message, generated_at
-		FROM user_insights
-		WHERE 1=1
-	`
-	args := []interface{}{}
-	argCount := 0
+	query, queryArgs := adminInsightsListing.selectPage(`
+		id, user_id, category, message, generated_at,
+		source, model, prompt_version, finish_reason, latency_ms, prompt_tokens, output_tokens, excluded_categories
+	`, filter, page)
 
-	if userID != "" {
-		argCount++
-		query += " AND user_id = $" + strconv.Itoa(argCount)
-		args = append(args, userID)
-	}
-
-	if dateFrom != "" {
-		argCount++
-		query += " AND generated_at >= $" + strconv.Itoa(argCount)
-		args = append(args, dateFrom)
-	}
-
-	// Add LIMIT and OFFSET last
-	argCount++
-	query += " ORDER BY generated_at DESC LIMIT $" + strconv.Itoa(argCount)
-	args = append(args, limit)
-
-	argCount++
-	query += " OFFSET $" + strconv.Itoa(argCount)
-	args = append(args, offset)
-
-	rows, err := database.DB.Query(query, args...)
+	rows, err := h.DB.Query(query, queryArgs...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch insights", "details": err.Error()})
 		return
@@ -193,39 +175,84 @@ func (h *AdminHandler) GetInsights(c *gin.Context) {
 	insights := []models.AdminInsight{}
 	for rows.Next() {
 		var insight models.AdminInsight
+		var source, model, promptVersion, finishReason sql.NullString
+		var latencyMs, promptTokens, outputTokens sql.NullInt64
+		var excluded pq.StringArray
 		rows.Scan(
 			&insight.ID,
 			&insight.UserID,
 			&insight.Type,
 			&insight.Content,
 			&insight.GeneratedAt,
+			&source,
+			&model,
+			&promptVersion,
+			&finishReason,
+			&latencyMs,
+			&promptTokens,
+			&outputTokens,
+			&excluded,
 		)
+		insight.Source = source.String
+		insight.Model = model.String
+		insight.PromptVersion = promptVersion.String
+		insight.FinishReason = finishReason.String
+		insight.ResponseTimeMs = int(latencyMs.Int64)
+		insight.PromptTokens = int(promptTokens.Int64)
+		insight.OutputTokens = int(outputTokens.Int64)
+		insight.ExcludedCategories = excluded
 		// Default delivered to true for now since we don't track it per insight
 		insight.Delivered = true
 		insights = append(insights, insight)
 	}
 
 	var total int
-	database.DB.QueryRow("SELECT COUNT(*) FROM user_insights").Scan(&total)
+	countQuery, countArgs := adminInsightsListing.count(filter)
+	h.DB.QueryRow(countQuery, countArgs...).Scan(&total)
 
 	c.JSON(http.StatusOK, gin.H{
 		"insights": insights,
 		"total":    total,
-		"page":     page,
+		"page":     page.Page,
 	})
 }
 
-// TriggerInsights manually triggers AI analysis
+// TriggerInsights manually triggers AI analysis. With dry_run it's queued
+// as a job that sends sample_percent of users to Gemini and stores and
+// sends nothing; follow it with GET /admin/insights/dry-runs/:id
 func (h *AdminHandler) TriggerInsights(c *gin.Context) {
 	var req struct {
-		UserID string `json:"user_id"`
+		UserID        string `json:"user_id"`
+		DryRun        bool   `json:"dry_run"`
+		SamplePercent *int   `json:"sample_percent" binding:"omitempty,min=0,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if h.InsightsHandler == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI insights are not configured"})
+		return
 	}
 
-	c.ShouldBindJSON(&req)
+	if req.DryRun {
+		params := analysisDryRunParams{SamplePercent: h.InsightsHandler.opts.DryRunSamplePercent}
+		if req.SamplePercent != nil {
+			params.SamplePercent = *req.SamplePercent
+		}
+		jobID, err := h.Jobs.Enqueue("", JobTypeAnalysisDryRun, params)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue dry run"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Dry run queued", "job_id": jobID})
+		return
+	}
 
 	// Note: Current implementation triggers for all users
 	// TODO: Implement single-user analysis when needed
-	go h.InsightsHandler.RunDailyAnalysis()
+	services.Go("manual insights run", h.InsightsHandler.RunDailyAnalysis)
 
 	if req.UserID != "" {
 		c.JSON(http.StatusOK, gin.H{"message": "Analysis triggered (all users - single-user not yet implemented)"})
@@ -234,6 +261,21 @@ func (h *AdminHandler) TriggerInsights(c *gin.Context) {
 	}
 }
 
+// FCM truncates long notifications and rejects payloads over 4KB
+const (
+	maxNotificationTitleLen = 65
+	maxNotificationBodyLen  = 240
+	maxNotificationPayload  = 4096
+	broadcastSampleSize     = 10
+)
+
+// broadcastRecipient is a user resolved from a broadcast target
+type broadcastRecipient struct {
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"`
+	token    string
+}
+
 // Broadcast sends push notifications
 func (h *AdminHandler) Broadcast(c *gin.Context) {
 	var req models.BroadcastRequest
@@ -243,130 +285,190 @@ func (h *AdminHandler) Broadcast(c *gin.Context) {
 		return
 	}
 
-	var tokens []string
-
-	if req.Target == "specific" && len(req.UserIDs) > 0 {
-		// Get tokens for specific users
-		placeholders := ""
-		for i := range req.UserIDs {
-			if i > 0 {
-				placeholders += ","
-			}
-			placeholders += "$" + strconv.Itoa(i+1)
-		}
-		query := "SELECT fcm_token FROM users WHERE id IN (" + placeholders + ") AND fcm_token IS NOT NULL"
-
-		args := make([]interface{}, len(req.UserIDs))
-		for i, id := range req.UserIDs {
-			args[i] = id
-		}
+	notification := req.Notification()
+	if err := ValidateNotification(notification); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		rows, _ := database.DB.Query(query, args...)
-		defer rows.Close()
+	recipients, err := resolveBroadcastAudience(h.DB, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve audience"})
+		return
+	}
 
-		for rows.Next() {
-			var token string
-			rows.Scan(&token)
-			tokens = append(tokens, token)
-		}
-	} else if req.Target == "active" {
-		// Get tokens for active users (last 7 days)
-		rows, _ := database.DB.Query(`
-			SELECT DISTINCT u.fcm_token 
-			FROM users u
-			INNER JOIN transactions t ON u.id = t.user_id
-			WHERE t.created_at >= $1 AND u.fcm_token IS NOT NULL
-		`, time.Now().AddDate(0, 0, -7))
-		defer rows.Close()
-
-		for rows.Next() {
-			var token string
-			rows.Scan(&token)
-			tokens = append(tokens, token)
-		}
-	} else {
-		// Get all tokens
-		rows, _ := database.DB.Query("SELECT fcm_token FROM users WHERE fcm_token IS NOT NULL")
-		defer rows.Close()
-
-		for rows.Next() {
-			var token string
-			rows.Scan(&token)
-			tokens = append(tokens, token)
+	// Dry run: show who would receive it without sending anything
+	if req.DryRun {
+		sample := recipients
+		if len(sample) > broadcastSampleSize {
+			sample = sample[:broadcastSampleSize]
 		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Dry run - no notifications sent",
+			"dry_run": true,
+			"count":   len(recipients),
+			"sample":  sample,
+		})
+		return
 	}
 
-	if len(tokens) == 0 {
+	if len(recipients) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No tokens found"})
 		return
 	}
 
+	if h.FCMService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Push notifications are not configured"})
+		return
+	}
+
 	// Send notifications (in background if scheduled)
 	if req.ScheduledFor != nil && req.ScheduledFor.After(time.Now()) {
 		// TODO: implement job queue for scheduled notifications
 		c.JSON(http.StatusOK, gin.H{"message": "Scheduled notification (not yet implemented)"})
 	} else {
-		go func() {
-			for _, token := range tokens {
-				h.FCMService.SendNotification(c, token, req.Title, req.Body, nil)
+		services.Go("broadcast", func() {
+			for _, r := range recipients {
+				err := h.Notifier.SendNow(context.Background(), r.UserID, models.Notification{
+					Type: models.NotificationAnnouncements,
+					Push: notification,
+				})
+				if err != nil {
+					log.Printf("❌ Failed to send broadcast to user %s: %v", r.UserID, err)
+				}
 			}
-		}()
+		})
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Broadcasting notification",
-			"count":   len(tokens),
+			"count":   len(recipients),
 		})
 	}
 }
 
-// GetTransactions returns paginated transactions
-func (h *AdminHandler) GetTransactions(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	userID := c.Query("user_id")
-	category := c.Query("category")
-	dateFrom := c.Query("date_from")
-	dateTo := c.Query("date_to")
+// ValidateNotification checks a notification against FCM display and payload limits
+func ValidateNotification(n models.PushNotification) error {
+	if strings.TrimSpace(n.Title) == "" || strings.TrimSpace(n.Body) == "" {
+		return fmt.Errorf("title and body must not be empty")
+	}
+	if l := utf8.RuneCountInString(n.Title); l > maxNotificationTitleLen {
+		return fmt.Errorf("title is %d characters, max is %d", l, maxNotificationTitleLen)
+	}
+	if l := utf8.RuneCountInString(n.Body); l > maxNotificationBodyLen {
+		return fmt.Errorf("body is %d characters, max is %d", l, maxNotificationBodyLen)
+	}
+	if n.ImageURL != "" {
+		if u, err := url.Parse(n.ImageURL); err != nil || u.Scheme != "https" {
+			return fmt.Errorf("image_url must be an https URL")
+		}
+	}
+	if n.DeepLink != "" {
+		if u, err := url.Parse(n.DeepLink); err != nil || u.Scheme == "" {
+			return fmt.Errorf("deep_link must be an absolute URI")
+		}
+	}
 
-	offset := (page - 1) * limit
+	size := len(n.Title) + len(n.Body) + len(n.ImageURL) + len(n.DeepLink)
+	for k, v := range n.Data {
+		size += len(k) + len(v)
+	}
+	if size > maxNotificationPayload {
+		return fmt.Errorf("notification payload is %d bytes, max is %d", size, maxNotificationPayload)
+	}
+	return nil
+}
 
-	query := "SELECT id, user_id, type, category, amount, balance, description, date FROM transactions WHERE 1=1"
-	args := []interface{}{}
-	argCount := 0
+// resolveBroadcastAudience returns the users (with FCM tokens) targeted by a broadcast.
+// The target picks the base audience and every segment filter set narrows it further
+func resolveBroadcastAudience(db *sql.DB, req models.BroadcastRequest) ([]broadcastRecipient, error) {
+	f := &sqlFilter{}
+	f.where("u.fcm_token IS NOT NULL AND u.fcm_token <> ''")
 
-	if userID != "" {
-		argCount++
-		query += " AND user_id = $" + strconv.Itoa(argCount)
-		args = append(args, userID)
+	if req.Target == "specific" && len(req.UserIDs) > 0 {
+		// Specific users
+		f.where("u.id IN (" + f.argList(req.UserIDs) + ")")
+	} else if req.Target == "active" {
+		// Active users (last 7 days)
+		f.where("EXISTS (SELECT 1 FROM transactions t WHERE t.user_id = u.id AND t.created_at >= " +
+			f.arg(time.Now().AddDate(0, 0, -7)) + ")")
 	}
 
-	if category != "" {
-		argCount++
-		query += " AND category = $" + strconv.Itoa(argCount)
-		args = append(args, category)
+	if seg := req.Segment; seg != nil {
+		if len(seg.Operators) > 0 {
+			operators := make([]string, len(seg.Operators))
+			for i, op := range seg.Operators {
+				operators[i] = strings.ToUpper(op)
+			}
+			f.where("UPPER(u.operator) IN (" + f.argList(operators) + ")")
+		}
+		if len(seg.Languages) > 0 {
+			languages := make([]string, len(seg.Languages))
+			for i, lang := range seg.Languages {
+				languages[i] = strings.ToLower(lang)
+			}
+			f.where("u.language IN (" + f.argList(languages) + ")")
+		}
+		if seg.IsPremium != nil {
+			f.where("u.is_premium = " + f.arg(*seg.IsPremium))
+		}
+		if seg.ConsentGiven != nil {
+			f.where("u.consent_given = " + f.arg(*seg.ConsentGiven))
+		}
+		if seg.ConsentAnalytics != nil {
+			f.where("u.consent_analytics = " + f.arg(*seg.ConsentAnalytics))
+		}
+		if seg.ConsentAI != nil {
+			f.where("u.consent_ai = " + f.arg(*seg.ConsentAI))
+		}
+		if seg.SyncedWithinDays != nil {
+			f.where("EXISTS (SELECT 1 FROM transactions t WHERE t.user_id = u.id AND t.created_at >= " +
+				f.arg(time.Now().AddDate(0, 0, -*seg.SyncedWithinDays)) + ")")
+		}
+		if seg.NotSyncedForDays != nil {
+			f.where("NOT EXISTS (SELECT 1 FROM transactions t WHERE t.user_id = u.id AND t.created_at >= " +
+				f.arg(time.Now().AddDate(0, 0, -*seg.NotSyncedForDays)) + ")")
+		}
+		if seg.MinSpend30d != nil || seg.MaxSpend30d != nil {
+			spend := "(SELECT COALESCE(SUM(t.amount), 0) FROM transactions t WHERE t.user_id = u.id AND t.type = 'EXPENSE' AND t.date >= " +
+				f.arg(time.Now().AddDate(0, 0, -30)) + ")"
+			if seg.MinSpend30d != nil {
+				f.where(spend + " >= " + f.arg(*seg.MinSpend30d))
+			}
+			if seg.MaxSpend30d != nil {
+				f.where(spend + " < " + f.arg(*seg.MaxSpend30d))
+			}
+		}
 	}
 
-	if dateFrom != "" {
-		argCount++
-		query += " AND date >= $" + strconv.Itoa(argCount)
-		args = append(args, dateFrom)
+	query := "SELECT u.id, u.device_id, u.fcm_token FROM users u" + f.sql() + " ORDER BY u.created_at DESC"
+	args := f.args
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	if dateTo != "" {
-		argCount++
-		query += " AND date <= $" + strconv.Itoa(argCount)
-		args = append(args, dateTo)
+	recipients := []broadcastRecipient{}
+	for rows.Next() {
+		var r broadcastRecipient
+		if err := rows.Scan(&r.UserID, &r.DeviceID, &r.token); err != nil {
+			continue
+		}
+		recipients = append(recipients, r)
 	}
 
-	// Add LIMIT and OFFSET last
-	argCount++
-	query += " ORDER BY date DESC LIMIT $" + strconv.Itoa(argCount)
-	args = append(args, limit)
+	return recipients, rows.Err()
+}
+
+// GetTransactions returns paginated transactions
+func (h *AdminHandler) GetTransactions(c *gin.Context) {
+	page := adminPagination(c)
+	filter := adminTransactionFilters(c)
 
-	argCount++
-	query += " OFFSET $" + strconv.Itoa(argCount)
-	args = append(args, offset)
+	query, queryArgs := adminTransactionsListing.selectPage(
+		"id, user_id, type, category, amount, balance, description, date", filter, page)
 
-	rows, err := database.DB.Query(query, args...)
+	rows, err := h.DB.Query(query, queryArgs...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions", "details": err.Error()})
 		return
@@ -402,11 +504,74 @@ func (h *AdminHandler) GetTransactions(c *gin.Context) {
 	}
 
 	var total int
-	database.DB.QueryRow("SELECT COUNT(*) FROM transactions").Scan(&total)
+	countQuery, countArgs := adminTransactionsListing.count(filter)
+	h.DB.QueryRow(countQuery, countArgs...).Scan(&total)
 
 	c.JSON(http.StatusOK, gin.H{
 		"transactions": transactions,
 		"total":        total,
-		"page":         page,
+		"page":         page.Page,
 	})
 }
+
+// adminUserFilters builds the filter shared by the user list and export.
+// Conditions reference the users table as u and user_stats as s
+func adminUserFilters(c *gin.Context) *sqlFilter {
+	f := &sqlFilter{}
+	if c.Query("filter") == "synced" {
+		f.where("s.last_sync >= " + f.arg(time.Now().AddDate(0, 0, -7)))
+	}
+	// Support finds users from what a screenshot shows: part of the device
+	// ID, or the start of the user ID or FCM token. Phone numbers aren't
+	// stored, so there's nothing to match an MSISDN against
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		pattern := escapeLike(search)
+		f.where(fmt.Sprintf("(u.device_id ILIKE %s OR u.id::text ILIKE %s OR u.fcm_token LIKE %s)",
+			f.arg("%"+pattern+"%"), f.arg(pattern+"%"), f.arg(pattern+"%")))
+	}
+	return f
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// adminInsightFilters builds the filter shared by the insight list and export
+func adminInsightFilters(c *gin.Context) *sqlFilter {
+	f := &sqlFilter{}
+	if userID := c.Query("user_id"); userID != "" {
+		f.where("user_id = " + f.arg(userID))
+	}
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		f.where("generated_at >= " + f.arg(dateFrom))
+	}
+	return f
+}
+
+// adminTransactionFilters builds the filter shared by the transaction list and export
+func adminTransactionFilters(c *gin.Context) *sqlFilter {
+	f := &sqlFilter{}
+	if userID := c.Query("user_id"); userID != "" {
+		f.where("user_id = " + f.arg(userID))
+	}
+	if category := c.Query("category"); category != "" {
+		f.where("category = " + f.arg(category))
+	}
+	if operator := c.Query("operator"); operator != "" {
+		f.where("UPPER(operator) = " + f.arg(strings.ToUpper(operator)))
+	}
+	if appVersion := c.Query("app_version"); appVersion != "" {
+		f.where("app_version = " + f.arg(appVersion))
+	}
+	if issue, ok := dataQualityIssues[c.Query("issue")]; ok {
+		f.where(issue)
+	}
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		f.where("date >= " + f.arg(dateFrom))
+	}
+	if dateTo := c.Query("date_to"); dateTo != "" {
+		f.where("date <= " + f.arg(dateTo))
+	}
+	return f
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeNotificationCampaign sends one run of a recurring notification campaign
+const JobTypeNotificationCampaign = "notification_campaign"
+
+// campaignPreviewRuns is how many upcoming runs are shown when a campaign is saved
+const campaignPreviewRuns = 3
+
+// validateCampaign checks a campaign request and parses its schedule
+func validateCampaign(req models.CampaignRequest) (*services.CronSchedule, error) {
+	schedule, err := services.ParseCron(req.Cron)
+	if err != nil {
+		return nil, err
+	}
+	switch req.Audience.Target {
+	case "", "all", "active":
+	case "specific":
+		if len(req.Audience.UserIDs) == 0 {
+			return nil, fmt.Errorf("audience.user_ids is required for specific targets")
+		}
+	default:
+		return nil, fmt.Errorf("audience.target must be all, active or specific")
+	}
+	if err := ValidateNotification(req.Template); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// campaignResponse adds the next few runs so admins can check the schedule
+func campaignResponse(campaign models.NotificationCampaign, schedule *services.CronSchedule) gin.H {
+	upcoming := []time.Time{}
+	if campaign.Enabled {
+		at := time.Now()
+		for i := 0; i < campaignPreviewRuns; i++ {
+			at = schedule.Next(at)
+			upcoming = append(upcoming, at)
+		}
+	}
+	return gin.H{"campaign": campaign, "upcoming_runs": upcoming}
+}
+
+// scanCampaign reads a notification_campaigns row selected with campaignColumns
+func scanCampaign(row interface{ Scan(...interface{}) error }) (models.NotificationCampaign, error) {
+	var campaign models.NotificationCampaign
+	var audience, template []byte
+	err := row.Scan(&campaign.ID, &campaign.Name, &campaign.Cron, &audience, &template, &campaign.Enabled,
+		&campaign.NextRunAt, &campaign.LastRunAt, &campaign.LastJobID, &campaign.LastRecipients,
+		&campaign.CreatedAt, &campaign.UpdatedAt)
+	if err != nil {
+		return campaign, err
+	}
+	if err := json.Unmarshal(audience, &campaign.Audience); err != nil {
+		return campaign, err
+	}
+	return campaign, json.Unmarshal(template, &campaign.Template)
+}
+
+const campaignColumns = `id, name, cron, audience, template, enabled,
+	next_run_at, last_run_at, last_job_id, last_recipients, created_at, updated_at`
+
+// GetCampaigns lists the recurring notification campaigns
+func (h *AdminHandler) GetCampaigns(c *gin.Context) {
+	rows, err := h.DB.Query("SELECT " + campaignColumns + " FROM notification_campaigns ORDER BY created_at")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch campaigns"})
+		return
+	}
+	defer rows.Close()
+
+	campaigns := []models.NotificationCampaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			continue
+		}
+		campaigns = append(campaigns, campaign)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"campaigns": campaigns})
+}
+
+// CreateCampaign adds a recurring notification campaign
+func (h *AdminHandler) CreateCampaign(c *gin.Context) {
+	h.saveCampaign(c, "")
+}
+
+// UpdateCampaign replaces a campaign's schedule, audience and template
+func (h *AdminHandler) UpdateCampaign(c *gin.Context) {
+	h.saveCampaign(c, c.Param("id"))
+}
+
+// saveCampaign inserts a campaign, or replaces the one with id. The next run
+// is recomputed from now, so a changed schedule applies straight away
+func (h *AdminHandler) saveCampaign(c *gin.Context, id string) {
+	var req models.CampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule, err := validateCampaign(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Audience.Target == "" {
+		req.Audience.Target = "all"
+	}
+
+	enabled := req.Enabled == nil || *req.Enabled
+	var nextRun *time.Time
+	if enabled {
+		next := schedule.Next(time.Now())
+		nextRun = &next
+	}
+	audience, _ := json.Marshal(req.Audience)
+	template, _ := json.Marshal(req.Template)
+
+	var row *sql.Row
+	if id == "" {
+		row = h.DB.QueryRow(`
+			INSERT INTO notification_campaigns (name, cron, audience, template, enabled, next_run_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING `+campaignColumns,
+			req.Name, schedule.String(), audience, template, enabled, nextRun)
+	} else {
+		row = h.DB.QueryRow(`
+			UPDATE notification_campaigns SET
+				name = $2, cron = $3, audience = $4, template = $5, enabled = $6,
+				next_run_at = $7, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING `+campaignColumns,
+			id, req.Name, schedule.String(), audience, template, enabled, nextRun)
+	}
+
+	campaign, err := scanCampaign(row)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save campaign"})
+		return
+	}
+
+	status := http.StatusOK
+	if id == "" {
+		status = http.StatusCreated
+	}
+	c.JSON(status, campaignResponse(campaign, schedule))
+}
+
+// DeleteCampaign removes a campaign; a run already queued is skipped
+func (h *AdminHandler) DeleteCampaign(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM notification_campaigns WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete campaign"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Campaign deleted"})
+}
+
+// RunCampaign sends a campaign now, without moving its schedule
+func (h *AdminHandler) RunCampaign(c *gin.Context) {
+	id := c.Param("id")
+
+	var exists bool
+	h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM notification_campaigns WHERE id = $1)", id).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	jobID, err := h.Jobs.Enqueue("", JobTypeNotificationCampaign, gin.H{"campaign_id": id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue campaign"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Campaign queued",
+		"job_id":  jobID,
+	})
+}
+
+// DispatchCampaigns queues a job for every enabled campaign that is due and
+// moves it to its next run after at. Runs missed while the server was down
+// are sent once, not once per missed occurrence
+func DispatchCampaigns(ctx context.Context, db *sql.DB, jobs *services.JobService, at time.Time) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, cron, next_run_at FROM notification_campaigns
+		WHERE enabled AND next_run_at <= $1
+	`, at)
+	if err != nil {
+		return err
+	}
+
+	type dueCampaign struct {
+		id, cron string
+		due      time.Time
+	}
+	due := []dueCampaign{}
+	for rows.Next() {
+		var d dueCampaign
+		if err := rows.Scan(&d.id, &d.cron, &d.due); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		schedule, err := services.ParseCron(d.cron)
+		if err != nil {
+			log.Printf("⚠️ Campaign %s has an invalid schedule %q: %v", d.id, d.cron, err)
+			continue
+		}
+
+		// Claim the run first so a retried dispatch can't queue it twice
+		result, err := db.ExecContext(ctx, `
+			UPDATE notification_campaigns SET next_run_at = $2, last_run_at = $3
+			WHERE id = $1 AND next_run_at = $4
+		`, d.id, schedule.Next(at), at, d.due)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		jobID, err := jobs.Enqueue("", JobTypeNotificationCampaign, gin.H{"campaign_id": d.id})
+		if err != nil {
+			log.Printf("❌ Failed to queue campaign %s: %v", d.id, err)
+			continue
+		}
+		db.ExecContext(ctx, "UPDATE notification_campaigns SET last_job_id = $2 WHERE id = $1", d.id, jobID)
+	}
+	return nil
+}
+
+// NotificationCampaignJob returns the job type that sends one campaign run
+// through the notifications service
+func NotificationCampaignJob(db *sql.DB, notifier *notifications.Service) services.JobType {
+	return services.JobType{
+		Name: JobTypeNotificationCampaign,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			var params struct {
+				CampaignID uuid.UUID `json:"campaign_id"`
+			}
+			if err := json.Unmarshal(job.Params, &params); err != nil {
+				return nil, err
+			}
+			return runCampaign(ctx, db, notifier, params.CampaignID)
+		},
+	}
+}
+
+// runCampaign resolves the campaign's audience now, so users who joined
+// since the last run are included, and queues the template for each of them
+func runCampaign(ctx context.Context, db *sql.DB, notifier *notifications.Service, id uuid.UUID) (interface{}, error) {
+	campaign, err := scanCampaign(db.QueryRowContext(ctx,
+		"SELECT "+campaignColumns+" FROM notification_campaigns WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return gin.H{"campaign_id": id, "skipped": "campaign deleted"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recipients, err := resolveBroadcastAudience(db, models.BroadcastRequest{
+		Target:  campaign.Audience.Target,
+		UserIDs: campaign.Audience.UserIDs,
+		Segment: campaign.Audience.Segment,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, r := range recipients {
+		if err := notifier.Send(tx, r.UserID, models.Notification{Type: models.NotificationAnnouncements, Push: campaign.Template}); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec("UPDATE notification_campaigns SET last_recipients = $2 WHERE id = $1", id, len(recipients)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("📣 Campaign %q queued for %d users", campaign.Name, len(recipients))
+	return gin.H{"campaign_id": id, "recipients": len(recipients)}, nil
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeCategoryRemap rewrites stored transactions to the current category taxonomy
+const JobTypeCategoryRemap = "category_remap"
+
+const categoryRemapBatchSize = 5000
+
+// categoryRemapMaxBatches stops the remap job should mappings that predate
+// the cycle check send rows round in circles
+const categoryRemapMaxBatches = 10000
+
+// mappedCategorySQL is a transaction's category under the current taxonomy (see category_mappings)
+const mappedCategorySQL = "mapped_category(category, date, recipient, description)"
+
+// GetCategoryMappings lists the category taxonomy changes
+func (h *AdminHandler) GetCategoryMappings(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT id, from_category, to_category, match_pattern, effective_from, created_at
+		FROM category_mappings
+		ORDER BY effective_from DESC, id
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category mappings"})
+		return
+	}
+	defer rows.Close()
+
+	mappings := []models.CategoryMapping{}
+	for rows.Next() {
+		var m models.CategoryMapping
+		var pattern sql.NullString
+		if err := rows.Scan(&m.ID, &m.FromCategory, &m.ToCategory, &pattern, &m.EffectiveFrom, &m.CreatedAt); err != nil {
+			continue
+		}
+		if pattern.Valid {
+			m.MatchPattern = &pattern.String
+		}
+		mappings = append(mappings, m)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mappings": mappings})
+}
+
+// CreateCategoryMapping records a rename or split of a category. Analytics use
+// it straight away; run the remap job to rewrite the stored transactions
+func (h *AdminHandler) CreateCategoryMapping(c *gin.Context) {
+	var req struct {
+		FromCategory  string  `json:"from_category" binding:"required"`
+		ToCategory    string  `json:"to_category" binding:"required"`
+		MatchPattern  *string `json:"match_pattern"`
+		EffectiveFrom string  `json:"effective_from" binding:"required"` // YYYY-MM-DD
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from := strings.ToUpper(strings.TrimSpace(req.FromCategory))
+	to := strings.ToUpper(strings.TrimSpace(req.ToCategory))
+	if from == to {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from_category and to_category must differ"})
+		return
+	}
+	effectiveFrom, err := time.Parse("2006-01-02", req.EffectiveFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "effective_from must be YYYY-MM-DD"})
+		return
+	}
+	if req.MatchPattern != nil && strings.TrimSpace(*req.MatchPattern) == "" {
+		req.MatchPattern = nil
+	}
+
+	// Patterns are Postgres regexes, so let Postgres validate them
+	if req.MatchPattern != nil {
+		if _, err := h.DB.Exec("SELECT '' ~* $1", *req.MatchPattern); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid match_pattern: " + err.Error()})
+			return
+		}
+	}
+
+	// A chain of mappings from to_category back to from_category would make
+	// the remap job loop
+	var cycle bool
+	err = h.DB.QueryRow(`
+		WITH RECURSIVE reachable(category) AS (
+			SELECT $1::text
+			UNION
+			SELECT m.to_category FROM category_mappings m JOIN reachable r ON m.from_category = r.category
+		)
+		SELECT EXISTS (SELECT 1 FROM reachable WHERE category = $2)
+	`, to, from).Scan(&cycle)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check category mappings"})
+		return
+	}
+	if cycle {
+		c.JSON(http.StatusConflict, gin.H{"error": "Mappings from " + to + " already lead back to " + from})
+		return
+	}
+
+	m := models.CategoryMapping{FromCategory: from, ToCategory: to, MatchPattern: req.MatchPattern, EffectiveFrom: effectiveFrom}
+	err = h.DB.QueryRow(`
+		INSERT INTO category_mappings (from_category, to_category, match_pattern, effective_from)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, from, to, req.MatchPattern, effectiveFrom).Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category mapping"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, m)
+}
+
+// RemapCategories queues the job that rewrites stored transactions to the current taxonomy
+func (h *AdminHandler) RemapCategories(c *gin.Context) {
+	jobID, err := h.Jobs.EnqueueUnique("", JobTypeCategoryRemap, gin.H{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue category remap"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Category remap queued",
+		"job_id":  jobID,
+	})
+}
+
+// CategoryRemapJob returns the job type that applies category mappings to stored transactions
+func CategoryRemapJob(db *sql.DB) services.JobType {
+	return services.JobType{
+		Name: JobTypeCategoryRemap,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			return runCategoryRemap(ctx, db)
+		},
+	}
+}
+
+// runCategoryRemap rewrites transactions in batches, keeping the category the
+// app sent in original_category. Rows are rechecked after each batch, so
+// chained renames (A to B, later B to C) end up in the final category
+func runCategoryRemap(ctx context.Context, db *sql.DB) (interface{}, error) {
+	remapped := int64(0)
+	for batch := 0; ; batch++ {
+		if batch == categoryRemapMaxBatches {
+			return nil, fmt.Errorf("stopped after %d batches (%d rows); check category_mappings for a cycle", batch, remapped)
+		}
+
+		result, err := db.ExecContext(ctx, `
+			UPDATE transactions SET
+				original_category = COALESCE(original_category, category),
+				category = `+mappedCategorySQL+`
+			WHERE id IN (
+				SELECT id FROM transactions
+				WHERE category IN (SELECT from_category FROM category_mappings)
+				AND `+mappedCategorySQL+` <> category
+				LIMIT $1
+			)
+		`, categoryRemapBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		n, _ := result.RowsAffected()
+		remapped += n
+		if n < categoryRemapBatchSize {
+			return gin.H{"remapped": remapped}, nil
+		}
+	}
+}
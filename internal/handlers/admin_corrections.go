@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// AuditTransactionCorrection is the audit log action for CorrectTransaction
+const AuditTransactionCorrection = "transaction_correction"
+
+// Corrections for the common parser mistakes
+const (
+	correctionFlipSign     = "flip_sign"     // Income filed as an expense, or the other way round
+	correctionDecimalShift = "decimal_shift" // Amount read with the decimal point in the wrong place
+)
+
+var adminAuditListing = adminListing{
+	from:    "admin_audit_log",
+	orderBy: "created_at DESC, id DESC",
+}
+
+// transactionFigures are the fields a correction can change, as recorded in the audit log
+type transactionFigures struct {
+	Type    string   `json:"type"`
+	Kind    string   `json:"kind"`
+	Amount  float64  `json:"amount"`
+	Balance *float64 `json:"balance,omitempty"`
+}
+
+// recordAudit writes an audit log entry within the transaction making the change
+func recordAudit(tx *sql.Tx, actor, action, userID, targetID, ticket string, before, after interface{}) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO admin_audit_log (actor, action, user_id, target_id, ticket, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, actor, action, userID, targetID, ticket, beforeJSON, afterJSON)
+	return err
+}
+
+// CorrectTransaction fixes a mis-parsed transaction for a user who asked for
+// it through support: flip_sign swaps INCOME and EXPENSE and rederives the
+// kind from the category, decimal_shift multiplies the amount (and with
+// shift_balance the balance) by 10^shift. The before and after values are
+// audited against the ticket, the user's cached insights are dropped and
+// their derived figures (stats, reconciliation, group matching) rebuilt
+func (h *AdminHandler) CorrectTransaction(c *gin.Context) {
+	var req struct {
+		UserID       string `json:"user_id" binding:"required,uuid"`
+		Ticket       string `json:"ticket" binding:"required,max=100"`
+		Correction   string `json:"correction" binding:"required,oneof=flip_sign decimal_shift"`
+		Shift        int    `json:"shift" binding:"min=-3,max=3"`
+		ShiftBalance bool   `json:"shift_balance"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Correction == correctionDecimalShift && req.Shift == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "shift is required for decimal_shift"})
+		return
+	}
+	transactionID := c.Param("id")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var before transactionFigures
+	var category string
+	var balance sql.NullFloat64
+	err = tx.QueryRow(`
+		SELECT type, COALESCE(kind, transaction_kind(type, category)), COALESCE(category, ''), amount, balance
+		FROM transactions WHERE id = $1 AND user_id = $2 FOR UPDATE
+	`, transactionID, req.UserID).Scan(&before.Type, &before.Kind, &category, &before.Amount, &balance)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found for this user"})
+		return
+	}
+	if balance.Valid {
+		before.Balance = &balance.Float64
+	}
+
+	after := before
+	switch req.Correction {
+	case correctionFlipSign:
+		after.Type = "INCOME"
+		if before.Type == "INCOME" {
+			after.Type = "EXPENSE"
+		}
+		after.Kind = services.TransactionKind(after.Type, category)
+	case correctionDecimalShift:
+		factor := math.Pow10(req.Shift)
+		after.Amount = math.Round(before.Amount*factor*100) / 100
+		if req.ShiftBalance && before.Balance != nil {
+			shifted := math.Round(*before.Balance*factor*100) / 100
+			after.Balance = &shifted
+		}
+	}
+	if after.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Correction would leave the amount at zero"})
+		return
+	}
+
+	_, err = tx.Exec(
+		"UPDATE transactions SET type = $1, kind = $2, amount = $3, balance = $4 WHERE id = $5",
+		after.Type, after.Kind, after.Amount, after.Balance, transactionID,
+	)
+	if err == nil {
+		err = recordAudit(tx, c.GetString("user_id"), AuditTransactionCorrection, req.UserID, transactionID, req.Ticket, before, after)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM insight_cache WHERE user_id = $1", req.UserID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Failed to correct transaction %s: %v", transactionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to correct transaction"})
+		return
+	}
+
+	// Figures built from the old amount are rebuilt in the background
+	if _, err := h.Jobs.EnqueueUnique(req.UserID, JobTypeReaggregate, reaggregateParams{UserID: req.UserID}); err != nil {
+		log.Printf("⚠️ Failed to queue re-aggregation after correcting transaction %s: %v", transactionID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transaction corrected", "before": before, "after": after})
+}
+
+// GetAuditLog lists admin changes to user data, newest first, filtered by
+// user_id and action
+func (h *AdminHandler) GetAuditLog(c *gin.Context) {
+	page := adminPagination(c)
+	f := &sqlFilter{}
+	if userID := c.Query("user_id"); userID != "" {
+		f.where("user_id = " + f.arg(userID))
+	}
+	if action := c.Query("action"); action != "" {
+		f.where("action = " + f.arg(action))
+	}
+
+	query, args := adminAuditListing.selectPage(
+		"id, actor, action, user_id, target_id, ticket, before, after, created_at", f, page)
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.AuditLogEntry{}
+	for rows.Next() {
+		var e models.AuditLogEntry
+		var userID, targetID, ticket sql.NullString
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &userID, &targetID, &ticket, &before, &after, &e.CreatedAt); err != nil {
+			continue
+		}
+		if userID.Valid {
+			e.UserID = &userID.String
+		}
+		if targetID.Valid {
+			e.TargetID = &targetID.String
+		}
+		if ticket.Valid {
+			e.Ticket = &ticket.String
+		}
+		e.Before, e.After = before, after
+		entries = append(entries, e)
+	}
+
+	var total int
+	countQuery, countArgs := adminAuditListing.count(f)
+	h.DB.QueryRow(countQuery, countArgs...).Scan(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"total":   total,
+		"page":    page.Page,
+	})
+}
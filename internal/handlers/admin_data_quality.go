@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+// maxParseFailuresPerSync caps what one sync can add to an operator's
+// parse-failure count, so a misbehaving client can't swamp the figures
+const maxParseFailuresPerSync = 1000
+
+// Conditions flagging a transaction the parser likely got wrong. The parser
+// files what it can't categorise under one of the unknownCategorySQL names,
+// and an amount over K1,000,000 is almost always a balance or reference read
+// as the amount
+const (
+	nullBalanceSQL      = "balance IS NULL"
+	unknownCategorySQL  = "UPPER(COALESCE(category, '')) IN ('', 'UNKNOWN', 'OTHER', 'UNCATEGORIZED')"
+	suspiciousAmountSQL = "(amount = 0 OR amount > 1000000)"
+)
+
+// dataQualityIssues maps the admin transaction list's issue filter onto its condition
+var dataQualityIssues = map[string]string{
+	"null_balance":      nullBalanceSQL,
+	"unknown_category":  unknownCategorySQL,
+	"suspicious_amount": suspiciousAmountSQL,
+}
+
+// dataQualityBreakdowns are the groupings the report is broken down by. The
+// expression applies to both transactions and parse_failure_counts
+var dataQualityBreakdowns = []struct {
+	name string
+	expr string
+}{
+	{name: "operator", expr: "UPPER(operator)"},
+	{name: "app_version", expr: "COALESCE(NULLIF(app_version, ''), 'unknown')"},
+}
+
+// recordParseFailures adds the SMS a client couldn't parse to today's counts.
+// It runs inside the sync transaction; the counts aren't tied to the user
+func recordParseFailures(ctx context.Context, tx *sql.Tx, appVersion string, failures map[string]int) error {
+	for operator, n := range failures {
+		operator = strings.ToUpper(strings.TrimSpace(operator))
+		if operator == "" || len(operator) > 50 || n <= 0 {
+			continue
+		}
+		if n > maxParseFailuresPerSync {
+			n = maxParseFailuresPerSync
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO parse_failure_counts (day, operator, app_version, failures)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (day, operator, app_version) DO UPDATE SET
+				failures = parse_failure_counts.failures + EXCLUDED.failures
+		`, localDate(time.Now()), operator, appVersion, n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDataQuality reports how well transactions synced in the date range were
+// parsed (date_from/date_to as YYYY-MM-DD, default the last 30 days): missing
+// balances, unknown categories, suspicious amounts (0 or over K1,000,000) and
+// client-reported parse failures, overall and by operator and app version.
+// List the flagged transactions with /admin/transactions?issue=
+func (h *AdminHandler) GetDataQuality(c *gin.Context) {
+	now := time.Now()
+	from := now.AddDate(0, 0, -30)
+	to := now
+
+	if v := c.Query("date_from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("date_to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+			return
+		}
+		to = t.AddDate(0, 0, 1) // Inclusive
+	}
+
+	overall, err := h.dataQuality("'all'", from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch data quality"})
+		return
+	}
+
+	response := gin.H{
+		"date_from": from.Format("2006-01-02"),
+		"date_to":   to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"overall":   models.DataQuality{Group: "all"},
+	}
+	if len(overall) > 0 {
+		response["overall"] = overall[0]
+	}
+	for _, b := range dataQualityBreakdowns {
+		rows, err := h.dataQuality(b.expr, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch data quality"})
+			return
+		}
+		response["by_"+b.name] = rows
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// dataQuality computes the report grouped by expr
+func (h *AdminHandler) dataQuality(expr string, from, to time.Time) ([]models.DataQuality, error) {
+	rows, err := h.DB.Query(`
+		SELECT `+expr+` AS grp, COUNT(*),
+			COUNT(*) FILTER (WHERE `+nullBalanceSQL+`),
+			COUNT(*) FILTER (WHERE `+unknownCategorySQL+`),
+			COUNT(*) FILTER (WHERE `+suspiciousAmountSQL+`)
+		FROM transactions
+		WHERE created_at >= $1 AND created_at < $2 AND source = $3
+		GROUP BY grp
+	`, from, to, models.TransactionSourceSMS)
+	if err != nil {
+		return nil, err
+	}
+
+	byGroup := make(map[string]*models.DataQuality)
+	var groups []string
+	for rows.Next() {
+		q := &models.DataQuality{}
+		if err := rows.Scan(&q.Group, &q.Transactions, &q.NullBalance, &q.UnknownCategory, &q.SuspiciousAmount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byGroup[q.Group] = q
+		groups = append(groups, q.Group)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	failures, err := h.DB.Query(`
+		SELECT `+expr+` AS grp, SUM(failures)
+		FROM parse_failure_counts
+		WHERE day >= $1 AND day < $2
+		GROUP BY grp
+	`, localDate(from), localDate(to))
+	if err != nil {
+		return nil, err
+	}
+	defer failures.Close()
+	for failures.Next() {
+		var group string
+		var n int
+		if err := failures.Scan(&group, &n); err != nil {
+			return nil, err
+		}
+		q, ok := byGroup[group]
+		if !ok {
+			q = &models.DataQuality{Group: group}
+			byGroup[group] = q
+			groups = append(groups, group)
+		}
+		q.ParseFailures = n
+	}
+	if err := failures.Err(); err != nil {
+		return nil, err
+	}
+
+	report := make([]models.DataQuality, 0, len(groups))
+	for _, group := range groups {
+		q := byGroup[group]
+		if q.Transactions > 0 {
+			n := float64(q.Transactions)
+			q.NullBalanceRate = float64(q.NullBalance) / n
+			q.UnknownCategoryRate = float64(q.UnknownCategory) / n
+			q.SuspiciousAmountRate = float64(q.SuspiciousAmount) / n
+		}
+		if attempted := q.Transactions + q.ParseFailures; attempted > 0 {
+			q.ParseFailureRate = float64(q.ParseFailures) / float64(attempted)
+		}
+		report = append(report, *q)
+	}
+
+	// Groups with the most parse problems first
+	problems := func(q models.DataQuality) float64 {
+		return q.ParseFailureRate + q.NullBalanceRate + q.UnknownCategoryRate + q.SuspiciousAmountRate
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		return problems(report[i]) > problems(report[j])
+	})
+	return report, nil
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// exportFlushEvery controls how often buffered rows are flushed to the client
+	exportFlushEvery = 500
+
+	// exportTimeout replaces the default query timeout; it matches the admin write timeout
+	exportTimeout = 5 * time.Minute
+)
+
+// Export formats, chosen with ?format=
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json" // An array of objects keyed by the CSV header
+)
+
+// ExportUsers streams users as CSV or JSON, filtered and sorted like GetUsers
+func (h *AdminHandler) ExportUsers(c *gin.Context) {
+	filter := adminUserFilters(c)
+	query, args := adminUsersListing.sortedBy(c, adminUserSorts).selectAll(`
+		u.id, u.device_id, u.operator, u.language, u.is_premium, u.consent_given,
+		u.consent_analytics, u.consent_ai, u.created_at,
+		s.last_sync, COALESCE(s.transaction_count, 0), COALESCE(s.insights_count, 0)
+	`, filter)
+
+	h.streamExport(c, "users", []string{
+		"id", "device_id", "operator", "language", "is_premium", "consent_given",
+		"consent_analytics", "consent_ai", "created_at", "last_sync", "transaction_count", "insights_count",
+	}, query, args)
+}
+
+// ExportTransactions streams transactions as CSV or JSON, filtered like GetTransactions
+func (h *AdminHandler) ExportTransactions(c *gin.Context) {
+	filter := adminTransactionFilters(c)
+	query, args := adminTransactionsListing.selectAll(
+		"id, user_id, date, type, category, amount, balance, operator, recipient, reference, description, created_at",
+		filter)
+
+	h.streamExport(c, "transactions", []string{
+		"id", "user_id", "date", "type", "category", "amount", "balance", "operator",
+		"recipient", "reference", "description", "created_at",
+	}, query, args)
+}
+
+// ExportInsights streams insights as CSV or JSON, filtered like GetInsights
+func (h *AdminHandler) ExportInsights(c *gin.Context) {
+	filter := adminInsightFilters(c)
+	query, args := adminInsightsListing.selectAll(`
+		id, user_id, generated_at, category, priority, title, message,
+		source, model, prompt_version, finish_reason, latency_ms, prompt_tokens, output_tokens
+	`, filter)
+
+	h.streamExport(c, "insights", []string{
+		"id", "user_id", "generated_at", "category", "priority", "title", "message",
+		"source", "model", "prompt_version", "finish_reason", "latency_ms", "prompt_tokens", "output_tokens",
+	}, query, args)
+}
+
+// exportWriter writes an export's rows in one format
+type exportWriter interface {
+	begin(header []string)
+	row(values []interface{})
+	flush()
+	end()
+}
+
+// streamExport runs query and writes every row in the requested format (CSV
+// unless ?format=json) without buffering the whole result. Columns are named
+// and written in header order
+func (h *AdminHandler) streamExport(c *gin.Context, name string, header []string, query string, args []interface{}) {
+	format := c.DefaultQuery("format", exportFormatCSV)
+	if format != exportFormatCSV && format != exportFormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), exportTimeout)
+	defer cancel()
+
+	rows, err := h.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export " + name})
+		return
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export " + name})
+		return
+	}
+
+	var w exportWriter
+	switch format {
+	case exportFormatJSON:
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		w = &jsonExportWriter{w: bufio.NewWriter(c.Writer), flusher: c.Writer}
+	default:
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w = &csvExportWriter{w: csv.NewWriter(c.Writer), flusher: c.Writer}
+	}
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+	w.begin(header)
+
+	values := make([]interface{}, len(header))
+	dest := make([]interface{}, len(header))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	count := 0
+	var failed error
+	for rows.Next() {
+		if failed = rows.Scan(dest...); failed != nil {
+			break
+		}
+		for i, v := range values {
+			// NUMERIC comes back as text; keep it a number without rounding it through a float
+			if b, ok := v.([]byte); ok {
+				if columnTypes[i].DatabaseTypeName() == "NUMERIC" {
+					values[i] = json.Number(b)
+				} else {
+					values[i] = string(b)
+				}
+			}
+		}
+		w.row(values)
+
+		count++
+		if count%exportFlushEvery == 0 {
+			w.flush()
+		}
+	}
+	if failed == nil {
+		failed = rows.Err()
+	}
+	if failed != nil {
+		// Headers are already sent, so the best we can do is stop and log
+		log.Printf("❌ Export of %s failed after %d rows: %v", name, count, failed)
+		w.flush()
+		return
+	}
+	w.end()
+}
+
+// csvExportWriter writes rows as CSV; NULLs become empty cells
+type csvExportWriter struct {
+	w       *csv.Writer
+	flusher http.Flusher
+	record  []string
+}
+
+func (e *csvExportWriter) begin(header []string) {
+	e.w.Write(header)
+	e.record = make([]string, len(header))
+}
+
+func (e *csvExportWriter) row(values []interface{}) {
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			e.record[i] = ""
+		case time.Time:
+			e.record[i] = v.Format(time.RFC3339Nano)
+		default:
+			e.record[i] = fmt.Sprint(v)
+		}
+	}
+	e.w.Write(e.record)
+}
+
+func (e *csvExportWriter) flush() {
+	e.w.Flush()
+	e.flusher.Flush()
+}
+
+func (e *csvExportWriter) end() {
+	e.flush()
+}
+
+// jsonExportWriter writes rows as a JSON array, one object per row, encoding
+// each row as it comes. An export cut short leaves the array unterminated,
+// so clients can't mistake it for a complete one
+type jsonExportWriter struct {
+	w       *bufio.Writer
+	flusher http.Flusher
+	header  []string
+	rows    int
+}
+
+func (e *jsonExportWriter) begin(header []string) {
+	e.header = header
+	e.w.WriteString("[")
+}
+
+func (e *jsonExportWriter) row(values []interface{}) {
+	if e.rows > 0 {
+		e.w.WriteString(",")
+	}
+	e.rows++
+
+	e.w.WriteString("\n{")
+	for i, v := range values {
+		if i > 0 {
+			e.w.WriteString(",")
+		}
+		key, _ := json.Marshal(e.header[i])
+		value, err := json.Marshal(v)
+		if err != nil {
+			value = []byte("null")
+		}
+		e.w.Write(key)
+		e.w.WriteString(":")
+		e.w.Write(value)
+	}
+	e.w.WriteString("}")
+}
+
+func (e *jsonExportWriter) flush() {
+	e.w.Flush()
+	e.flusher.Flush()
+}
+
+func (e *jsonExportWriter) end() {
+	e.w.WriteString("\n]\n")
+	e.flush()
+}
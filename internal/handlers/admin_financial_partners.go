@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+const partnerSecretPrefix = "whsec_"
+
+// GetFinancialPartners lists the financial partners users can share spend
+// summaries with, and how many users currently do
+func (h *AdminHandler) GetFinancialPartners(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT p.id, p.name, p.webhook_url, p.active, COUNT(g.id), p.created_at
+		FROM financial_partners p
+		LEFT JOIN partner_grants g ON g.partner_id = p.id AND g.revoked_at IS NULL
+		GROUP BY p.id
+		ORDER BY p.name
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch financial partners"})
+		return
+	}
+	defer rows.Close()
+
+	partners := []models.FinancialPartner{}
+	for rows.Next() {
+		var p models.FinancialPartner
+		if err := rows.Scan(&p.ID, &p.Name, &p.WebhookURL, &p.Active, &p.ActiveGrants, &p.CreatedAt); err != nil {
+			continue
+		}
+		partners = append(partners, p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"partners": partners})
+}
+
+// CreateFinancialPartner registers a partner and its webhook. The signing
+// secret deliveries are signed with is only returned here
+func (h *AdminHandler) CreateFinancialPartner(c *gin.Context) {
+	var req struct {
+		Name       string `json:"name" binding:"required,max=100"`
+		WebhookURL string `json:"webhook_url" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateHookURL(req.WebhookURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create financial partner"})
+		return
+	}
+	secret := partnerSecretPrefix + hex.EncodeToString(raw)
+
+	var id string
+	var createdAt time.Time
+	err := h.DB.QueryRow(`
+		INSERT INTO financial_partners (name, webhook_url, signing_secret)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, req.Name, req.WebhookURL, secret).Scan(&id, &createdAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create financial partner"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":             id,
+		"name":           req.Name,
+		"webhook_url":    req.WebhookURL,
+		"signing_secret": secret,
+		"created_at":     createdAt,
+	})
+}
+
+// UpdateFinancialPartner renames a partner, moves its webhook or turns it
+// on or off. An inactive partner is hidden from users and sent nothing, but
+// keeps its grants
+func (h *AdminHandler) UpdateFinancialPartner(c *gin.Context) {
+	var req struct {
+		Name       *string `json:"name" binding:"omitempty,max=100"`
+		WebhookURL *string `json:"webhook_url"`
+		Active     *bool   `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.WebhookURL != nil {
+		if err := validateHookURL(*req.WebhookURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	result, err := h.DB.Exec(`
+		UPDATE financial_partners SET
+			name = COALESCE($2, name),
+			webhook_url = COALESCE($3, webhook_url),
+			active = COALESCE($4, active),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, c.Param("id"), req.Name, req.WebhookURL, req.Active)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update financial partner"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Financial partner not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Financial partner updated"})
+}
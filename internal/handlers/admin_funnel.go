@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+// GetFunnel returns onboarding conversion for users who registered in the date range
+// (date_from/date_to as YYYY-MM-DD, default the last 30 days)
+func (h *AdminHandler) GetFunnel(c *gin.Context) {
+	now := time.Now()
+	from := now.AddDate(0, 0, -30)
+	to := now
+
+	if v := c.Query("date_from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("date_to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+			return
+		}
+		to = t.AddDate(0, 0, 1) // Inclusive
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT e.event, COUNT(*)
+		FROM funnel_events e
+		JOIN funnel_events r ON r.user_id = e.user_id AND r.event = $1
+		WHERE r.created_at >= $2 AND r.created_at < $3
+		GROUP BY e.event
+	`, models.FunnelRegistered, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch funnel"})
+		return
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var event string
+		var count int
+		if rows.Scan(&event, &count) == nil {
+			counts[event] = count
+		}
+	}
+
+	registered := counts[models.FunnelRegistered]
+	steps := make([]models.FunnelStep, len(models.FunnelSteps))
+	for i, event := range models.FunnelSteps {
+		step := models.FunnelStep{Event: event, Users: counts[event]}
+		if registered > 0 {
+			step.FromRegistered = float64(step.Users) / float64(registered)
+		}
+		if i == 0 {
+			step.FromPrevious = 1
+			if registered == 0 {
+				step.FromPrevious = 0
+			}
+		} else if previous := steps[i-1].Users; previous > 0 {
+			step.FromPrevious = float64(step.Users) / float64(previous)
+		}
+		steps[i] = step
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date_from": from.Format("2006-01-02"),
+		"date_to":   to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"steps":     steps,
+	})
+}
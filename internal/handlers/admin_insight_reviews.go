@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+// Insights sampled for review each day, and the most an admin can ask for
+const (
+	InsightReviewSampleSize = 20
+	maxInsightReviewSample  = 200
+)
+
+var adminInsightReviewsListing = adminListing{
+	from:    "insight_reviews r LEFT JOIN user_insights i ON i.id = r.insight_id",
+	orderBy: "r.sample_date DESC, r.id",
+}
+
+var adminInsightBlocksListing = adminListing{
+	from:    "insight_blocks",
+	orderBy: "created_at DESC, id DESC",
+}
+
+// SampleInsightsForReview queues a random sample of the AI insights generated
+// on day for review, topping up to size if some were sampled already. Rule
+// insights aren't sampled; they come from code, not a prompt
+func SampleInsightsForReview(ctx context.Context, db *sql.DB, day time.Time, size int) (int, error) {
+	day = localDate(day)
+	date := day.Format("2006-01-02")
+
+	var queued int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM insight_reviews WHERE sample_date = $1", date).Scan(&queued)
+	if err != nil {
+		return 0, err
+	}
+	if queued >= size {
+		return 0, nil
+	}
+
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO insight_reviews (insight_id, sample_date, source, model, prompt_version)
+		SELECT i.id, $1, i.source, i.model, i.prompt_version
+		FROM user_insights i
+		WHERE i.generated_at >= $2 AND i.generated_at < $3
+			AND i.source IN ('gemini', 'fallback')
+			AND NOT EXISTS (SELECT 1 FROM insight_reviews r WHERE r.insight_id = i.id)
+		ORDER BY random()
+		LIMIT $4
+		ON CONFLICT (insight_id) DO NOTHING
+	`, date, day, day.AddDate(0, 0, 1), size-queued)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		log.Printf("📝 Queued %d insights from %s for review", n, date)
+	}
+	return int(n), nil
+}
+
+// SampleInsightReviews queues insights from a day (yesterday by default) for
+// review, up to size (20 by default) for the day
+func (h *AdminHandler) SampleInsightReviews(c *gin.Context) {
+	var req struct {
+		Date string `json:"date"`
+		Size int    `json:"size" binding:"omitempty,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	day := time.Now().AddDate(0, 0, -1)
+	if req.Date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", req.Date, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+		day = parsed
+	}
+	if req.Size == 0 {
+		req.Size = InsightReviewSampleSize
+	}
+	if req.Size > maxInsightReviewSample {
+		req.Size = maxInsightReviewSample
+	}
+
+	queued, err := SampleInsightsForReview(c.Request.Context(), h.DB, day, req.Size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sample insights"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"queued": queued, "date": localDate(day).Format("2006-01-02")})
+}
+
+// GetInsightReviews lists sampled insights, newest day first, filtered by
+// status (pending or reviewed), prompt_version, flag and date
+func (h *AdminHandler) GetInsightReviews(c *gin.Context) {
+	page := adminPagination(c)
+	f := &sqlFilter{}
+	switch c.Query("status") {
+	case "pending":
+		f.where("r.reviewed_at IS NULL")
+	case "reviewed":
+		f.where("r.reviewed_at IS NOT NULL")
+	}
+	if v := c.Query("prompt_version"); v != "" {
+		f.where("r.prompt_version = " + f.arg(v))
+	}
+	if v := c.Query("flag"); v != "" {
+		f.where(f.arg(v) + " = ANY(r.flags)")
+	}
+	if v := c.Query("date"); v != "" {
+		day, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+		f.where("r.sample_date = " + f.arg(day.Format("2006-01-02")))
+	}
+
+	query, args := adminInsightReviewsListing.selectPage(`
+		r.id, r.insight_id, r.sample_date, COALESCE(r.source, ''), COALESCE(r.model, ''), COALESCE(r.prompt_version, ''),
+		COALESCE(i.title, ''), COALESCE(i.message, ''), COALESCE(i.category, ''),
+		r.rating, r.flags, r.notes, r.reviewed_by, r.reviewed_at`, f, page)
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch insight reviews"})
+		return
+	}
+	defer rows.Close()
+
+	reviews := []models.InsightReview{}
+	for rows.Next() {
+		var r models.InsightReview
+		var insightID, notes, reviewedBy sql.NullString
+		var sampleDate time.Time
+		var rating sql.NullInt64
+		var flags pq.StringArray
+		var reviewedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &insightID, &sampleDate, &r.Source, &r.Model, &r.PromptVersion,
+			&r.Title, &r.Message, &r.Category, &rating, &flags, &notes, &reviewedBy, &reviewedAt); err != nil {
+			continue
+		}
+		r.SampleDate = sampleDate.Format("2006-01-02")
+		r.Flags = []string(flags)
+		if insightID.Valid {
+			r.InsightID = &insightID.String
+		}
+		if rating.Valid {
+			n := int(rating.Int64)
+			r.Rating = &n
+		}
+		if notes.Valid {
+			r.Notes = &notes.String
+		}
+		if reviewedBy.Valid {
+			r.ReviewedBy = &reviewedBy.String
+		}
+		if reviewedAt.Valid {
+			r.ReviewedAt = &reviewedAt.Time
+		}
+		reviews = append(reviews, r)
+	}
+
+	var total int
+	countQuery, countArgs := adminInsightReviewsListing.count(f)
+	h.DB.QueryRow(countQuery, countArgs...).Scan(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews": reviews,
+		"total":   total,
+		"page":    page.Page,
+	})
+}
+
+// ReviewInsight rates a sampled insight from 1 to 5 and flags it unsafe or
+// incorrect. A second review replaces the first
+func (h *AdminHandler) ReviewInsight(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return
+	}
+
+	var req struct {
+		Rating int      `json:"rating" binding:"required,min=1,max=5"`
+		Flags  []string `json:"flags" binding:"max=2,dive,oneof=unsafe incorrect"`
+		Notes  *string  `json:"notes" binding:"omitempty,max=2000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Flags == nil {
+		req.Flags = []string{}
+	}
+
+	result, err := h.DB.Exec(`
+		UPDATE insight_reviews
+		SET rating = $1, flags = $2, notes = $3, reviewed_by = $4, reviewed_at = NOW()
+		WHERE id = $5
+	`, req.Rating, pq.Array(req.Flags), req.Notes, c.GetString("user_id"), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save review"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Insight review not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review saved"})
+}
+
+// GetInsightReviewSummary aggregates the ratings per prompt version, newest
+// version first, optionally over sample dates date_from to date_to
+func (h *AdminHandler) GetInsightReviewSummary(c *gin.Context) {
+	f := &sqlFilter{}
+	for _, bound := range []struct{ param, op string }{{"date_from", ">="}, {"date_to", "<="}} {
+		if v := c.Query(bound.param); v != "" {
+			day, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + " must be YYYY-MM-DD"})
+				return
+			}
+			f.where("sample_date " + bound.op + " " + f.arg(day.Format("2006-01-02")))
+		}
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT COALESCE(prompt_version, 'unknown'), COUNT(*), COUNT(reviewed_at), AVG(rating),
+			COUNT(*) FILTER (WHERE 'unsafe' = ANY(flags)),
+			COUNT(*) FILTER (WHERE 'incorrect' = ANY(flags)),
+			COUNT(*) FILTER (WHERE reviewed_at IS NOT NULL AND cardinality(flags) > 0)
+		FROM insight_reviews`+f.sql()+`
+		GROUP BY 1
+		ORDER BY MAX(sample_date) DESC, 1 DESC
+	`, f.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch review summary"})
+		return
+	}
+	defer rows.Close()
+
+	versions := []models.PromptQuality{}
+	for rows.Next() {
+		var q models.PromptQuality
+		var average sql.NullFloat64
+		var flagged int
+		if err := rows.Scan(&q.PromptVersion, &q.Sampled, &q.Reviewed, &average, &q.Unsafe, &q.Incorrect, &flagged); err != nil {
+			continue
+		}
+		if average.Valid {
+			q.AverageRating = &average.Float64
+		}
+		if q.Reviewed > 0 {
+			q.FlaggedRate = float64(flagged) / float64(q.Reviewed)
+		}
+		versions = append(versions, q)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"prompt_versions": versions})
+}
+
+// GetInsightBlocks lists the insights the advice guard kept from users, newest
+// first, filtered by reason, blocked_by and prompt_version
+func (h *AdminHandler) GetInsightBlocks(c *gin.Context) {
+	page := adminPagination(c)
+	f := &sqlFilter{}
+	for _, column := range []string{"reason", "blocked_by", "prompt_version"} {
+		if v := c.Query(column); v != "" {
+			f.where(column + " = " + f.arg(v))
+		}
+	}
+
+	query, args := adminInsightBlocksListing.selectPage(`
+		id, user_id, title, message, reason, blocked_by, COALESCE(model, ''), COALESCE(prompt_version, ''),
+		ai_call_id, created_at`, f, page)
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocked insights"})
+		return
+	}
+	defer rows.Close()
+
+	blocks := []models.InsightBlock{}
+	for rows.Next() {
+		var b models.InsightBlock
+		var userID, callID sql.NullString
+		if err := rows.Scan(&b.ID, &userID, &b.Title, &b.Message, &b.Reason, &b.BlockedBy, &b.Model,
+			&b.PromptVersion, &callID, &b.CreatedAt); err != nil {
+			continue
+		}
+		if userID.Valid {
+			b.UserID = &userID.String
+		}
+		if callID.Valid {
+			b.AICallID = &callID.String
+		}
+		blocks = append(blocks, b)
+	}
+
+	var total int
+	countQuery, countArgs := adminInsightBlocksListing.count(f)
+	h.DB.QueryRow(countQuery, countArgs...).Scan(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"blocks": blocks,
+		"total":  total,
+		"page":   page.Page,
+	})
+}
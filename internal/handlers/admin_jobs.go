@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// GetScheduledJobs lists the scheduled jobs with their last and next run
+func (h *AdminHandler) GetScheduledJobs(c *gin.Context) {
+	jobs, err := h.Scheduler.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// PauseScheduledJob stops a job from running on schedule until it is resumed
+func (h *AdminHandler) PauseScheduledJob(c *gin.Context) {
+	h.updateScheduledJob(c, h.Scheduler.Pause, http.StatusOK)
+}
+
+// ResumeScheduledJob puts a paused job back on its schedule
+func (h *AdminHandler) ResumeScheduledJob(c *gin.Context) {
+	h.updateScheduledJob(c, h.Scheduler.Resume, http.StatusOK)
+}
+
+// RunScheduledJob runs a job now instead of waiting for its next run. The
+// leader instance picks the request up within a few seconds
+func (h *AdminHandler) RunScheduledJob(c *gin.Context) {
+	h.updateScheduledJob(c, h.Scheduler.RunNow, http.StatusAccepted)
+}
+
+// updateScheduledJob applies a change to the job named in the path and responds with its status
+func (h *AdminHandler) updateScheduledJob(c *gin.Context, update func(name string) error, status int) {
+	name := c.Param("name")
+
+	err := update(name)
+	if errors.Is(err, services.ErrUnknownScheduledJob) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled job"})
+		return
+	}
+
+	job, err := h.Scheduler.Status(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled job"})
+		return
+	}
+
+	c.JSON(status, job)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+// adminListing is one filterable admin table. The page, total count and CSV
+// export are all built from the same source and filters, so the total always
+// matches what paging through the list would return
+type adminListing struct {
+	from    string // Tables and joins, aliased as the filter builders expect
+	orderBy string
+}
+
+var (
+	adminUsersListing = adminListing{
+		from:    "users u LEFT JOIN user_stats s ON s.user_id = u.id",
+		orderBy: "u.created_at DESC",
+	}
+	// Orders for ?sort= on the user list and export. Ties fall back to the
+	// newest user first so pages don't shift
+	adminUserSorts = map[string]string{
+		"created_at":        "u.created_at DESC",
+		"last_sync":         "s.last_sync DESC NULLS LAST, u.created_at DESC",
+		"transaction_count": "COALESCE(s.transaction_count, 0) DESC, u.created_at DESC",
+	}
+	adminInsightsListing = adminListing{
+		from:    "user_insights",
+		orderBy: "generated_at DESC",
+	}
+	adminTransactionsListing = adminListing{
+		from:    "transactions",
+		orderBy: "date DESC",
+	}
+)
+
+// sortedBy returns the listing ordered by one of sorts, chosen with ?sort=,
+// or in its default order when sort is missing or unknown
+func (l adminListing) sortedBy(c *gin.Context, sorts map[string]string) adminListing {
+	if orderBy, ok := sorts[c.Query("sort")]; ok {
+		l.orderBy = orderBy
+	}
+	return l
+}
+
+// adminPage is the requested page of a listing
+type adminPage struct {
+	Page  int
+	Limit int
+}
+
+// adminPagination reads page and limit, falling back to the first page of the default size
+func adminPagination(c *gin.Context) adminPage {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAdminPageSize)))
+	if err != nil || limit < 1 {
+		limit = defaultAdminPageSize
+	}
+	if limit > maxAdminPageSize {
+		limit = maxAdminPageSize
+	}
+	return adminPage{Page: page, Limit: limit}
+}
+
+// selectAll returns the query for every matching row, for exports
+func (l adminListing) selectAll(columns string, f *sqlFilter) (string, []interface{}) {
+	return fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s", columns, l.from, f.sql(), l.orderBy), f.args
+}
+
+// selectPage returns the query for one page of matching rows
+func (l adminListing) selectPage(columns string, f *sqlFilter, p adminPage) (string, []interface{}) {
+	f = f.clone()
+	query, _ := l.selectAll(columns, f)
+	query += fmt.Sprintf(" LIMIT %s OFFSET %s", f.arg(p.Limit), f.arg((p.Page-1)*p.Limit))
+	return query, f.args
+}
+
+// count returns the query for the number of matching rows
+func (l adminListing) count(f *sqlFilter) (string, []interface{}) {
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s%s", l.from, f.sql()), f.args
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+	"github.com/lib/pq"
+)
+
+// MarketMinUsers is the k-anonymity threshold: no aggregate covering fewer
+// distinct users than this is ever returned
+const MarketMinUsers = 10
+
+// marketFeeCategories are the categories operators' transaction charges are filed under
+var marketFeeCategories = []string{"FEES", "FEE", "CHARGES"}
+
+// marketConsentFilter limits market analytics to users who opted into analytics
+const marketConsentFilter = `
+	JOIN users u ON u.id = t.user_id
+	WHERE u.consent_given = TRUE AND u.consent_analytics = TRUE
+	AND t.date >= $1 AND t.date < $2
+`
+
+// marketRange reads date_from/date_to (YYYY-MM-DD) and interval (week or month)
+func marketRange(c *gin.Context) (from, to time.Time, interval string, ok bool) {
+	now := time.Now()
+	from = now.AddDate(0, -6, 0)
+	to = now
+
+	if v := c.Query("date_from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+			return from, to, "", false
+		}
+		from = t
+	}
+	if v := c.Query("date_to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+			return from, to, "", false
+		}
+		to = t.AddDate(0, 0, 1) // Inclusive
+	}
+
+	interval = c.DefaultQuery("interval", "month")
+	if interval != "week" && interval != "month" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be week or month"})
+		return from, to, "", false
+	}
+
+	return from, to, interval, true
+}
+
+// marketResponse wraps segments with the suppression details clients need to read them
+func marketResponse(segments []models.MarketSegment, suppressed int, interval string) gin.H {
+	return gin.H{
+		"segments":   segments,
+		"suppressed": suppressed,
+		"min_users":  MarketMinUsers,
+		"interval":   interval,
+	}
+}
+
+// GetMarketShare returns each operator's share of tracked spend per period
+func (h *AdminHandler) GetMarketShare(c *gin.Context) {
+	h.serveMarket(c, marketShare, "Failed to fetch market share")
+}
+
+// GetMarketCategories returns spend volume by operator and category per period
+func (h *AdminHandler) GetMarketCategories(c *gin.Context) {
+	h.serveMarket(c, marketCategories, "Failed to fetch market categories")
+}
+
+// GetMarketFees returns average transaction fees by operator per period
+func (h *AdminHandler) GetMarketFees(c *gin.Context) {
+	h.serveMarket(c, marketFees, "Failed to fetch market fees")
+}
+
+// serveMarket returns exact segments; admins are inside the company, so
+// only the cohort threshold applies
+func (h *AdminHandler) serveMarket(c *gin.Context, spec marketSpec, failure string) {
+	from, to, interval, ok := marketRange(c)
+	if !ok {
+		return
+	}
+
+	segments, suppressed, err := queryMarket(h.DB, spec, from, to, interval, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return
+	}
+
+	c.JSON(http.StatusOK, marketResponse(segments, suppressed, interval))
+}
+
+// marketSpec is one market aggregate: the transactions it covers, whether
+// it splits operators by category and the figures derived from its totals
+type marketSpec struct {
+	name     string
+	category bool
+	filter   func(f *sqlFilter) // Adds extra conditions on t
+	derive   func([]models.MarketSegment)
+}
+
+var (
+	// Shares are computed over every segment, suppressed or not, so
+	// suppression doesn't inflate the operators that remain visible
+	marketShare = marketSpec{
+		name: "share",
+		derive: func(segments []models.MarketSegment) {
+			totals := make(map[string]float64)
+			for _, s := range segments {
+				totals[s.Period] += s.Volume
+			}
+			for i := range segments {
+				if total := totals[segments[i].Period]; total > 0 {
+					share := segments[i].Volume / total
+					segments[i].Share = &share
+				}
+			}
+		},
+	}
+
+	marketCategories = marketSpec{name: "categories", category: true}
+
+	marketFees = marketSpec{
+		name: "fees",
+		filter: func(f *sqlFilter) {
+			f.where("UPPER(" + mappedCategorySQL + ") = ANY(" + f.arg(pq.Array(marketFeeCategories)) + ")")
+		},
+		derive: func(segments []models.MarketSegment) {
+			for i := range segments {
+				if segments[i].Transactions > 0 {
+					averageFee := segments[i].Volume / float64(segments[i].Transactions)
+					segments[i].AverageFee = &averageFee
+				}
+			}
+		},
+	}
+)
+
+// queryMarket is the only way market segments leave the database. It
+// computes spec's segments per period and drops those covering fewer than
+// MarketMinUsers users, returning how many were dropped. With a privacy
+// policy each user's contribution to a segment is clamped and every figure
+// is noised before the threshold and derived figures are applied, so
+// neither works from exact counts
+func queryMarket(db *sql.DB, spec marketSpec, from, to time.Time, interval string, privacy *services.PrivacyPolicy) ([]models.MarketSegment, int, error) {
+	category := "''"
+	if spec.category {
+		category = mappedCategorySQL
+	}
+	var maxTransactions *int
+	var maxVolume *float64
+	if privacy != nil {
+		maxTransactions, maxVolume = &privacy.MaxTransactions, &privacy.MaxVolume
+	}
+
+	// LEAST ignores NULLs, so without a policy nothing is clamped. The query
+	// numbers these $1-$5 itself; spec's conditions bind after them
+	f := &sqlFilter{args: []interface{}{from, to, interval, maxTransactions, maxVolume}}
+	if spec.filter != nil {
+		spec.filter(f)
+	}
+	rows, err := db.Query(`
+		WITH per_user AS (
+			SELECT to_char(date_trunc($3, t.date), 'YYYY-MM-DD') AS period, UPPER(t.operator) AS operator,
+				`+category+` AS category, t.user_id,
+				LEAST(COUNT(*), $4::int) AS transactions, LEAST(SUM(t.amount), $5::numeric) AS volume
+			FROM transactions t`+marketConsentFilter+`
+			AND t.type = 'EXPENSE'`+f.and()+`
+			GROUP BY 1, 2, 3, 4
+		)
+		SELECT period, operator, category, COUNT(*), SUM(transactions), SUM(volume)
+		FROM per_user
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 6 DESC
+	`, f.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	all := []models.MarketSegment{}
+	for rows.Next() {
+		var s models.MarketSegment
+		if err := rows.Scan(&s.Period, &s.Operator, &s.Category, &s.Users, &s.Transactions, &s.Volume); err != nil {
+			return nil, 0, err
+		}
+		if privacy != nil {
+			id := []string{"market", spec.name, s.Period, s.Operator, s.Category}
+			s.Users = privacy.Count(s.Users, 1, append(id, "users")...)
+			s.Transactions = privacy.Count(s.Transactions, float64(privacy.MaxTransactions), append(id, "transactions")...)
+			s.Volume = privacy.Amount(s.Volume, privacy.MaxVolume, append(id, "volume")...)
+		}
+		all = append(all, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if spec.derive != nil {
+		spec.derive(all)
+	}
+
+	segments := []models.MarketSegment{}
+	for _, s := range all {
+		if s.Users >= MarketMinUsers {
+			segments = append(segments, s)
+		}
+	}
+	return segments, len(all) - len(segments), nil
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
+)
+
+// Transactions dated in the last 30 days that put a user in each volume band
+const (
+	meterRegularVolume = 100
+	meterHeavyVolume   = 500
+)
+
+// meterUnattributed is the segment for Gemini usage made for no user
+const meterUnattributed = "unattributed"
+
+// MeterCosts snapshots the day before now: per segment (free or premium, by
+// transaction volume) the users, the rows they store, the Gemini tokens and
+// spend made for them and the pushes they were sent. Rerunning a day replaces it
+func MeterCosts(ctx context.Context, db *sql.DB, now time.Time) error {
+	to := localDate(now)
+	from := to.AddDate(0, 0, -1)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM cost_meter WHERE day = $1", from); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO cost_meter (day, segment, users, rows_stored, ai_prompt_tokens, ai_output_tokens, ai_cost_usd, pushes)
+		SELECT $1,
+			CASE WHEN COALESCE(u.is_premium, FALSE) THEN 'premium' ELSE 'free' END || '_' ||
+			CASE
+				WHEN COALESCE(v.n, 0) >= $4 THEN 'heavy'
+				WHEN COALESCE(v.n, 0) >= $3 THEN 'regular'
+				WHEN COALESCE(v.n, 0) > 0 THEN 'light'
+				ELSE 'inactive'
+			END,
+			COUNT(*),
+			SUM(COALESCE(s.transaction_count, 0) + COALESCE(s.insights_count, 0) + COALESCE(d.n, 0)),
+			SUM(COALESCE(a.prompt_tokens, 0)), SUM(COALESCE(a.output_tokens, 0)), SUM(COALESCE(a.cost_usd, 0)),
+			SUM(COALESCE(p.n, 0))
+		FROM users u
+		LEFT JOIN (
+			SELECT user_id, COUNT(*) AS n FROM transactions
+			WHERE date >= $6 AND date < $2
+			GROUP BY user_id
+		) v ON v.user_id = u.id
+		LEFT JOIN user_stats s ON s.user_id = u.id
+		LEFT JOIN (
+			SELECT user_id, COUNT(*) AS n FROM daily_aggregates GROUP BY user_id
+		) d ON d.user_id = u.id
+		LEFT JOIN (
+			SELECT user_id, SUM(prompt_tokens) AS prompt_tokens, SUM(output_tokens) AS output_tokens, SUM(cost_usd) AS cost_usd
+			FROM ai_usage
+			WHERE created_at >= $1 AND created_at < $2 AND user_id IS NOT NULL
+			GROUP BY user_id
+		) a ON a.user_id = u.id
+		LEFT JOIN (
+			SELECT user_id, COUNT(*) AS n FROM notifications
+			WHERE created_at >= $1 AND created_at < $2 AND delivery = $5
+			GROUP BY user_id
+		) p ON p.user_id = u.id
+		WHERE u.created_at < $2
+		GROUP BY 2
+	`, from, to, meterRegularVolume, meterHeavyVolume, notifications.DeliveryPush, to.AddDate(0, 0, -30))
+	if err != nil {
+		return err
+	}
+	segments, _ := result.RowsAffected()
+
+	// Gemini usage with no user to charge, such as that of deleted accounts
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO cost_meter (day, segment, users, rows_stored, ai_prompt_tokens, ai_output_tokens, ai_cost_usd, pushes)
+		SELECT $1, $3, 0, 0, SUM(prompt_tokens), SUM(output_tokens), SUM(cost_usd), 0
+		FROM ai_usage
+		WHERE created_at >= $1 AND created_at < $2 AND user_id IS NULL
+		HAVING COUNT(*) > 0
+	`, from, to, meterUnattributed)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("📊 Metered costs for %s across %d segments", from.Format("2006-01-02"), segments)
+	return nil
+}
+
+// GetCostMetering reports what each user segment costs to serve between
+// date_from and date_to (default the last 30 days), from the daily cost
+// snapshots, with per-user figures to set free-tier limits and pricing against
+func (h *AdminHandler) GetCostMetering(c *gin.Context) {
+	to := localDate(time.Now())
+	from := to.AddDate(0, 0, -30)
+
+	if v := c.Query("date_from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("date_to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+			return
+		}
+		to = t.AddDate(0, 0, 1) // Inclusive
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT segment,
+			(array_agg(users ORDER BY day DESC))[1], (array_agg(rows_stored ORDER BY day DESC))[1],
+			SUM(users), SUM(ai_prompt_tokens), SUM(ai_output_tokens), SUM(ai_cost_usd), SUM(pushes)
+		FROM cost_meter
+		WHERE day >= $1 AND day < $2
+		GROUP BY segment
+		ORDER BY SUM(ai_cost_usd) DESC, segment
+	`, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cost metering"})
+		return
+	}
+	defer rows.Close()
+
+	segments := []models.CostSegment{}
+	for rows.Next() {
+		var s models.CostSegment
+		var userDays int64
+		if err := rows.Scan(&s.Segment, &s.Users, &s.RowsStored, &userDays,
+			&s.AIPromptTokens, &s.AIOutputTokens, &s.AICostUSD, &s.Pushes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cost metering"})
+			return
+		}
+		if s.Users > 0 {
+			s.RowsPerUser = float64(s.RowsStored) / float64(s.Users)
+		}
+		if userDays > 0 {
+			s.AITokensPerUserDay = float64(s.AIPromptTokens+s.AIOutputTokens) / float64(userDays)
+			s.AICostPerUserMonthUSD = s.AICostUSD / float64(userDays) * 30
+			s.PushesPerUserDay = float64(s.Pushes) / float64(userDays)
+		}
+		segments = append(segments, s)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cost metering"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date_from": from.Format("2006-01-02"),
+		"date_to":   to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"segments":  segments,
+	})
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/middleware"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+const partnerKeyPrefix = "ktp_"
+
+// GetPartnerPlans lists the partner API plans
+func (h *AdminHandler) GetPartnerPlans(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT p.name, p.requests_per_day, p.fields, p.updated_at,
+			COUNT(k.id) FILTER (WHERE k.revoked_at IS NULL)
+		FROM partner_plans p
+		LEFT JOIN partner_keys k ON k.plan = p.name
+		GROUP BY p.name
+		ORDER BY p.requests_per_day
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch partner plans"})
+		return
+	}
+	defer rows.Close()
+
+	plans := []models.PartnerPlan{}
+	for rows.Next() {
+		var p models.PartnerPlan
+		var fields pq.StringArray
+		if err := rows.Scan(&p.Name, &p.RequestsPerDay, &fields, &p.UpdatedAt, &p.Keys); err != nil {
+			continue
+		}
+		p.Fields = fields
+		plans = append(plans, p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plans": plans, "available_fields": PartnerFields})
+}
+
+// UpdatePartnerPlan creates or changes the plan named in the path. Keys on
+// the plan pick the change up on their next request
+func (h *AdminHandler) UpdatePartnerPlan(c *gin.Context) {
+	name := c.Param("name")
+
+	var req struct {
+		RequestsPerDay int      `json:"requests_per_day" binding:"required,gt=0"`
+		Fields         []string `json:"fields" binding:"required,dive,oneof=users transactions volume share average_fee"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(name) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Plan name is too long"})
+		return
+	}
+
+	_, err := h.DB.Exec(`
+		INSERT INTO partner_plans (name, requests_per_day, fields)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET
+			requests_per_day = EXCLUDED.requests_per_day,
+			fields = EXCLUDED.fields,
+			updated_at = CURRENT_TIMESTAMP
+	`, name, req.RequestsPerDay, pq.Array(req.Fields))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save partner plan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":             name,
+		"requests_per_day": req.RequestsPerDay,
+		"fields":           req.Fields,
+	})
+}
+
+// GetPartnerKeys lists partner API keys with today's request count
+func (h *AdminHandler) GetPartnerKeys(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT k.id, k.name, k.plan, k.key_prefix, COALESCE(u.requests, 0),
+			k.last_used_at, k.revoked_at, k.created_at
+		FROM partner_keys k
+		LEFT JOIN partner_usage u ON u.key_id = k.id AND u.day = $1
+		ORDER BY k.revoked_at IS NOT NULL, k.created_at
+	`, time.Now().UTC().Format("2006-01-02"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch partner keys"})
+		return
+	}
+	defer rows.Close()
+
+	keys := []models.PartnerKey{}
+	for rows.Next() {
+		var k models.PartnerKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.Plan, &k.KeyPrefix, &k.RequestsToday,
+			&k.LastUsedAt, &k.RevokedAt, &k.CreatedAt); err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// CreatePartnerKey issues a partner API key on a plan. The key is only returned here
+func (h *AdminHandler) CreatePartnerKey(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required,max=100"`
+		Plan string `json:"plan" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create partner key"})
+		return
+	}
+	key := partnerKeyPrefix + hex.EncodeToString(secret)
+	prefix := key[:len(partnerKeyPrefix)+integrationKeyShownChars]
+
+	var id string
+	var createdAt time.Time
+	err := h.DB.QueryRow(`
+		INSERT INTO partner_keys (name, plan, key_hash, key_prefix)
+		SELECT $1, name, $3, $4 FROM partner_plans WHERE name = $2
+		RETURNING id, created_at
+	`, req.Name, req.Plan, middleware.HashIntegrationKey(key), prefix).Scan(&id, &createdAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown plan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create partner key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         id,
+		"name":       req.Name,
+		"plan":       req.Plan,
+		"key":        key,
+		"key_prefix": prefix,
+		"created_at": createdAt,
+	})
+}
+
+// UpdatePartnerKey moves a partner key to another plan
+func (h *AdminHandler) UpdatePartnerKey(c *gin.Context) {
+	var req struct {
+		Plan string `json:"plan" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exists bool
+	h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM partner_plans WHERE name = $1)", req.Plan).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown plan"})
+		return
+	}
+
+	result, err := h.DB.Exec("UPDATE partner_keys SET plan = $1 WHERE id = $2", req.Plan, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update partner key"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Partner key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Partner key updated", "plan": req.Plan})
+}
+
+// RevokePartnerKey stops a partner key working. Its usage is kept for billing
+func (h *AdminHandler) RevokePartnerKey(c *gin.Context) {
+	result, err := h.DB.Exec(
+		"UPDATE partner_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL",
+		c.Param("id"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke partner key"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Partner key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Partner key revoked"})
+}
+
+// GetPartnerUsage returns partner API consumption per key per day, with
+// totals per key, for date_from/date_to (YYYY-MM-DD, default the last 30 days)
+// and optionally one key_id
+func (h *AdminHandler) GetPartnerUsage(c *gin.Context) {
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -partnerUsageDays)
+	if v := c.Query("date_from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("date_to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+			return
+		}
+		to = t
+	}
+
+	usage, err := loadPartnerUsage(h.DB, c.Query("key_id"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch partner usage"})
+		return
+	}
+
+	type keyTotal struct {
+		KeyID    string `json:"key_id"`
+		Partner  string `json:"partner"`
+		Plan     string `json:"plan"`
+		Requests int    `json:"requests"`
+		Served   int    `json:"served"`
+		Rejected int    `json:"rejected"`
+	}
+	totals := []*keyTotal{}
+	byKey := make(map[string]*keyTotal)
+	for _, u := range usage {
+		t, ok := byKey[u.KeyID.String()]
+		if !ok {
+			t = &keyTotal{KeyID: u.KeyID.String(), Partner: u.Partner, Plan: u.Plan}
+			byKey[t.KeyID] = t
+			totals = append(totals, t)
+		}
+		t.Requests += u.Requests
+		t.Served += u.Served
+		t.Rejected += u.Rejected
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date_from": from.Format("2006-01-02"),
+		"date_to":   to.Format("2006-01-02"),
+		"totals":    totals,
+		"usage":     usage,
+	})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+const (
+	// reportMaxDays is the longest date range a report may cover
+	reportMaxDays = 366
+
+	// reportDefaultLimit is how many rows a report returns unless it sets a limit
+	reportDefaultLimit = 100
+
+	// reportTimeout replaces the default query timeout; reports scan a lot of rows
+	reportTimeout = 30 * time.Second
+)
+
+// reportSource is every user's spending, whatever their sync mode, with
+// categories mapped and operators normalized. Daily totals carry no operator
+const reportSource = `(
+	SELECT user_id, date, type, kind, ` + mappedCategorySQL + ` AS category, UPPER(operator) AS operator, amount, entries
+	FROM ` + transactionSource + `
+	UNION ALL
+	SELECT user_id, date, type, kind, ` + mappedCategorySQL + `, operator, amount, entries
+	FROM ` + aggregateSource + `
+) r`
+
+// reportDimensions are the columns a report can group by; date buckets are
+// rendered as the bucket's first day
+var reportDimensions = map[string]string{
+	"operator": "COALESCE(r.operator, '')",
+	"category": "r.category",
+	"type":     "r.type",
+	"kind":     "r.kind",
+	"day":      "to_char(date_trunc('day', r.date), 'YYYY-MM-DD')",
+	"week":     "to_char(date_trunc('week', r.date), 'YYYY-MM-DD')",
+	"month":    "to_char(date_trunc('month', r.date), 'YYYY-MM-DD')",
+}
+
+// reportDateBuckets are the dimensions that bucket by date; a report uses at most one
+var reportDateBuckets = map[string]bool{"day": true, "week": true, "month": true}
+
+// QueryReport answers a reporting question without database access: the
+// admin picks dimensions (operator, category, type, kind and a day, week or
+// month bucket) and measures (sum, count, distinct_users) over a date range of at
+// most a year. Only whitelisted SQL is ever run, and groups covering fewer
+// than MarketMinUsers users are suppressed
+func (h *AdminHandler) QueryReport(c *gin.Context) {
+	var req models.ReportQuery
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, err := time.Parse("2006-01-02", req.DateFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+		return
+	}
+	to, err := time.Parse("2006-01-02", req.DateTo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+		return
+	}
+	to = to.AddDate(0, 0, 1) // Inclusive
+	if !to.After(from) || to.Sub(from) > reportMaxDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date range must run forwards and cover at most " + strconv.Itoa(reportMaxDays) + " days"})
+		return
+	}
+
+	seen := make(map[string]bool, len(req.Dimensions))
+	buckets := 0
+	for _, d := range req.Dimensions {
+		if seen[d] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dimension " + d + " is repeated"})
+			return
+		}
+		seen[d] = true
+		if reportDateBuckets[d] {
+			buckets++
+		}
+	}
+	if buckets > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only one of day, week and month can be used"})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = reportDefaultLimit
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), reportTimeout)
+	defer cancel()
+
+	rows, suppressed, truncated, err := runReport(ctx, h.DB, req, from, to)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Report took too long; narrow the date range or dimensions"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rows":       rows,
+		"suppressed": suppressed,
+		"truncated":  truncated,
+		"min_users":  MarketMinUsers,
+	})
+}
+
+// runReport builds the report's query from the whitelists, ordered by its
+// dimensions, and returns up to req.Limit groups with how many were
+// suppressed under the cohort threshold and whether more were left out
+func runReport(ctx context.Context, db *sql.DB, req models.ReportQuery, from, to time.Time) ([]models.ReportRow, int, bool, error) {
+	f := &sqlFilter{}
+	f.where("r.date >= " + f.arg(from))
+	f.where("r.date < " + f.arg(to))
+	if req.Type != "" {
+		f.where("r.type = " + f.arg(req.Type))
+	}
+	if req.Kind != "" {
+		f.where("r.kind = " + f.arg(strings.ToUpper(req.Kind)))
+	}
+	if req.Operator != "" {
+		f.where("r.operator = " + f.arg(strings.ToUpper(req.Operator)))
+	}
+	if req.Category != "" {
+		f.where("UPPER(r.category) = " + f.arg(strings.ToUpper(req.Category)))
+	}
+
+	columns := make([]string, len(req.Dimensions))
+	groupBy := make([]string, len(req.Dimensions))
+	for i, d := range req.Dimensions {
+		columns[i] = reportDimensions[d]
+		groupBy[i] = strconv.Itoa(i + 1)
+	}
+	query := "SELECT " + strings.Join(append(columns, "COALESCE(SUM(r.amount), 0)", "COALESCE(SUM(r.entries), 0)", "COUNT(DISTINCT r.user_id)"), ", ") +
+		" FROM " + reportSource + f.sql()
+	if len(groupBy) > 0 {
+		query += " GROUP BY " + strings.Join(groupBy, ", ") + " ORDER BY " + strings.Join(groupBy, ", ")
+	}
+
+	rows, err := db.QueryContext(ctx, query, f.args...)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer rows.Close()
+
+	measures := make(map[string]bool, len(req.Measures))
+	for _, m := range req.Measures {
+		measures[m] = true
+	}
+
+	report := []models.ReportRow{}
+	suppressed, truncated := 0, false
+	dims := make([]sql.NullString, len(req.Dimensions))
+	var sum float64
+	var count, users int
+	dest := make([]interface{}, 0, len(dims)+3)
+	for i := range dims {
+		dest = append(dest, &dims[i])
+	}
+	dest = append(dest, &sum, &count, &users)
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, false, err
+		}
+		if users < MarketMinUsers {
+			suppressed++
+			continue
+		}
+		if len(report) == req.Limit {
+			truncated = true
+			continue
+		}
+
+		var row models.ReportRow
+		for i, d := range req.Dimensions {
+			value := dims[i].String
+			switch d {
+			case "operator":
+				row.Operator = &value
+			case "category":
+				row.Category = &value
+			case "type":
+				row.Type = &value
+			case "kind":
+				row.Kind = &value
+			default:
+				row.Period = &value
+			}
+		}
+		if measures["sum"] {
+			v := sum
+			row.Sum = &v
+		}
+		if measures["count"] {
+			v := count
+			row.Count = &v
+		}
+		if measures["distinct_users"] {
+			v := users
+			row.DistinctUsers = &v
+		}
+		report = append(report, row)
+	}
+	return report, suppressed, truncated, rows.Err()
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// settingAIBudget is the settings history key for AI budget control changes
+const settingAIBudget = "ai_budget"
+
+// aiBudgetControls is the part of the AI budget status an admin sets
+func aiBudgetControls(status *services.AIBudgetStatus) gin.H {
+	return gin.H{
+		"kill_switch":        status.KillSwitch,
+		"override_until":     status.OverrideUntil,
+		"daily_budget_usd":   status.DailyBudget,
+		"monthly_budget_usd": status.MonthlyBudget,
+	}
+}
+
+// updateAIBudget applies AI budget controls and records the change in the
+// settings history, returning the new status
+func (h *AdminHandler) updateAIBudget(ctx context.Context, update services.AIBudgetUpdate, actor string) (*services.AIBudgetStatus, error) {
+	before, err := h.AIUsage.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.AIUsage.UpdateControls(ctx, update); err != nil {
+		return nil, err
+	}
+	after, err := h.AIUsage.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Settings.RecordChange(ctx, settingAIBudget, aiBudgetControls(before), aiBudgetControls(after), actor); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// GetSettings returns the runtime settings and the AI budget controls
+func (h *AdminHandler) GetSettings(c *gin.Context) {
+	budget, err := h.AIUsage.Status(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch AI budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings":  h.Settings.List(),
+		"ai_budget": budget,
+	})
+}
+
+// UpdateSettings changes runtime settings and the AI budget controls. They
+// apply on this instance at once and on the others within half a minute
+func (h *AdminHandler) UpdateSettings(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Settings map[string]json.RawMessage `json:"settings"`
+		AIBudget *services.AIBudgetUpdate   `json:"ai_budget"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	actor := c.GetString("user_id")
+
+	if len(req.Settings) > 0 {
+		if err := h.Settings.Update(ctx, req.Settings, actor); err != nil {
+			if errors.Is(err, services.ErrInvalidSetting) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+			return
+		}
+	}
+
+	var budget *services.AIBudgetStatus
+	var err error
+	if req.AIBudget != nil {
+		budget, err = h.updateAIBudget(ctx, *req.AIBudget, actor)
+	} else {
+		budget, err = h.AIUsage.Status(ctx)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update AI budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings":  h.Settings.List(),
+		"ai_budget": budget,
+	})
+}
+
+// GetSettingsHistory returns the latest setting changes, newest first,
+// optionally for one ?key=
+func (h *AdminHandler) GetSettingsHistory(c *gin.Context) {
+	changes, err := h.Settings.History(c.Request.Context(), c.Query("key"), adminPagination(c).Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+// smsTemplateSamples is how many recent redacted reports a template's review shows
+const smsTemplateSamples = 20
+
+var adminSMSTemplatesListing = adminListing{
+	from:    "sms_templates",
+	orderBy: "reports DESC, last_seen DESC",
+}
+
+// GetSMSTemplates lists clusters of unparsed SMS, most reported first,
+// filtered by status and operator
+func (h *AdminHandler) GetSMSTemplates(c *gin.Context) {
+	page := adminPagination(c)
+	f := &sqlFilter{}
+	if status := c.Query("status"); status != "" {
+		f.where("status = " + f.arg(status))
+	}
+	if operator := c.Query("operator"); operator != "" {
+		f.where("operator = " + f.arg(strings.ToUpper(operator)))
+	}
+
+	query, args := adminSMSTemplatesListing.selectPage(
+		"id, operator, template, sample, reports, status, notes, first_seen, last_seen", f, page)
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch SMS templates"})
+		return
+	}
+	defer rows.Close()
+
+	templates := []models.SMSTemplate{}
+	for rows.Next() {
+		var t models.SMSTemplate
+		var notes sql.NullString
+		if err := rows.Scan(&t.ID, &t.Operator, &t.Template, &t.Sample, &t.Reports, &t.Status, &notes, &t.FirstSeen, &t.LastSeen); err != nil {
+			continue
+		}
+		if notes.Valid {
+			t.Notes = &notes.String
+		}
+		templates = append(templates, t)
+	}
+
+	var total int
+	countQuery, countArgs := adminSMSTemplatesListing.count(f)
+	h.DB.QueryRow(countQuery, countArgs...).Scan(&total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"total":     total,
+		"page":      page.Page,
+	})
+}
+
+// GetSMSTemplateReports returns a template's most recent redacted reports
+// and the app versions they came from
+func (h *AdminHandler) GetSMSTemplateReports(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT snippet, COALESCE(app_version, ''), created_at
+		FROM parse_failure_reports
+		WHERE template_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, id, smsTemplateSamples)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reports"})
+		return
+	}
+	defer rows.Close()
+
+	reports := []gin.H{}
+	for rows.Next() {
+		var snippet, appVersion string
+		var createdAt time.Time
+		if rows.Scan(&snippet, &appVersion, &createdAt) == nil {
+			reports = append(reports, gin.H{"snippet": snippet, "app_version": appVersion, "created_at": createdAt})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+// UpdateSMSTemplate moves a template through review: reviewing while the
+// parser is being taught it, supported once an app release parses it, or
+// ignored if it isn't a transaction
+func (h *AdminHandler) UpdateSMSTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	var req struct {
+		Status string  `json:"status" binding:"required,oneof=new reviewing supported ignored"`
+		Notes  *string `json:"notes" binding:"omitempty,max=1000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.DB.Exec(
+		"UPDATE sms_templates SET status = $1, notes = COALESCE($2, notes) WHERE id = $3",
+		req.Status, req.Notes, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update SMS template"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SMS template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SMS template updated"})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// affordabilityMonths is how many complete months the affordability score looks back
+const affordabilityMonths = 6
+
+// loadAffordabilityMonths totals income and spending for each of the last
+// complete months, oldest first, starting from the first month with income.
+// Savings moves are left out on both sides
+func loadAffordabilityMonths(ctx context.Context, db *sql.DB, userID string, now time.Time) ([]services.AffordabilityMonth, error) {
+	source, err := spendingSource(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	from := to.AddDate(0, -affordabilityMonths, 0)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT EXTRACT(YEAR FROM date)::int * 12 + EXTRACT(MONTH FROM date)::int - 1 AS month,
+			COALESCE(SUM(amount) FILTER (WHERE type = 'INCOME'), 0),
+			COALESCE(SUM(amount) FILTER (WHERE type = 'EXPENSE'), 0)
+		FROM `+source+`
+		WHERE user_id = $1 AND category <> 'SAVINGS' AND date >= $2 AND date < $3
+		GROUP BY month
+	`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	firstMonth := from.Year()*12 + int(from.Month()) - 1
+	months := make([]services.AffordabilityMonth, affordabilityMonths)
+	earliest := affordabilityMonths
+	for rows.Next() {
+		var month int
+		var m services.AffordabilityMonth
+		if err := rows.Scan(&month, &m.Income, &m.Expenses); err != nil {
+			return nil, err
+		}
+		if i := month - firstMonth; i >= 0 && i < affordabilityMonths {
+			months[i] = m
+			if m.Income > 0 && i < earliest {
+				earliest = i
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return months[earliest:], nil
+}
+
+// GetAffordabilityScore returns the user's affordability score with the
+// factors behind it. It needs the user's scoring consent, is worked out on
+// request and is never stored or shared
+func (h *AnalyticsHandler) GetAffordabilityScore(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var consented bool
+	err := h.DB.QueryRowContext(ctx,
+		"SELECT COALESCE(consent_scoring, FALSE) FROM users WHERE id = $1",
+		userID,
+	).Scan(&consented)
+	if err != nil || !consented {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Scoring consent required to see your affordability score"})
+		return
+	}
+
+	months, err := loadAffordabilityMonths(ctx, h.DB, userID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate score"})
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ScoreAffordability(months))
+}
+
+// UpdateAffordabilityConsent turns the affordability score on or off
+func (h *AnalyticsHandler) UpdateAffordabilityConsent(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var consentDate *time.Time
+	if req.Enabled {
+		now := time.Now()
+		consentDate = &now
+	}
+
+	_, err := h.DB.Exec(
+		`UPDATE users SET consent_scoring = $1, consent_scoring_date = $2, updated_at = $3 WHERE id = $4`,
+		req.Enabled, consentDate, time.Now(), userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update consent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enabled": req.Enabled})
+}
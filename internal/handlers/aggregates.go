@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+// transactionSource and aggregateSource are the two shapes of a user's
+// spending that analytics and insights read through. Both expose the
+// transaction columns those queries use plus entries, the number of
+// transactions a row stands for, and kind (see services.TransactionKind)
+const (
+	transactionSource = `(SELECT user_id, amount, type, category, operator, recipient, description, date,
+		1 AS entries, COALESCE(kind, transaction_kind(type, category)) AS kind FROM transactions) transactions`
+
+	// A day's total is dated at the day's last second so a window reaching
+	// into the day counts it. Aggregates carry no operator or SMS text
+	aggregateSource = `(SELECT user_id, total AS amount, type, category, NULL::varchar AS operator,
+		NULL::text AS recipient, NULL::text AS description,
+		day + INTERVAL '1 day' - INTERVAL '1 second' AS date, entries, transaction_kind(type, category) AS kind
+		FROM daily_aggregates) transactions`
+)
+
+// spendingSource returns the FROM item for the user's spending, depending on
+// their sync mode
+func spendingSource(db *sql.DB, userID string) (string, error) {
+	var mode string
+	if err := db.QueryRow("SELECT sync_mode FROM users WHERE id = $1", userID).Scan(&mode); err != nil {
+		return "", err
+	}
+	if mode == models.SyncModeMetadata {
+		return aggregateSource, nil
+	}
+	return transactionSource, nil
+}
+
+// GetSyncMode returns the user's sync mode
+func (h *SyncHandler) GetSyncMode(c *gin.Context) {
+	var mode string
+	var acknowledgedAt *time.Time
+	err := h.DB.QueryRow(
+		"SELECT sync_mode, sync_mode_acknowledged_at FROM users WHERE id = $1",
+		c.GetString("user_id"),
+	).Scan(&mode, &acknowledgedAt)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mode": mode, "acknowledged_at": acknowledgedAt})
+}
+
+// UpdateSyncMode switches between full and metadata-only sync. Moving to
+// metadata-only needs the user's acknowledgement that features built on
+// individual transactions stop working; their synced transactions are rolled
+// up into daily totals and deleted. Moving back drops the totals so the app
+// can sync its transactions again
+func (h *SyncHandler) UpdateSyncMode(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req struct {
+		Mode        string `json:"mode" binding:"required,oneof=full metadata"`
+		Acknowledge bool   `json:"acknowledge"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Mode == models.SyncModeMetadata && !req.Acknowledge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Metadata-only mode must be acknowledged"})
+		return
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRowContext(ctx, "SELECT sync_mode FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&current); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if current == req.Mode {
+		c.JSON(http.StatusOK, gin.H{"mode": current})
+		return
+	}
+
+	var acknowledgedAt *time.Time
+	if req.Mode == models.SyncModeMetadata {
+		// Pattern-based category mappings need the SMS text, so they're
+		// applied now, before it's gone
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO daily_aggregates (user_id, day, type, category, total, entries)
+			SELECT user_id, date::date, type, `+mappedCategorySQL+` AS mapped, SUM(amount), COUNT(*)
+			FROM transactions
+			WHERE user_id = $1
+			GROUP BY user_id, date::date, type, mapped
+			ON CONFLICT (user_id, day, type, category) DO UPDATE SET
+				total = EXCLUDED.total, entries = EXCLUDED.entries, updated_at = CURRENT_TIMESTAMP
+		`, userID)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "DELETE FROM transactions WHERE user_id = $1", userID)
+		}
+		if err == nil {
+			err = clearTransactionStats(ctx, tx, userID)
+		}
+		now := time.Now()
+		acknowledgedAt = &now
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM daily_aggregates WHERE user_id = $1", userID)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE users SET sync_mode = $1, sync_mode_acknowledged_at = $2, updated_at = NOW() WHERE id = $3",
+			req.Mode, acknowledgedAt, userID,
+		)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to switch user %s to %s sync: %v", userID, req.Mode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sync mode"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sync mode"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mode": req.Mode, "acknowledged_at": acknowledgedAt})
+}
+
+// SyncAggregates stores daily totals from a metadata-only device, replacing
+// any totals already held for the same day, type and category
+func (h *SyncHandler) SyncAggregates(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req models.AggregateSyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mode, ok := checkSyncConsent(c, h.DB, h.Settings, userID)
+	if !ok {
+		return
+	}
+	if mode != models.SyncModeMetadata {
+		c.JSON(http.StatusConflict, gin.H{"error": "Daily totals are only accepted in metadata-only mode"})
+		return
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	stored := 0
+	rejected := []gin.H{}
+	for i, a := range req.Aggregates {
+		day, err := validateAggregate(&a)
+		if err != nil {
+			rejected = append(rejected, gin.H{"index": i, "reason": err.Error()})
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO daily_aggregates (user_id, day, type, category, total, entries)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id, day, type, category) DO UPDATE SET
+				total = EXCLUDED.total, entries = EXCLUDED.entries, updated_at = CURRENT_TIMESTAMP
+		`, userID, day, a.Type, a.Category, a.Total, a.Count)
+		if err != nil {
+			log.Printf("⚠️ Aggregate sync failed for user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store daily totals"})
+			return
+		}
+		stored++
+	}
+
+	// Totals replace each other, so only last_sync moves
+	if stored > 0 {
+		if err := recordSyncStats(ctx, tx, userID, 0); err != nil {
+			log.Printf("❌ Failed to update sync stats for user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	if err := recordParseFailures(ctx, tx, req.AppVersion, req.ParseFailures); err != nil {
+		log.Printf("⚠️ Failed to record parse failures: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Sync completed",
+		"stored":   stored,
+		"skipped":  len(rejected),
+		"total":    len(req.Aggregates),
+		"rejected": rejected,
+	})
+}
+
+// validateAggregate normalises a daily total and returns its day
+func validateAggregate(a *models.DailyAggregate) (time.Time, error) {
+	day, err := time.Parse("2006-01-02", a.Day)
+	if err != nil {
+		return day, fmt.Errorf("day must be YYYY-MM-DD")
+	}
+	if day.After(time.Now().Add(24 * time.Hour)) {
+		return day, fmt.Errorf("day is in the future")
+	}
+	if a.Type != "INCOME" && a.Type != "EXPENSE" {
+		return day, fmt.Errorf("type must be INCOME or EXPENSE")
+	}
+	a.Category = strings.ToUpper(strings.TrimSpace(a.Category))
+	if a.Category == "" {
+		return day, fmt.Errorf("category is required")
+	}
+	return day, nil
+}
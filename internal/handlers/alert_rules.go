@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeAlertRules checks a user's alert rules against their newly synced transactions
+const JobTypeAlertRules = "alert_rules"
+
+const (
+	maxAlertRules = 10
+	alertBatch    = 500 // New transactions read per query
+	alertMaxPush  = 3   // Single-expense alerts one rule sends per sync
+	alertMaxAge   = 7   // Days; older transactions synced late, such as a first sync's history, don't fire
+)
+
+// AlertRulesHandler manages the user's spending alerts
+type AlertRulesHandler struct {
+	DB *sql.DB
+}
+
+// alertRule is an alert_rules row with its evaluation state
+type alertRule struct {
+	services.AlertRule
+	checkedThrough time.Time
+	checkedID      string
+	firedFor       sql.NullTime
+	lastFiredAt    sql.NullTime
+	createdAt      time.Time
+}
+
+const alertRuleColumns = "id, kind, COALESCE(category, ''), COALESCE(period, ''), threshold, checked_through, COALESCE(checked_id::text, '" + zeroUUID + "'), fired_for, last_fired_at, created_at"
+
+func scanAlertRule(row interface{ Scan(...interface{}) error }) (alertRule, error) {
+	var r alertRule
+	err := row.Scan(&r.ID, &r.Kind, &r.Category, &r.Period, &r.Threshold, &r.checkedThrough, &r.checkedID,
+		&r.firedFor, &r.lastFiredAt, &r.createdAt)
+	return r, err
+}
+
+// alertRuleView is the API view of a rule
+func alertRuleView(r alertRule) models.AlertRule {
+	view := models.AlertRule{
+		Kind:        r.Kind,
+		Threshold:   r.Threshold,
+		Description: r.Describe(),
+		CreatedAt:   r.createdAt,
+	}
+	view.ID, _ = uuid.Parse(r.ID)
+	if r.Category != "" {
+		view.Category = &r.Category
+	}
+	if r.Period != "" {
+		view.Period = &r.Period
+	}
+	if r.lastFiredAt.Valid {
+		view.LastFiredAt = &r.lastFiredAt.Time
+	}
+	return view
+}
+
+// loadAlertRules returns the user's rules, oldest first
+func loadAlertRules(ctx context.Context, db *sql.DB, userID string) ([]alertRule, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+alertRuleColumns+" FROM alert_rules WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []alertRule
+	for rows.Next() {
+		r, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// GetAlertRules lists the user's spending alerts
+func (h *AlertRulesHandler) GetAlertRules(c *gin.Context) {
+	rules, err := loadAlertRules(c.Request.Context(), h.DB, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert rules"})
+		return
+	}
+
+	result := []models.AlertRule{}
+	for _, r := range rules {
+		result = append(result, alertRuleView(r))
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": result})
+}
+
+// CreateAlertRule adds a spending alert. It applies to transactions synced
+// from now on
+func (h *AlertRulesHandler) CreateAlertRule(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req struct {
+		Kind      string  `json:"kind" binding:"required,oneof=single_expense period_spend"`
+		Category  *string `json:"category" binding:"omitempty,max=50"`
+		Period    *string `json:"period" binding:"omitempty,oneof=day week month"`
+		Threshold float64 `json:"threshold" binding:"required,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Kind == services.AlertPeriodSpend && req.Period == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period is required for period_spend rules"})
+		return
+	}
+	if req.Kind == services.AlertSingleExpense {
+		req.Period = nil
+	}
+	if req.Category != nil {
+		category := strings.ToUpper(strings.TrimSpace(*req.Category))
+		req.Category = &category
+		if category == "" {
+			req.Category = nil
+		}
+	}
+
+	var count int
+	h.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM alert_rules WHERE user_id = $1", userID).Scan(&count)
+	if count >= maxAlertRules {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You can have at most %d alert rules", maxAlertRules)})
+		return
+	}
+
+	r, err := scanAlertRule(h.DB.QueryRowContext(ctx, `
+		INSERT INTO alert_rules (user_id, kind, category, period, threshold)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+alertRuleColumns,
+		userID, req.Kind, req.Category, req.Period, req.Threshold,
+	))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, alertRuleView(r))
+}
+
+// DeleteAlertRule removes a spending alert
+func (h *AlertRulesHandler) DeleteAlertRule(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	result, err := h.DB.Exec("DELETE FROM alert_rules WHERE id = $1 AND user_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alert rule"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert rule deleted"})
+}
+
+// AlertRulesJob returns the job type that checks a user's alert rules after a sync
+func AlertRulesJob(db *sql.DB, notifier *notifications.Service) services.JobType {
+	return services.JobType{
+		Name: JobTypeAlertRules,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			fired, err := runAlertRules(ctx, db, notifier, job.UserID.String())
+			if err != nil {
+				return nil, err
+			}
+			return gin.H{"fired": fired}, nil
+		},
+	}
+}
+
+// alertCandidate is a synced transaction with where it sits in sync order
+type alertCandidate struct {
+	services.AlertTransaction
+	createdAt time.Time
+}
+
+// loadAlertCandidates returns the user's expenses synced after the cursor,
+// oldest first, with mapped categories
+func loadAlertCandidates(ctx context.Context, db *sql.DB, userID string, after time.Time, afterID string) ([]alertCandidate, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, created_at, amount, `+mappedCategorySQL+`, COALESCE(recipient, ''), date
+		FROM transactions
+		WHERE user_id = $1 AND type = 'EXPENSE' AND (created_at, id) > ($2, $3::uuid)
+		ORDER BY created_at, id
+		LIMIT $4
+	`, userID, after, afterID, alertBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []alertCandidate
+	for rows.Next() {
+		var t alertCandidate
+		if err := rows.Scan(&t.ID, &t.createdAt, &t.Amount, &t.Category, &t.Recipient, &t.Date); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, t)
+	}
+	return candidates, rows.Err()
+}
+
+// runAlertRules checks each rule against the transactions synced since it
+// was last checked. Savings deposits only fire rules naming SAVINGS.
+// Single-expense rules fire for each recent expense over the threshold;
+// period rules fire once per period, when a newly synced expense in it
+// finds the period's spending over the threshold. Pushes are queued with the rule's new state in one
+// transaction
+func runAlertRules(ctx context.Context, db *sql.DB, notifier *notifications.Service, userID string) (int, error) {
+	rules, err := loadAlertRules(ctx, db, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	today := localDate(now)
+	fired := 0
+	for _, r := range rules {
+		var pushes []models.PushNotification
+		periodStart := r.PeriodStart(today)
+		var periodCrossed *alertCandidate
+
+		for {
+			candidates, err := loadAlertCandidates(ctx, db, userID, r.checkedThrough, r.checkedID)
+			if err != nil {
+				return fired, err
+			}
+			for i := range candidates {
+				t := &candidates[i]
+				if !r.Covers(t.AlertTransaction) || (r.Category == "" && services.IsNonBudgetCategory(t.Category)) {
+					continue
+				}
+				switch r.Kind {
+				case services.AlertSingleExpense:
+					if t.Amount > r.Threshold && !t.Date.Before(today.AddDate(0, 0, -alertMaxAge)) && len(pushes) < alertMaxPush {
+						pushes = append(pushes, alertPush(r, t.AlertTransaction, 0))
+					}
+				case services.AlertPeriodSpend:
+					if !t.Date.Before(periodStart) && (periodCrossed == nil || t.Date.After(periodCrossed.Date)) {
+						periodCrossed = t
+					}
+				}
+			}
+			if len(candidates) > 0 {
+				last := candidates[len(candidates)-1]
+				r.checkedThrough, r.checkedID = last.createdAt, last.ID
+			}
+			if len(candidates) < alertBatch {
+				break
+			}
+		}
+
+		alreadyFired := r.firedFor.Valid && !localDate(r.firedFor.Time).Before(periodStart)
+		if periodCrossed != nil && !alreadyFired {
+			total, err := alertPeriodTotal(ctx, db, userID, r.AlertRule, periodStart)
+			if err != nil {
+				return fired, err
+			}
+			if total > r.Threshold {
+				pushes = append(pushes, alertPush(r, periodCrossed.AlertTransaction, total))
+				r.firedFor = sql.NullTime{Time: periodStart, Valid: true}
+			}
+		}
+
+		if err := saveAlertRule(ctx, db, notifier, userID, r, pushes, now); err != nil {
+			return fired, err
+		}
+		fired += len(pushes)
+	}
+	return fired, nil
+}
+
+// alertPeriodTotal sums the spending a period rule covers since the period started
+func alertPeriodTotal(ctx context.Context, db *sql.DB, userID string, r services.AlertRule, since time.Time) (float64, error) {
+	f := &sqlFilter{}
+	f.where("user_id = " + f.arg(userID))
+	f.where("type = 'EXPENSE'")
+	f.where("date >= " + f.arg(since))
+	if r.Category != "" {
+		f.where("UPPER(" + mappedCategorySQL + ") = UPPER(" + f.arg(r.Category) + ")")
+	} else {
+		f.where("UPPER(" + mappedCategorySQL + ") <> 'SAVINGS'")
+	}
+
+	var total float64
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(SUM(amount), 0) FROM transactions"+f.sql(), f.args...).Scan(&total)
+	return total, err
+}
+
+// alertPush is the notification for a rule firing on t, with the transaction attached
+func alertPush(r alertRule, t services.AlertTransaction, total float64) models.PushNotification {
+	return models.PushNotification{
+		Title: "🔔 Spending alert",
+		Body:  r.AlertMessage(t, total),
+		Data: map[string]string{
+			"type":           "alert_rule",
+			"rule_id":        r.ID,
+			"transaction_id": t.ID,
+			"amount":         fmt.Sprintf("%.2f", t.Amount),
+			"category":       t.Category,
+			"recipient":      t.Recipient,
+			"date":           t.Date.Format(time.RFC3339),
+		},
+	}
+}
+
+// saveAlertRule advances the rule's cursor and queues its pushes together,
+// so a retried job neither misses nor repeats an alert
+func saveAlertRule(ctx context.Context, db *sql.DB, notifier *notifications.Service, userID string, r alertRule, pushes []models.PushNotification, now time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(pushes) > 0 {
+		r.lastFiredAt = sql.NullTime{Time: now, Valid: true}
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE alert_rules SET checked_through = $2, checked_id = $3, fired_for = $4, last_fired_at = $5
+		WHERE id = $1
+	`, r.ID, r.checkedThrough, r.checkedID, r.firedFor, r.lastFiredAt)
+	if err != nil {
+		return err
+	}
+	for _, push := range pushes {
+		if err := notifier.Send(tx, userID, models.Notification{Type: models.NotificationAlerts, Push: push}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
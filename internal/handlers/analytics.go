@@ -6,12 +6,15 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/kwachatracker/backend/internal/database"
 	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
 )
 
 // AnalyticsHandler handles analytics endpoints
-type AnalyticsHandler struct{}
+type AnalyticsHandler struct {
+	DB     *sql.DB
+	Funnel *services.FunnelTracker
+}
 
 // GetSummary returns spending analytics for the user
 func (h *AnalyticsHandler) GetSummary(c *gin.Context) {
@@ -36,9 +39,18 @@ func (h *AnalyticsHandler) GetSummary(c *gin.Context) {
 	summary := models.AnalyticsSummary{
 		ByCategory: make(map[string]float64),
 		ByOperator: make(map[string]float64),
+		ByBank:     make(map[string]float64),
+		ByKind:     make(map[string]float64),
 		Period:     period,
 	}
 
+	// Metadata-only users are summarised from their daily totals
+	source, err := spendingSource(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate totals"})
+		return
+	}
+
 	// Get totals
 	var totalIncome, totalExpenses sql.NullFloat64
 	var count int
@@ -47,12 +59,12 @@ func (h *AnalyticsHandler) GetSummary(c *gin.Context) {
 		SELECT 
 			COALESCE(SUM(CASE WHEN type = 'INCOME' THEN amount ELSE 0 END), 0) as income,
 			COALESCE(SUM(CASE WHEN type = 'EXPENSE' THEN amount ELSE 0 END), 0) as expenses,
-			COUNT(*) as count
-		FROM transactions
+			COALESCE(SUM(entries), 0) as count
+		FROM ` + source + `
 		WHERE user_id = $1 AND date >= $2
 	`
 
-	err := database.DB.QueryRow(query, userID, startDate).Scan(&totalIncome, &totalExpenses, &count)
+	err = h.DB.QueryRow(query, userID, startDate).Scan(&totalIncome, &totalExpenses, &count)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate totals"})
 		return
@@ -64,11 +76,11 @@ func (h *AnalyticsHandler) GetSummary(c *gin.Context) {
 	summary.TransactionCount = count
 
 	// Get breakdown by category
-	categoryRows, err := database.DB.Query(`
-		SELECT category, COALESCE(SUM(amount), 0) as total
-		FROM transactions
+	categoryRows, err := h.DB.Query(`
+		SELECT `+mappedCategorySQL+` AS mapped, COALESCE(SUM(amount), 0) as total
+		FROM `+source+`
 		WHERE user_id = $1 AND type = 'EXPENSE' AND date >= $2
-		GROUP BY category
+		GROUP BY mapped
 		ORDER BY total DESC
 	`, userID, startDate)
 
@@ -83,11 +95,11 @@ func (h *AnalyticsHandler) GetSummary(c *gin.Context) {
 		}
 	}
 
-	// Get breakdown by operator
-	operatorRows, err := database.DB.Query(`
+	// Get breakdown by operator, with banks apart from mobile money
+	operatorRows, err := h.DB.Query(`
 		SELECT operator, COALESCE(SUM(amount), 0) as total
-		FROM transactions
-		WHERE user_id = $1 AND date >= $2
+		FROM `+source+`
+		WHERE user_id = $1 AND date >= $2 AND operator IS NOT NULL
 		GROUP BY operator
 		ORDER BY total DESC
 	`, userID, startDate)
@@ -97,12 +109,37 @@ func (h *AnalyticsHandler) GetSummary(c *gin.Context) {
 		for operatorRows.Next() {
 			var op string
 			var total float64
-			if operatorRows.Scan(&op, &total) == nil {
+			if operatorRows.Scan(&op, &total) != nil {
+				continue
+			}
+			if services.IsBank(op) {
+				summary.ByBank[op] = total
+			} else {
 				summary.ByOperator[op] = total
 			}
 		}
 	}
 
+	// Get breakdown by transaction kind
+	kindRows, err := h.DB.Query(`
+		SELECT kind, COALESCE(SUM(amount), 0) as total
+		FROM `+source+`
+		WHERE user_id = $1 AND date >= $2
+		GROUP BY kind
+		ORDER BY total DESC
+	`, userID, startDate)
+
+	if err == nil {
+		defer kindRows.Close()
+		for kindRows.Next() {
+			var kind string
+			var total float64
+			if kindRows.Scan(&kind, &total) == nil {
+				summary.ByKind[kind] = total
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, summary)
 }
 
@@ -130,12 +167,18 @@ func (h *AnalyticsHandler) GetTrends(c *gin.Context) {
 		groupFormat = "YYYY-MM-DD"
 	}
 
-	rows, err := database.DB.Query(`
+	source, err := spendingSource(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trends"})
+		return
+	}
+
+	rows, err := h.DB.Query(`
 		SELECT 
 			TO_CHAR(date, $3) as period,
 			COALESCE(SUM(CASE WHEN type = 'INCOME' THEN amount ELSE 0 END), 0) as income,
 			COALESCE(SUM(CASE WHEN type = 'EXPENSE' THEN amount ELSE 0 END), 0) as expenses
-		FROM transactions
+		FROM `+source+`
 		WHERE user_id = $1 AND date >= $2
 		GROUP BY TO_CHAR(date, $3)
 		ORDER BY period ASC
@@ -166,3 +209,28 @@ func (h *AnalyticsHandler) GetTrends(c *gin.Context) {
 		"period": period,
 	})
 }
+
+// clientFunnelEvents are the funnel steps only the app can observe
+var clientFunnelEvents = map[string]bool{
+	models.FunnelInsightOpened: true,
+}
+
+// TrackEvent records a funnel event reported by the app (e.g. an insight being opened)
+func (h *AnalyticsHandler) TrackEvent(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Event string `json:"event" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !clientFunnelEvents[req.Event] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event"})
+		return
+	}
+
+	h.Funnel.Record(userID, req.Event)
+	c.JSON(http.StatusOK, gin.H{"message": "Event recorded"})
+}
@@ -1,20 +1,30 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/kwachatracker/backend/config"
-	"github.com/kwachatracker/backend/internal/database"
 	"github.com/kwachatracker/backend/internal/middleware"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+	"github.com/lib/pq"
 )
 
 // AuthHandler handles authentication endpoints
 type AuthHandler struct {
-	Config *config.Config
+	DB       *sql.DB
+	Config   *config.Config
+	Funnel   *services.FunnelTracker
+	Events   *services.EventBus
+	Storage  services.ObjectStorage // Receipt photos to remove on data deletion
+	Settings *services.Settings
 }
 
 // RegisterRequest represents a device registration request
@@ -22,6 +32,8 @@ type RegisterRequest struct {
 	DeviceID string `json:"device_id" binding:"required"`
 	FCMToken string `json:"fcm_token,omitempty"`
 	Operator string `json:"operator,omitempty"`
+	Language string `json:"language,omitempty"`
+	Country  string `json:"country,omitempty"` // ISO 3166-1 alpha-2; Zambia if unset
 }
 
 // Register registers a new device or returns existing token
@@ -31,28 +43,42 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	req.Country = strings.ToUpper(strings.TrimSpace(req.Country))
+	if req.Country == "" {
+		req.Country = services.DefaultCountry
+	}
+	if !services.IsSupportedCountry(req.Country) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "country must be one of " + strings.Join(services.CountryCodes(), ", ")})
+		return
+	}
 
 	// Check if user exists
 	var userID uuid.UUID
 	var exists bool
 
-	err := database.DB.QueryRow(
+	err := h.DB.QueryRow(
 		"SELECT id FROM users WHERE device_id = $1",
 		req.DeviceID,
 	).Scan(&userID)
 
 	if err == sql.ErrNoRows {
 		// Create new user with consent enabled by default
+		language := strings.ToLower(req.Language)
+		if language == "" {
+			language = "en"
+		}
 		userID = uuid.New()
-		_, err = database.DB.Exec(
-			`INSERT INTO users (id, device_id, fcm_token, operator, consent_analytics, consent_ai, consent_given, consent_date) 
-			 VALUES ($1, $2, $3, $4, true, true, true, $5)`,
-			userID, req.DeviceID, req.FCMToken, req.Operator, time.Now(),
+		_, err = h.DB.Exec(
+			`INSERT INTO users (id, device_id, fcm_token, operator, language, consent_analytics, consent_ai, consent_given, consent_date, consent_policy_version, country) 
+			 VALUES ($1, $2, $3, $4, $5, true, true, true, $6, $7, $8)`,
+			userID, req.DeviceID, req.FCMToken, req.Operator, language, time.Now(), h.Settings.Int(services.SettingConsentPolicyVersion), req.Country,
 		)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 			return
 		}
+		h.Funnel.Record(userID.String(), models.FunnelRegistered)
+		h.Funnel.Record(userID.String(), models.FunnelConsented)
 		exists = false
 	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -61,10 +87,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		exists = true
 		// Update FCM token and enable consent if provided
 		if req.FCMToken != "" {
-			database.DB.Exec(`UPDATE users 
+			h.DB.Exec(`UPDATE users 
 				SET fcm_token = $1, consent_analytics = true, consent_ai = true, consent_given = true, consent_date = $2, updated_at = $3 
 				WHERE id = $4`,
 				req.FCMToken, time.Now(), time.Now(), userID)
+			h.Funnel.Record(userID.String(), models.FunnelConsented)
 		}
 	}
 
@@ -88,12 +115,60 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	})
 }
 
+// GetProfile returns the user's account settings and learning progress
+func (h *AuthHandler) GetProfile(c *gin.Context) {
+	profile, err := loadProfile(h.DB, c.GetString("user_id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// loadProfile returns the user's account settings and learning progress
+func loadProfile(db *sql.DB, userID string) (models.UserProfile, error) {
+	var profile models.UserProfile
+	var displayName sql.NullString
+	var excluded pq.StringArray
+	err := db.QueryRow(`
+		SELECT id, display_name, COALESCE(operator, 'UNKNOWN'), COALESCE(language, 'en'), country, COALESCE(is_premium, FALSE),
+			COALESCE(consent_given, FALSE), COALESCE(business_mode, FALSE), sync_mode, created_at,
+			ai_excluded_categories
+		FROM users WHERE id = $1
+	`, userID).Scan(&profile.ID, &displayName, &profile.Operator, &profile.Language, &profile.Country, &profile.IsPremium,
+		&profile.ConsentGiven, &profile.BusinessMode, &profile.SyncMode, &profile.CreatedAt, &excluded)
+	if err != nil {
+		return profile, err
+	}
+	profile.Currency = services.CountryFor(profile.Country).Currency
+	if displayName.Valid {
+		profile.DisplayName = &displayName.String
+	}
+	profile.AIExcludedCategories = []string(excluded)
+
+	profile.Learning, err = loadLearningProgress(db, userID)
+	return profile, err
+}
+
+// loadCountry returns the user's country, the default one if it can't be read
+func loadCountry(ctx context.Context, db *sql.DB, userID string) services.Country {
+	var code sql.NullString
+	db.QueryRowContext(ctx, "SELECT country FROM users WHERE id = $1", userID).Scan(&code)
+	return services.CountryFor(code.String)
+}
+
 // UpdateConsent updates the user's consent status
 func (h *AuthHandler) UpdateConsent(c *gin.Context) {
 	userID := c.GetString("user_id")
 
 	var req struct {
-		ConsentGiven bool `json:"consent_given"`
+		ConsentGiven  bool `json:"consent_given"`
+		PolicyVersion int  `json:"policy_version"` // The version shown; the current one if unset
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -102,40 +177,265 @@ func (h *AuthHandler) UpdateConsent(c *gin.Context) {
 	}
 
 	var consentDate *time.Time
+	var policyVersion *int
 	if req.ConsentGiven {
+		current := h.Settings.Int(services.SettingConsentPolicyVersion)
+		if req.PolicyVersion != 0 && req.PolicyVersion != current {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "The privacy policy has changed; show the current one and ask again",
+				"code":           "CONSENT_POLICY_CHANGED",
+				"policy_version": current,
+			})
+			return
+		}
 		now := time.Now()
 		consentDate = &now
+		policyVersion = &current
 	}
 
-	_, err := database.DB.Exec(
-		`UPDATE users SET consent_given = $1, consent_date = $2, updated_at = $3 WHERE id = $4`,
-		req.ConsentGiven, consentDate, time.Now(), userID,
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE users SET consent_given = $1, consent_date = $2, consent_policy_version = $3, updated_at = $4 WHERE id = $5`,
+		req.ConsentGiven, consentDate, policyVersion, time.Now(), userID,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update consent"})
 		return
 	}
+	_, err = tx.Exec(`
+		INSERT INTO consent_log (user_id, consent, granted, source, policy_version) VALUES ($1, $2, $3, $4, $5)
+	`, userID, consentData, req.ConsentGiven, consentSourceConsent, policyVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update consent"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update consent"})
+		return
+	}
+
+	h.Events.Publish(services.EventConsentChanged, userID, services.ConsentChanged{ConsentGiven: req.ConsentGiven})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Consent updated"})
 }
 
+// GetAppConfig returns what the app needs before sign-in: the privacy policy
+// version consent is asked for, which features are on and the countries
+// users can pick, with their currencies and operators
+func (h *AuthHandler) GetAppConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"consent_policy_version": h.Settings.Int(services.SettingConsentPolicyVersion),
+		"features":               h.Settings.Features(),
+		"countries":              services.Countries(),
+	})
+}
+
+// loadAIExclusions returns the categories the user doesn't want sent to Gemini
+func loadAIExclusions(db *sql.DB, userID string) ([]string, error) {
+	var categories pq.StringArray
+	err := db.QueryRow("SELECT ai_excluded_categories FROM users WHERE id = $1", userID).Scan(&categories)
+	return categories, err
+}
+
+// GetAIExclusions lists the categories kept out of AI analysis
+func (h *AuthHandler) GetAIExclusions(c *gin.Context) {
+	categories, err := loadAIExclusions(h.DB, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch AI exclusions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": []string(categories)})
+}
+
+// UpdateAIExclusions sets the categories, e.g. MEDICAL or GAMBLING, whose
+// spending is never sent to the third-party AI. Insights still cover them
+// through the on-server rules
+func (h *AuthHandler) UpdateAIExclusions(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Categories []string `json:"categories" binding:"max=30,dive,required,max=50"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seen := make(map[string]bool)
+	categories := []string{}
+	for _, cat := range req.Categories {
+		cat = strings.ToUpper(strings.TrimSpace(cat))
+		if cat != "" && !seen[cat] {
+			seen[cat] = true
+			categories = append(categories, cat)
+		}
+	}
+	_, err := h.DB.Exec(
+		"UPDATE users SET ai_excluded_categories = $1, updated_at = $2 WHERE id = $3",
+		pq.Array(categories), time.Now(), userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update AI exclusions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+// GetAIActivity lists, newest first, each time the user's data was sent to
+// Gemini: what for, the model, which fields of their data went and the
+// insights kept from the answer. Paged like the insight history
+func (h *AuthHandler) GetAIActivity(c *gin.Context) {
+	userID := c.GetString("user_id")
+	limit := 20
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := parseInt(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := parseInt(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	var total int
+	if err := h.DB.QueryRow("SELECT COUNT(*) FROM ai_usage WHERE user_id = $1", userID).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch AI activity"})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT COALESCE(call_id::text, ''), purpose, model, COALESCE(fields, '{}'), created_at
+		FROM ai_usage
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch AI activity"})
+		return
+	}
+	defer rows.Close()
+
+	activity := []models.AIActivity{}
+	byCall := make(map[string]int)
+	var callIDs []string
+	for rows.Next() {
+		var callID string
+		var fields pq.StringArray
+		a := models.AIActivity{Insights: []models.UserInsight{}}
+		if err := rows.Scan(&callID, &a.Purpose, &a.Model, &fields, &a.SentAt); err != nil {
+			continue
+		}
+		a.Fields = []string(fields)
+		if callID != "" {
+			byCall[callID] = len(activity)
+			callIDs = append(callIDs, callID)
+		}
+		activity = append(activity, a)
+	}
+	rows.Close()
+
+	if len(callIDs) > 0 {
+		insightRows, err := h.DB.Query(`
+			SELECT ai_call_id::text, id, title, message, category, priority, COALESCE(period, 'daily'), generated_at,
+				COALESCE(excluded_categories, '{}')
+			FROM user_insights
+			WHERE user_id = $1 AND ai_call_id = ANY($2::uuid[])
+			ORDER BY generated_at, id
+		`, userID, pq.Array(callIDs))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch AI activity"})
+			return
+		}
+		defer insightRows.Close()
+		for insightRows.Next() {
+			var callID string
+			var insight models.UserInsight
+			var excluded pq.StringArray
+			if insightRows.Scan(&callID, &insight.ID, &insight.Title, &insight.Message, &insight.Category,
+				&insight.Priority, &insight.Period, &insight.GeneratedAt, &excluded) != nil {
+				continue
+			}
+			a := &activity[byCall[callID]]
+			a.Insights = append(a.Insights, insight)
+			if len(excluded) > 0 {
+				a.ExcludedCategories = []string(excluded)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activity": activity,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
 // DeleteData deletes all user data (GDPR compliance)
 func (h *AuthHandler) DeleteData(c *gin.Context) {
 	userID := c.GetString("user_id")
 
-	// Delete transactions first (foreign key)
-	_, err := database.DB.Exec("DELETE FROM transactions WHERE user_id = $1", userID)
+	// Receipt and backup rows cascade, but the photos and blobs live in object storage
+	var receiptKeys []string
+	if rows, err := h.DB.Query(`
+		SELECT image_key FROM receipts WHERE user_id = $1
+		UNION ALL
+		SELECT storage_key FROM client_backups WHERE user_id = $1
+	`, userID); err == nil {
+		for rows.Next() {
+			var key string
+			if rows.Scan(&key) == nil {
+				receiptKeys = append(receiptKeys, key)
+			}
+		}
+		rows.Close()
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Delete transactions first (foreign key), with the counts kept of them
+	_, err = tx.Exec("DELETE FROM transactions WHERE user_id = $1", userID)
+	if err == nil {
+		err = clearTransactionStats(c.Request.Context(), tx, userID)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete transactions"})
 		return
 	}
 
 	// Delete user
-	_, err = database.DB.Exec("DELETE FROM users WHERE id = $1", userID)
+	_, err = tx.Exec("DELETE FROM users WHERE id = $1", userID)
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
 
+	if h.Storage != nil {
+		for _, key := range receiptKeys {
+			if err := h.Storage.Delete(c.Request.Context(), key); err != nil {
+				log.Printf("⚠️ Failed to delete stored file %s: %v", key, err)
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "All data deleted"})
 }
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// MaxBackupSize is the largest backup blob accepted (20 MB)
+const MaxBackupSize = 20 << 20
+
+// backupVersionsKept is how many versions of each device's backup are kept
+const backupVersionsKept = 3
+
+// BackupHandler stores the app's client-encrypted backups. Blobs are
+// encrypted on the device before upload, so the server only sees their size
+// and checksum
+type BackupHandler struct {
+	DB      *sql.DB
+	Storage services.ObjectStorage
+}
+
+// GetBackups lists the stored backup versions for each of the user's devices
+func (h *BackupHandler) GetBackups(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT device_id, version, size, sha256, created_at
+		FROM client_backups
+		WHERE user_id = $1
+		ORDER BY device_id, version DESC
+	`, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch backups"})
+		return
+	}
+	defer rows.Close()
+
+	backups := []models.ClientBackup{}
+	for rows.Next() {
+		var b models.ClientBackup
+		if err := rows.Scan(&b.DeviceID, &b.Version, &b.Size, &b.SHA256, &b.CreatedAt); err != nil {
+			continue
+		}
+		backups = append(backups, b)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"backups": backups})
+}
+
+// UploadBackup stores the request body as the device's next backup version.
+// Sending If-Match with the version the device last saw rejects the upload
+// with 409 if another upload got there first
+func (h *BackupHandler) UploadBackup(c *gin.Context) {
+	userID := c.GetString("user_id")
+	deviceID := c.Param("device_id")
+	if len(deviceID) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id is too long"})
+		return
+	}
+
+	blob, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxBackupSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Backup must be 20 MB or smaller"})
+		return
+	}
+	if len(blob) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Backup body is empty"})
+		return
+	}
+
+	var current int
+	err = h.DB.QueryRow(
+		"SELECT COALESCE(MAX(version), 0) FROM client_backups WHERE user_id = $1 AND device_id = $2",
+		userID, deviceID,
+	).Scan(&current)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store backup"})
+		return
+	}
+	if match := c.GetHeader("If-Match"); match != "" && strings.Trim(match, `"`) != strconv.Itoa(current) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Backup has changed since this device last saw it", "version": current})
+		return
+	}
+
+	sum := sha256.Sum256(blob)
+	backup := models.ClientBackup{
+		DeviceID: deviceID,
+		Version:  current + 1,
+		Size:     len(blob),
+		SHA256:   hex.EncodeToString(sum[:]),
+	}
+
+	ctx := c.Request.Context()
+	key := fmt.Sprintf("backups/%s/%s", userID, uuid.New())
+	if err := h.Storage.Put(ctx, key, blob); err != nil {
+		log.Printf("❌ Failed to store backup for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store backup"})
+		return
+	}
+
+	// A concurrent upload that claimed the same version wins
+	backup.CreatedAt = time.Now()
+	result, err := h.DB.Exec(`
+		INSERT INTO client_backups (user_id, device_id, version, storage_key, size, sha256, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, device_id, version) DO NOTHING
+	`, userID, deviceID, backup.Version, key, backup.Size, backup.SHA256, backup.CreatedAt)
+	if err != nil {
+		h.Storage.Delete(ctx, key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store backup"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		h.Storage.Delete(ctx, key)
+		c.JSON(http.StatusConflict, gin.H{"error": "Another upload for this device got there first", "version": backup.Version})
+		return
+	}
+
+	// Only the last few versions are kept
+	_, err = h.removeBackups(ctx, `
+		DELETE FROM client_backups
+		WHERE user_id = $1 AND device_id = $2 AND version <= $3
+		RETURNING storage_key
+	`, userID, deviceID, backup.Version-backupVersionsKept)
+	if err != nil {
+		log.Printf("⚠️ Failed to prune backups for user %s: %v", userID, err)
+	}
+
+	c.Header("ETag", strconv.Quote(strconv.Itoa(backup.Version)))
+	c.JSON(http.StatusCreated, backup)
+}
+
+// removeBackups runs a DELETE on client_backups returning storage_key and
+// deletes the removed blobs, returning how many versions went
+func (h *BackupHandler) removeBackups(ctx context.Context, query string, args ...interface{}) (int, error) {
+	rows, err := h.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if rows.Scan(&key) == nil {
+			keys = append(keys, key)
+		}
+	}
+	rows.Close()
+
+	for _, key := range keys {
+		if err := h.Storage.Delete(ctx, key); err != nil {
+			log.Printf("⚠️ Failed to delete backup %s: %v", key, err)
+		}
+	}
+	return len(keys), rows.Err()
+}
+
+// DownloadBackup returns the device's latest backup blob, or the version
+// given by ?version=
+func (h *BackupHandler) DownloadBackup(c *gin.Context) {
+	userID := c.GetString("user_id")
+	deviceID := c.Param("device_id")
+
+	f := &sqlFilter{}
+	f.where("user_id = " + f.arg(userID))
+	f.where("device_id = " + f.arg(deviceID))
+	if v := c.Query("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a number"})
+			return
+		}
+		f.where("version = " + f.arg(version))
+	}
+
+	var key string
+	var b models.ClientBackup
+	err := h.DB.QueryRow(`
+		SELECT storage_key, version, sha256
+		FROM client_backups`+f.sql()+`
+		ORDER BY version DESC
+		LIMIT 1
+	`, f.args...).Scan(&key, &b.Version, &b.SHA256)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+		return
+	}
+
+	blob, err := h.Storage.Get(c.Request.Context(), key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+		return
+	}
+
+	c.Header("ETag", strconv.Quote(strconv.Itoa(b.Version)))
+	c.Header("X-Backup-SHA256", b.SHA256)
+	c.Data(http.StatusOK, "application/octet-stream", blob)
+}
+
+// DeleteBackups removes every version of the device's backup
+func (h *BackupHandler) DeleteBackups(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	removed, err := h.removeBackups(c.Request.Context(),
+		"DELETE FROM client_backups WHERE user_id = $1 AND device_id = $2 RETURNING storage_key",
+		userID, c.Param("device_id"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete backups"})
+		return
+	}
+	if removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Backups deleted", "versions": removed})
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// bankFeeSuffix marks the fingerprint of the fee row a bank SMS adds
+const bankFeeSuffix = ":fee"
+
+// SyncBankSMS reads Zanaco, FNB and Stanbic SMS the app can't parse itself
+// and stores the transactions in them, with the bank as the operator. A fee
+// the SMS names is stored as its own FEES expense. Each transaction goes in
+// the user's account at the bank, matched on the account number's last
+// digits. The SMS text is read and dropped; only the fingerprint is kept
+func (h *SyncHandler) SyncBankSMS(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req models.BankSMSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !canStoreTransactions(c, h.DB, h.Settings, userID) {
+		return
+	}
+
+	accounts, err := loadSyncAccounts(ctx, h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	insertedCount := 0
+	skippedCount := 0
+	results := make([]models.SyncResult, 0, len(req.Messages))
+
+	for _, m := range req.Messages {
+		fingerprint := bankSMSFingerprint(m.Text)
+		result := models.SyncResult{SMSFingerprint: fingerprint}
+
+		sms, ok := services.ParseBankSMS(m.Sender, m.Text)
+		if !ok {
+			result.Status = models.SyncStatusInvalid
+			result.Reason = "Not a recognized bank transaction SMS"
+			results = append(results, result)
+			skippedCount++
+			continue
+		}
+
+		t := models.TransactionInput{
+			Amount:         sms.Amount,
+			Type:           sms.Type,
+			Category:       sms.Category,
+			Kind:           services.TransactionKind(sms.Type, sms.Category),
+			Operator:       sms.Bank,
+			Balance:        sms.Balance,
+			SMSFingerprint: fingerprint,
+			Date:           m.Date,
+		}
+		if sms.Counterparty != "" {
+			t.Recipient = maskPhoneNumbers(&sms.Counterparty)
+		}
+		if sms.Reference != "" {
+			t.Reference = &sms.Reference
+		}
+		if err := validateTransactionInput(t); err != nil {
+			result.Status = models.SyncStatusInvalid
+			result.Reason = err.Error()
+			results = append(results, result)
+			skippedCount++
+			continue
+		}
+		accountID := accounts.resolveBank(sms)
+
+		inserted, err := storeTransaction(ctx, tx, userID, req.AppVersion, fingerprint, t, nil, accountID)
+		if err != nil {
+			log.Printf("⚠️ Bank SMS insert failed for user %s: %v", userID, err)
+			result.Status = models.SyncStatusInvalid
+			result.Reason = "Failed to store transaction"
+			results = append(results, result)
+			skippedCount++
+			continue
+		}
+		if inserted && sms.Fee > 0 {
+			fee := t
+			fee.Amount, fee.Type, fee.Category, fee.Kind = sms.Fee, "EXPENSE", "FEES", services.KindFee
+			fee.Recipient, fee.Balance = nil, nil
+			feeInserted, err := storeTransaction(ctx, tx, userID, req.AppVersion, fingerprint+bankFeeSuffix, fee, nil, accountID)
+			if err != nil {
+				log.Printf("⚠️ Bank SMS fee insert failed for user %s: %v", userID, err)
+			} else if feeInserted {
+				insertedCount++
+			}
+		}
+
+		if inserted {
+			result.Status = models.SyncStatusInserted
+			insertedCount++
+		} else {
+			result.Status = models.SyncStatusDuplicate
+			result.Reason = "Transaction already synced"
+			skippedCount++
+		}
+		results = append(results, result)
+	}
+
+	if insertedCount > 0 {
+		if err := recordSyncStats(ctx, tx, userID, insertedCount); err != nil {
+			log.Printf("❌ Failed to update sync stats for user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if insertedCount > 0 {
+		h.Events.Publish(services.EventTransactionsSynced, userID, services.TransactionsSynced{
+			Inserted: insertedCount,
+			Total:    len(req.Messages),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Sync completed",
+		"inserted": insertedCount,
+		"skipped":  skippedCount,
+		"total":    len(req.Messages),
+		"results":  results,
+	})
+}
+
+// bankSMSFingerprint is the dedup key of a bank SMS: the SHA-256 hex of its
+// text with runs of whitespace collapsed to single spaces
+func bankSMSFingerprint(text string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(text), " ")))
+	return hex.EncodeToString(sum[:])
+}
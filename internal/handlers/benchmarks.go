@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// benchmarkWeeks is the window benchmarks average weekly spend over
+const benchmarkWeeks = 4
+
+// ComputeSpendingBenchmarks rebuilds the typical weekly spend per category
+// in each country from users who opted into analytics, over the last
+// complete weeks. Each
+// user who spent in a category counts once towards it, with their weekly
+// spend clamped to the privacy policy's bound, so heavy spenders don't skew
+// the cohort. Benchmarks are shown to users, so the cohort size and
+// percentiles are noised once here, and categories whose noisy cohort is
+// below MarketMinUsers are dropped.
+//
+// A percentile's noise is scaled to the clamp bound spread over the cohort,
+// which is how far one user typically moves it rather than the worst case
+func ComputeSpendingBenchmarks(ctx context.Context, db *sql.DB, privacy *services.PrivacyPolicy, now time.Time) error {
+	to := localDate(now)
+	from := to.AddDate(0, 0, -7*benchmarkWeeks)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT country, category, COUNT(*),
+			percentile_cont(0.25) WITHIN GROUP (ORDER BY weekly),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY weekly),
+			percentile_cont(0.75) WITHIN GROUP (ORDER BY weekly)
+		FROM (
+			SELECT u.country, t.user_id, `+mappedCategorySQL+` AS category, LEAST(SUM(t.amount) / $3, $4) AS weekly
+			FROM transactions t`+marketConsentFilter+`
+			AND t.type = 'EXPENSE'
+			GROUP BY 1, 2, 3
+		) per_user
+		WHERE category <> 'SAVINGS'
+		GROUP BY country, category
+	`, from, to, benchmarkWeeks, privacy.MaxVolume)
+	if err != nil {
+		return err
+	}
+
+	benchmarks := []models.SpendingBenchmark{}
+	for rows.Next() {
+		var b models.SpendingBenchmark
+		if err := rows.Scan(&b.Country, &b.Category, &b.Users, &b.P25Weekly, &b.MedianWeekly, &b.P75Weekly); err != nil {
+			rows.Close()
+			return err
+		}
+
+		id := []string{"benchmark", from.Format("2006-01-02"), b.Country, b.Category}
+		b.Users = privacy.Count(b.Users, 1, append(id, "users")...)
+		if b.Users < MarketMinUsers {
+			continue
+		}
+		sensitivity := privacy.MaxVolume / float64(b.Users)
+		percentiles := []float64{
+			privacy.Amount(b.P25Weekly, sensitivity, append(id, "p25")...),
+			privacy.Amount(b.MedianWeekly, sensitivity, append(id, "median")...),
+			privacy.Amount(b.P75Weekly, sensitivity, append(id, "p75")...),
+		}
+		sort.Float64s(percentiles)
+		b.P25Weekly, b.MedianWeekly, b.P75Weekly = percentiles[0], percentiles[1], percentiles[2]
+		benchmarks = append(benchmarks, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM spending_benchmarks"); err != nil {
+		return err
+	}
+	for _, b := range benchmarks {
+		_, err := tx.Exec(`
+			INSERT INTO spending_benchmarks (country, category, users, p25_weekly, median_weekly, p75_weekly, window_start, window_end)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, b.Country, b.Category, b.Users, b.P25Weekly, b.MedianWeekly, b.P75Weekly, from, to)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("📊 Spending benchmarks computed for %d country categories", len(benchmarks))
+	return nil
+}
+
+// GetBenchmarks compares the user's weekly spend per category with other
+// users' in their country. Only users sharing their own analytics can see
+// the comparison
+func (h *AnalyticsHandler) GetBenchmarks(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var consented bool
+	var country string
+	err := h.DB.QueryRowContext(ctx,
+		"SELECT consent_given AND COALESCE(consent_analytics, FALSE), country FROM users WHERE id = $1",
+		userID,
+	).Scan(&consented, &country)
+	if err != nil || !consented {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Analytics consent required to compare spending"})
+		return
+	}
+
+	rows, err := h.DB.QueryContext(ctx, `
+		SELECT category, users, p25_weekly, median_weekly, p75_weekly, window_start, window_end, computed_at
+		FROM spending_benchmarks
+		WHERE country = $1
+		ORDER BY median_weekly DESC
+	`, country)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch benchmarks"})
+		return
+	}
+	defer rows.Close()
+
+	benchmarks := []models.SpendingBenchmark{}
+	var from, to, computedAt time.Time
+	for rows.Next() {
+		var b models.SpendingBenchmark
+		if err := rows.Scan(&b.Category, &b.Users, &b.P25Weekly, &b.MedianWeekly, &b.P75Weekly, &from, &to, &computedAt); err != nil {
+			continue
+		}
+		benchmarks = append(benchmarks, b)
+	}
+	if len(benchmarks) == 0 {
+		c.JSON(http.StatusOK, gin.H{"benchmarks": benchmarks, "country": country, "min_users": MarketMinUsers})
+		return
+	}
+
+	// The user's own spend over the same window
+	yours := make(map[string]float64)
+	spend, err := h.DB.QueryContext(ctx, `
+		SELECT `+mappedCategorySQL+` AS mapped, SUM(amount) / $4
+		FROM transactions
+		WHERE user_id = $1 AND type = 'EXPENSE' AND date >= $2 AND date < $3
+		GROUP BY mapped
+	`, userID, from, to, benchmarkWeeks)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch spending"})
+		return
+	}
+	defer spend.Close()
+	for spend.Next() {
+		var category string
+		var weekly float64
+		if spend.Scan(&category, &weekly) == nil {
+			yours[category] = weekly
+		}
+	}
+
+	for i := range benchmarks {
+		b := &benchmarks[i]
+		b.YourWeekly = yours[b.Category]
+		switch {
+		case b.YourWeekly < b.P25Weekly:
+			b.Comparison = "below"
+		case b.YourWeekly > b.P75Weekly:
+			b.Comparison = "above"
+		default:
+			b.Comparison = "typical"
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"benchmarks":   benchmarks,
+		"country":      country,
+		"window_start": from.Format("2006-01-02"),
+		"window_end":   to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"computed_at":  computedAt,
+		"min_users":    MarketMinUsers,
+	})
+}
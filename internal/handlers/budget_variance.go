@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+// Budget variance statuses
+const (
+	budgetOnTrack = "on_track"
+	budgetAtRisk  = "at_risk" // Projected to run over by the month end
+	budgetOver    = "over"
+)
+
+// loadBudgetVariance compares each of the user's budgets with this month's
+// spending, projects it to the month end at the month-to-date daily rate,
+// and counts how many of the last complete months the user was active in
+// stayed within it. Past months are judged against today's budget
+func loadBudgetVariance(ctx context.Context, db *sql.DB, userID string, now time.Time) ([]models.BudgetVariance, error) {
+	budgets, err := loadBudgets(ctx, db, userID)
+	if err != nil || len(budgets) == 0 {
+		return []models.BudgetVariance{}, err
+	}
+
+	source, err := spendingSource(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	today := localDate(now)
+	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.Local)
+	from := monthStart.AddDate(0, -budgetHistoryMonths, 0)
+
+	// Month 0 is the oldest complete month and budgetHistoryMonths the current one
+	rows, err := db.QueryContext(ctx, `
+		SELECT COALESCE(`+mappedCategorySQL+`, '') AS mapped,
+			EXTRACT(YEAR FROM date)::int * 12 + EXTRACT(MONTH FROM date)::int - 1 AS month,
+			COALESCE(SUM(amount) FILTER (WHERE type = 'EXPENSE'), 0)
+		FROM `+source+`
+		WHERE user_id = $1 AND date >= $2 AND date < $3
+		GROUP BY mapped, month
+	`, userID, from, today.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	firstMonth := from.Year()*12 + int(from.Month()) - 1
+	spent := make(map[string][]float64)
+	active := make([]bool, budgetHistoryMonths)
+	for rows.Next() {
+		var category string
+		var month int
+		var total float64
+		if err := rows.Scan(&category, &month, &total); err != nil {
+			return nil, err
+		}
+		i := month - firstMonth
+		if i < 0 || i > budgetHistoryMonths {
+			continue
+		}
+		if i < budgetHistoryMonths {
+			active[i] = true
+		}
+		category = strings.ToUpper(category)
+		if spent[category] == nil {
+			spent[category] = make([]float64, budgetHistoryMonths+1)
+		}
+		spent[category][i] += total
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	daysElapsed := today.Day()
+	daysInMonth := monthStart.AddDate(0, 1, -1).Day()
+	variances := make([]models.BudgetVariance, 0, len(budgets))
+	for _, b := range budgets {
+		monthly := spent[b.Category]
+		if monthly == nil {
+			monthly = make([]float64, budgetHistoryMonths+1)
+		}
+
+		v := models.BudgetVariance{
+			Category:      b.Category,
+			Budget:        b.Amount,
+			Spent:         monthly[budgetHistoryMonths],
+			DailyBurnRate: monthly[budgetHistoryMonths] / float64(daysElapsed),
+			Status:        budgetOnTrack,
+		}
+		v.Remaining = v.Budget - v.Spent
+		v.PercentUsed = int(math.Round(v.Spent / v.Budget * 100))
+		v.ProjectedSpend = v.Spent + v.DailyBurnRate*float64(daysInMonth-daysElapsed)
+
+		switch {
+		case v.Spent > v.Budget:
+			v.Status = budgetOver
+		case v.ProjectedSpend > v.Budget:
+			v.Status = budgetAtRisk
+			// The day the running total passes the budget at today's rate
+			days := int(math.Ceil(v.Remaining / v.DailyBurnRate))
+			overrun := today.AddDate(0, 0, days).Format("2006-01-02")
+			v.OverrunDate = &overrun
+		}
+
+		for i := 0; i < budgetHistoryMonths; i++ {
+			if !active[i] {
+				continue
+			}
+			v.Months++
+			if monthly[i] <= b.Amount {
+				v.MonthsWithin++
+			}
+		}
+		variances = append(variances, v)
+	}
+	return variances, nil
+}
+
+// GetBudgetVariance returns each budget against this month's spending, with
+// the daily burn rate, the projected month-end spend and the day the budget
+// is projected to run out, plus how often recent months stayed within it
+func (h *AnalyticsHandler) GetBudgetVariance(c *gin.Context) {
+	now := time.Now()
+	variances, err := loadBudgetVariance(c.Request.Context(), h.DB, c.GetString("user_id"), now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate budget variance"})
+		return
+	}
+
+	var budgeted, spent float64
+	within, months := 0, 0
+	for _, v := range variances {
+		budgeted += v.Budget
+		spent += v.Spent
+		within += v.MonthsWithin
+		months += v.Months
+	}
+	// Share of budget-months that stayed within the budget
+	var adherence *float64
+	if months > 0 {
+		a := float64(within) / float64(months)
+		adherence = &a
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"month":          now.Format("2006-01"),
+		"budgets":        variances,
+		"total_budget":   budgeted,
+		"total_spent":    spent,
+		"adherence_rate": adherence,
+	})
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// budgetHistoryMonths is how many complete months budget suggestions and
+// adherence look back over
+const budgetHistoryMonths = 3
+
+// maxBudgets is how many categories a user can budget for
+const maxBudgets = 30
+
+// BudgetsHandler manages the user's budgets and suggests them from spending history
+type BudgetsHandler struct {
+	DB     *sql.DB
+	Gemini *services.GeminiService // Optional; refines suggestions when set
+}
+
+// SuggestBudgets returns a budget per category from the median of the last
+// three complete months plus a buffer. With "use_ai" the set is adjusted by
+// Gemini for local living costs, falling back to the history-based set
+func (h *BudgetsHandler) SuggestBudgets(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		UseAI bool `json:"use_ai"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	from := to.AddDate(0, -budgetHistoryMonths, 0)
+
+	rows, err := h.DB.Query(`
+		SELECT `+mappedCategorySQL+` AS mapped,
+			EXTRACT(YEAR FROM date)::int * 12 + EXTRACT(MONTH FROM date)::int - 1 AS month,
+			SUM(amount)
+		FROM transactions
+		WHERE user_id = $1 AND type = 'EXPENSE' AND date >= $2 AND date < $3
+		GROUP BY mapped, month
+	`, userID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch spending history"})
+		return
+	}
+	defer rows.Close()
+
+	// One slot per month, so months without spend count as zero
+	firstMonth := from.Year()*12 + int(from.Month()) - 1
+	monthly := make(map[string][]float64)
+	for rows.Next() {
+		var category string
+		var month int
+		var total float64
+		if rows.Scan(&category, &month, &total) != nil {
+			continue
+		}
+		if monthly[category] == nil {
+			monthly[category] = make([]float64, budgetHistoryMonths)
+		}
+		if i := month - firstMonth; i >= 0 && i < budgetHistoryMonths {
+			monthly[category][i] = total
+		}
+	}
+
+	budgets := services.SuggestBudgets(monthly)
+	source := "history"
+
+	if req.UseAI && h.Gemini != nil && len(budgets) > 0 {
+		// Categories the user keeps from the AI keep their history-based budget.
+		// If the exclusions can't be read nothing is sent
+		excluded, err := loadAIExclusions(h.DB, userID)
+		if err != nil {
+			log.Printf("⚠️ Failed to load AI exclusions for user %s: %v", userID, err)
+		}
+		private := make(map[string]bool)
+		for _, cat := range excluded {
+			private[cat] = true
+		}
+		shared := []services.BudgetSuggestion{}
+		for _, b := range budgets {
+			if !private[b.Category] {
+				shared = append(shared, b)
+			}
+		}
+
+		if err == nil && len(shared) > 0 {
+			var income sql.NullFloat64
+			h.DB.QueryRow(`
+				SELECT COALESCE(SUM(amount), 0) / $4
+				FROM transactions
+				WHERE user_id = $1 AND type = 'INCOME' AND date >= $2 AND date < $3
+			`, userID, from, to, budgetHistoryMonths).Scan(&income)
+
+			refined, _, err := h.Gemini.RefineBudgets(services.WithAIUsers(c.Request.Context(), userID),
+				loadCountry(c.Request.Context(), h.DB, userID), shared, income.Float64)
+			switch {
+			case err == nil:
+				for _, b := range budgets {
+					if private[b.Category] {
+						refined = append(refined, b)
+					}
+				}
+				sort.SliceStable(refined, func(i, j int) bool { return refined[i].Amount > refined[j].Amount })
+				budgets, source = refined, "ai"
+			case errors.Is(err, services.ErrAIUnavailable):
+				// History-based budgets are still a good answer
+			default:
+				log.Printf("⚠️ Budget refinement failed for user %s: %v", userID, err)
+			}
+		}
+	}
+
+	total := 0.0
+	for _, b := range budgets {
+		total += b.Amount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"budgets": budgets,
+		"total":   total,
+		"source":  source,
+		"from":    from.Format("2006-01-02"),
+		"to":      to.AddDate(0, 0, -1).Format("2006-01-02"),
+	})
+}
+
+// loadBudgets returns the user's budgets, largest first
+func loadBudgets(ctx context.Context, db *sql.DB, userID string) ([]models.Budget, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT category, amount, updated_at FROM budgets WHERE user_id = $1 ORDER BY amount DESC, category",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []models.Budget{}
+	for rows.Next() {
+		var b models.Budget
+		if err := rows.Scan(&b.Category, &b.Amount, &b.UpdatedAt); err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets, rows.Err()
+}
+
+// GetBudgets lists the user's monthly budgets
+func (h *BudgetsHandler) GetBudgets(c *gin.Context) {
+	budgets, err := loadBudgets(c.Request.Context(), h.DB, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch budgets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"budgets": budgets})
+}
+
+// SetBudgets replaces the user's budgets, e.g. with an accepted set of
+// suggestions. An empty list removes them all
+func (h *BudgetsHandler) SetBudgets(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req struct {
+		Budgets []models.Budget `json:"budgets" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Budgets) > maxBudgets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You can budget for at most %d categories", maxBudgets)})
+		return
+	}
+
+	seen := make(map[string]bool, len(req.Budgets))
+	for i := range req.Budgets {
+		category := strings.ToUpper(strings.TrimSpace(req.Budgets[i].Category))
+		if seen[category] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "category " + category + " is repeated"})
+			return
+		}
+		if services.IsNonBudgetCategory(category) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": category + " can't be budgeted"})
+			return
+		}
+		seen[category] = true
+		req.Budgets[i].Category = category
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save budgets"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM budgets WHERE user_id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save budgets"})
+		return
+	}
+	for _, b := range req.Budgets {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO budgets (user_id, category, amount) VALUES ($1, $2, $3)",
+			userID, b.Category, b.Amount,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save budgets"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save budgets"})
+		return
+	}
+
+	budgets, err := loadBudgets(ctx, h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch budgets"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"budgets": budgets})
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+var (
+	categoryCodePattern  = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,49}$`)
+	categoryIconPattern  = regexp.MustCompile(`^[a-z0-9_]{1,50}$`)
+	categoryColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+)
+
+// CategoriesHandler serves category display metadata to the app
+type CategoriesHandler struct {
+	DB *sql.DB
+}
+
+// loadCategories returns the categories in display order with every
+// translation, naming each in language where translated and English otherwise
+func loadCategories(ctx context.Context, db *sql.DB, language string) ([]models.Category, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.code, c.type, c.icon, c.color, c.position, c.updated_at, COALESCE(n.language, ''), COALESCE(n.name, '')
+		FROM categories c
+		LEFT JOIN category_names n ON n.category = c.code
+		ORDER BY c.position, c.code
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var c models.Category
+		var lang, name string
+		if err := rows.Scan(&c.Code, &c.Type, &c.Icon, &c.Color, &c.Position, &c.UpdatedAt, &lang, &name); err != nil {
+			return nil, err
+		}
+		if n := len(categories); n == 0 || categories[n-1].Code != c.Code {
+			c.Names = make(map[string]string)
+			categories = append(categories, c)
+		}
+		if lang != "" {
+			categories[len(categories)-1].Names[lang] = name
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range categories {
+		c := &categories[i]
+		c.Name = c.Names[language]
+		if c.Name == "" {
+			c.Name = c.Names[services.DefaultLocale]
+		}
+		if c.Name == "" {
+			c.Name = c.Code
+		}
+	}
+	return categories, nil
+}
+
+// GetCategories returns the canonical categories with their icon, color and
+// names, in the user's language unless ?language= asks for another
+func (h *CategoriesHandler) GetCategories(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	language := strings.ToLower(c.Query("language"))
+	if language == "" {
+		h.DB.QueryRowContext(ctx,
+			"SELECT COALESCE(NULLIF(language, ''), 'en') FROM users WHERE id = $1",
+			c.GetString("user_id"),
+		).Scan(&language)
+	}
+
+	categories, err := loadCategories(ctx, h.DB, language)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+// GetCategories lists the category display metadata with every translation
+func (h *AdminHandler) GetCategories(c *gin.Context) {
+	categories, err := loadCategories(c.Request.Context(), h.DB, services.DefaultLocale)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+// SaveCategory creates or updates the category with the code in the path.
+// names replaces its translations and needs an English name
+func (h *AdminHandler) SaveCategory(c *gin.Context) {
+	ctx := c.Request.Context()
+	code := strings.ToUpper(c.Param("code"))
+
+	var req struct {
+		Type     string            `json:"type" binding:"required,oneof=EXPENSE INCOME"`
+		Icon     string            `json:"icon" binding:"required"`
+		Color    string            `json:"color" binding:"required"`
+		Position int               `json:"position"`
+		Names    map[string]string `json:"names" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !categoryCodePattern.MatchString(code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category code must be upper case letters, digits and underscores"})
+		return
+	}
+	if !categoryIconPattern.MatchString(req.Icon) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "icon must be a lower case key, e.g. shopping_cart"})
+		return
+	}
+	if !categoryColorPattern.MatchString(req.Color) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "color must be a hex color, e.g. #1E88E5"})
+		return
+	}
+
+	names := make(map[string]string, len(req.Names))
+	for lang, name := range req.Names {
+		lang = strings.ToLower(lang)
+		name = strings.TrimSpace(name)
+		if !services.IsSupportedLocale(lang) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported language " + lang})
+			return
+		}
+		if name == "" || len(name) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Names must be 1 to 100 characters"})
+			return
+		}
+		names[lang] = name
+	}
+	if names[services.DefaultLocale] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An English name is required"})
+		return
+	}
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save category"})
+		return
+	}
+	defer tx.Rollback()
+
+	saved := models.Category{
+		Code:     code,
+		Type:     req.Type,
+		Icon:     req.Icon,
+		Color:    strings.ToUpper(req.Color),
+		Position: req.Position,
+		Name:     names[services.DefaultLocale],
+		Names:    names,
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO categories (code, type, icon, color, position)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (code) DO UPDATE SET
+			type = EXCLUDED.type, icon = EXCLUDED.icon, color = EXCLUDED.color,
+			position = EXCLUDED.position, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`, saved.Code, saved.Type, saved.Icon, saved.Color, saved.Position).Scan(&saved.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save category"})
+		return
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM category_names WHERE category = $1", code); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save category"})
+		return
+	}
+	for lang, name := range names {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO category_names (category, language, name) VALUES ($1, $2, $3)",
+			code, lang, name,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save category"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// DeleteCategory removes a category's display metadata; its transactions keep their category
+func (h *AdminHandler) DeleteCategory(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM categories WHERE code = $1", strings.ToUpper(c.Param("code")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted"})
+}
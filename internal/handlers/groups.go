@@ -0,0 +1,786 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeGroupMatching matches a user's synced income to their groups' contributions
+const JobTypeGroupMatching = "group_matching"
+
+// Contribution cycles
+const (
+	groupCycleWeekly  = "weekly"
+	groupCycleMonthly = "monthly"
+)
+
+const (
+	maxGroupMembers     = 50
+	groupReminderLead   = 2    // Days before a cycle ends that the organizer is reminded
+	groupMatchTolerance = 0.01 // Share of the amount due a matched payment may exceed it by
+	groupReminderNames  = 3    // Unpaid members named in a reminder before "and N others"
+)
+
+// GroupsHandler tracks chilimba / village banking contributions for the groups a user organizes
+type GroupsHandler struct {
+	DB *sql.DB
+}
+
+// groupMemberInput is a member as sent by the app
+type groupMemberInput struct {
+	Name      string  `json:"name" binding:"required"`
+	Phone     *string `json:"phone"`
+	Reference *string `json:"reference"`
+}
+
+// contributionGroup is a group row as needed to work out its cycles
+type contributionGroup struct {
+	id          string
+	organizerID string
+	name        string
+	amount      float64
+	cycle       string
+	startDate   time.Time
+	createdAt   time.Time
+}
+
+// cycleStart returns the start of the cycle containing day. Days before the
+// group starts belong to its first cycle
+func (g contributionGroup) cycleStart(day time.Time) time.Time {
+	day = dateOnly(day)
+	if !day.After(g.startDate) {
+		return g.startDate
+	}
+	if g.cycle == groupCycleMonthly {
+		months := (day.Year()-g.startDate.Year())*12 + int(day.Month()) - int(g.startDate.Month())
+		if start := g.startDate.AddDate(0, months, 0); !start.After(day) {
+			return start
+		}
+		return g.startDate.AddDate(0, months-1, 0)
+	}
+	days := int(day.Sub(g.startDate).Hours() / 24)
+	return g.startDate.AddDate(0, 0, days/7*7)
+}
+
+// nextCycle returns the start of the cycle after the one starting at start
+func (g contributionGroup) nextCycle(start time.Time) time.Time {
+	if g.cycle == groupCycleMonthly {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 7)
+}
+
+// previousCycle returns the start of the cycle before the one starting at start
+func (g contributionGroup) previousCycle(start time.Time) time.Time {
+	if !start.After(g.startDate) {
+		return g.startDate
+	}
+	if g.cycle == groupCycleMonthly {
+		return start.AddDate(0, -1, 0)
+	}
+	return start.AddDate(0, 0, -7)
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// loadGroup fetches a group the user organizes
+func loadGroup(ctx context.Context, db *sql.DB, groupID, userID string) (contributionGroup, error) {
+	g := contributionGroup{id: groupID, organizerID: userID}
+	err := db.QueryRowContext(ctx, `
+		SELECT name, contribution_amount, cycle, start_date, created_at
+		FROM contribution_groups WHERE id = $1 AND organizer_id = $2
+	`, groupID, userID).Scan(&g.name, &g.amount, &g.cycle, &g.startDate, &g.createdAt)
+	return g, err
+}
+
+// loadUserGroups fetches every group the user organizes
+func loadUserGroups(ctx context.Context, db *sql.DB, userID string) ([]contributionGroup, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, contribution_amount, cycle, start_date, created_at
+		FROM contribution_groups WHERE organizer_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []contributionGroup
+	for rows.Next() {
+		g := contributionGroup{organizerID: userID}
+		if err := rows.Scan(&g.id, &g.name, &g.amount, &g.cycle, &g.startDate, &g.createdAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// ensureCycle records the expected contribution of every member for a cycle.
+// The amount is fixed when the cycle starts, so changing the group's amount
+// later doesn't rewrite history
+func ensureCycle(ctx context.Context, db *sql.DB, g contributionGroup, cycleStart time.Time) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO group_contributions (member_id, cycle_start, expected_amount)
+		SELECT id, $2, $3 FROM group_members WHERE group_id = $1
+		ON CONFLICT (member_id, cycle_start) DO NOTHING
+	`, g.id, cycleStart, g.amount)
+	return err
+}
+
+// groupStatus builds the API view of a group for one cycle
+func groupStatus(ctx context.Context, db *sql.DB, g contributionGroup, cycleStart time.Time) (models.ContributionGroup, error) {
+	status := models.ContributionGroup{
+		Name:               g.name,
+		ContributionAmount: g.amount,
+		Cycle:              g.cycle,
+		StartDate:          g.startDate.Format("2006-01-02"),
+		CycleStart:         cycleStart.Format("2006-01-02"),
+		CycleEnd:           g.nextCycle(cycleStart).AddDate(0, 0, -1).Format("2006-01-02"),
+		Members:            []models.GroupMemberStatus{},
+		CreatedAt:          g.createdAt,
+	}
+	status.ID, _ = uuid.Parse(g.id)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT m.id, m.name, m.phone, m.reference, COALESCE(c.expected_amount, 0), COALESCE(p.paid, 0)
+		FROM group_members m
+		LEFT JOIN group_contributions c ON c.member_id = m.id AND c.cycle_start = $2
+		LEFT JOIN (
+			SELECT member_id, SUM(amount) AS paid FROM group_payments
+			WHERE cycle_start = $2 GROUP BY member_id
+		) p ON p.member_id = m.id
+		WHERE m.group_id = $1
+		ORDER BY m.created_at, m.name
+	`, g.id, cycleStart)
+	if err != nil {
+		return status, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m models.GroupMemberStatus
+		var phone, reference sql.NullString
+		if err := rows.Scan(&m.ID, &m.Name, &phone, &reference, &m.Expected, &m.Paid); err != nil {
+			return status, err
+		}
+		if phone.Valid {
+			m.Phone = &phone.String
+		}
+		if reference.Valid {
+			m.Reference = &reference.String
+		}
+		m.PaidUp = m.Paid >= m.Expected
+		if m.PaidUp {
+			status.PaidCount++
+		}
+		status.Expected += m.Expected
+		status.Collected += m.Paid
+		status.Members = append(status.Members, m)
+	}
+	return status, rows.Err()
+}
+
+// insertMembers adds members to a group within tx
+func insertMembers(tx *sql.Tx, groupID string, members []groupMemberInput) error {
+	for _, m := range members {
+		_, err := tx.Exec(
+			"INSERT INTO group_members (group_id, name, phone, reference) VALUES ($1, $2, $3, $4)",
+			groupID, strings.TrimSpace(m.Name), trimmedOrNil(m.Phone), trimmedOrNil(m.Reference),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func trimmedOrNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*s)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// CreateGroup creates a group with its members
+func (h *GroupsHandler) CreateGroup(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Name               string             `json:"name" binding:"required"`
+		ContributionAmount float64            `json:"contribution_amount" binding:"required,gt=0"`
+		Cycle              string             `json:"cycle" binding:"required,oneof=weekly monthly"`
+		StartDate          string             `json:"start_date" binding:"required"` // YYYY-MM-DD
+		Members            []groupMemberInput `json:"members" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be YYYY-MM-DD"})
+		return
+	}
+	// Later days don't exist in every month
+	if req.Cycle == groupCycleMonthly && startDate.Day() > 28 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Monthly groups must start on or before the 28th"})
+		return
+	}
+	if len(req.Members) > maxGroupMembers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A group can have at most %d members", maxGroupMembers)})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+	defer tx.Rollback()
+
+	g := contributionGroup{
+		organizerID: userID,
+		name:        strings.TrimSpace(req.Name),
+		amount:      req.ContributionAmount,
+		cycle:       req.Cycle,
+		startDate:   startDate,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO contribution_groups (organizer_id, name, contribution_amount, cycle, start_date)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, userID, g.name, g.amount, g.cycle, g.startDate).Scan(&g.id, &g.createdAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+	if err := insertMembers(tx, g.id, req.Members); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add members"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	cycleStart := g.cycleStart(time.Now())
+	ensureCycle(ctx, h.DB, g, cycleStart)
+	status, err := groupStatus(ctx, h.DB, g, cycleStart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, status)
+}
+
+// GetGroups lists the user's groups with who has paid in the current cycle
+func (h *GroupsHandler) GetGroups(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	groups, err := loadUserGroups(ctx, h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
+		return
+	}
+
+	result := []models.ContributionGroup{}
+	for _, g := range groups {
+		cycleStart := g.cycleStart(time.Now())
+		if err := ensureCycle(ctx, h.DB, g, cycleStart); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
+			return
+		}
+		status, err := groupStatus(ctx, h.DB, g, cycleStart)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
+			return
+		}
+		result = append(result, status)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"groups": result})
+}
+
+// GetGroup returns one group for the current cycle, or for the cycle
+// containing the "cycle" query date (YYYY-MM-DD)
+func (h *GroupsHandler) GetGroup(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	g, err := loadGroup(ctx, h.DB, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	day := time.Now()
+	if q := c.Query("cycle"); q != "" {
+		if day, err = time.Parse("2006-01-02", q); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cycle must be YYYY-MM-DD"})
+			return
+		}
+	}
+	cycleStart := g.cycleStart(day)
+
+	// Past cycles show what was recorded at the time
+	if cycleStart.Equal(g.cycleStart(time.Now())) {
+		ensureCycle(ctx, h.DB, g, cycleStart)
+	}
+	status, err := groupStatus(ctx, h.DB, g, cycleStart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// AddGroupMembers adds members to a group. They owe from the current cycle on
+func (h *GroupsHandler) AddGroupMembers(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req struct {
+		Members []groupMemberInput `json:"members" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	g, err := loadGroup(ctx, h.DB, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var count int
+	h.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM group_members WHERE group_id = $1", g.id).Scan(&count)
+	if count+len(req.Members) > maxGroupMembers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A group can have at most %d members", maxGroupMembers)})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add members"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := insertMembers(tx, g.id, req.Members); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add members"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add members"})
+		return
+	}
+
+	cycleStart := g.cycleStart(time.Now())
+	ensureCycle(ctx, h.DB, g, cycleStart)
+	status, err := groupStatus(ctx, h.DB, g, cycleStart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// RecordGroupPayment logs a contribution paid outside mobile money, e.g. in cash
+func (h *GroupsHandler) RecordGroupPayment(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req struct {
+		MemberID string  `json:"member_id" binding:"required"`
+		Amount   float64 `json:"amount" binding:"required,gt=0"`
+		PaidAt   string  `json:"paid_at"` // YYYY-MM-DD, defaults to today
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	g, err := loadGroup(ctx, h.DB, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	paidAt := time.Now()
+	if req.PaidAt != "" {
+		if paidAt, err = time.Parse("2006-01-02", req.PaidAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paid_at must be YYYY-MM-DD"})
+			return
+		}
+	}
+	cycleStart := g.cycleStart(paidAt)
+
+	result, err := h.DB.ExecContext(ctx, `
+		INSERT INTO group_payments (member_id, cycle_start, amount, paid_at)
+		SELECT id, $3, $4, $5 FROM group_members WHERE id = $1 AND group_id = $2
+	`, req.MemberID, g.id, cycleStart, req.Amount, paidAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	if cycleStart.Equal(g.cycleStart(time.Now())) {
+		ensureCycle(ctx, h.DB, g, cycleStart)
+	}
+	status, err := groupStatus(ctx, h.DB, g, cycleStart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, status)
+}
+
+// DeleteGroup deletes a group with its members and payments
+func (h *GroupsHandler) DeleteGroup(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	result, err := h.DB.Exec("DELETE FROM contribution_groups WHERE id = $1 AND organizer_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
+}
+
+// GroupMatchingJob returns the job type that matches synced income to group contributions
+func GroupMatchingJob(db *sql.DB) services.JobType {
+	return services.JobType{
+		Name: JobTypeGroupMatching,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			matched, err := matchGroupPayments(ctx, db, job.UserID.String())
+			if err != nil {
+				return nil, err
+			}
+			return gin.H{"matched": matched}, nil
+		},
+	}
+}
+
+// dueContribution is a member's unpaid contribution for one cycle
+type dueContribution struct {
+	memberID   string
+	cycleStart time.Time
+	due        float64
+	name       string
+	phone      string
+	phoneHash  string // The phone as the app hashes recipients, to match hashed payers
+	reference  string
+}
+
+// matchGroupPayments matches the organizer's unmatched income since the
+// previous cycle to members who still owe. A payment matches a member when
+// their reference, phone number or name appears in the SMS, or the payer's
+// hashed number is theirs, and it's no more than they owe; failing that, an
+// amount owed by exactly one member matches them
+func matchGroupPayments(ctx context.Context, db *sql.DB, userID string) (int, error) {
+	groups, err := loadUserGroups(ctx, db, userID)
+	if err != nil {
+		return 0, err
+	}
+	salt, err := recipientSalt(db, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	matched := 0
+	for _, g := range groups {
+		current := g.cycleStart(time.Now())
+		if err := ensureCycle(ctx, db, g, current); err != nil {
+			return matched, err
+		}
+		since := g.previousCycle(current)
+
+		dues, err := loadDueContributions(ctx, db, g.id, since)
+		if err != nil {
+			return matched, err
+		}
+		if len(dues) == 0 {
+			continue
+		}
+		for _, d := range dues {
+			d.phoneHash = hashRecipient(salt, d.phone)
+		}
+
+		rows, err := db.QueryContext(ctx, `
+			SELECT id, amount, COALESCE(reference, ''), COALESCE(recipient, ''), COALESCE(description, ''),
+				COALESCE(recipient_hash, ''), date
+			FROM transactions t
+			WHERE user_id = $1 AND type = 'INCOME' AND date >= $2
+			AND NOT EXISTS (SELECT 1 FROM group_payments p WHERE p.transaction_id = t.id)
+			ORDER BY date
+		`, userID, since)
+		if err != nil {
+			return matched, err
+		}
+
+		type payment struct {
+			transactionID string
+			amount        float64
+			date          time.Time
+			due           *dueContribution
+		}
+		var payments []payment
+		for rows.Next() {
+			var p payment
+			var reference, recipient, description, recipientHash string
+			if err := rows.Scan(&p.transactionID, &p.amount, &reference, &recipient, &description, &recipientHash, &p.date); err != nil {
+				rows.Close()
+				return matched, err
+			}
+			p.due = matchContribution(dues, g.cycleStart(p.date), p.amount, reference+" "+recipient+" "+description, recipientHash)
+			if p.due != nil {
+				p.due.due -= p.amount
+				payments = append(payments, p)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return matched, err
+		}
+
+		for _, p := range payments {
+			// The transaction may have been matched by a concurrent run
+			result, err := db.ExecContext(ctx, `
+				INSERT INTO group_payments (member_id, cycle_start, amount, transaction_id, paid_at)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (transaction_id) DO NOTHING
+			`, p.due.memberID, p.due.cycleStart, p.amount, p.transactionID, p.date)
+			if err != nil {
+				return matched, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				matched++
+			}
+		}
+	}
+	return matched, nil
+}
+
+// loadDueContributions fetches the group's unpaid contributions for cycles starting on or after since
+func loadDueContributions(ctx context.Context, db *sql.DB, groupID string, since time.Time) ([]*dueContribution, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.member_id, c.cycle_start, c.expected_amount - COALESCE(SUM(p.amount), 0),
+			m.name, COALESCE(m.phone, ''), COALESCE(m.reference, '')
+		FROM group_contributions c
+		JOIN group_members m ON m.id = c.member_id
+		LEFT JOIN group_payments p ON p.member_id = c.member_id AND p.cycle_start = c.cycle_start
+		WHERE m.group_id = $1 AND c.cycle_start >= $2
+		GROUP BY c.member_id, c.cycle_start, c.expected_amount, m.name, m.phone, m.reference, m.created_at
+		HAVING c.expected_amount > COALESCE(SUM(p.amount), 0)
+		ORDER BY c.cycle_start, m.created_at
+	`, groupID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dues []*dueContribution
+	for rows.Next() {
+		d := &dueContribution{}
+		if err := rows.Scan(&d.memberID, &d.cycleStart, &d.due, &d.name, &d.phone, &d.reference); err != nil {
+			return nil, err
+		}
+		dues = append(dues, d)
+	}
+	return dues, rows.Err()
+}
+
+// matchContribution picks the contribution in a cycle that a payment most likely settles, or nil
+func matchContribution(dues []*dueContribution, cycleStart time.Time, amount float64, text, recipientHash string) *dueContribution {
+	lower := strings.ToLower(text)
+	digits := digitsOnly(text)
+
+	var byAmount []*dueContribution
+	for _, d := range dues {
+		if !d.cycleStart.Equal(cycleStart) || d.due <= 0 {
+			continue
+		}
+		if math.Abs(d.due-amount) < 0.01 {
+			byAmount = append(byAmount, d)
+		}
+		if amount > d.due*(1+groupMatchTolerance) {
+			continue
+		}
+
+		switch {
+		case d.reference != "" && strings.Contains(lower, strings.ToLower(d.reference)):
+			return d
+		case len(digitsOnly(d.phone)) >= 9 && strings.Contains(digits, lastN(digitsOnly(d.phone), 9)):
+			return d
+		case recipientHash != "" && recipientHash == d.phoneHash:
+			return d
+		case strings.Contains(lower, strings.ToLower(d.name)):
+			return d
+		}
+	}
+
+	if len(byAmount) == 1 {
+		return byAmount[0]
+	}
+	return nil
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func lastN(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+// SendGroupReminders tells organizers who hasn't paid yet, once per cycle,
+// in the last days before the cycle ends. Income is matched first so members
+// who paid since the last sync aren't listed
+func SendGroupReminders(ctx context.Context, db *sql.DB, notifier *notifications.Service) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, organizer_id, name, contribution_amount, cycle, start_date, created_at, reminded_cycle
+		FROM contribution_groups
+		WHERE start_date <= CURRENT_DATE
+	`)
+	if err != nil {
+		return err
+	}
+
+	today := dateOnly(time.Now())
+	var due []contributionGroup
+	for rows.Next() {
+		var g contributionGroup
+		var reminded sql.NullTime
+		if err := rows.Scan(&g.id, &g.organizerID, &g.name, &g.amount, &g.cycle, &g.startDate, &g.createdAt, &reminded); err != nil {
+			rows.Close()
+			return err
+		}
+		cycleStart := g.cycleStart(today)
+		if reminded.Valid && reminded.Time.Equal(cycleStart) {
+			continue
+		}
+		if g.nextCycle(cycleStart).Sub(today) <= groupReminderLead*24*time.Hour {
+			due = append(due, g)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	matchedOrganizers := make(map[string]bool)
+	for _, g := range due {
+		if !matchedOrganizers[g.organizerID] {
+			matchedOrganizers[g.organizerID] = true
+			if _, err := matchGroupPayments(ctx, db, g.organizerID); err != nil {
+				log.Printf("⚠️ Failed to match group payments for user %s: %v", g.organizerID, err)
+			}
+		}
+		if err := sendGroupReminder(ctx, db, notifier, g, g.cycleStart(today)); err != nil {
+			log.Printf("❌ Failed to send reminder for group %s: %v", g.id, err)
+		}
+	}
+	return nil
+}
+
+// sendGroupReminder queues the organizer's reminder for one group and marks the cycle reminded
+func sendGroupReminder(ctx context.Context, db *sql.DB, notifier *notifications.Service, g contributionGroup, cycleStart time.Time) error {
+	if err := ensureCycle(ctx, db, g, cycleStart); err != nil {
+		return err
+	}
+	status, err := groupStatus(ctx, db, g, cycleStart)
+	if err != nil {
+		return err
+	}
+
+	var unpaid []string
+	for _, m := range status.Members {
+		if !m.PaidUp {
+			unpaid = append(unpaid, m.Name)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE contribution_groups SET reminded_cycle = $2 WHERE id = $1", g.id, cycleStart); err != nil {
+		return err
+	}
+	if len(unpaid) > 0 {
+		cycleEnd := g.nextCycle(cycleStart).AddDate(0, 0, -1)
+		err := notifier.Send(tx, g.organizerID, models.Notification{
+			Type: models.NotificationReminders,
+			Push: models.PushNotification{
+				Title: fmt.Sprintf("%s: %d still to pay", g.name, len(unpaid)),
+				Body:  fmt.Sprintf("Not yet paid their %s: %s. This cycle ends %s.", services.FormatKwacha(g.amount), joinNames(unpaid), cycleEnd.Format("2 Jan")),
+				Data: map[string]string{
+					"type":     "group_reminder",
+					"group_id": g.id,
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// joinNames lists names as "A, B and C", shortening long lists to "A, B, C and 4 others"
+func joinNames(names []string) string {
+	if len(names) > groupReminderNames+1 {
+		names = append(names[:groupReminderNames:groupReminderNames], fmt.Sprintf("%d others", len(names)-groupReminderNames))
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// highlightsLimit is how many items each highlights list holds
+const highlightsLimit = 5
+
+// GetHighlights returns the period's (week, month, year or all) largest
+// expenses and incomes, most frequent recipients and merchants paid for the
+// first time, for the app's month in review
+func (h *AnalyticsHandler) GetHighlights(c *gin.Context) {
+	userID := c.GetString("user_id")
+	period := c.DefaultQuery("period", "month")
+
+	var since time.Time
+	now := time.Now()
+	switch period {
+	case "week":
+		since = now.AddDate(0, 0, -7)
+	case "month":
+		since = now.AddDate(0, -1, 0)
+	case "year":
+		since = now.AddDate(-1, 0, 0)
+	default:
+		period = "all"
+	}
+
+	highlights, err := loadHighlights(c.Request.Context(), h.DB, userID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load highlights"})
+		return
+	}
+	highlights.Period = period
+
+	c.JSON(http.StatusOK, highlights)
+}
+
+// loadHighlights picks out the standout transactions since the given time
+// (zero for all time). Hashed recipients are grouped by hash and shown by
+// their latest alias. A merchant is new when nothing was paid to it before
+// since; people, who are paid through transfers, are never merchants
+func loadHighlights(ctx context.Context, db *sql.DB, userID string, since time.Time) (*models.Highlights, error) {
+	highlights := &models.Highlights{
+		LargestExpenses:    []models.HighlightTransaction{},
+		LargestIncomes:     []models.HighlightTransaction{},
+		FrequentRecipients: []models.RecipientHighlight{},
+		NewMerchants:       []models.RecipientHighlight{},
+	}
+
+	// Metadata-only users keep no individual transactions
+	source, err := spendingSource(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if source != transactionSource {
+		return highlights, nil
+	}
+
+	if highlights.LargestExpenses, err = loadLargestTransactions(ctx, db, userID, "EXPENSE", since); err != nil {
+		return nil, err
+	}
+	if highlights.LargestIncomes, err = loadLargestTransactions(ctx, db, userID, "INCOME", since); err != nil {
+		return nil, err
+	}
+
+	highlights.FrequentRecipients, err = loadRecipientHighlights(ctx, db, `
+		SELECT COALESCE((array_agg(recipient ORDER BY date DESC))[1], ''),
+			(array_agg(`+mappedCategorySQL+` ORDER BY date DESC))[1],
+			COUNT(*), SUM(amount)
+		FROM transactions
+		WHERE user_id = $1 AND type = 'EXPENSE' AND date >= $2
+		AND (recipient_hash IS NOT NULL OR (recipient IS NOT NULL AND recipient <> ''))
+		GROUP BY COALESCE(recipient_hash, recipient)
+		ORDER BY COUNT(*) DESC, SUM(amount) DESC
+		LIMIT $3
+	`, userID, since, highlightsLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Over all time every merchant is new, so there's nothing to single out
+	if since.IsZero() {
+		return highlights, nil
+	}
+	highlights.NewMerchants, err = loadRecipientHighlights(ctx, db, `
+		SELECT recipient,
+			(array_agg(`+mappedCategorySQL+` ORDER BY date DESC))[1],
+			COUNT(*), SUM(amount)
+		FROM transactions
+		WHERE user_id = $1 AND type = 'EXPENSE'
+		AND recipient_hash IS NULL AND recipient IS NOT NULL AND recipient <> ''
+		AND category NOT IN ('TRANSFER', 'RECEIVED')
+		GROUP BY recipient
+		HAVING MIN(date) >= $2
+		ORDER BY SUM(amount) DESC
+		LIMIT $3
+	`, userID, since, highlightsLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return highlights, nil
+}
+
+// loadLargestTransactions returns the user's largest transactions of a type since the given time
+func loadLargestTransactions(ctx context.Context, db *sql.DB, userID, txType string, since time.Time) ([]models.HighlightTransaction, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, amount, `+mappedCategorySQL+`, COALESCE(recipient, ''), date
+		FROM transactions
+		WHERE user_id = $1 AND type = $2 AND date >= $3
+		ORDER BY amount DESC, date DESC
+		LIMIT $4
+	`, userID, txType, since, highlightsLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []models.HighlightTransaction{}
+	for rows.Next() {
+		var t models.HighlightTransaction
+		if err := rows.Scan(&t.ID, &t.Amount, &t.Category, &t.Recipient, &t.Date); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// loadRecipientHighlights runs a query selecting recipient, category, count and total
+func loadRecipientHighlights(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]models.RecipientHighlight, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []models.RecipientHighlight{}
+	for rows.Next() {
+		var r models.RecipientHighlight
+		if err := rows.Scan(&r.Recipient, &r.Category, &r.Count, &r.Total); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// spendingHighlight is a highlight as the AI prompt gets it: a person's name
+// scrubbed, and phone numbers and references taken out of any other
+// recipient, as agents and merchants are often saved by number
+func spendingHighlight(recipient, category string, amount float64) services.SpendingHighlight {
+	if personalTransferCategories[category] && recipient != "" {
+		recipient = services.ScrubbedName
+	} else {
+		recipient = services.ScrubPII(recipient)
+	}
+	return services.SpendingHighlight{Recipient: recipient, Category: category, Amount: amount}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+const (
+	incomeProfileMonths = 6  // Complete months used to judge how steady income is
+	incomeLongWindow    = 90 // Days in the rolling income averages
+	incomeShortWindow   = 30
+	billHorizonDays     = 30 // Bills expected this far ahead are set aside
+	billHistoryMonths   = 3
+)
+
+// loadIncomeProfile profiles the user's income over the last complete months,
+// starting from the first month they received anything
+func loadIncomeProfile(ctx context.Context, db *sql.DB, userID string, now time.Time) (services.IncomeProfile, error) {
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	from := to.AddDate(0, -incomeProfileMonths, 0)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT EXTRACT(YEAR FROM date)::int * 12 + EXTRACT(MONTH FROM date)::int - 1 AS month, SUM(amount)
+		FROM transactions
+		WHERE user_id = $1 AND type = 'INCOME' AND category <> 'SAVINGS' AND date >= $2 AND date < $3
+		GROUP BY month
+	`, userID, from, to)
+	if err != nil {
+		return services.IncomeProfile{}, err
+	}
+	defer rows.Close()
+
+	firstMonth := from.Year()*12 + int(from.Month()) - 1
+	monthly := make([]float64, incomeProfileMonths)
+	earliest := incomeProfileMonths
+	for rows.Next() {
+		var month int
+		var total float64
+		if err := rows.Scan(&month, &total); err != nil {
+			return services.IncomeProfile{}, err
+		}
+		if i := month - firstMonth; i >= 0 && i < incomeProfileMonths {
+			monthly[i] = total
+			if i < earliest {
+				earliest = i
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return services.IncomeProfile{}, err
+	}
+
+	return services.AnalyzeIncome(monthly[earliest:]), nil
+}
+
+// loadUpcomingBills estimates the recurring bills due in the next 30 days.
+// A recipient is a recurring bill when it was paid under BILLS in at least
+// two of the last three months; it's expected on its usual day of the month
+// unless it has already been paid this month. Hashed recipients are grouped
+// by hash and shown by their latest alias
+func loadUpcomingBills(ctx context.Context, db *sql.DB, userID string, now time.Time) ([]models.UpcomingBill, error) {
+	today := localDate(now)
+	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.Local)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT COALESCE((array_agg(recipient ORDER BY date DESC))[1], ''),
+			SUM(amount) / COUNT(DISTINCT date_trunc('month', date)),
+			(percentile_disc(0.5) WITHIN GROUP (ORDER BY EXTRACT(DAY FROM date)))::int,
+			MAX(date)
+		FROM transactions
+		WHERE user_id = $1 AND type = 'EXPENSE' AND `+mappedCategorySQL+` = 'BILLS'
+		AND (recipient_hash IS NOT NULL OR (recipient IS NOT NULL AND recipient <> '')) AND date >= $2
+		GROUP BY COALESCE(recipient_hash, recipient)
+		HAVING COUNT(DISTINCT date_trunc('month', date)) >= 2
+	`, userID, monthStart.AddDate(0, -billHistoryMonths, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	horizon := today.AddDate(0, 0, billHorizonDays)
+	bills := []models.UpcomingBill{}
+	for rows.Next() {
+		var bill models.UpcomingBill
+		var day int
+		var lastPaid time.Time
+		if err := rows.Scan(&bill.Recipient, &bill.Amount, &day, &lastPaid); err != nil {
+			return nil, err
+		}
+
+		due := dayOfMonth(monthStart, day)
+		switch {
+		case !localDate(lastPaid).Before(monthStart):
+			due = dayOfMonth(monthStart.AddDate(0, 1, 0), day)
+		case due.Before(today):
+			due = today // Late this month
+		}
+		if due.Before(horizon) {
+			bill.DueDate = due.Format("2006-01-02")
+			bills = append(bills, bill)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(bills, func(i, j int) bool { return bills[i].DueDate < bills[j].DueDate })
+	return bills, nil
+}
+
+// dayOfMonth returns the given day of monthStart's month, clamped to the month's length
+func dayOfMonth(monthStart time.Time, day int) time.Time {
+	last := time.Date(monthStart.Year(), monthStart.Month()+1, 0, 0, 0, 0, 0, time.Local).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(monthStart.Year(), monthStart.Month(), day, 0, 0, 0, 0, time.Local)
+}
+
+// GetSafeToSpend returns a daily spending allowance: average daily income
+// less what upcoming bills and saving goals need per day. Irregular earners
+// get the lower of their 30 and 90 day averages, so one good week doesn't
+// inflate the allowance
+func (h *AnalyticsHandler) GetSafeToSpend(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	profile, err := loadIncomeProfile(ctx, h.DB, userID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze income"})
+		return
+	}
+
+	// Averages cover the user's history when it's shorter than the window
+	var firstDate sql.NullTime
+	var longIncome, shortIncome float64
+	err = h.DB.QueryRowContext(ctx, `
+		SELECT
+			(SELECT MIN(date) FROM transactions WHERE user_id = $1),
+			COALESCE(SUM(amount), 0),
+			COALESCE(SUM(amount) FILTER (WHERE date >= $3), 0)
+		FROM transactions
+		WHERE user_id = $1 AND type = 'INCOME' AND category <> 'SAVINGS' AND date >= $2
+	`, userID, now.AddDate(0, 0, -incomeLongWindow), now.AddDate(0, 0, -incomeShortWindow)).Scan(&firstDate, &longIncome, &shortIncome)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch income"})
+		return
+	}
+
+	historyDays := 1.0
+	if firstDate.Valid {
+		historyDays = math.Max(1, math.Ceil(now.Sub(firstDate.Time).Hours()/24))
+	}
+	dailyIncome := longIncome / math.Min(incomeLongWindow, historyDays)
+	if profile.Irregular {
+		dailyIncome = math.Min(dailyIncome, shortIncome/math.Min(incomeShortWindow, historyDays))
+	}
+
+	bills, err := loadUpcomingBills(ctx, h.DB, userID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bills"})
+		return
+	}
+	billsTotal := 0.0
+	for _, b := range bills {
+		billsTotal += b.Amount
+	}
+
+	savingsPerDay := 0.0
+	rows, err := h.DB.QueryContext(ctx, "SELECT amount, cadence FROM saving_goals WHERE user_id = $1", userID)
+	if err == nil {
+		for rows.Next() {
+			var amount float64
+			var cadence string
+			if rows.Scan(&amount, &cadence) != nil {
+				continue
+			}
+			if cadence == savingCadenceMonthly {
+				savingsPerDay += amount * 12 / 365
+			} else {
+				savingsPerDay += amount / 7
+			}
+		}
+		rows.Close()
+	}
+
+	var spentToday float64
+	h.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM transactions
+		WHERE user_id = $1 AND type = 'EXPENSE' AND category <> 'SAVINGS' AND date >= $2
+	`, userID, localDate(now)).Scan(&spentToday)
+
+	result := models.SafeToSpend{
+		AverageDailyIncome: dailyIncome,
+		IrregularIncome:    profile.Irregular,
+		IncomeVariability:  profile.Variability,
+		BillsPerDay:        billsTotal / billHorizonDays,
+		SavingsPerDay:      savingsPerDay,
+		SpentToday:         spentToday,
+		UpcomingBills:      bills,
+	}
+	result.DailyAmount = math.Max(0, dailyIncome-result.BillsPerDay-savingsPerDay)
+	result.RemainingToday = math.Max(0, result.DailyAmount-spentToday)
+
+	c.JSON(http.StatusOK, result)
+}
@@ -1,33 +1,87 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/kwachatracker/backend/internal/database"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
 	"github.com/kwachatracker/backend/internal/services"
+	"github.com/lib/pq"
 )
 
 // InsightsHandler handles AI-powered insights endpoints
 type InsightsHandler struct {
-	gemini *services.GeminiService
-	fcm    *services.FCMService
+	db       *sql.DB
+	gemini   *services.GeminiService
+	notifier *notifications.Service
+	events   *services.EventBus
+	jobs     *services.JobService
+	opts     InsightsOptions
+}
+
+// InsightsOptions configures analysis runs
+type InsightsOptions struct {
+	PushWindow          time.Duration // A run's pushes are spread over this
+	DryRun              bool          // Runs only report what they would store and push
+	DryRunSamplePercent int           // Share of users a dry run sends to Gemini
 }
 
 // NewInsightsHandler creates a new insights handler
-func NewInsightsHandler(gemini *services.GeminiService, fcm *services.FCMService) *InsightsHandler {
+func NewInsightsHandler(db *sql.DB, gemini *services.GeminiService, notifier *notifications.Service, events *services.EventBus, jobs *services.JobService, opts InsightsOptions) *InsightsHandler {
 	return &InsightsHandler{
-		gemini: gemini,
-		fcm:    fcm,
+		db:       db,
+		gemini:   gemini,
+		notifier: notifier,
+		events:   events,
+		jobs:     jobs,
+		opts:     opts,
 	}
 }
 
-// GenerateInsights generates AI insights for a specific user
+// JobTypeInsightGeneration analyzes one user's last day of spending on request
+const JobTypeInsightGeneration = "insight_generation"
+
+// GenerateInsights queues AI insights for the user's last day of spending and
+// answers 202 with the job to poll at /jobs/:id; the user is also told by
+// push and over the WebSocket when it's done. Insights already generated
+// today from the same data are answered straight away instead, unless a
+// premium user asks for fresh ones with ?force=true. Without Gemini
+// configured it answers 503 AI_DISABLED, unlike the temporary AI_UNAVAILABLE
 func (h *InsightsHandler) GenerateInsights(c *gin.Context) {
+	if h.gemini == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "AI insights are not enabled on this server",
+			"code":  "AI_DISABLED",
+		})
+		return
+	}
 	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	force := c.Query("force") == "true"
+	if force {
+		var premium bool
+		h.db.QueryRowContext(ctx, "SELECT COALESCE(is_premium, FALSE) FROM users WHERE id = $1", userID).Scan(&premium)
+		if !premium {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Regenerating insights is a premium feature",
+				"code":  "PREMIUM_REQUIRED",
+			})
+			return
+		}
+	}
 
 	// Fetch spending data for the last 24 hours
 	spendingData, err := h.fetchSpendingData(userID, "daily")
@@ -45,83 +99,495 @@ func (h *InsightsHandler) GenerateInsights(c *gin.Context) {
 		return
 	}
 
-	// Generate AI insights
-	insights, err := h.gemini.AnalyzeSpending(c.Request.Context(), *spendingData)
+	if !force {
+		if cached, ok := h.cachedInsights(ctx, spendingData); ok {
+			c.JSON(http.StatusOK, cached)
+			return
+		}
+	}
+
+	if err := h.gemini.Available(ctx); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "AI temporarily unavailable",
+			"code":  "AI_UNAVAILABLE",
+		})
+		return
+	}
+
+	// Gemini can take most of a request's deadline, so the analysis runs as a
+	// job; asking again while one waits returns the same job
+	jobID, err := h.jobs.EnqueueUnique(userID, JobTypeInsightGeneration, insightGenerationParams{Force: force})
 	if err != nil {
-		log.Printf("AI analysis failed for user %s: %v", userID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Analysis failed"})
+		log.Printf("❌ Failed to queue insight generation for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue analysis"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"insights": insights,
-		"period":   "daily",
-		"analyzed": spendingData.TransactionCount,
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Analysis queued",
+		"job_id":  jobID,
 	})
 }
 
-// RunDailyAnalysis processes all users with consent - called by scheduler
+type insightGenerationParams struct {
+	Force bool `json:"force"` // Skip the day's cached insights
+}
+
+// generatedInsights is the result of an insight generation job, or the
+// cached one GenerateInsights answers with
+type generatedInsights struct {
+	Insights []services.AIInsight `json:"insights"`
+	Period   string               `json:"period"`
+	Analyzed int                  `json:"analyzed"` // Transactions analyzed
+	Cached   bool                 `json:"cached"`   // Generated earlier today from the same data
+}
+
+// InsightGenerationJob returns the job type behind GenerateInsights. Its
+// result is a generatedInsights
+func InsightGenerationJob(h *InsightsHandler) services.JobType {
+	return services.JobType{
+		Name: JobTypeInsightGeneration,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			var params insightGenerationParams
+			if len(job.Params) > 0 {
+				if err := json.Unmarshal(job.Params, &params); err != nil {
+					return nil, err
+				}
+			}
+			return h.generateInsights(ctx, job.UserID.String(), params.Force)
+		},
+		DoneTitle: "💡 Your insights are ready",
+		DoneBody:  "See what we found in your spending today.",
+	}
+}
+
+func (h *InsightsHandler) generateInsights(ctx context.Context, userID string, force bool) (*generatedInsights, error) {
+	spendingData, err := h.fetchSpendingData(userID, "daily")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch spending data: %w", err)
+	}
+	if spendingData.TransactionCount == 0 {
+		return &generatedInsights{Insights: []services.AIInsight{}, Period: "daily"}, nil
+	}
+	if !force {
+		if cached, ok := h.cachedInsights(ctx, spendingData); ok {
+			return cached, nil
+		}
+	}
+
+	insights, err := h.gemini.AnalyzeSpending(ctx, *spendingData)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.cacheInsights(ctx, spendingData, insights); err != nil {
+		log.Printf("⚠️ Failed to cache insights for user %s: %v", userID, err)
+	}
+
+	return &generatedInsights{Insights: insights, Period: "daily", Analyzed: spendingData.TransactionCount}, nil
+}
+
+// spendingFingerprint identifies the spending data an analysis sends to
+// Gemini. The same data gets the same insights, so they're cached under it
+func spendingFingerprint(data *services.SpendingData) string {
+	encoded, _ := json.Marshal(data)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedInsights returns the insights generated today for the user from the
+// same data, if there are any
+func (h *InsightsHandler) cachedInsights(ctx context.Context, data *services.SpendingData) (*generatedInsights, bool) {
+	var encoded []byte
+	err := h.db.QueryRowContext(ctx, `
+		SELECT insights FROM insight_cache
+		WHERE user_id = $1 AND day = CURRENT_DATE AND fingerprint = $2
+	`, data.UserID, spendingFingerprint(data)).Scan(&encoded)
+	if err != nil {
+		return nil, false
+	}
+
+	cached := &generatedInsights{Period: "daily", Analyzed: data.TransactionCount, Cached: true}
+	if err := json.Unmarshal(encoded, &cached.Insights); err != nil {
+		return nil, false
+	}
+	return cached, true
+}
+
+// cacheInsights keeps the insights generated from data for the rest of the
+// day, replacing what was cached for the user before
+func (h *InsightsHandler) cacheInsights(ctx context.Context, data *services.SpendingData, insights []services.AIInsight) error {
+	encoded, err := json.Marshal(insights)
+	if err != nil {
+		return err
+	}
+	_, err = h.db.ExecContext(ctx, `
+		INSERT INTO insight_cache (user_id, day, fingerprint, insights)
+		VALUES ($1, CURRENT_DATE, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			day = EXCLUDED.day, fingerprint = EXCLUDED.fingerprint,
+			insights = EXCLUDED.insights, created_at = CURRENT_TIMESTAMP
+	`, data.UserID, spendingFingerprint(data), encoded)
+	return err
+}
+
+// Insight pushes default to 6 AM and are kept within waking hours
+const (
+	DefaultInsightHour  = 6
+	earliestInsightHour = 6
+	latestInsightHour   = 21
+)
+
+// RunDailyAnalysis processes all users with consent - called by admin trigger
 func (h *InsightsHandler) RunDailyAnalysis() {
 	log.Println("🔄 Starting daily AI analysis job...")
 
 	// Get all users with consent and FCM tokens
-	rows, err := database.DB.Query(`
+	run := h.newRun(context.Background())
+	h.runAnalysis(run, dailyAnalysisUsersSQL, run.date)
+}
+
+// dailyAnalysisUsersSQL selects the users with consent and FCM tokens not yet
+// analyzed on the run date ($1)
+const dailyAnalysisUsersSQL = `
+	SELECT id, fcm_token 
+	FROM users u
+	WHERE consent_given = true AND fcm_token IS NOT NULL
+	AND NOT EXISTS (SELECT 1 FROM analysis_log a WHERE a.user_id = u.id AND a.run_date = $1)
+`
+
+// RunScheduledAnalysis processes users whose preferred delivery window starts at hour
+func (h *InsightsHandler) RunScheduledAnalysis(hour int) {
+	log.Printf("🔄 Starting AI analysis for the %02d:00 delivery window...", hour)
+
+	run := h.newRun(context.Background())
+	h.runAnalysis(run, `
 		SELECT id, fcm_token 
-		FROM users 
+		FROM users u
 		WHERE consent_given = true AND fcm_token IS NOT NULL
-	`)
+		AND COALESCE(preferred_push_hour, $1) = $2
+		AND NOT EXISTS (SELECT 1 FROM analysis_log a WHERE a.user_id = u.id AND a.run_date = $3)
+	`, DefaultInsightHour, hour, run.date)
+}
+
+// Small accounts are analyzed several to a prompt to cut Gemini calls
+const (
+	smallAccountMaxTransactions = 10
+	analysisBatchSize           = 8
+)
+
+// A day with no income and only this little spending, like one airtime
+// purchase, isn't worth a Gemini call; rules cover it
+const (
+	trivialMaxTransactions = 2
+	trivialMaxExpenses     = 100.0
+)
+
+// analysisTarget is a user picked up by an analysis run
+type analysisTarget struct {
+	userID      string
+	fcmToken    sql.NullString
+	data        *services.SpendingData
+	fingerprint string // Of the day's aggregates, logged with the user's insights
+}
+
+// analysisRun tracks the state and counters of one analysis run
+type analysisRun struct {
+	ctx           context.Context
+	date          string // Day the run delivers insights for, as recorded in analysis_log
+	aiAvailable   bool
+	successCount  int
+	errorCount    int
+	fallbackCount int
+	batchedCount  int
+	skippedCount  int
+	pushCount     int
+
+	// Given rule-based insights without asking Gemini
+	unchangedCount int // Same aggregates as at the user's last analysis
+	trivialCount   int
+
+	dryRun   *analysisDryRun       // Set when the run stores and sends nothing
+	progress func(done, total int) // Called every analysisProgressEvery users, if set
+}
+
+// analysisProgressEvery is how many users a run processes between progress callbacks
+const analysisProgressEvery = 50
+
+// newRun starts a run for today, a dry run if the handler is configured for them
+func (h *InsightsHandler) newRun(ctx context.Context) *analysisRun {
+	run := &analysisRun{ctx: ctx, date: analysisDate(), aiAvailable: true}
+	if h.opts.DryRun {
+		run.dryRun = newAnalysisDryRun(h.opts.DryRunSamplePercent)
+	}
+	return run
+}
+
+// errAlreadyAnalyzed means another run delivered the user's insights for the day first
+var errAlreadyAnalyzed = errors.New("user already analyzed today")
+
+// analysisDate is the analysis_log date of a run starting now
+func analysisDate() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// runAnalysis generates, stores and pushes insights for the users returned by
+// query. Users are logged per run date as their insights are stored, so the
+// query should exclude users already in analysis_log for it. A dry run
+// sends only its sample of users to Gemini and records what it would have
+// stored and pushed instead
+func (h *InsightsHandler) runAnalysis(run *analysisRun, query string, args ...interface{}) {
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		log.Printf("❌ Failed to fetch users: %v", err)
 		return
 	}
-	defer rows.Close()
-
-	successCount := 0
-	errorCount := 0
 
+	// Load the user list up front so the connection isn't held for the whole run
+	var targets []analysisTarget
 	for rows.Next() {
-		var userID string
-		var fcmToken sql.NullString
-
-		if err := rows.Scan(&userID, &fcmToken); err != nil {
+		var t analysisTarget
+		if err := rows.Scan(&t.userID, &t.fcmToken); err != nil {
 			continue
 		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+
+	start := time.Now()
+	var batch []analysisTarget
+
+	for i, t := range targets {
+		if run.ctx.Err() != nil {
+			break
+		}
+		if run.progress != nil && i > 0 && i%analysisProgressEvery == 0 {
+			run.progress(i, len(targets))
+		}
 
 		// Fetch user's spending data
-		spendingData, err := h.fetchSpendingData(userID, "daily")
+		spendingData, err := h.fetchSpendingData(t.userID, "daily")
 		if err != nil || spendingData.TransactionCount == 0 {
 			continue
 		}
+		t.data = spendingData
+		t.fingerprint = aggregatesFingerprint(spendingData)
 
-		// Generate AI insights
-		insights, err := h.gemini.AnalyzeSpending(nil, *spendingData)
-		if err != nil {
-			log.Printf("❌ AI analysis failed for user %s: %v", userID, err)
-			errorCount++
+		if trivialSpending(spendingData) {
+			run.trivialCount++
+			h.deliverInsights(run, t, services.RuleBasedInsights(*t.data))
+			continue
+		}
+		if h.lastFingerprint(t.userID) == t.fingerprint {
+			run.unchangedCount++
+			h.deliverInsights(run, t, services.RuleBasedInsights(*t.data))
 			continue
 		}
 
-		// Store insights for retrieval
-		h.storeInsights(userID, insights)
+		if run.dryRun != nil && !run.dryRun.sample() {
+			h.deliverInsights(run, t, services.RuleBasedInsights(*t.data))
+			continue
+		}
 
-		// Send push notification if user has FCM token
-		if fcmToken.Valid && h.fcm != nil {
-			title, body := h.gemini.GenerateNotificationText(insights)
-			err = h.fcm.SendNotification(nil, fcmToken.String, title, body, map[string]string{
-				"type": "daily_insight",
-			})
-			if err != nil {
-				log.Printf("⚠️ Push failed for user %s: %v", userID, err)
+		if run.aiAvailable && spendingData.TransactionCount < smallAccountMaxTransactions {
+			batch = append(batch, t)
+			if len(batch) == analysisBatchSize {
+				h.analyzeBatch(run, batch)
+				batch = nil
 			}
+			continue
 		}
 
-		successCount++
+		h.analyzeOne(run, t)
+	}
+	if len(batch) > 0 {
+		h.analyzeBatch(run, batch)
+	}
+
+	elapsed := time.Since(start)
+	if run.dryRun != nil {
+		run.dryRun.finish(run, len(targets), elapsed)
+		log.Printf("🧪 Dry run complete in %s: %d users, %d sampled for Gemini, %d unchanged and %d trivial skipped it, %d errors, %d insights and %d pushes not stored or sent",
+			elapsed.Round(time.Second), len(targets), run.dryRun.Sampled, run.unchangedCount, run.trivialCount,
+			run.errorCount, run.dryRun.Insights, run.pushCount)
+		return
+	}
+	log.Printf("✅ Daily analysis complete in %s (%.1f users/s): %d success, %d errors, %d rule-based, %d unchanged, %d trivial, %d batched, %d already analyzed, %d pushes queued over %s",
+		elapsed.Round(time.Second), float64(len(targets))/elapsed.Seconds(),
+		run.successCount, run.errorCount, run.fallbackCount, run.unchangedCount, run.trivialCount,
+		run.batchedCount, run.skippedCount, run.pushCount, h.opts.PushWindow)
+}
+
+// trivialSpending reports whether a day's spending is too small to be worth
+// a Gemini call
+func trivialSpending(data *services.SpendingData) bool {
+	return data.TransactionCount <= trivialMaxTransactions && data.TotalIncome == 0 && data.TotalExpenses <= trivialMaxExpenses
+}
+
+// aggregatesFingerprint identifies a user's totals, categories and merchants
+// for the day. A user whose fingerprint matches their last analysis has
+// nothing new for Gemini to say
+func aggregatesFingerprint(data *services.SpendingData) string {
+	encoded, _ := json.Marshal(struct {
+		Income       float64            `json:"income"`
+		Expenses     float64            `json:"expenses"`
+		ByCategory   map[string]float64 `json:"by_category"`
+		TopMerchants []string           `json:"top_merchants"`
+		Count        int                `json:"count"`
+	}{data.TotalIncome, data.TotalExpenses, data.ByCategory, data.TopMerchants, data.TransactionCount})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// lastFingerprint returns the aggregates fingerprint logged with the user's
+// latest insights, or "" if there's none
+func (h *InsightsHandler) lastFingerprint(userID string) string {
+	var fingerprint sql.NullString
+	h.db.QueryRow(`
+		SELECT fingerprint FROM analysis_log
+		WHERE user_id = $1
+		ORDER BY run_date DESC
+		LIMIT 1
+	`, userID).Scan(&fingerprint)
+	return fingerprint.String
+}
+
+// analyzeOne generates insights for a single user, falling back to rules when
+// Gemini is down or capped
+func (h *InsightsHandler) analyzeOne(run *analysisRun, t analysisTarget) {
+	var insights []services.AIInsight
+	if run.aiAvailable {
+		var err error
+		insights, err = h.gemini.AnalyzeSpending(run.ctx, *t.data)
+		if errors.Is(err, services.ErrAIUnavailable) {
+			log.Println("🛑 AI budget exhausted or disabled, using rule-based insights for the rest of this run")
+			run.aiAvailable = false
+		} else if err != nil {
+			log.Printf("❌ AI analysis failed for user %s: %v", t.userID, err)
+			run.errorCount++
+		}
 
 		// Rate limit to avoid overwhelming APIs
 		time.Sleep(500 * time.Millisecond)
 	}
+	if insights == nil {
+		insights = services.RuleBasedInsights(*t.data)
+		run.fallbackCount++
+	}
 
-	log.Printf("✅ Daily analysis complete: %d success, %d errors", successCount, errorCount)
+	h.deliverInsights(run, t, insights)
+}
+
+// analyzeBatch analyzes several small accounts in one Gemini call; users the
+// batch response doesn't cover are analyzed individually
+func (h *InsightsHandler) analyzeBatch(run *analysisRun, batch []analysisTarget) {
+	if len(batch) == 1 || !run.aiAvailable {
+		for _, t := range batch {
+			h.analyzeOne(run, t)
+		}
+		return
+	}
+
+	data := make([]services.SpendingData, len(batch))
+	for i, t := range batch {
+		data[i] = *t.data
+	}
+
+	results, err := h.gemini.AnalyzeSpendingBatch(run.ctx, data)
+	if errors.Is(err, services.ErrAIUnavailable) {
+		log.Println("🛑 AI budget exhausted or disabled, using rule-based insights for the rest of this run")
+		run.aiAvailable = false
+	} else if err != nil {
+		log.Printf("❌ Batch AI analysis failed for %d users: %v", len(batch), err)
+		run.errorCount++
+	}
+
+	// Rate limit to avoid overwhelming APIs
+	time.Sleep(500 * time.Millisecond)
+
+	for _, t := range batch {
+		if insights, ok := results[t.userID]; ok {
+			run.batchedCount++
+			h.deliverInsights(run, t, insights)
+		} else {
+			h.analyzeOne(run, t)
+		}
+	}
+}
+
+// deliverInsights stores a user's insights, with their weekly library tip
+// when one is due and any new operator notice, and queues a push of the top one
+func (h *InsightsHandler) deliverInsights(run *analysisRun, t analysisTarget, insights []services.AIInsight) {
+	if len(insights) == 0 {
+		return
+	}
+	insights = h.withLibraryTip(t.userID, insights)
+	insights = h.withOperatorNotice(t.userID, insights)
+
+	var push *models.PushNotification
+	if t.fcmToken.Valid {
+		title, body := h.gemini.GenerateNotificationText(insights)
+		push = &models.PushNotification{
+			Title: title,
+			Body:  body,
+			Data:  map[string]string{"type": "daily_insight"},
+		}
+	}
+
+	if run.dryRun != nil {
+		run.dryRun.record(t.userID, insights, push)
+		run.successCount++
+		if push != nil {
+			run.pushCount++
+		}
+		return
+	}
+
+	err := h.storeInsights(t.userID, run.date, t.data.Period, t.fingerprint, insights, push, time.Now().Add(h.pushDelay()))
+	if errors.Is(err, errAlreadyAnalyzed) {
+		run.skippedCount++
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to store insights for user %s: %v", t.userID, err)
+		run.errorCount++
+		return
+	}
+
+	run.successCount++
+	if push != nil {
+		run.pushCount++
+	}
+}
+
+// pushDelay picks when within the push window a user's push goes out, so a
+// run's pushes reach FCM spread out rather than all at once
+func (h *InsightsHandler) pushDelay() time.Duration {
+	if h.opts.PushWindow <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(h.opts.PushWindow)))
+}
+
+// UpdateDeliveryWindows sets each user's preferred push hour to the waking hour
+// they were most often active in over the last 30 days
+func (h *InsightsHandler) UpdateDeliveryWindows() {
+	result, err := h.db.Exec(`
+		UPDATE users u SET preferred_push_hour = w.hour
+		FROM (
+			SELECT DISTINCT ON (user_id) user_id, hour
+			FROM user_activity_hours
+			WHERE last_seen_at >= $1 AND hour BETWEEN $2 AND $3
+			ORDER BY user_id, hits DESC, hour ASC
+		) w
+		WHERE u.id = w.user_id
+	`, time.Now().AddDate(0, 0, -30), earliestInsightHour, latestInsightHour)
+	if err != nil {
+		log.Printf("❌ Failed to update delivery windows: %v", err)
+		return
+	}
+
+	updated, _ := result.RowsAffected()
+	log.Printf("🕐 Delivery windows updated for %d users", updated)
 }
 
 // fetchSpendingData retrieves aggregated spending for a user
@@ -141,19 +607,27 @@ func (h *InsightsHandler) fetchSpendingData(userID, period string) (*services.Sp
 	}
 
 	data := &services.SpendingData{
-		UserID:     userID,
-		Period:     period,
-		ByCategory: make(map[string]float64),
+		UserID:               userID,
+		Period:               period,
+		ByCategory:           make(map[string]float64),
+		CategoryDailyAverage: make(map[string]float64),
+		DaysSinceIncome:      -1,
 	}
 
 	// Get totals
+	// Metadata-only users are analyzed from their daily totals
+	source, err := spendingSource(h.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
 	var totalIncome, totalExpenses sql.NullFloat64
-	err := database.DB.QueryRow(`
+	err = h.db.QueryRow(`
 		SELECT 
 			COALESCE(SUM(CASE WHEN type = 'INCOME' THEN amount ELSE 0 END), 0),
 			COALESCE(SUM(CASE WHEN type = 'EXPENSE' THEN amount ELSE 0 END), 0),
-			COUNT(*)
-		FROM transactions
+			COALESCE(SUM(entries), 0)
+		FROM `+source+`
 		WHERE user_id = $1 AND date >= $2
 	`, userID, startDate).Scan(&totalIncome, &totalExpenses, &data.TransactionCount)
 
@@ -166,11 +640,11 @@ func (h *InsightsHandler) fetchSpendingData(userID, period string) (*services.Sp
 	data.NetBalance = data.TotalIncome - data.TotalExpenses
 
 	// Get category breakdown
-	rows, err := database.DB.Query(`
-		SELECT category, COALESCE(SUM(amount), 0)
-		FROM transactions
+	rows, err := h.db.Query(`
+		SELECT `+mappedCategorySQL+` AS mapped, COALESCE(SUM(amount), 0)
+		FROM `+source+`
 		WHERE user_id = $1 AND type = 'EXPENSE' AND date >= $2
-		GROUP BY category
+		GROUP BY mapped
 	`, userID, startDate)
 
 	if err == nil {
@@ -186,51 +660,253 @@ func (h *InsightsHandler) fetchSpendingData(userID, period string) (*services.Sp
 
 	// Get savings deposits
 	var savingsDeposits sql.NullFloat64
-	database.DB.QueryRow(`
+	h.db.QueryRow(`
 		SELECT COALESCE(SUM(amount), 0)
-		FROM transactions
+		FROM `+source+`
 		WHERE user_id = $1 AND category = 'SAVINGS' AND type = 'EXPENSE' AND date >= $2
 	`, userID, startDate).Scan(&savingsDeposits)
 	data.SavingsDeposits = savingsDeposits.Float64
 
+	// Interest credited to savings products
+	if movements, err := loadSavingsMovements(context.Background(), h.db, userID, startDate); err == nil {
+		data.InterestEarned = savingsInterest(movements)
+	}
+
+	// Standout payments, with the names of people paid left out
+	if highlights, err := loadHighlights(context.Background(), h.db, userID, startDate); err == nil {
+		for _, t := range highlights.LargestExpenses {
+			data.LargestExpenses = append(data.LargestExpenses, spendingHighlight(t.Recipient, t.Category, t.Amount))
+		}
+		for _, r := range highlights.NewMerchants {
+			data.NewMerchants = append(data.NewMerchants, spendingHighlight(r.Recipient, r.Category, r.Total))
+		}
+	}
+
+	// Budgets the user set, so insights can refer to them
+	if variances, err := loadBudgetVariance(context.Background(), h.db, userID, now); err == nil {
+		for _, v := range variances {
+			data.Budgets = append(data.Budgets, services.BudgetStatus{
+				Category:     v.Category,
+				Budget:       v.Budget,
+				Spent:        v.Spent,
+				Projected:    v.ProjectedSpend,
+				MonthsWithin: v.MonthsWithin,
+				Months:       v.Months,
+			})
+		}
+	}
+
+	// Categories the user keeps away from Gemini. Without them nothing can be sent
+	data.ExcludedCategories, err = loadAIExclusions(h.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Irregular earners get advice on smoothing income rather than monthly budgets
+	if profile, err := loadIncomeProfile(context.Background(), h.db, userID, now); err == nil {
+		data.IrregularIncome = profile.Irregular
+		data.AverageIncome = profile.AverageMonthly
+	}
+
+	h.fetchRuleContext(userID, source, data)
+
 	return data, nil
 }
 
-// storeInsights saves generated insights to database
-func (h *InsightsHandler) storeInsights(userID string, insights []services.AIInsight) {
+// fetchRuleContext fills in the history the rule-based insight engine
+// compares against, read from the user's spending source
+func (h *InsightsHandler) fetchRuleContext(userID, source string, data *services.SpendingData) {
+	now := time.Now()
+
+	// Language and country for amount formatting
+	var language, country sql.NullString
+	h.db.QueryRow("SELECT language, country FROM users WHERE id = $1", userID).Scan(&language, &country)
+	data.Locale = language.String
+	data.Country = country.String
+
+	// Average daily spend per category over the last 30 days
+	rows, err := h.db.Query(`
+		SELECT `+mappedCategorySQL+` AS mapped, COALESCE(SUM(amount), 0) / 30
+		FROM `+source+`
+		WHERE user_id = $1 AND type = 'EXPENSE' AND date >= $2
+		GROUP BY mapped
+	`, userID, now.AddDate(0, 0, -30))
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var cat string
+			var average float64
+			if rows.Scan(&cat, &average) == nil {
+				data.CategoryDailyAverage[cat] = average
+			}
+		}
+	}
+
+	// Days since the last income
+	var lastIncome sql.NullTime
+	h.db.QueryRow(
+		"SELECT MAX(date) FROM "+source+" WHERE user_id = $1 AND type = 'INCOME'",
+		userID,
+	).Scan(&lastIncome)
+	if lastIncome.Valid {
+		data.DaysSinceIncome = int(now.Sub(lastIncome.Time).Hours() / 24)
+	}
+
+	// Month-to-date totals
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	h.db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN type = 'INCOME' THEN amount ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN type = 'EXPENSE' THEN amount ELSE 0 END), 0)
+		FROM `+source+`
+		WHERE user_id = $1 AND date >= $2
+	`, userID, monthStart).Scan(&data.MonthIncome, &data.MonthExpenses)
+}
+
+// storeInsights saves generated insights, logs the user as analyzed for
+// runDate with the fingerprint of the aggregates analyzed and queues the push notification, if any, for pushAt in one
+// transaction: the push can't be lost once the insights exist, and a user is
+// never given a second set for the day. Returns errAlreadyAnalyzed if they
+// already have one
+func (h *InsightsHandler) storeInsights(userID, runDate, period, fingerprint string, insights []services.AIInsight, push *models.PushNotification, pushAt time.Time) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	logged, err := tx.Exec(`
+		INSERT INTO analysis_log (user_id, run_date, insights_count, fingerprint)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT DO NOTHING
+	`, userID, runDate, len(insights), fingerprint)
+	if err != nil {
+		return err
+	}
+	if n, _ := logged.RowsAffected(); n == 0 {
+		return errAlreadyAnalyzed
+	}
+
 	for _, insight := range insights {
-		database.DB.Exec(`
-			INSERT INTO user_insights (user_id, title, message, category, priority, generated_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
-		`, userID, insight.Title, insight.Message, insight.Category, insight.Priority, insight.GeneratedAt)
+		meta := insight.Meta
+		if meta == nil {
+			meta = &services.GenerationMeta{}
+		}
+		_, err := tx.Exec(`
+			INSERT INTO user_insights (user_id, title, message, category, priority, generated_at,
+				source, model, prompt_version, finish_reason, latency_ms, prompt_tokens, output_tokens, excluded_categories, period, ai_call_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, '')::uuid)
+		`, userID, insight.Title, insight.Message, insight.Category, insight.Priority, insight.GeneratedAt,
+			meta.Source, meta.Model, meta.PromptVersion, meta.FinishReason, meta.LatencyMs, meta.PromptTokens, meta.OutputTokens,
+			pq.Array(meta.ExcludedCategories), period, meta.CallID)
+		if err != nil {
+			return err
+		}
+	}
+	if err := recordTipsShown(tx, userID, insights); err != nil {
+		return err
 	}
+	if err := recordNoticesShown(tx, userID, insights); err != nil {
+		return err
+	}
+
+	if push != nil {
+		err := h.notifier.Send(tx, userID, models.Notification{
+			Type:   models.NotificationInsights,
+			Push:   *push,
+			SendAt: pushAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	recordInsightStats(h.db, userID, len(insights))
+	for _, insight := range insights {
+		h.events.Publish(services.EventInsightGenerated, userID, services.InsightGenerated{
+			Title:    insight.Title,
+			Message:  insight.Message,
+			Category: insight.Category,
+			Priority: insight.Priority,
+		})
+	}
+	return nil
 }
 
-// GetUserInsights retrieves stored insights for display
+// GetUserInsights pages through the user's stored insights, newest first,
+// filtered by category, priority, period and date_from/date_to (YYYY-MM-DD,
+// inclusive). total is the number of matching insights across all pages
 func (h *InsightsHandler) GetUserInsights(c *gin.Context) {
-	userID := c.GetString("user_id")
+	limit := 20
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := parseInt(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := parseInt(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
 
-	rows, err := database.DB.Query(`
-		SELECT title, message, category, priority, generated_at
-		FROM user_insights
-		WHERE user_id = $1
-		ORDER BY generated_at DESC
-		LIMIT 10
-	`, userID)
+	f := &sqlFilter{}
+	f.where("user_id = " + f.arg(c.GetString("user_id")))
+	for _, field := range []string{"category", "priority", "period"} {
+		if v := c.Query(field); v != "" {
+			f.where(field + " = " + f.arg(strings.ToLower(v)))
+		}
+	}
+	if v := c.Query("date_from"); v != "" {
+		from, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+			return
+		}
+		f.where("generated_at >= " + f.arg(from))
+	}
+	if v := c.Query("date_to"); v != "" {
+		to, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+			return
+		}
+		f.where("generated_at < " + f.arg(to.AddDate(0, 0, 1)))
+	}
+
+	var total int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM user_insights"+f.sql(), f.args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch insights"})
+		return
+	}
 
+	page := f.clone()
+	rows, err := h.db.Query(`
+		SELECT id, title, message, category, priority, COALESCE(period, 'daily'), generated_at
+		FROM user_insights`+page.sql()+`
+		ORDER BY generated_at DESC, id
+		LIMIT `+page.arg(limit)+` OFFSET `+page.arg(offset), page.args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch insights"})
 		return
 	}
 	defer rows.Close()
 
-	var insights []services.AIInsight
+	insights := []models.UserInsight{}
 	for rows.Next() {
-		var insight services.AIInsight
-		if rows.Scan(&insight.Title, &insight.Message, &insight.Category, &insight.Priority, &insight.GeneratedAt) == nil {
+		var insight models.UserInsight
+		if rows.Scan(&insight.ID, &insight.Title, &insight.Message, &insight.Category, &insight.Priority, &insight.Period, &insight.GeneratedAt) == nil {
 			insights = append(insights, insight)
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"insights": insights})
+	c.JSON(http.StatusOK, gin.H{
+		"insights": insights,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
 }
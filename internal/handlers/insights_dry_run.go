@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeAnalysisDryRun runs the daily analysis without storing or sending anything
+const JobTypeAnalysisDryRun = "analysis_dry_run"
+
+// dryRunSamples is how many users' would-be insights a dry run report shows
+const dryRunSamples = 20
+
+// analysisDryRunParams sets the share of users a dry run sends to Gemini;
+// the rest get rule-based insights, which cost nothing
+type analysisDryRunParams struct {
+	SamplePercent int `json:"sample_percent" binding:"min=0,max=100"`
+}
+
+// analysisDryRun reports what an analysis run would have stored and pushed.
+// It's reported as progress while the run goes and returned as its result
+type analysisDryRun struct {
+	SamplePercent int                    `json:"sample_percent"`
+	Users         int                    `json:"users"` // Picked up by the run
+	Done          int                    `json:"done"`
+	Delivered     int                    `json:"delivered"` // Would have been given insights
+	Sampled       int                    `json:"sampled"`   // Sent to Gemini
+	Errors        int                    `json:"errors"`
+	RuleBased     int                    `json:"rule_based"` // Sampled, but fell back to rules
+	Unchanged     int                    `json:"unchanged"`  // Same aggregates as their last analysis, so not sent to Gemini
+	Trivial       int                    `json:"trivial"`    // Too little spending to send to Gemini
+	Batched       int                    `json:"batched"`
+	Insights      int                    `json:"insights"` // Would have been stored
+	Pushes        int                    `json:"pushes"`   // Would have been queued
+	ByCategory    map[string]int         `json:"by_category"`
+	BySource      map[string]int         `json:"by_source"`
+	Samples       []analysisDryRunSample `json:"samples"`
+	Duration      string                 `json:"duration,omitempty"`
+}
+
+// analysisDryRunSample is one user's would-be insights and push
+type analysisDryRunSample struct {
+	UserID   string                   `json:"user_id"`
+	Insights []dryRunInsight          `json:"insights"`
+	Push     *models.PushNotification `json:"push,omitempty"`
+}
+
+// dryRunInsight is an insight with how it was produced, for checking prompt changes
+type dryRunInsight struct {
+	Title         string `json:"title"`
+	Message       string `json:"message"`
+	Category      string `json:"category"`
+	Priority      string `json:"priority"`
+	Source        string `json:"source,omitempty"`
+	PromptVersion string `json:"prompt_version,omitempty"`
+}
+
+// newAnalysisDryRun starts an empty report
+func newAnalysisDryRun(samplePercent int) *analysisDryRun {
+	return &analysisDryRun{
+		SamplePercent: samplePercent,
+		ByCategory:    make(map[string]int),
+		BySource:      make(map[string]int),
+		Samples:       []analysisDryRunSample{},
+	}
+}
+
+// sample decides whether the next user is sent to Gemini
+func (d *analysisDryRun) sample() bool {
+	if rand.Intn(100) >= d.SamplePercent {
+		return false
+	}
+	d.Sampled++
+	return true
+}
+
+// record adds a user's would-be insights and push to the report
+func (d *analysisDryRun) record(userID string, insights []services.AIInsight, push *models.PushNotification) {
+	d.Insights += len(insights)
+	sample := analysisDryRunSample{UserID: userID, Push: push}
+	for _, insight := range insights {
+		i := dryRunInsight{
+			Title:    insight.Title,
+			Message:  insight.Message,
+			Category: insight.Category,
+			Priority: insight.Priority,
+		}
+		if insight.Meta != nil {
+			i.Source, i.PromptVersion = insight.Meta.Source, insight.Meta.PromptVersion
+		}
+		d.ByCategory[i.Category]++
+		d.BySource[i.Source]++
+		sample.Insights = append(sample.Insights, i)
+	}
+	if len(d.Samples) < dryRunSamples {
+		d.Samples = append(d.Samples, sample)
+	}
+}
+
+// update copies the run's counters into the report
+func (d *analysisDryRun) update(run *analysisRun, done, users int) {
+	d.Users, d.Done = users, done
+	d.Delivered = run.successCount
+	d.Errors = run.errorCount
+	d.RuleBased = run.fallbackCount
+	d.Unchanged = run.unchangedCount
+	d.Trivial = run.trivialCount
+	d.Batched = run.batchedCount
+	d.Pushes = run.pushCount
+}
+
+// finish completes the report once the run is over; a cancelled run keeps
+// its last progress
+func (d *analysisDryRun) finish(run *analysisRun, users int, elapsed time.Duration) {
+	done := users
+	if run.ctx.Err() != nil {
+		done = d.Done
+	}
+	d.update(run, done, users)
+	d.Duration = elapsed.Round(time.Second).String()
+}
+
+// AnalysisDryRunJob returns the job type that dry-runs the daily analysis,
+// reporting the partial report as progress
+func AnalysisDryRunJob(h *InsightsHandler, jobs *services.JobService) services.JobType {
+	return services.JobType{
+		Name: JobTypeAnalysisDryRun,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			var params analysisDryRunParams
+			if err := json.Unmarshal(job.Params, &params); err != nil {
+				return nil, err
+			}
+
+			run := &analysisRun{ctx: ctx, date: analysisDate(), aiAvailable: true, dryRun: newAnalysisDryRun(params.SamplePercent)}
+			run.progress = func(done, total int) {
+				run.dryRun.update(run, done, total)
+				if err := jobs.ReportProgress(job.ID, run.dryRun); err != nil {
+					log.Printf("⚠️ Failed to report dry run progress: %v", err)
+				}
+			}
+			h.runAnalysis(run, dailyAnalysisUsersSQL, run.date)
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return run.dryRun, nil
+		},
+	}
+}
+
+// GetAnalysisDryRun returns a dry run's progress, and its report once done
+func (h *AdminHandler) GetAnalysisDryRun(c *gin.Context) {
+	job, err := h.Jobs.Get(c.Param("id"))
+	if err != nil || job.Type != JobTypeAnalysisDryRun {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/middleware"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// Events no-code integrations can poll or subscribe to
+const (
+	HookEventNewTransaction = "new_transaction"
+	HookEventLargeExpense   = "large_expense"
+	HookEventNewInsight     = "new_insight"
+)
+
+// JobTypeHookDelivery sends a user's new events to their REST hook subscriptions
+const JobTypeHookDelivery = "hook_delivery"
+
+const (
+	maxIntegrationKeys       = 10
+	maxHookSubscriptions     = 20
+	hookPollLimit            = 50
+	hookDeliveryBatch        = 100
+	defaultLargeExpense      = 1000.0
+	hookDeliveryTimeout      = 10 * time.Second
+	integrationKeyPrefix     = "kt_"
+	integrationKeyShownChars = 8 // Characters of the key kept to tell keys apart
+)
+
+var hookEvents = map[string]bool{
+	HookEventNewTransaction: true,
+	HookEventLargeExpense:   true,
+	HookEventNewInsight:     true,
+}
+
+// zeroUUID sorts before every id, for cursors that haven't delivered anything yet
+const zeroUUID = "00000000-0000-0000-0000-000000000000"
+
+// errHookAddress is returned when a hook host resolves to a non-public address
+var errHookAddress = errors.New("target_url must be a public address")
+
+// carrierNAT is the shared address space (100.64.0.0/10) some clouds use internally
+var carrierNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip can be reached from the internet, rather
+// than being one of ours or the host's
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || carrierNAT.Contains(ip))
+}
+
+// hookClient only connects to public addresses. The check runs on the
+// address actually dialled, so a host that resolves to a public address when
+// validated and an internal one when dialled (DNS rebinding) is still refused
+var hookClient = &http.Client{
+	Timeout: hookDeliveryTimeout,
+	Transport: &http.Transport{
+		Proxy: nil, // A proxy would dial on our behalf, past the check
+		DialContext: (&net.Dialer{
+			Timeout: hookDeliveryTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+					return errHookAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: hookDeliveryTimeout,
+	},
+	// A redirect could point the hook at an internal address
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// IntegrationsHandler serves API keys, polling triggers and REST hooks for
+// no-code tools such as Zapier and IFTTT
+type IntegrationsHandler struct {
+	DB *sql.DB
+}
+
+// CreateIntegrationKey issues an API key. The key is only returned here
+func (h *IntegrationsHandler) CreateIntegrationKey(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int
+	h.DB.QueryRow("SELECT COUNT(*) FROM integration_keys WHERE user_id = $1", userID).Scan(&count)
+	if count >= maxIntegrationKeys {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You can have at most %d API keys", maxIntegrationKeys)})
+		return
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	key := integrationKeyPrefix + hex.EncodeToString(secret)
+	prefix := key[:len(integrationKeyPrefix)+integrationKeyShownChars]
+
+	var id string
+	var createdAt time.Time
+	err := h.DB.QueryRow(`
+		INSERT INTO integration_keys (user_id, name, key_hash, key_prefix)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, userID, req.Name, middleware.HashIntegrationKey(key), prefix).Scan(&id, &createdAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         id,
+		"name":       req.Name,
+		"key":        key,
+		"key_prefix": prefix,
+		"created_at": createdAt,
+	})
+}
+
+// GetIntegrationKeys lists the user's API keys without the secrets
+func (h *IntegrationsHandler) GetIntegrationKeys(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	rows, err := h.DB.Query(`
+		SELECT id, name, key_prefix, last_used_at, created_at
+		FROM integration_keys WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+	defer rows.Close()
+
+	keys := []gin.H{}
+	for rows.Next() {
+		var id, name, prefix string
+		var lastUsed sql.NullTime
+		var createdAt time.Time
+		if rows.Scan(&id, &name, &prefix, &lastUsed, &createdAt) != nil {
+			continue
+		}
+		key := gin.H{"id": id, "name": name, "key_prefix": prefix, "created_at": createdAt}
+		if lastUsed.Valid {
+			key["last_used_at"] = lastUsed.Time
+		}
+		keys = append(keys, key)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// DeleteIntegrationKey revokes an API key
+func (h *IntegrationsHandler) DeleteIntegrationKey(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	result, err := h.DB.Exec("DELETE FROM integration_keys WHERE id = $1 AND user_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// Me confirms an API key works; integration platforms call it when connecting
+func (h *IntegrationsHandler) Me(c *gin.Context) {
+	var name string
+	h.DB.QueryRow("SELECT name FROM integration_keys WHERE id = $1", c.GetString("integration_key_id")).Scan(&name)
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":       c.GetString("user_id"),
+		"key_name": name,
+	})
+}
+
+// hookItem is one event as sent to an integration
+type hookItem struct {
+	id        string
+	createdAt time.Time
+	payload   gin.H
+}
+
+// loadHookItems fetches an event's items created after the (after, afterID)
+// cursor, newest first for polling or oldest first for delivery
+func loadHookItems(ctx context.Context, db *sql.DB, userID, event string, minAmount float64, after time.Time, afterID string, oldestFirst bool, limit int) ([]hookItem, error) {
+	order := "DESC"
+	if oldestFirst {
+		order = "ASC"
+	}
+
+	var rows *sql.Rows
+	var err error
+	switch event {
+	case HookEventNewInsight:
+		rows, err = db.QueryContext(ctx, `
+			SELECT id, created_at, title, message, category, priority, generated_at
+			FROM user_insights
+			WHERE user_id = $1 AND (created_at, id) > ($2, $3::uuid)
+			ORDER BY created_at `+order+`, id `+order+`
+			LIMIT $4
+		`, userID, after, afterID, limit)
+	default:
+		f := &sqlFilter{}
+		f.where("user_id = " + f.arg(userID))
+		f.where("(created_at, id) > (" + f.arg(after) + ", " + f.arg(afterID) + "::uuid)")
+		if event == HookEventLargeExpense {
+			if minAmount <= 0 {
+				minAmount = defaultLargeExpense
+			}
+			f.where("type = 'EXPENSE'")
+			f.where("amount >= " + f.arg(minAmount))
+		}
+		query := `
+			SELECT id, created_at, amount, type, ` + mappedCategorySQL + `, operator,
+				COALESCE(recipient, ''), COALESCE(reference, ''), COALESCE(description, ''), date
+			FROM transactions` + f.sql() + `
+			ORDER BY created_at ` + order + `, id ` + order + `
+			LIMIT ` + f.arg(limit)
+		rows, err = db.QueryContext(ctx, query, f.args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []hookItem{}
+	for rows.Next() {
+		var item hookItem
+		if event == HookEventNewInsight {
+			var title, message, category, priority string
+			var generatedAt time.Time
+			if err := rows.Scan(&item.id, &item.createdAt, &title, &message, &category, &priority, &generatedAt); err != nil {
+				return nil, err
+			}
+			item.payload = gin.H{
+				"id":           item.id,
+				"title":        title,
+				"message":      message,
+				"category":     category,
+				"priority":     priority,
+				"generated_at": generatedAt.Format(time.RFC3339),
+			}
+		} else {
+			var amount float64
+			var txType, category, operator, recipient, reference, description string
+			var date time.Time
+			if err := rows.Scan(&item.id, &item.createdAt, &amount, &txType, &category, &operator, &recipient, &reference, &description, &date); err != nil {
+				return nil, err
+			}
+			item.payload = gin.H{
+				"id":          item.id,
+				"amount":      amount,
+				"type":        txType,
+				"category":    category,
+				"operator":    operator,
+				"recipient":   recipient,
+				"reference":   reference,
+				"description": description,
+				"date":        date.Format(time.RFC3339),
+			}
+		}
+		item.payload["created_at"] = item.createdAt.Format(time.RFC3339)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// PollTrigger returns an event's latest items, newest first, each with a
+// unique id so polling platforms can tell which are new. large_expense
+// takes a min_amount (default K1,000)
+func (h *IntegrationsHandler) PollTrigger(c *gin.Context) {
+	userID := c.GetString("user_id")
+	event := c.Param("event")
+	if !hookEvents[event] {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown event"})
+		return
+	}
+
+	minAmount := 0.0
+	if v := c.Query("min_amount"); v != "" {
+		var err error
+		if minAmount, err = strconv.ParseFloat(v, 64); err != nil || minAmount < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_amount must be a positive number"})
+			return
+		}
+	}
+
+	items, err := loadHookItems(c.Request.Context(), h.DB, userID, event, minAmount, time.Time{}, zeroUUID, false, hookPollLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+
+	payloads := make([]gin.H, len(items))
+	for i, item := range items {
+		payloads[i] = item.payload
+	}
+	c.JSON(http.StatusOK, payloads)
+}
+
+// validateHookURL only accepts https URLs on public addresses, so hooks
+// can't be used to reach services inside our network. It tells users early;
+// hookClient enforces it when delivering
+func validateHookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return errors.New("target_url must be an https URL")
+	}
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil || len(ips) == 0 {
+		return errors.New("target_url host could not be resolved")
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return errHookAddress
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a REST hook: new items for the event are POSTed to
+// target_url as a JSON array. Items from before the subscription aren't sent
+func (h *IntegrationsHandler) Subscribe(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Event     string   `json:"event" binding:"required"`
+		TargetURL string   `json:"target_url" binding:"required"`
+		MinAmount *float64 `json:"min_amount"` // large_expense only
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !hookEvents[req.Event] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event"})
+		return
+	}
+	if err := validateHookURL(req.TargetURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int
+	h.DB.QueryRow("SELECT COUNT(*) FROM hook_subscriptions WHERE user_id = $1", userID).Scan(&count)
+	if count >= maxHookSubscriptions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You can have at most %d subscriptions", maxHookSubscriptions)})
+		return
+	}
+
+	var id string
+	err := h.DB.QueryRow(`
+		INSERT INTO hook_subscriptions (user_id, event, target_url, min_amount)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, userID, req.Event, req.TargetURL, req.MinAmount).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         id,
+		"event":      req.Event,
+		"target_url": req.TargetURL,
+	})
+}
+
+// Unsubscribe removes a REST hook
+func (h *IntegrationsHandler) Unsubscribe(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	result, err := h.DB.Exec("DELETE FROM hook_subscriptions WHERE id = $1 AND user_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed"})
+}
+
+// HookDeliveryJob returns the job type that sends new events to a user's REST hooks
+func HookDeliveryJob(db *sql.DB) services.JobType {
+	return services.JobType{
+		Name: JobTypeHookDelivery,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			return runHookDelivery(ctx, db, job.UserID.String())
+		},
+	}
+}
+
+// runHookDelivery posts each subscription's new items and advances its
+// cursor on success. Failed deliveries are retried with the next event; a
+// 410 Gone means the platform dropped the hook, so the subscription is removed
+func runHookDelivery(ctx context.Context, db *sql.DB, userID string) (interface{}, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, event, target_url, COALESCE(min_amount, 0), delivered_through, COALESCE(delivered_id::text, $2)
+		FROM hook_subscriptions WHERE user_id = $1
+	`, userID, zeroUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	type subscription struct {
+		id, event, targetURL string
+		minAmount            float64
+		after                time.Time
+		afterID              string
+	}
+	var subs []subscription
+	for rows.Next() {
+		var s subscription
+		if err := rows.Scan(&s.id, &s.event, &s.targetURL, &s.minAmount, &s.after, &s.afterID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	rows.Close()
+
+	delivered, failed := 0, 0
+	for _, s := range subs {
+		items, err := loadHookItems(ctx, db, userID, s.event, s.minAmount, s.after, s.afterID, true, hookDeliveryBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		payloads := make([]gin.H, len(items))
+		for i, item := range items {
+			payloads[i] = item.payload
+		}
+		status, err := postHook(ctx, s.targetURL, payloads)
+		if status == http.StatusGone {
+			db.ExecContext(ctx, "DELETE FROM hook_subscriptions WHERE id = $1", s.id)
+			continue
+		}
+		if err != nil {
+			log.Printf("⚠️ Hook delivery to subscription %s failed: %v", s.id, err)
+			failed++
+			continue
+		}
+
+		last := items[len(items)-1]
+		_, err = db.ExecContext(ctx,
+			"UPDATE hook_subscriptions SET delivered_through = $2, delivered_id = $3 WHERE id = $1",
+			s.id, last.createdAt, last.id,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivered += len(items)
+	}
+
+	return gin.H{"delivered": delivered, "failed": failed}, nil
+}
+
+// postHook sends a JSON payload to a hook URL and returns the response status
+func postHook(ctx context.Context, targetURL string, payload interface{}) (int, error) {
+	if err := validateHookURL(targetURL); err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := hookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("hook returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
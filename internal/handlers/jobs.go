@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeDataExport builds a GDPR archive of everything stored for a user
+const JobTypeDataExport = "data_export"
+
+// JobsHandler exposes background job status and job-backed endpoints
+type JobsHandler struct {
+	DB   *sql.DB
+	Jobs *services.JobService
+}
+
+// GetJob returns the status (and result once completed) of one of the user's jobs
+func (h *JobsHandler) GetJob(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	job, err := h.Jobs.Get(c.Param("id"))
+	if err != nil || job.UserID == nil || job.UserID.String() != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// RequestDataExport queues a GDPR data export for the user. Business mode
+// users can ask for an accounting import file instead with
+// {"format": "quickbooks"} or {"format": "xero"}
+func (h *JobsHandler) RequestDataExport(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Format string `json:"format"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Format == "" {
+		req.Format = "json"
+	}
+
+	if req.Format != "json" {
+		if _, ok := accountingFormat(c, req.Format); !ok {
+			return
+		}
+
+		var businessMode bool
+		err := h.DB.QueryRow("SELECT COALESCE(business_mode, FALSE) FROM users WHERE id = $1", userID).Scan(&businessMode)
+		if err != nil || !businessMode {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Accounting exports require business mode"})
+			return
+		}
+	}
+
+	jobID, err := h.Jobs.Enqueue(userID, JobTypeDataExport, gin.H{"format": req.Format})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue export"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Export queued",
+		"job_id":  jobID,
+		"format":  req.Format,
+	})
+}
+
+// DownloadExport serves the file built by one of the user's completed
+// accounting exports
+func (h *JobsHandler) DownloadExport(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	job, err := h.Jobs.Get(c.Param("id"))
+	if err != nil || job.UserID == nil || job.UserID.String() != userID || job.Type != JobTypeDataExport {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+	if job.Status != models.JobStatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready", "status": job.Status})
+		return
+	}
+
+	var result struct {
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+		CSV         string `json:"csv"`
+	}
+	if err := json.Unmarshal(job.Result, &result); err != nil || result.Filename == "" {
+		// GDPR archives are returned inline by GET /jobs/:id
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export has no file to download"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+result.Filename+`"`)
+	c.Data(http.StatusOK, result.ContentType, []byte(result.CSV))
+}
+
+// DataExportJob returns the job type that builds a user's data archive
+func DataExportJob(db *sql.DB) services.JobType {
+	return services.JobType{
+		Name: JobTypeDataExport,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			return runDataExport(ctx, db, job)
+		},
+		DoneTitle: "📦 Your data export is ready",
+		DoneBody:  "Open Kwacha Tracker to download your data.",
+	}
+}
+
+// runDataExport collects the user's account, transactions and insights,
+// or builds an accounting import file when one was asked for
+func runDataExport(ctx context.Context, db *sql.DB, job *models.Job) (interface{}, error) {
+	userID := job.UserID.String()
+
+	var params struct {
+		Format string `json:"format"`
+	}
+	if len(job.Params) > 0 {
+		if err := json.Unmarshal(job.Params, &params); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := services.AccountingProfiles[params.Format]; ok {
+		return runAccountingExport(ctx, db, userID, params.Format)
+	}
+
+	var user models.User
+	var consentDate sql.NullTime
+	err := db.QueryRowContext(ctx, `
+		SELECT id, device_id, operator, language, is_premium, consent_given, consent_date, created_at, updated_at
+		FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.DeviceID, &user.Operator, &user.Language, &user.IsPremium,
+		&user.ConsentGiven, &consentDate, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if consentDate.Valid {
+		user.ConsentDate = consentDate.Time
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, amount, type, category, operator, recipient, balance, reference, description, sms_fingerprint, account_id, source, date, created_at
+		FROM transactions
+		WHERE user_id = $1
+		ORDER BY date ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		var t models.Transaction
+		if err := rows.Scan(&t.ID, &t.Amount, &t.Type, &t.Category, &t.Operator, &t.Recipient,
+			&t.Balance, &t.Reference, &t.Description, &t.SMSFingerprint, &t.AccountID, &t.Source, &t.Date, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.UserID = user.ID
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	accounts, err := loadAccounts(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	recurring, err := loadRecurringEntries(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	insightRows, err := db.QueryContext(ctx, `
+		SELECT title, message, category, priority, generated_at
+		FROM user_insights
+		WHERE user_id = $1
+		ORDER BY generated_at ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer insightRows.Close()
+
+	insights := []services.AIInsight{}
+	for insightRows.Next() {
+		var insight services.AIInsight
+		if err := insightRows.Scan(&insight.Title, &insight.Message, &insight.Category,
+			&insight.Priority, &insight.GeneratedAt); err != nil {
+			return nil, err
+		}
+		insights = append(insights, insight)
+	}
+	if err := insightRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"exported_at":  time.Now().Format(time.RFC3339),
+		"user":         user,
+		"accounts":     accounts,
+		"recurring":    recurring,
+		"transactions": transactions,
+		"insights":     insights,
+	}, nil
+}
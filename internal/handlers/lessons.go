@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
+)
+
+// learningStreakMilestones are the streak lengths, in days, that earn a push
+var learningStreakMilestones = map[int]bool{3: true, 7: true, 14: true, 30: true, 60: true, 100: true}
+
+// LessonsHandler serves the learning section's lessons and progress
+type LessonsHandler struct {
+	DB       *sql.DB
+	Notifier *notifications.Service
+}
+
+// GetLessons lists the published lessons in order with the user's completions
+func (h *LessonsHandler) GetLessons(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	rows, err := h.DB.Query(`
+		SELECT l.id, l.title, l.topic, l.position, l.duration_minutes, l.published, lc.completed_at
+		FROM lessons l
+		LEFT JOIN lesson_completions lc ON lc.lesson_id = l.id AND lc.user_id = $1
+		WHERE l.published
+		ORDER BY l.position, l.id
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lessons"})
+		return
+	}
+	defer rows.Close()
+
+	lessons := []models.Lesson{}
+	for rows.Next() {
+		var l models.Lesson
+		if err := rows.Scan(&l.ID, &l.Title, &l.Topic, &l.Position, &l.DurationMinutes, &l.Published, &l.CompletedAt); err != nil {
+			continue
+		}
+		lessons = append(lessons, l)
+	}
+
+	progress, err := loadLearningProgress(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lessons": lessons, "progress": progress})
+}
+
+// CompleteLesson records that the user finished a lesson. Completing it again
+// keeps the first completion. Reaching a streak milestone queues a push
+func (h *LessonsHandler) CompleteLesson(c *gin.Context) {
+	userID := c.GetString("user_id")
+	lessonID := c.Param("id")
+
+	var published bool
+	err := h.DB.QueryRow("SELECT published FROM lessons WHERE id = $1", lessonID).Scan(&published)
+	if err != nil || !published {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lesson not found"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record completion"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO lesson_completions (user_id, lesson_id, completed_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, lesson_id) DO NOTHING
+	`, userID, lessonID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record completion"})
+		return
+	}
+	inserted, _ := result.RowsAffected()
+
+	progress, err := learningProgress(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record completion"})
+		return
+	}
+
+	// Only the first lesson of the day can extend the streak, so a milestone is pushed once
+	if inserted > 0 && learningStreakMilestones[progress.CurrentStreak] && progress.completedToday == 1 {
+		err := h.Notifier.Send(tx, userID, models.Notification{
+			Type: models.NotificationReminders,
+			Push: models.PushNotification{
+				Title: fmt.Sprintf("🔥 %d-day learning streak!", progress.CurrentStreak),
+				Body:  fmt.Sprintf("You've completed a lesson %d days in a row. Keep it going tomorrow!", progress.CurrentStreak),
+				Data:  map[string]string{"type": "learning_streak"},
+			},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record completion"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record completion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lesson_id": lessonID, "progress": progress.LearningProgress})
+}
+
+// learningState is a user's progress plus what CompleteLesson needs to decide on a push
+type learningState struct {
+	models.LearningProgress
+	completedToday int
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadLearningProgress summarises a user's lesson completions
+func loadLearningProgress(db *sql.DB, userID string) (models.LearningProgress, error) {
+	state, err := learningProgress(db, userID)
+	return state.LearningProgress, err
+}
+
+// learningProgress counts completions and walks the days lessons were
+// completed on to find the current and best streaks. The current streak is
+// still alive if the last lesson was completed yesterday
+func learningProgress(q queryer, userID string) (learningState, error) {
+	var state learningState
+	err := q.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM lesson_completions lc JOIN lessons l ON l.id = lc.lesson_id
+				WHERE lc.user_id = $1 AND l.published),
+			(SELECT COUNT(*) FROM lessons WHERE published),
+			(SELECT MAX(completed_at) FROM lesson_completions WHERE user_id = $1),
+			(SELECT COUNT(*) FROM lesson_completions WHERE user_id = $1 AND completed_at >= $2)
+	`, userID, localDate(time.Now())).Scan(&state.Completed, &state.Total, &state.LastCompletedAt, &state.completedToday)
+	if err != nil {
+		return state, err
+	}
+
+	rows, err := q.Query(`
+		SELECT DISTINCT completed_at::date FROM lesson_completions
+		WHERE user_id = $1
+		ORDER BY 1 DESC
+	`, userID)
+	if err != nil {
+		return state, err
+	}
+	defer rows.Close()
+
+	var days []time.Time // Most recent first
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return state, err
+		}
+		days = append(days, localDate(day))
+	}
+	if err := rows.Err(); err != nil {
+		return state, err
+	}
+
+	run := 0
+	for i, day := range days {
+		if i > 0 && !days[i-1].AddDate(0, 0, -1).Equal(day) {
+			run = 0
+		}
+		run++
+		if run > state.BestStreak {
+			state.BestStreak = run
+		}
+		if run == i+1 {
+			state.CurrentStreak = run
+		}
+	}
+	if len(days) > 0 && days[0].Before(localDate(time.Now()).AddDate(0, 0, -1)) {
+		state.CurrentStreak = 0
+	}
+	return state, nil
+}
+
+// GetLessons lists every lesson, published or not, with completion counts
+func (h *AdminHandler) GetLessons(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT l.id, l.title, l.topic, l.position, l.duration_minutes, l.published,
+			(SELECT COUNT(*) FROM lesson_completions lc WHERE lc.lesson_id = l.id)
+		FROM lessons l
+		ORDER BY l.position, l.id
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lessons"})
+		return
+	}
+	defer rows.Close()
+
+	lessons := []gin.H{}
+	for rows.Next() {
+		var l models.Lesson
+		var completions int
+		if err := rows.Scan(&l.ID, &l.Title, &l.Topic, &l.Position, &l.DurationMinutes, &l.Published, &completions); err != nil {
+			continue
+		}
+		lessons = append(lessons, gin.H{"lesson": l, "completions": completions})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lessons": lessons})
+}
+
+// SaveLesson creates or updates the lesson with the id in the path
+func (h *AdminHandler) SaveLesson(c *gin.Context) {
+	id := strings.ToLower(c.Param("id"))
+
+	var req struct {
+		Title           string `json:"title" binding:"required,max=255"`
+		Topic           string `json:"topic" binding:"required,max=50"`
+		Position        int    `json:"position"`
+		DurationMinutes int    `json:"duration_minutes" binding:"omitempty,gt=0,lte=120"`
+		Published       bool   `json:"published"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(id) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lesson id is too long"})
+		return
+	}
+	if req.DurationMinutes == 0 {
+		req.DurationMinutes = 5
+	}
+
+	_, err := h.DB.Exec(`
+		INSERT INTO lessons (id, title, topic, position, duration_minutes, published)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			title = EXCLUDED.title, topic = EXCLUDED.topic, position = EXCLUDED.position,
+			duration_minutes = EXCLUDED.duration_minutes, published = EXCLUDED.published,
+			updated_at = CURRENT_TIMESTAMP
+	`, id, req.Title, req.Topic, req.Position, req.DurationMinutes, req.Published)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save lesson"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Lesson{
+		ID:              id,
+		Title:           req.Title,
+		Topic:           req.Topic,
+		Position:        req.Position,
+		DurationMinutes: req.DurationMinutes,
+		Published:       req.Published,
+	})
+}
+
+// DeleteLesson removes a lesson along with its completions
+func (h *AdminHandler) DeleteLesson(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM lessons WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete lesson"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lesson not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lesson deleted"})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// manualOperator is the operator of transactions entered by hand
+const manualOperator = "CASH"
+
+// CreateTransaction stores a transaction the user entered by hand, such as
+// cash spending no SMS reports. It's marked source=manual and counts in
+// analytics, budgets and insights like any synced transaction, but never in
+// the sync status the app compares its SMS against
+func (h *SyncHandler) CreateTransaction(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req models.ManualTransactionInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Date == 0 {
+		req.Date = time.Now().UnixMilli()
+	}
+	t := models.TransactionInput{
+		Amount:      req.Amount,
+		Type:        req.Type,
+		Category:    strings.ToUpper(strings.TrimSpace(req.Category)),
+		Kind:        strings.ToUpper(req.Kind),
+		Operator:    manualOperator,
+		Recipient:   maskPhoneNumbers(req.Recipient),
+		Description: maskPhoneNumbers(req.Description),
+		AccountID:   req.AccountID,
+		Date:        req.Date,
+	}
+	if t.Category == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "category is required"})
+		return
+	}
+	if err := validateTransactionInput(t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if t.Kind == "" {
+		t.Kind = services.TransactionKind(t.Type, t.Category)
+	}
+
+	if !canStoreTransactions(c, h.DB, h.Settings, userID) {
+		return
+	}
+	accounts, err := loadSyncAccounts(c.Request.Context(), h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var accountID *string
+	switch {
+	case t.AccountID != nil:
+		if accountID, err = accounts.resolve(t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	case accounts.cash != "":
+		accountID = &accounts.cash
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	created, err := insertManualTransaction(tx, userID, t, accountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store transaction"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	// Insights, alerts and the like pick it up as they do a sync
+	h.Events.Publish(services.EventTransactionsSynced, userID, services.TransactionsSynced{Inserted: 1, Total: 1, Manual: true})
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// insertManualTransaction stores a transaction entered by hand and counts it
+// in the user's stats. Its fingerprint is only there to fill the column
+func insertManualTransaction(tx *sql.Tx, userID string, t models.TransactionInput, accountID *string) (models.Transaction, error) {
+	id := uuid.New()
+	created := models.Transaction{
+		ID:             id,
+		Amount:         t.Amount,
+		Type:           t.Type,
+		Category:       t.Category,
+		Operator:       t.Operator,
+		Recipient:      t.Recipient,
+		Description:    t.Description,
+		SMSFingerprint: models.TransactionSourceManual + ":" + id.String(),
+		Source:         models.TransactionSourceManual,
+		Date:           time.UnixMilli(t.Date),
+	}
+	err := tx.QueryRow(`
+		INSERT INTO transactions (id, user_id, amount, type, category, operator, recipient, description, sms_fingerprint, date, kind, account_id, source)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING user_id, account_id, created_at
+	`, id, userID, t.Amount, t.Type, t.Category, t.Operator, t.Recipient, t.Description,
+		created.SMSFingerprint, created.Date, t.Kind, accountID, created.Source,
+	).Scan(&created.UserID, &created.AccountID, &created.CreatedAt)
+	if err != nil {
+		return created, err
+	}
+	return created, recordManualEntryStats(tx, userID)
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// GetMe returns the user's profile, consents, notification preferences,
+// devices, streaks and quota usage in one response
+func (h *AuthHandler) GetMe(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.GetString("user_id")
+
+	profile, err := loadProfile(h.DB, userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+	state := models.AccountState{
+		Profile: profile,
+		Streaks: models.AccountStreaks{
+			LearningCurrent: profile.Learning.CurrentStreak,
+			LearningBest:    profile.Learning.BestStreak,
+		},
+	}
+
+	var deviceID string
+	var pushEnabled bool
+	var givenAt, scoringDate sql.NullTime
+	err = h.DB.QueryRowContext(ctx, `
+		SELECT device_id, COALESCE(fcm_token, '') <> '',
+			COALESCE(consent_given, FALSE), consent_date, COALESCE(consent_policy_version, 0), COALESCE(consent_analytics, FALSE),
+			COALESCE(consent_ai, FALSE), COALESCE(consent_scoring, FALSE), consent_scoring_date
+		FROM users WHERE id = $1
+	`, userID).Scan(&deviceID, &pushEnabled, &state.Consent.Given, &givenAt, &state.Consent.PolicyVersion,
+		&state.Consent.Analytics, &state.Consent.AI, &state.Consent.Scoring, &scoringDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch consent"})
+		return
+	}
+	if givenAt.Valid {
+		state.Consent.GivenAt = &givenAt.Time
+	}
+	state.Consent.ReconsentRequired = state.Consent.Given &&
+		state.Consent.PolicyVersion < h.Settings.Int(services.SettingConsentPolicyVersion)
+	if scoringDate.Valid {
+		state.Consent.ScoringDate = &scoringDate.Time
+	}
+
+	if state.Notifications, err = loadNotificationPreferences(ctx, h.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+	if state.Devices, err = loadLinkedDevices(ctx, h.DB, userID, deviceID, pushEnabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices"})
+		return
+	}
+	if state.Streaks.Saving, err = loadGoalStreaks(ctx, h.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch streaks"})
+		return
+	}
+	if state.Quotas, err = h.loadQuotas(ctx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quotas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// Consent changes in consent_log
+const (
+	consentAnalytics     = "analytics"
+	consentAI            = "ai"
+	consentData          = "data"    // Data processing, with the policy version
+	consentSourceProfile = "profile" // Changed by the user with PATCH /me
+	consentSourceConsent = "consent" // Given or withdrawn with PUT /consent
+)
+
+// UpdateMe changes the display name, country, operator, language and the
+// analytics and AI consents. Each consent that actually changes is logged
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req models.ProfileUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DisplayName == nil && req.Operator == nil && req.Language == nil && req.Country == nil &&
+		req.ConsentAnalytics == nil && req.ConsentAI == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if req.Country != nil {
+		country := strings.ToUpper(strings.TrimSpace(*req.Country))
+		if !services.IsSupportedCountry(country) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "country must be one of " + strings.Join(services.CountryCodes(), ", ")})
+			return
+		}
+		req.Country = &country
+	}
+	if req.Operator != nil {
+		operator := strings.ToUpper(strings.TrimSpace(*req.Operator))
+		req.Operator = &operator
+	}
+	if req.Language != nil {
+		language := strings.ToLower(*req.Language)
+		req.Language = &language
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var analytics, ai bool
+	var countryCode, currentOperator string
+	err = tx.QueryRow(`
+		SELECT COALESCE(consent_analytics, FALSE), COALESCE(consent_ai, FALSE), country, COALESCE(operator, '')
+		FROM users WHERE id = $1 FOR UPDATE
+	`, userID).Scan(&analytics, &ai, &countryCode, &currentOperator)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	// The operator must be one of the country's. Moving to a country the
+	// current operator isn't in clears it
+	if req.Country != nil {
+		countryCode = *req.Country
+	}
+	country := services.CountryFor(countryCode)
+	clearOperator := false
+	if req.Operator != nil {
+		if !country.HasOperator(*req.Operator) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "operator must be one of " + strings.Join(country.Operators, ", ")})
+			return
+		}
+	} else if currentOperator != "" && !country.HasOperator(currentOperator) {
+		clearOperator = true
+	}
+
+	var displayName interface{}
+	if req.DisplayName != nil {
+		if name := strings.Join(strings.Fields(*req.DisplayName), " "); name != "" {
+			displayName = name
+		}
+	}
+	_, err = tx.Exec(`
+		UPDATE users SET
+			display_name = CASE WHEN $2 THEN $3 ELSE display_name END,
+			operator = CASE WHEN $9 THEN NULL ELSE COALESCE($4, operator) END,
+			language = COALESCE($5, language),
+			consent_analytics = COALESCE($6, consent_analytics),
+			consent_ai = COALESCE($7, consent_ai),
+			updated_at = $8,
+			country = COALESCE($10, country)
+		WHERE id = $1
+	`, userID, req.DisplayName != nil, displayName, req.Operator, req.Language,
+		req.ConsentAnalytics, req.ConsentAI, time.Now(), clearOperator, req.Country)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	for _, change := range []struct {
+		consent string
+		before  bool
+		after   *bool
+	}{
+		{consentAnalytics, analytics, req.ConsentAnalytics},
+		{consentAI, ai, req.ConsentAI},
+	} {
+		if change.after == nil || *change.after == change.before {
+			continue
+		}
+		_, err = tx.Exec(`
+			INSERT INTO consent_log (user_id, consent, granted, source) VALUES ($1, $2, $3, $4)
+		`, userID, change.consent, *change.after, consentSourceProfile)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	profile, err := loadProfile(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// loadLinkedDevices returns the device the account was registered from,
+// then any other device that has backed it up, most recent first
+func loadLinkedDevices(ctx context.Context, db *sql.DB, userID, registeredID string, pushEnabled bool) ([]models.LinkedDevice, error) {
+	devices := []models.LinkedDevice{{DeviceID: registeredID, Registered: true, PushEnabled: pushEnabled}}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT device_id, MAX(created_at) AS last_backup
+		FROM client_backups
+		WHERE user_id = $1
+		GROUP BY device_id
+		ORDER BY last_backup DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var lastBackup time.Time
+		if err := rows.Scan(&id, &lastBackup); err != nil {
+			return nil, err
+		}
+		if id == registeredID {
+			devices[0].LastBackupAt = &lastBackup
+			continue
+		}
+		devices = append(devices, models.LinkedDevice{DeviceID: id, LastBackupAt: &lastBackup})
+	}
+	return devices, rows.Err()
+}
+
+// loadGoalStreaks returns each saving goal's streak, oldest goal first
+func loadGoalStreaks(ctx context.Context, db *sql.DB, userID string) ([]models.GoalStreak, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, amount, cadence, COALESCE(current_streak, 0), COALESCE(best_streak, 0)
+		FROM saving_goals
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	streaks := []models.GoalStreak{}
+	for rows.Next() {
+		var s models.GoalStreak
+		if err := rows.Scan(&s.GoalID, &s.Amount, &s.Cadence, &s.Current, &s.Best); err != nil {
+			return nil, err
+		}
+		streaks = append(streaks, s)
+	}
+	return streaks, rows.Err()
+}
+
+// loadQuotas counts what the user has against each per-user limit. The
+// counts match the checks the limits are enforced with
+func (h *AuthHandler) loadQuotas(ctx context.Context, userID string) ([]models.QuotaUsage, error) {
+	var goals, rules, budgets, keys, subscriptions, reports, pushes, accounts, recurring int
+	err := h.DB.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM saving_goals WHERE user_id = $1),
+			(SELECT COUNT(*) FROM alert_rules WHERE user_id = $1),
+			(SELECT COUNT(*) FROM budgets WHERE user_id = $1),
+			(SELECT COUNT(*) FROM integration_keys WHERE user_id = $1),
+			(SELECT COUNT(*) FROM hook_subscriptions WHERE user_id = $1),
+			(SELECT COUNT(*) FROM parse_failure_reports WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 day'),
+			(SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND delivery = $2 AND created_at >= CURRENT_DATE),
+			(SELECT COUNT(*) FROM accounts WHERE user_id = $1),
+			(SELECT COUNT(*) FROM recurring_entries WHERE user_id = $1)
+	`, userID, notifications.DeliveryPush).Scan(&goals, &rules, &budgets, &keys, &subscriptions, &reports, &pushes, &accounts, &recurring)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := func(n int) *int { return &n }
+	var pushLimit *int
+	if n := h.Settings.Int(services.SettingDailyPushCap); n > 0 {
+		pushLimit = limit(n)
+	}
+	return []models.QuotaUsage{
+		{Name: "saving_goals", Used: goals, Limit: limit(maxSavingGoals)},
+		{Name: "alert_rules", Used: rules, Limit: limit(maxAlertRules)},
+		{Name: "budgets", Used: budgets, Limit: limit(maxBudgets)},
+		{Name: "accounts", Used: accounts, Limit: limit(maxAccounts)},
+		{Name: "recurring_entries", Used: recurring, Limit: limit(maxRecurringEntries)},
+		{Name: "integration_keys", Used: keys, Limit: limit(maxIntegrationKeys)},
+		{Name: "hook_subscriptions", Used: subscriptions, Limit: limit(maxHookSubscriptions)},
+		{Name: "parse_failure_reports", Used: reports, Limit: limit(maxParseFailureReportsPerDay), Period: "day"},
+		{Name: "pushes", Used: pushes, Limit: pushLimit, Period: "day"},
+	}, nil
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler exposes runtime metrics in the Prometheus text format
+type MetricsHandler struct {
+	DB *sql.DB
+}
+
+// GetMetrics reports connection pool usage, to diagnose saturation during sync spikes
+func (h *MetricsHandler) GetMetrics(c *gin.Context) {
+	stats := h.DB.Stats()
+
+	var b strings.Builder
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+	}
+
+	metric("kwacha_db_pool_max_open_connections", "gauge", "Maximum number of open connections allowed.", float64(stats.MaxOpenConnections))
+	metric("kwacha_db_pool_open_connections", "gauge", "Open connections, in use and idle.", float64(stats.OpenConnections))
+	metric("kwacha_db_pool_in_use_connections", "gauge", "Connections currently in use.", float64(stats.InUse))
+	metric("kwacha_db_pool_idle_connections", "gauge", "Idle connections.", float64(stats.Idle))
+	metric("kwacha_db_pool_wait_count_total", "counter", "Queries that waited for a free connection.", float64(stats.WaitCount))
+	metric("kwacha_db_pool_wait_duration_seconds_total", "counter", "Total time spent waiting for a free connection.", stats.WaitDuration.Seconds())
+	metric("kwacha_db_pool_max_idle_closed_total", "counter", "Connections closed because the idle pool was full.", float64(stats.MaxIdleClosed))
+	metric("kwacha_db_pool_max_idle_time_closed_total", "counter", "Connections closed after being idle too long.", float64(stats.MaxIdleTimeClosed))
+	metric("kwacha_db_pool_max_lifetime_closed_total", "counter", "Connections closed after reaching their maximum lifetime.", float64(stats.MaxLifetimeClosed))
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
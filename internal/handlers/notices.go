@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// noticeMinReporters is how many users must report an operator notice before
+// it's shown, so one user can't broadcast a made-up announcement
+const noticeMinReporters = 3
+
+// relevantNoticesSQL selects the operator notices still worth showing the
+// user ($1): reported by at least $2 users, recent (maintenance windows pass
+// quickly, fee changes stay news for a month) and from an operator they use
+const relevantNoticesSQL = `
+	SELECT n.id, n.operator, n.kind, n.message, n.first_seen
+	FROM operator_notices n
+	WHERE n.reporters >= $2
+	AND n.first_seen > NOW() - CASE n.kind WHEN 'maintenance' THEN INTERVAL '3 days' ELSE INTERVAL '30 days' END
+	AND UPPER(n.operator) IN (
+		SELECT UPPER(operator) FROM transactions WHERE user_id = $1 AND date > NOW() - INTERVAL '90 days'
+		UNION
+		SELECT UPPER(operator) FROM users WHERE id = $1
+	)
+`
+
+// NoticesHandler serves operator announcements
+type NoticesHandler struct {
+	DB *sql.DB
+}
+
+// GetNotices lists current fee-change and maintenance notices for the
+// operators the user transacts with, newest first
+func (h *NoticesHandler) GetNotices(c *gin.Context) {
+	rows, err := h.DB.Query(relevantNoticesSQL+" ORDER BY n.first_seen DESC", c.GetString("user_id"), noticeMinReporters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notices"})
+		return
+	}
+	defer rows.Close()
+
+	notices := []models.OperatorNotice{}
+	for rows.Next() {
+		var n models.OperatorNotice
+		if rows.Scan(&n.ID, &n.Operator, &n.Kind, &n.Message, &n.FirstSeen) == nil {
+			notices = append(notices, n)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notices": notices})
+}
+
+// recordOperatorNotice files a reported SMS the classifier recognized as an
+// operator notice, counting each user who reported it once. hash identifies
+// the notice's template, as for sms_templates
+func recordOperatorNotice(tx *sql.Tx, userID, operator, kind, hash, message string) error {
+	var noticeID int
+	err := tx.QueryRow(`
+		INSERT INTO operator_notices (operator, kind, message, template_hash)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (template_hash) DO UPDATE SET last_seen = CURRENT_TIMESTAMP
+		RETURNING id
+	`, operator, kind, message, hash).Scan(&noticeID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO operator_notice_reporters (notice_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		noticeID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		_, err = tx.Exec("UPDATE operator_notices SET reporters = reporters + 1 WHERE id = $1", noticeID)
+	}
+	return err
+}
+
+// withOperatorNotice adds the newest relevant operator notice the user
+// hasn't been shown yet, such as "MTN fees changed", after their insights
+func (h *InsightsHandler) withOperatorNotice(userID string, insights []services.AIInsight) []services.AIInsight {
+	var n models.OperatorNotice
+	err := h.db.QueryRow(relevantNoticesSQL+`
+		AND NOT EXISTS (SELECT 1 FROM user_notices s WHERE s.user_id = $1 AND s.notice_id = n.id)
+		ORDER BY n.first_seen DESC
+		LIMIT 1
+	`, userID, noticeMinReporters).Scan(&n.ID, &n.Operator, &n.Kind, &n.Message, &n.FirstSeen)
+	if err == sql.ErrNoRows {
+		return insights
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to pick an operator notice for user %s: %v", userID, err)
+		return insights
+	}
+
+	title := "📣 " + n.Operator + " fees changed"
+	if n.Kind == services.NoticeMaintenance {
+		title = "🔧 " + n.Operator + " maintenance"
+	}
+	return append(insights, services.AIInsight{
+		Title:       title,
+		Message:     n.Message,
+		Category:    "tip",
+		Priority:    "medium",
+		GeneratedAt: time.Now(),
+		Meta:        &services.GenerationMeta{Source: services.InsightSourceNotice, NoticeID: n.ID},
+	})
+}
+
+// recordNoticesShown marks the operator notices among insights as shown,
+// within the transaction that stores them
+func recordNoticesShown(tx *sql.Tx, userID string, insights []services.AIInsight) error {
+	for _, insight := range insights {
+		if insight.Meta == nil || insight.Meta.NoticeID == 0 {
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT INTO user_notices (user_id, notice_id, shown_at) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, notice_id) DO NOTHING
+		`, userID, insight.Meta.NoticeID, insight.GeneratedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
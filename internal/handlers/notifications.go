@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultInboxLimit = 50
+	maxInboxLimit     = 200
+)
+
+// NotificationsHandler serves the user's notification inbox and preferences
+type NotificationsHandler struct {
+	DB *sql.DB
+}
+
+// GetNotifications returns the user's most recent notifications, newest
+// first, including the ones that weren't pushed
+func (h *NotificationsHandler) GetNotifications(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultInboxLimit)))
+	if err != nil || limit < 1 {
+		limit = defaultInboxLimit
+	}
+	if limit > maxInboxLimit {
+		limit = maxInboxLimit
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, type, notification, delivery, created_at
+		FROM notifications
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, c.GetString("user_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+	defer rows.Close()
+
+	records := []models.NotificationRecord{}
+	for rows.Next() {
+		var r models.NotificationRecord
+		var notificationJSON []byte
+		if err := rows.Scan(&r.ID, &r.Type, &notificationJSON, &r.Delivery, &r.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+			return
+		}
+		var push models.PushNotification
+		if err := json.Unmarshal(notificationJSON, &push); err == nil {
+			r.Title, r.Body, r.Data = push.Title, push.Body, push.Data
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": records})
+}
+
+// loadNotificationPreferences returns the user's preferences, or the
+// defaults (nothing muted, no quiet hours) if they never set any
+func loadNotificationPreferences(ctx context.Context, db *sql.DB, userID string) (models.NotificationPreferences, error) {
+	prefs := models.NotificationPreferences{Muted: []string{}}
+	var muted pq.StringArray
+	var quietStart, quietEnd sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+		SELECT muted, quiet_start, quiet_end FROM notification_preferences WHERE user_id = $1
+	`, userID).Scan(&muted, &quietStart, &quietEnd)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	}
+	if err != nil {
+		return prefs, err
+	}
+
+	prefs.Muted = append(prefs.Muted, muted...)
+	if quietStart.Valid && quietEnd.Valid {
+		prefs.QuietHours = &models.QuietHours{Start: int(quietStart.Int64), End: int(quietEnd.Int64)}
+	}
+	return prefs, nil
+}
+
+// GetNotificationPreferences returns the muted notification types and quiet
+// hours, with every type that can be muted
+func (h *NotificationsHandler) GetNotificationPreferences(c *gin.Context) {
+	prefs, err := loadNotificationPreferences(c.Request.Context(), h.DB, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"muted":       prefs.Muted,
+		"quiet_hours": prefs.QuietHours,
+		"types":       models.NotificationTypes,
+	})
+}
+
+// UpdateNotificationPreferences replaces the muted types and quiet hours;
+// quiet_hours null turns them off
+func (h *NotificationsHandler) UpdateNotificationPreferences(c *gin.Context) {
+	var req models.NotificationPreferences
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	muted := []string{}
+	seen := make(map[string]bool)
+	for _, t := range req.Muted {
+		if !isNotificationType(t) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown notification type " + t})
+			return
+		}
+		if !seen[t] {
+			seen[t] = true
+			muted = append(muted, t)
+		}
+	}
+
+	var quietStart, quietEnd interface{}
+	if q := req.QuietHours; q != nil {
+		if q.Start == q.End {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Quiet hours must start and end at different hours"})
+			return
+		}
+		quietStart, quietEnd = q.Start, q.End
+	}
+
+	_, err := h.DB.Exec(`
+		INSERT INTO notification_preferences (user_id, muted, quiet_start, quiet_end)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET
+			muted = EXCLUDED.muted, quiet_start = EXCLUDED.quiet_start, quiet_end = EXCLUDED.quiet_end,
+			updated_at = CURRENT_TIMESTAMP
+	`, c.GetString("user_id"), pq.Array(muted), quietStart, quietEnd)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"muted":       muted,
+		"quiet_hours": req.QuietHours,
+		"types":       models.NotificationTypes,
+	})
+}
+
+func isNotificationType(t string) bool {
+	for _, known := range models.NotificationTypes {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
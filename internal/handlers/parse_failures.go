@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// maxParseFailureReportsPerDay caps how many SMS one user can report a day
+const maxParseFailureReportsPerDay = 200
+
+// ReportParseFailures stores SMS the app couldn't parse, for users who share
+// analytics. Each report is redacted again with ScrubPII and phone masking,
+// then clustered with others of the same operator and skeleton into
+// sms_templates, where the most reported formats are picked up for review.
+// Fee-change and maintenance announcements go to operator_notices instead
+func (h *SyncHandler) ReportParseFailures(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req models.ParseFailureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var consented bool
+	var reportedToday int
+	err := h.DB.QueryRow(`
+		SELECT u.consent_given AND COALESCE(u.consent_analytics, FALSE),
+			(SELECT COUNT(*) FROM parse_failure_reports r WHERE r.user_id = u.id AND r.created_at > NOW() - INTERVAL '1 day')
+		FROM users u WHERE u.id = $1
+	`, userID).Scan(&consented, &reportedToday)
+	if err != nil || !consented {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Analytics consent required to report unparsed SMS"})
+		return
+	}
+	if reportedToday+len(req.Reports) > maxParseFailureReportsPerDay {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Daily parse-failure report limit reached"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	for _, r := range req.Reports {
+		operator := strings.ToUpper(strings.TrimSpace(r.Operator))
+		template := services.SMSTemplate(r.Text)
+		snippet := maskPhoneNumbers(&r.Text)
+		*snippet = services.ScrubPII(*snippet)
+
+		sum := sha256.Sum256([]byte(operator + "\n" + template))
+		hash := hex.EncodeToString(sum[:])
+		if kind := services.ClassifyNotice(r.Text); kind != "" {
+			err = recordOperatorNotice(tx, userID, operator, kind, hash, *snippet)
+		} else {
+			err = recordParseFailure(tx, userID, req.AppVersion, operator, template, hash, *snippet)
+		}
+		if err != nil {
+			log.Printf("⚠️ Failed to store parse failure for user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store parse failures"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Parse failures reported", "accepted": len(req.Reports)})
+}
+
+// recordParseFailure adds a redacted report to its template's cluster
+func recordParseFailure(tx *sql.Tx, userID, appVersion, operator, template, hash, snippet string) error {
+	var templateID int
+	err := tx.QueryRow(`
+		INSERT INTO sms_templates (operator, template, template_hash, sample, reports)
+		VALUES ($1, $2, $3, $4, 1)
+		ON CONFLICT (template_hash) DO UPDATE SET
+			reports = sms_templates.reports + 1,
+			sample = EXCLUDED.sample,
+			last_seen = CURRENT_TIMESTAMP
+		RETURNING id
+	`, operator, template, hash, snippet).Scan(&templateID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO parse_failure_reports (template_id, user_id, app_version, snippet)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+	`, templateID, userID, appVersion, snippet)
+	return err
+}
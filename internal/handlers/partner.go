@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// PartnerFields are the aggregate fields a partner plan can include. Period,
+// operator and category identify a segment and are always returned
+var PartnerFields = []string{"users", "transactions", "volume", "share", "average_fee"}
+
+// partnerUsageDays is how much consumption history partners can see
+const partnerUsageDays = 30
+
+// PartnerHandler serves the anonymized market aggregates to data partners
+type PartnerHandler struct {
+	DB      *sql.DB
+	Privacy *services.PrivacyPolicy // Noise added to every figure partners see
+}
+
+// partnerSegments drops the fields the key's plan doesn't include
+func partnerSegments(c *gin.Context, segments []models.MarketSegment) []gin.H {
+	allowed := make(map[string]bool)
+	for _, f := range c.GetStringSlice("partner_fields") {
+		allowed[f] = true
+	}
+
+	result := make([]gin.H, 0, len(segments))
+	for _, s := range segments {
+		item := gin.H{"period": s.Period, "operator": s.Operator}
+		if s.Category != "" {
+			item["category"] = s.Category
+		}
+		if allowed["users"] {
+			item["users"] = s.Users
+		}
+		if allowed["transactions"] {
+			item["transactions"] = s.Transactions
+		}
+		if allowed["volume"] {
+			item["volume"] = s.Volume
+		}
+		if allowed["share"] && s.Share != nil {
+			item["share"] = *s.Share
+		}
+		if allowed["average_fee"] && s.AverageFee != nil {
+			item["average_fee"] = *s.AverageFee
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// serveMarket runs a market query over the requested range, with
+// differential-privacy noise, and responds with the segments the partner's
+// plan allows
+func (h *PartnerHandler) serveMarket(c *gin.Context, spec marketSpec, failure string) {
+	from, to, interval, ok := marketRange(c)
+	if !ok {
+		return
+	}
+
+	segments, suppressed, err := queryMarket(h.DB, spec, from, to, interval, h.Privacy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"segments":   partnerSegments(c, segments),
+		"suppressed": suppressed,
+		"min_users":  MarketMinUsers,
+		"interval":   interval,
+	})
+}
+
+// GetMarketShare returns each operator's share of tracked spend per period
+func (h *PartnerHandler) GetMarketShare(c *gin.Context) {
+	h.serveMarket(c, marketShare, "Failed to fetch market share")
+}
+
+// GetMarketCategories returns spend by operator and category per period
+func (h *PartnerHandler) GetMarketCategories(c *gin.Context) {
+	h.serveMarket(c, marketCategories, "Failed to fetch market categories")
+}
+
+// GetMarketFees returns average transaction fees by operator per period
+func (h *PartnerHandler) GetMarketFees(c *gin.Context) {
+	h.serveMarket(c, marketFees, "Failed to fetch market fees")
+}
+
+// GetUsage returns the key's plan and its daily consumption over the last 30 days
+func (h *PartnerHandler) GetUsage(c *gin.Context) {
+	keyID := c.GetString("partner_key_id")
+
+	var plan string
+	var limit int
+	err := h.DB.QueryRow(`
+		SELECT p.name, p.requests_per_day
+		FROM partner_keys k JOIN partner_plans p ON p.name = k.plan
+		WHERE k.id = $1
+	`, keyID).Scan(&plan, &limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+
+	usage, err := loadPartnerUsage(h.DB, keyID, time.Now().UTC().AddDate(0, 0, -partnerUsageDays), time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan":             plan,
+		"requests_per_day": limit,
+		"fields":           c.GetStringSlice("partner_fields"),
+		"usage":            usage,
+	})
+}
+
+// loadPartnerUsage returns daily consumption between from and to (inclusive
+// UTC days), for one key or, with an empty keyID, every key
+func loadPartnerUsage(db *sql.DB, keyID string, from, to time.Time) ([]models.PartnerUsage, error) {
+	rows, err := db.Query(`
+		SELECT k.id, k.name, k.plan, to_char(u.day, 'YYYY-MM-DD'), u.requests, u.rejected
+		FROM partner_usage u
+		JOIN partner_keys k ON k.id = u.key_id
+		WHERE ($1 = '' OR k.id::text = $1) AND u.day BETWEEN $2 AND $3
+		ORDER BY u.day DESC, k.name
+	`, keyID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []models.PartnerUsage{}
+	for rows.Next() {
+		var u models.PartnerUsage
+		if err := rows.Scan(&u.KeyID, &u.Partner, &u.Plan, &u.Day, &u.Requests, &u.Rejected); err != nil {
+			return nil, err
+		}
+		u.Served = u.Requests - u.Rejected
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
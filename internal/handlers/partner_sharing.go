@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+const (
+	// partnerMaxBacklogDays is the most days one delivery covers; a partner
+	// unreachable for longer misses the older days
+	partnerMaxBacklogDays = 7
+
+	defaultPartnerDeliveries = 50
+	maxPartnerDeliveries     = 200
+
+	// partnerSignatureHeader carries t=<unix time>,v1=<hex HMAC-SHA256 of
+	// "<unix time>.<body>"> keyed with the partner's signing secret
+	partnerSignatureHeader = "X-Kwacha-Signature"
+)
+
+// partnerWebhook is the body POSTed to a financial partner for one grant
+type partnerWebhook struct {
+	GrantID   string                     `json:"grant_id"`
+	Reference *string                    `json:"reference,omitempty"`
+	Currency  string                     `json:"currency"`
+	Days      []models.DailySpendSummary `json:"days"`
+}
+
+// PartnerSharingHandler lets users share daily spend summaries with
+// financial partners and see what was sent
+type PartnerSharingHandler struct {
+	DB *sql.DB
+}
+
+// GetSharingPartners lists the active financial partners and which ones the
+// user shares with
+func (h *PartnerSharingHandler) GetSharingPartners(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT p.id, p.name, g.granted_at, g.reference
+		FROM financial_partners p
+		LEFT JOIN partner_grants g ON g.partner_id = p.id AND g.user_id = $1 AND g.revoked_at IS NULL
+		WHERE p.active
+		ORDER BY p.name
+	`, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch partners"})
+		return
+	}
+	defer rows.Close()
+
+	partners := []models.SharingPartner{}
+	for rows.Next() {
+		var p models.SharingPartner
+		if err := rows.Scan(&p.ID, &p.Name, &p.GrantedAt, &p.Reference); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch partners"})
+			return
+		}
+		p.Granted = p.GrantedAt != nil
+		partners = append(partners, p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"partners": partners})
+}
+
+// GrantPartnerSharing opts the user in to sending the partner a daily summary
+// of their spending per category, starting with today. reference is the
+// user's customer reference at the partner, if it gave them one to link the
+// accounts. Granting again only changes the reference
+func (h *PartnerSharingHandler) GrantPartnerSharing(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Reference *string `json:"reference" binding:"omitempty,max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var active bool
+	err := h.DB.QueryRow("SELECT active FROM financial_partners WHERE id = $1", c.Param("id")).Scan(&active)
+	if err == sql.ErrNoRows || (err == nil && !active) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Partner not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share with partner"})
+		return
+	}
+
+	// Days before the grant are never sent
+	var grantID string
+	var grantedAt time.Time
+	err = h.DB.QueryRow(`
+		INSERT INTO partner_grants (user_id, partner_id, reference, delivered_through)
+		VALUES ($1, $2, $3, CURRENT_DATE - 1)
+		ON CONFLICT (user_id, partner_id) WHERE revoked_at IS NULL DO UPDATE SET reference = EXCLUDED.reference
+		RETURNING id, granted_at
+	`, userID, c.Param("id"), req.Reference).Scan(&grantID, &grantedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share with partner"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"grant_id":   grantID,
+		"granted_at": grantedAt,
+		"reference":  req.Reference,
+	})
+}
+
+// RevokePartnerSharing stops sending the partner summaries. Nothing more is
+// sent once it returns
+func (h *PartnerSharingHandler) RevokePartnerSharing(c *gin.Context) {
+	result, err := h.DB.Exec(`
+		UPDATE partner_grants SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND partner_id = $2 AND revoked_at IS NULL
+	`, c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop sharing"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not sharing with this partner"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Stopped sharing with partner"})
+}
+
+// GetPartnerDeliveries lists what was sent to partners for the user, newest
+// first, including failed attempts
+func (h *PartnerSharingHandler) GetPartnerDeliveries(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPartnerDeliveries)))
+	if err != nil || limit < 1 {
+		limit = defaultPartnerDeliveries
+	}
+	if limit > maxPartnerDeliveries {
+		limit = maxPartnerDeliveries
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT d.id, d.partner_id, p.name, to_char(d.date_from, 'YYYY-MM-DD'), to_char(d.date_to, 'YYYY-MM-DD'),
+			d.status_code, COALESCE(d.error, ''), d.payload, d.created_at
+		FROM partner_deliveries d
+		JOIN financial_partners p ON p.id = d.partner_id
+		WHERE d.user_id = $1
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT $2
+	`, c.GetString("user_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.PartnerDelivery{}
+	for rows.Next() {
+		var d models.PartnerDelivery
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.PartnerID, &d.Partner, &d.DateFrom, &d.DateTo,
+			&d.StatusCode, &d.Error, &payload, &d.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+			return
+		}
+		d.Payload = payload
+		d.Delivered = d.Error == ""
+		deliveries = append(deliveries, d)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// DeliverPartnerWebhooks sends each active grant the days it hasn't had, up
+// to yesterday, and logs every attempt. A failed delivery is retried with the
+// next run
+func DeliverPartnerWebhooks(ctx context.Context, db *sql.DB, now time.Time) error {
+	yesterday := localDate(now).AddDate(0, 0, -1)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT g.id, g.user_id, g.partner_id, g.reference, g.delivered_through, p.webhook_url, p.signing_secret
+		FROM partner_grants g
+		JOIN financial_partners p ON p.id = g.partner_id
+		WHERE g.revoked_at IS NULL AND p.active AND g.delivered_through < $1
+	`, yesterday)
+	if err != nil {
+		return err
+	}
+
+	type grant struct {
+		id, userID, partnerID string
+		reference             *string
+		deliveredThrough      time.Time
+		webhookURL, secret    string
+	}
+	var grants []grant
+	for rows.Next() {
+		var g grant
+		if err := rows.Scan(&g.id, &g.userID, &g.partnerID, &g.reference, &g.deliveredThrough, &g.webhookURL, &g.secret); err != nil {
+			rows.Close()
+			return err
+		}
+		grants = append(grants, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	delivered, failed := 0, 0
+	for _, g := range grants {
+		from := g.deliveredThrough.AddDate(0, 0, 1)
+		if earliest := yesterday.AddDate(0, 0, 1-partnerMaxBacklogDays); from.Before(earliest) {
+			from = earliest
+		}
+
+		days, err := loadDailySpendSummaries(ctx, db, g.userID, from, yesterday)
+		if err != nil {
+			return err
+		}
+		currency := loadCountry(ctx, db, g.userID).Currency
+		body, err := json.Marshal(partnerWebhook{GrantID: g.id, Reference: g.reference, Currency: currency, Days: days})
+		if err != nil {
+			return err
+		}
+
+		status, sendErr := postPartnerWebhook(ctx, g.webhookURL, g.secret, body)
+		var statusCode interface{}
+		if status != 0 {
+			statusCode = status
+		}
+		var errText interface{}
+		if sendErr != nil {
+			errText = sendErr.Error()
+		}
+		_, err = db.ExecContext(ctx, `
+			INSERT INTO partner_deliveries (grant_id, user_id, partner_id, date_from, date_to, payload, status_code, error)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, g.id, g.userID, g.partnerID, from, yesterday, body, statusCode, errText)
+		if err != nil {
+			return err
+		}
+
+		if sendErr != nil {
+			log.Printf("⚠️ Partner delivery for grant %s failed: %v", g.id, sendErr)
+			failed++
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "UPDATE partner_grants SET delivered_through = $2 WHERE id = $1", g.id, yesterday); err != nil {
+			return err
+		}
+		delivered++
+	}
+
+	if len(grants) > 0 {
+		log.Printf("📤 Partner deliveries: %d sent, %d failed", delivered, failed)
+	}
+	return nil
+}
+
+// loadDailySpendSummaries totals the user's spending per day and category
+// from the first day through the last, with a summary for every day
+func loadDailySpendSummaries(ctx context.Context, db *sql.DB, userID string, first, last time.Time) ([]models.DailySpendSummary, error) {
+	source, err := spendingSource(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	days := []models.DailySpendSummary{}
+	index := make(map[string]int)
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		index[date] = len(days)
+		days = append(days, models.DailySpendSummary{Date: date, ByCategory: map[string]float64{}})
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT to_char(date, 'YYYY-MM-DD'), type, `+mappedCategorySQL+`, SUM(amount), SUM(entries)
+		FROM `+source+`
+		WHERE user_id = $1 AND date >= $2 AND date < $3
+		GROUP BY 1, 2, 3
+	`, userID, first, last.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var date, txType, category string
+		var amount float64
+		var entries int
+		if err := rows.Scan(&date, &txType, &category, &amount, &entries); err != nil {
+			return nil, err
+		}
+		i, ok := index[date]
+		if !ok {
+			continue
+		}
+		day := &days[i]
+		day.Transactions += entries
+		switch txType {
+		case "INCOME":
+			day.Income += amount
+		case "EXPENSE":
+			day.Expenses += amount
+			day.ByCategory[category] += amount
+		}
+	}
+	return days, rows.Err()
+}
+
+// postPartnerWebhook POSTs a signed body to a partner and returns the
+// response status
+func postPartnerWebhook(ctx context.Context, targetURL, secret string, body []byte) (int, error) {
+	if err := validateHookURL(targetURL); err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(partnerSignatureHeader, fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil))))
+
+	resp, err := hookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("partner returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeReaggregate rebuilds the figures derived from users' transactions
+const JobTypeReaggregate = "reaggregate"
+
+// reaggregateProgressEvery is how many users are processed between progress reports
+const reaggregateProgressEvery = 25
+
+// reaggregateParams picks the users to rebuild: one user, users with
+// transactions dated in the range (YYYY-MM-DD, inclusive), or everyone
+type reaggregateParams struct {
+	UserID   string `json:"user_id,omitempty" binding:"omitempty,uuid"`
+	DateFrom string `json:"date_from,omitempty"`
+	DateTo   string `json:"date_to,omitempty"`
+}
+
+// reaggregateProgress is reported while the job runs and returned as its result
+type reaggregateProgress struct {
+	Users  int `json:"users"`
+	Done   int `json:"done"`
+	Failed int `json:"failed"`
+}
+
+// ReaggregateJob returns the job type that brings derived figures back in
+// line after category remaps or corrections
+func ReaggregateJob(db *sql.DB, jobs *services.JobService) services.JobType {
+	return services.JobType{
+		Name: JobTypeReaggregate,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			return runReaggregate(ctx, db, jobs, job)
+		},
+	}
+}
+
+// runReaggregate recounts each selected user's transactions, rebuilds their
+// balance reconciliation and rematches their group contributions, reporting
+// progress as it goes. A user who fails is logged and skipped
+func runReaggregate(ctx context.Context, db *sql.DB, jobs *services.JobService, job *models.Job) (interface{}, error) {
+	var params reaggregateParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return nil, err
+	}
+
+	f := &sqlFilter{}
+	if params.UserID != "" {
+		f.where("u.id = " + f.arg(params.UserID))
+	}
+	if params.DateFrom != "" || params.DateTo != "" {
+		cond := "EXISTS (SELECT 1 FROM transactions t WHERE t.user_id = u.id"
+		if params.DateFrom != "" {
+			cond += " AND t.date >= " + f.arg(params.DateFrom)
+		}
+		if params.DateTo != "" {
+			cond += " AND t.date < " + f.arg(params.DateTo) + "::date + 1"
+		}
+		f.where(cond + ")")
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT u.id FROM users u"+f.sql()+" ORDER BY u.id", f.args...)
+	if err != nil {
+		return nil, err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	progress := reaggregateProgress{Users: len(userIDs)}
+	log.Printf("📊 Re-aggregating %d users", progress.Users)
+	for i, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := reaggregateUser(ctx, db, userID); err != nil {
+			log.Printf("⚠️ Re-aggregation failed for user %s: %v", userID, err)
+			progress.Failed++
+		}
+		progress.Done++
+
+		if (i+1)%reaggregateProgressEvery == 0 {
+			if err := jobs.ReportProgress(job.ID, progress); err != nil {
+				log.Printf("⚠️ Failed to report re-aggregation progress: %v", err)
+			}
+			log.Printf("📊 Re-aggregated %d/%d users", progress.Done, progress.Users)
+		}
+	}
+
+	return progress, nil
+}
+
+// reaggregateUser rebuilds one user's derived figures
+func reaggregateUser(ctx context.Context, db *sql.DB, userID string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO user_stats (user_id, transaction_count)
+		VALUES ($1, (SELECT COUNT(*) FROM transactions WHERE user_id = $1))
+		ON CONFLICT (user_id) DO UPDATE SET
+			transaction_count = EXCLUDED.transaction_count,
+			updated_at = NOW()
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := runReconciliation(ctx, db, userID); err != nil {
+		return err
+	}
+	_, err = matchGroupPayments(ctx, db, userID)
+	return err
+}
+
+// Reaggregate queues a rebuild of derived figures for one user (user_id),
+// users with transactions in a date range (date_from/date_to), or everyone.
+// Follow it with GET /admin/reaggregate/:id
+func (h *AdminHandler) Reaggregate(c *gin.Context) {
+	var params reaggregateParams
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if _, err := time.Parse("2006-01-02", params.DateFrom); params.DateFrom != "" && err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", params.DateTo); params.DateTo != "" && err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+		return
+	}
+
+	jobID, err := h.Jobs.Enqueue("", JobTypeReaggregate, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue re-aggregation"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Re-aggregation queued",
+		"job_id":  jobID,
+	})
+}
+
+// GetReaggregation returns a re-aggregation job's progress, and its result once done
+func (h *AdminHandler) GetReaggregation(c *gin.Context) {
+	job, err := h.Jobs.Get(c.Param("id"))
+	if err != nil || job.Type != JobTypeReaggregate {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/services"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	realtimePingInterval = 30 * time.Second
+	realtimeWriteTimeout = 10 * time.Second
+)
+
+// RealtimeHandler streams events to the app over WebSocket so it doesn't have to poll
+type RealtimeHandler struct {
+	Hub *services.RealtimeHub
+}
+
+// Connect upgrades the request to a WebSocket and pushes the user's events
+// until the app disconnects. Messages from the app are ignored
+func (h *RealtimeHandler) Connect(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	events, unsubscribe, err := h.Hub.Subscribe(userID)
+	if err == services.ErrTooManySessions {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many open sessions"})
+		return
+	}
+	defer unsubscribe()
+
+	server := websocket.Server{
+		// Origin isn't checked: the session is authenticated by the
+		// Authorization header alone, which a web page can't attach to a
+		// WebSocket handshake, so another site can't open one as the user.
+		// No cookie is ever honoured here, and the app sends no Origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			serveRealtime(ws, events)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func serveRealtime(ws *websocket.Conn, events <-chan services.RealtimeEvent) {
+	defer ws.Close()
+
+	// Clear the HTTP server's read/write timeouts, which would cut the session off
+	ws.SetDeadline(time.Time{})
+
+	// Reading is how a closed connection is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	send := func(event services.RealtimeEvent) bool {
+		ws.SetWriteDeadline(time.Now().Add(realtimeWriteTimeout))
+		return websocket.JSON.Send(ws, event) == nil
+	}
+
+	if !send(services.RealtimeEvent{Type: services.RealtimeConnected, At: time.Now()}) {
+		return
+	}
+
+	ping := time.NewTicker(realtimePingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event := <-events:
+			if !send(event) {
+				return
+			}
+		case now := <-ping.C:
+			if !send(services.RealtimeEvent{Type: services.RealtimePing, At: now}) {
+				return
+			}
+		}
+	}
+}
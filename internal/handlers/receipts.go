@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeReceiptExtraction reads line items from an uploaded receipt photo
+const JobTypeReceiptExtraction = "receipt_extraction"
+
+// MaxReceiptSize is the largest receipt photo accepted (5 MB)
+const MaxReceiptSize = 5 << 20
+
+// maxReceiptBody allows for the multipart boundaries and headers around the
+// photo, so oversized uploads are cut off before they're buffered
+const maxReceiptBody = MaxReceiptSize + 64<<10
+
+// receiptContentTypes are the image formats Gemini vision accepts
+var receiptContentTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/webp": "webp",
+	"image/heic": "heic",
+}
+
+// ReceiptsHandler handles receipt photo uploads
+type ReceiptsHandler struct {
+	DB      *sql.DB
+	Storage services.ObjectStorage
+	Jobs    *services.JobService
+}
+
+type receiptJobParams struct {
+	TransactionID string `json:"transaction_id"`
+}
+
+// UploadReceipt stores a receipt photo for a transaction and queues extraction
+// Expects multipart/form-data with the photo in the "image" field
+func (h *ReceiptsHandler) UploadReceipt(c *gin.Context) {
+	userID := c.GetString("user_id")
+	transactionID := c.Param("id")
+
+	var exists bool
+	err := h.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM transactions WHERE id = $1 AND user_id = $2)",
+		transactionID, userID,
+	).Scan(&exists)
+	if err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxReceiptBody)
+	file, err := c.FormFile("image")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Receipt image must be 5 MB or smaller"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+		return
+	}
+	if file.Size > MaxReceiptSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Receipt image must be 5 MB or smaller"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+	defer f.Close()
+
+	image, err := io.ReadAll(io.LimitReader(f, MaxReceiptSize+1))
+	if err != nil || len(image) > MaxReceiptSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+
+	// Trust the bytes, not the client's Content-Type header
+	contentType := http.DetectContentType(image)
+	if file.Header.Get("Content-Type") == "image/heic" && contentType == "application/octet-stream" {
+		contentType = "image/heic" // DetectContentType doesn't know HEIC
+	}
+	ext, ok := receiptContentTypes[contentType]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Receipt must be a JPEG, PNG, WebP or HEIC image"})
+		return
+	}
+
+	key := fmt.Sprintf("receipts/%s/%s.%s", userID, transactionID, ext)
+	if err := h.Storage.Put(c.Request.Context(), key, image); err != nil {
+		log.Printf("❌ Failed to store receipt for transaction %s: %v", transactionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store receipt"})
+		return
+	}
+
+	status := models.ReceiptStatusStored
+	if h.Jobs != nil && h.Jobs.Registered(JobTypeReceiptExtraction) {
+		status = models.ReceiptStatusProcessing
+	}
+
+	var oldKey sql.NullString
+	h.DB.QueryRow("SELECT image_key FROM receipts WHERE transaction_id = $1", transactionID).Scan(&oldKey)
+
+	_, err = h.DB.Exec(`
+		INSERT INTO receipts (transaction_id, user_id, image_key, content_type, status)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (transaction_id) DO UPDATE SET
+			image_key = EXCLUDED.image_key, content_type = EXCLUDED.content_type, status = EXCLUDED.status,
+			merchant = NULL, receipt_date = NULL, currency = NULL, total = NULL, tax = NULL,
+			line_items = NULL, error = NULL, updated_at = NOW()
+	`, transactionID, userID, key, contentType, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save receipt"})
+		return
+	}
+
+	// A replacement photo in a different format leaves the old object behind
+	if oldKey.Valid && oldKey.String != key {
+		h.Storage.Delete(c.Request.Context(), oldKey.String)
+	}
+
+	response := gin.H{
+		"message":        "Receipt uploaded",
+		"transaction_id": transactionID,
+		"status":         status,
+	}
+
+	if status == models.ReceiptStatusProcessing {
+		jobID, err := h.Jobs.Enqueue(userID, JobTypeReceiptExtraction, receiptJobParams{TransactionID: transactionID})
+		if err != nil {
+			log.Printf("⚠️ Failed to queue receipt extraction for %s: %v", transactionID, err)
+			h.DB.Exec("UPDATE receipts SET status = $1 WHERE transaction_id = $2",
+				models.ReceiptStatusStored, transactionID)
+			response["status"] = models.ReceiptStatusStored
+		} else {
+			response["job_id"] = jobID
+		}
+	}
+
+	c.JSON(http.StatusAccepted, response)
+}
+
+// GetReceipt returns the extracted receipt data for a transaction
+func (h *ReceiptsHandler) GetReceipt(c *gin.Context) {
+	receipt, _, err := h.loadReceipt(c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, receipt)
+}
+
+// GetReceiptImage streams the stored receipt photo
+func (h *ReceiptsHandler) GetReceiptImage(c *gin.Context) {
+	receipt, key, err := h.loadReceipt(c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
+		return
+	}
+
+	image, err := h.Storage.Get(c.Request.Context(), key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt image not found"})
+		return
+	}
+
+	c.Data(http.StatusOK, receipt.ContentType, image)
+}
+
+// loadReceipt fetches a user's receipt and its storage key
+func (h *ReceiptsHandler) loadReceipt(transactionID, userID string) (*models.Receipt, string, error) {
+	var r models.Receipt
+	var key string
+	var merchant, receiptDate, currency, errMsg sql.NullString
+	var total, tax sql.NullFloat64
+	var lineItems []byte
+
+	err := h.DB.QueryRow(`
+		SELECT transaction_id, image_key, content_type, status, merchant, receipt_date, currency,
+		       total, tax, line_items, error, created_at, updated_at
+		FROM receipts
+		WHERE transaction_id = $1 AND user_id = $2
+	`, transactionID, userID).Scan(&r.TransactionID, &key, &r.ContentType, &r.Status, &merchant,
+		&receiptDate, &currency, &total, &tax, &lineItems, &errMsg, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	r.Merchant = merchant.String
+	r.ReceiptDate = receiptDate.String
+	r.Currency = currency.String
+	r.Error = errMsg.String
+	if total.Valid {
+		r.Total = &total.Float64
+	}
+	if tax.Valid {
+		r.Tax = &tax.Float64
+	}
+	if len(lineItems) > 0 {
+		r.LineItems = lineItems
+	}
+
+	return &r, key, nil
+}
+
+// ReceiptExtractionJob returns the job type that reads receipt photos with Gemini vision
+func ReceiptExtractionJob(db *sql.DB, gemini *services.GeminiService, storage services.ObjectStorage) services.JobType {
+	return services.JobType{
+		Name: JobTypeReceiptExtraction,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			return runReceiptExtraction(ctx, db, gemini, storage, job)
+		},
+		DoneTitle: "🧾 Receipt scanned",
+		DoneBody:  "Your receipt items have been added to the transaction.",
+	}
+}
+
+func runReceiptExtraction(ctx context.Context, db *sql.DB, gemini *services.GeminiService, storage services.ObjectStorage, job *models.Job) (interface{}, error) {
+	var params receiptJobParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return nil, fmt.Errorf("invalid job params: %w", err)
+	}
+
+	var key, contentType string
+	err := db.QueryRowContext(ctx, `
+		SELECT image_key, content_type FROM receipts
+		WHERE transaction_id = $1 AND user_id = $2
+	`, params.TransactionID, job.UserID).Scan(&key, &contentType)
+	if err != nil {
+		return nil, fmt.Errorf("receipt not found: %w", err)
+	}
+
+	image, err := storage.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load receipt image: %w", err)
+	}
+
+	receipt, _, err := gemini.ExtractReceipt(services.WithAIUsers(ctx, job.UserID.String()),
+		loadCountry(ctx, db, job.UserID.String()), image, contentType)
+	if err != nil {
+		db.Exec(`
+			UPDATE receipts SET status = $1, error = $2, updated_at = NOW()
+			WHERE transaction_id = $3
+		`, models.ReceiptStatusFailed, "Could not read receipt", params.TransactionID)
+		return nil, err
+	}
+
+	lineItems, err := json.Marshal(receipt.LineItems)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		UPDATE receipts SET status = $1, merchant = $2, receipt_date = $3, currency = $4,
+			total = $5, tax = $6, line_items = $7, error = NULL, updated_at = NOW()
+		WHERE transaction_id = $8
+	`, models.ReceiptStatusCompleted, nullableText(receipt.Merchant), nullableText(receipt.Date),
+		nullableText(receipt.Currency), receipt.Total, receipt.Tax, lineItems, params.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"transaction_id": params.TransactionID,
+		"merchant":       receipt.Merchant,
+		"line_items":     len(receipt.LineItems),
+	}, nil
+}
+
+// nullableText maps "" to NULL for optional columns
+func nullableText(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
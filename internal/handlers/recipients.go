@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recipientPhoneDigits is how many trailing digits identify a Zambian
+// number, so 0971234567 and +260971234567 hash the same
+const recipientPhoneDigits = 9
+
+// phoneDigitRun matches seven or more digits, optionally split by spaces or
+// dashes: enough to be most of a phone number
+var phoneDigitRun = regexp.MustCompile(`\d(?:[ -]?\d){6,}`)
+
+// recipientSalt returns the user's recipient hashing salt, creating it on first use
+func recipientSalt(db *sql.DB, userID string) (string, error) {
+	fresh := make([]byte, 32)
+	if _, err := rand.Read(fresh); err != nil {
+		return "", err
+	}
+
+	var salt string
+	err := db.QueryRow(`
+		UPDATE users SET recipient_salt = COALESCE(recipient_salt, $2)
+		WHERE id = $1
+		RETURNING recipient_salt
+	`, userID, hex.EncodeToString(fresh)).Scan(&salt)
+	return salt, err
+}
+
+// hashRecipient is the hash the app sends as recipient_hash: the hex
+// HMAC-SHA256, keyed by the user's salt, of the number's last nine digits.
+// Returns "" for anything too short to be a phone number
+func hashRecipient(salt, phone string) string {
+	digits := digitsOnly(phone)
+	if salt == "" || len(digits) < recipientPhoneDigits {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(lastN(digits, recipientPhoneDigits)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateRecipientHash normalises a client-sent recipient hash
+func validateRecipientHash(hash string) (string, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if len(hash) != sha256.Size*2 {
+		return "", fmt.Errorf("recipient_hash must be a hex-encoded HMAC-SHA256")
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", fmt.Errorf("recipient_hash must be a hex-encoded HMAC-SHA256")
+	}
+	return hash, nil
+}
+
+// maskPhoneNumbers masks digit runs long enough to be a phone number,
+// keeping the last three digits, so a number sent as a hash isn't also
+// stored in the clear in the alias or description
+func maskPhoneNumbers(text *string) *string {
+	if text == nil {
+		return nil
+	}
+	masked := phoneDigitRun.ReplaceAllStringFunc(*text, func(run string) string {
+		keep := 3
+		out := []rune(run)
+		for i := len(out) - 1; i >= 0; i-- {
+			if unicode.IsDigit(out[i]) {
+				if keep > 0 {
+					keep--
+				} else {
+					out[i] = '•'
+				}
+			}
+		}
+		return string(out)
+	})
+	return &masked
+}
+
+// GetRecipientSalt returns the salt the app keys recipient hashes with.
+// It never changes, so hashes stay comparable across syncs and devices
+func (h *SyncHandler) GetRecipientSalt(c *gin.Context) {
+	salt, err := recipientSalt(h.DB, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recipient salt"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"salt":      salt,
+		"algorithm": "hmac-sha256",
+		"input":     fmt.Sprintf("last %d digits of the phone number", recipientPhoneDigits),
+	})
+}
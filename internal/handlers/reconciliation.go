@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeReconciliation checks a user's SMS balances against their synced transactions
+const JobTypeReconciliation = "reconciliation"
+
+const (
+	// Fees and levies are deducted with a transaction but rarely parsed, so
+	// small mismatches are expected; only larger jumps count as gaps
+	reconcileMinTolerance  = 2.0   // Kwacha
+	reconcileFeeTolerance  = 0.015 // Share of the transaction amount
+	maxReconciliationGaps  = 20    // Gaps kept per report, most recent first
+	reconcileGapDateFormat = "2 Jan"
+)
+
+// ReconciliationHandler serves the latest reconciliation report to the app
+type ReconciliationHandler struct {
+	DB *sql.DB
+}
+
+// GetReconciliation returns the user's latest report, so the app can ask them
+// to sync the periods where SMS seem to be missing
+func (h *ReconciliationHandler) GetReconciliation(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var report models.ReconciliationReport
+	var coverage sql.NullFloat64
+	var gapsJSON []byte
+	err := h.DB.QueryRow(`
+		SELECT coverage_score, checked_pairs, gap_count, gaps, computed_at
+		FROM reconciliation_reports WHERE user_id = $1
+	`, userID).Scan(&coverage, &report.CheckedPairs, &report.GapCount, &gapsJSON, &report.ComputedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No reconciliation report yet"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reconciliation report"})
+		return
+	}
+
+	if coverage.Valid {
+		report.CoverageScore = &coverage.Float64
+	}
+	report.Gaps = []models.ReconciliationGap{}
+	json.Unmarshal(gapsJSON, &report.Gaps)
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ReconciliationJob returns the job type that rebuilds a user's reconciliation report
+func ReconciliationJob(db *sql.DB) services.JobType {
+	return services.JobType{
+		Name: JobTypeReconciliation,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			return runReconciliation(ctx, db, job.UserID.String())
+		},
+	}
+}
+
+// runReconciliation walks each operator's transactions in order and checks
+// that every reported balance follows from the previous one plus the
+// transactions in between. A jump they don't explain means SMS are missing
+func runReconciliation(ctx context.Context, db *sql.DB, userID string) (interface{}, error) {
+	var language, country sql.NullString
+	db.QueryRowContext(ctx, "SELECT language, country FROM users WHERE id = $1", userID).Scan(&language, &country)
+	format := services.CountryFor(country.String).AmountFormat(language.String)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT operator, amount, type, balance, date
+		FROM transactions
+		WHERE user_id = $1
+		ORDER BY operator, date, created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := models.ReconciliationReport{Gaps: []models.ReconciliationGap{}}
+	var operator string
+	var lastBalance *float64
+	var lastDate time.Time
+	var expected, tolerance float64
+
+	for rows.Next() {
+		var op, txType string
+		var amount float64
+		var balance sql.NullFloat64
+		var date time.Time
+		if err := rows.Scan(&op, &amount, &txType, &balance, &date); err != nil {
+			return nil, err
+		}
+
+		if op != operator {
+			operator, lastBalance = op, nil
+		}
+
+		if lastBalance != nil {
+			if txType == "INCOME" {
+				expected += amount
+			} else {
+				expected -= amount
+			}
+			tolerance += math.Max(reconcileMinTolerance, amount*reconcileFeeTolerance)
+		}
+		if !balance.Valid {
+			continue
+		}
+
+		if lastBalance != nil {
+			report.CheckedPairs++
+			if diff := balance.Float64 - expected; math.Abs(diff) > tolerance {
+				report.GapCount++
+				report.Gaps = append(report.Gaps, models.ReconciliationGap{
+					Operator:        operator,
+					From:            lastDate,
+					To:              date,
+					ExpectedBalance: expected,
+					ActualBalance:   balance.Float64,
+					Difference:      diff,
+					Message:         reconciliationGapMessage(format, operator, lastDate, date, diff),
+				})
+			}
+		}
+
+		current := balance.Float64
+		lastBalance, lastDate = &current, date
+		expected, tolerance = current, 0
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if report.CheckedPairs > 0 {
+		score := 1 - float64(report.GapCount)/float64(report.CheckedPairs)
+		report.CoverageScore = &score
+	}
+
+	// Most recent gaps first, across operators
+	sort.Slice(report.Gaps, func(i, j int) bool { return report.Gaps[i].To.After(report.Gaps[j].To) })
+	if len(report.Gaps) > maxReconciliationGaps {
+		report.Gaps = report.Gaps[:maxReconciliationGaps]
+	}
+	report.ComputedAt = time.Now()
+
+	gapsJSON, err := json.Marshal(report.Gaps)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO reconciliation_reports (user_id, coverage_score, checked_pairs, gap_count, gaps, computed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET
+			coverage_score = EXCLUDED.coverage_score,
+			checked_pairs = EXCLUDED.checked_pairs,
+			gap_count = EXCLUDED.gap_count,
+			gaps = EXCLUDED.gaps,
+			computed_at = EXCLUDED.computed_at
+	`, userID, report.CoverageScore, report.CheckedPairs, report.GapCount, gapsJSON, report.ComputedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"checked_pairs": report.CheckedPairs, "gap_count": report.GapCount}, nil
+}
+
+// reconciliationGapMessage tells the user where they may be missing transactions
+func reconciliationGapMessage(format services.AmountFormat, operator string, from, to time.Time, diff float64) string {
+	kind := "spending"
+	if diff > 0 {
+		kind = "income"
+	}
+	return fmt.Sprintf("You may have unsynced %s transactions between %s and %s: about %s of %s isn't accounted for",
+		operator, from.Format(reconcileGapDateFormat), to.Format(reconcileGapDateFormat),
+		format.FormatWhole(math.Abs(diff)), kind)
+}
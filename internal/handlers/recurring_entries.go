@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+const (
+	maxRecurringEntries           = 20
+	recurringEntryDefaultHour     = 8  // For users without a delivery window; before the day's spending starts
+	recurringEntryTransactionHour = 12 // Confirmed entries are dated midday on their due date
+)
+
+// RecurringEntriesHandler manages templates for transactions the user enters
+// by hand on a schedule, and the pending entries they create
+type RecurringEntriesHandler struct {
+	DB       *sql.DB
+	Events   *services.EventBus
+	Settings *services.Settings
+}
+
+const recurringEntryColumns = "id, amount, type, category, kind, description, account_id, cadence, due_day, next_due, created_at"
+
+func scanRecurringEntry(row interface{ Scan(...interface{}) error }) (models.RecurringEntry, error) {
+	var e models.RecurringEntry
+	var nextDue time.Time
+	err := row.Scan(&e.ID, &e.Amount, &e.Type, &e.Category, &e.Kind, &e.Description, &e.AccountID,
+		&e.Cadence, &e.DueDay, &nextDue, &e.CreatedAt)
+	e.NextDue = nextDue.Format("2006-01-02")
+	return e, err
+}
+
+// loadRecurringEntries returns the user's recurring entries, oldest first
+func loadRecurringEntries(ctx context.Context, db *sql.DB, userID string) ([]models.RecurringEntry, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+recurringEntryColumns+" FROM recurring_entries WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.RecurringEntry{}
+	for rows.Next() {
+		e, err := scanRecurringEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetRecurringEntries lists the user's recurring entries
+func (h *RecurringEntriesHandler) GetRecurringEntries(c *gin.Context) {
+	entries, err := loadRecurringEntries(c.Request.Context(), h.DB, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recurring entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// CreateRecurringEntry sets up a transaction the user makes by hand on a
+// schedule, e.g. rent paid in cash on the 1st. The first entry falls due on
+// the next due day, today included
+func (h *RecurringEntriesHandler) CreateRecurringEntry(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req struct {
+		Amount      float64 `json:"amount" binding:"required,gt=0"`
+		Type        string  `json:"type" binding:"required,oneof=INCOME EXPENSE"`
+		Category    string  `json:"category" binding:"required,max=50"`
+		Kind        string  `json:"kind"`
+		Description *string `json:"description" binding:"omitempty,max=200"`
+		AccountID   *string `json:"account_id"` // Defaults to the user's cash account when confirmed
+		Cadence     string  `json:"cadence" binding:"required,oneof=weekly monthly"`
+		DueDay      *int    `json:"due_day" binding:"required"` // Weekday (0 = Sunday) or day of the month
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateDueDay(req.Cadence, *req.DueDay); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category := strings.ToUpper(strings.TrimSpace(req.Category))
+	if category == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "category is required"})
+		return
+	}
+	kind := strings.ToUpper(req.Kind)
+	if kind == "" {
+		kind = services.TransactionKind(req.Type, category)
+	} else if !services.IsTransactionKind(kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be one of " + strings.Join(services.TransactionKinds, ", ")})
+		return
+	}
+
+	var accountID *string
+	if req.AccountID != nil {
+		accounts, err := loadSyncAccounts(c.Request.Context(), h.DB, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if accountID, err = accounts.resolve(models.TransactionInput{AccountID: req.AccountID}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var count int
+	h.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM recurring_entries WHERE user_id = $1", userID).Scan(&count)
+	if count >= maxRecurringEntries {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You can have at most %d recurring entries", maxRecurringEntries)})
+		return
+	}
+
+	nextDue := cadenceDueOnOrAfter(req.Cadence, *req.DueDay, time.Now())
+	e, err := scanRecurringEntry(h.DB.QueryRowContext(ctx, `
+		INSERT INTO recurring_entries (user_id, amount, type, category, kind, description, account_id, cadence, due_day, next_due)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+recurringEntryColumns,
+		userID, req.Amount, req.Type, category, kind, maskPhoneNumbers(req.Description), accountID,
+		req.Cadence, *req.DueDay, nextDue,
+	))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recurring entry"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, e)
+}
+
+// DeleteRecurringEntry removes a recurring entry and its pending entries.
+// Transactions already confirmed from it are kept
+func (h *RecurringEntriesHandler) DeleteRecurringEntry(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM recurring_entries WHERE id = $1 AND user_id = $2", c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurring entry"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recurring entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring entry deleted"})
+}
+
+// GetPendingEntries lists the entries waiting for the user to confirm or
+// dismiss, oldest due first
+func (h *RecurringEntriesHandler) GetPendingEntries(c *gin.Context) {
+	rows, err := h.DB.QueryContext(c.Request.Context(), `
+		SELECT p.id, p.due, p.status, p.created_at,
+			r.id, r.amount, r.type, r.category, r.kind, r.description, r.account_id, r.cadence, r.due_day, r.next_due, r.created_at
+		FROM pending_entries p
+		JOIN recurring_entries r ON r.id = p.recurring_id
+		WHERE p.user_id = $1 AND p.status = $2
+		ORDER BY p.due, p.created_at
+	`, c.GetString("user_id"), models.PendingEntryPending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pending entries"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.PendingEntry{}
+	for rows.Next() {
+		var p models.PendingEntry
+		var due, nextDue time.Time
+		e := &p.Entry
+		if err := rows.Scan(&p.ID, &due, &p.Status, &p.CreatedAt,
+			&e.ID, &e.Amount, &e.Type, &e.Category, &e.Kind, &e.Description, &e.AccountID,
+			&e.Cadence, &e.DueDay, &nextDue, &e.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pending entries"})
+			return
+		}
+		p.RecurringID = e.ID
+		p.Due = due.Format("2006-01-02")
+		e.NextDue = nextDue.Format("2006-01-02")
+		entries = append(entries, p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// ConfirmPendingEntry stores a pending entry as a manual transaction dated
+// its due date, for the template's amount unless the body gives another
+// (`{"amount": 2600}`). It goes in the template's account, or else the user's
+// cash account
+func (h *RecurringEntriesHandler) ConfirmPendingEntry(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Amount float64 `json:"amount" binding:"omitempty,gt=0"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !canStoreTransactions(c, h.DB, h.Settings, userID) {
+		return
+	}
+	accounts, err := loadSyncAccounts(c.Request.Context(), h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var due time.Time
+	var accountID sql.NullString
+	t := models.TransactionInput{Operator: manualOperator}
+	err = tx.QueryRow(`
+		SELECT p.due, r.amount, r.type, r.category, r.kind, r.description, r.account_id
+		FROM pending_entries p
+		JOIN recurring_entries r ON r.id = p.recurring_id
+		WHERE p.id = $1 AND p.user_id = $2 AND p.status = $3
+		FOR UPDATE OF p
+	`, c.Param("id"), userID, models.PendingEntryPending).Scan(&due, &t.Amount, &t.Type, &t.Category, &t.Kind, &t.Description, &accountID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pending entry not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.Amount > 0 {
+		t.Amount = req.Amount
+	}
+	t.Date = localDate(due).Add(recurringEntryTransactionHour * time.Hour).UnixMilli()
+
+	var account *string
+	switch {
+	case accountID.Valid:
+		account = &accountID.String
+	case accounts.cash != "":
+		account = &accounts.cash
+	}
+
+	created, err := insertManualTransaction(tx, userID, t, account)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store transaction"})
+		return
+	}
+	_, err = tx.Exec(`
+		UPDATE pending_entries SET status = $2, transaction_id = $3, resolved_at = NOW()
+		WHERE id = $1
+	`, c.Param("id"), models.PendingEntryConfirmed, created.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	h.Events.Publish(services.EventTransactionsSynced, userID, services.TransactionsSynced{Inserted: 1, Total: 1, Manual: true})
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// DismissPendingEntry marks a pending entry as not having happened
+func (h *RecurringEntriesHandler) DismissPendingEntry(c *gin.Context) {
+	result, err := h.DB.Exec(`
+		UPDATE pending_entries SET status = $4, resolved_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND status = $3
+	`, c.Param("id"), c.GetString("user_id"), models.PendingEntryPending, models.PendingEntryDismissed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dismiss pending entry"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pending entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pending entry dismissed"})
+}
+
+// dueRecurringEntry is a recurring entry the job creates pending entries for
+type dueRecurringEntry struct {
+	userID string
+	entry  models.RecurringEntry
+}
+
+// CreateRecurringEntries creates a pending entry for each due date a
+// recurring entry reached and asks the user to confirm it, from the hour
+// they're usually active in the app. Due dates missed while the job wasn't
+// running get their entries too, but only the latest is pushed
+func CreateRecurringEntries(ctx context.Context, db *sql.DB, notifier *notifications.Service, at time.Time) error {
+	today := localDate(at)
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.user_id, r.id, r.amount, r.type, r.category, r.kind, r.description, r.account_id,
+			r.cadence, r.due_day, r.next_due, r.created_at
+		FROM recurring_entries r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.next_due <= $1
+		AND COALESCE(u.preferred_push_hour, $2) <= $3
+	`, today, recurringEntryDefaultHour, at.Hour())
+	if err != nil {
+		return err
+	}
+
+	var due []dueRecurringEntry
+	for rows.Next() {
+		var d dueRecurringEntry
+		var nextDue time.Time
+		e := &d.entry
+		if err := rows.Scan(&d.userID, &e.ID, &e.Amount, &e.Type, &e.Category, &e.Kind, &e.Description, &e.AccountID,
+			&e.Cadence, &e.DueDay, &nextDue, &e.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		e.NextDue = nextDue.Format("2006-01-02")
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	created := 0
+	for _, d := range due {
+		n, err := createPendingEntries(ctx, db, notifier, d, today)
+		if err != nil {
+			log.Printf("❌ Failed to create pending entries for recurring entry %s: %v", d.entry.ID, err)
+			continue
+		}
+		created += n
+	}
+
+	if created > 0 {
+		log.Printf("📝 Created %d pending recurring entries", created)
+	}
+	return nil
+}
+
+// createPendingEntries creates the entry's pending entries up to today,
+// moves its next due date past today and queues the push, all in one
+// transaction
+func createPendingEntries(ctx context.Context, db *sql.DB, notifier *notifications.Service, d dueRecurringEntry, today time.Time) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	e := d.entry
+	nextDue, err := time.ParseInLocation("2006-01-02", e.NextDue, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	created := 0
+	var latestID string
+	for ; !nextDue.After(today); nextDue = cadenceNextDue(e.Cadence, nextDue) {
+		var id string
+		err := tx.QueryRow(`
+			INSERT INTO pending_entries (recurring_id, user_id, due)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (recurring_id, due) DO NOTHING
+			RETURNING id
+		`, e.ID, d.userID, nextDue).Scan(&id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		created++
+		latestID = id
+	}
+	if _, err := tx.Exec("UPDATE recurring_entries SET next_due = $2, updated_at = NOW() WHERE id = $1", e.ID, nextDue); err != nil {
+		return 0, err
+	}
+
+	if latestID != "" {
+		what := strings.ToLower(e.Category)
+		if e.Description != nil && *e.Description != "" {
+			what = *e.Description
+		}
+		body := fmt.Sprintf("Did you pay %s for %s? Tap to add it.", services.FormatKwacha(e.Amount), what)
+		if e.Type == "INCOME" {
+			body = fmt.Sprintf("Did you receive %s for %s? Tap to add it.", services.FormatKwacha(e.Amount), what)
+		}
+		err := notifier.Send(tx, d.userID, models.Notification{
+			Type: models.NotificationReminders,
+			Push: models.PushNotification{
+				Title: "📝 Confirm your entry",
+				Body:  body,
+				Data: map[string]string{
+					"type":         "recurring_entry",
+					"pending_id":   latestID,
+					"recurring_id": e.ID.String(),
+				},
+			},
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return created, tx.Commit()
+}
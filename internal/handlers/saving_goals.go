@@ -0,0 +1,451 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/notifications"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// Saving goal cadences
+const (
+	savingCadenceWeekly  = "weekly"
+	savingCadenceMonthly = "monthly"
+)
+
+const (
+	maxSavingGoals            = 5
+	defaultSnoozeHours        = 24
+	maxSnoozeHours            = 7 * 24
+	savingReminderDefaultHour = 17 // For users without a delivery window; after most people are paid for the day
+)
+
+// SavingGoalsHandler manages recurring saving targets
+type SavingGoalsHandler struct {
+	DB *sql.DB
+}
+
+// savingGoal is a saving_goals row
+type savingGoal struct {
+	id               string
+	userID           string
+	amount           float64
+	cadence          string
+	dueDay           int
+	currentStreak    int
+	bestStreak       int
+	evaluatedThrough sql.NullTime
+	snoozedUntil     sql.NullTime
+	createdAt        time.Time
+}
+
+const savingGoalColumns = "id, user_id, amount, cadence, due_day, current_streak, best_streak, evaluated_through, snoozed_until, created_at"
+
+func scanSavingGoal(row interface{ Scan(...interface{}) error }) (savingGoal, error) {
+	var g savingGoal
+	err := row.Scan(&g.id, &g.userID, &g.amount, &g.cadence, &g.dueDay, &g.currentStreak, &g.bestStreak,
+		&g.evaluatedThrough, &g.snoozedUntil, &g.createdAt)
+	return g, err
+}
+
+// localDate is midnight of t's calendar day in server time. Dates and
+// timestamps are stored as local wall-clock times, so only their fields are used
+func localDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// validateDueDay checks dueDay is a weekday for a weekly cadence or a day of
+// the month for a monthly one
+func validateDueDay(cadence string, dueDay int) error {
+	if cadence == savingCadenceWeekly && (dueDay < 0 || dueDay > 6) {
+		return fmt.Errorf("due_day must be a weekday from 0 (Sunday) to 6 (Saturday)")
+	}
+	// Later days don't exist in every month
+	if cadence == savingCadenceMonthly && (dueDay < 1 || dueDay > 28) {
+		return fmt.Errorf("due_day must be a day of the month from 1 to 28")
+	}
+	return nil
+}
+
+// cadenceDueOnOrAfter returns the first date on or after day that falls on
+// dueDay of a weekly or monthly cadence
+func cadenceDueOnOrAfter(cadence string, dueDay int, day time.Time) time.Time {
+	day = localDate(day)
+	if cadence == savingCadenceMonthly {
+		due := time.Date(day.Year(), day.Month(), dueDay, 0, 0, 0, 0, time.Local)
+		if due.Before(day) {
+			due = due.AddDate(0, 1, 0)
+		}
+		return due
+	}
+	return day.AddDate(0, 0, (dueDay-int(day.Weekday())+7)%7)
+}
+
+// cadenceNextDue returns the due date after due
+func cadenceNextDue(cadence string, due time.Time) time.Time {
+	if cadence == savingCadenceMonthly {
+		return due.AddDate(0, 1, 0)
+	}
+	return due.AddDate(0, 0, 7)
+}
+
+// dueOnOrAfter returns the first due date on or after day
+func (g savingGoal) dueOnOrAfter(day time.Time) time.Time {
+	return cadenceDueOnOrAfter(g.cadence, g.dueDay, day)
+}
+
+func (g savingGoal) nextDue(due time.Time) time.Time {
+	return cadenceNextDue(g.cadence, due)
+}
+
+func (g savingGoal) previousDue(due time.Time) time.Time {
+	if g.cadence == savingCadenceMonthly {
+		return due.AddDate(0, -1, 0)
+	}
+	return due.AddDate(0, 0, -7)
+}
+
+// firstOpenDue is the earliest due date whose period hasn't counted towards the streak yet
+func (g savingGoal) firstOpenDue() time.Time {
+	if g.evaluatedThrough.Valid {
+		return g.nextDue(localDate(g.evaluatedThrough.Time))
+	}
+	return g.dueOnOrAfter(g.createdAt)
+}
+
+// periodUnit names the goal's period for messages, e.g. "4-week streak"
+func (g savingGoal) periodUnit() string {
+	if g.cadence == savingCadenceMonthly {
+		return "month"
+	}
+	return "week"
+}
+
+// savedFor sums the savings deposits in the period ending on due
+func (g savingGoal) savedFor(movements []savingsMovement, due time.Time) float64 {
+	start := g.previousDue(due)
+	saved := 0.0
+	for _, m := range movements {
+		day := localDate(m.date)
+		if m.kind == services.SavingsDeposit && day.After(start) && !day.After(due) {
+			saved += m.amount
+		}
+	}
+	return saved
+}
+
+// updateStreak counts every period that has ended since the last update: a
+// met target extends the streak and a missed one resets it
+func updateStreak(ctx context.Context, db *sql.DB, g *savingGoal, movements []savingsMovement, today time.Time) error {
+	changed := false
+	for due := g.firstOpenDue(); due.Before(today); due = g.nextDue(due) {
+		if g.savedFor(movements, due) >= g.amount {
+			g.currentStreak++
+			if g.currentStreak > g.bestStreak {
+				g.bestStreak = g.currentStreak
+			}
+		} else {
+			g.currentStreak = 0
+		}
+		g.evaluatedThrough = sql.NullTime{Time: due, Valid: true}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE saving_goals SET current_streak = $2, best_streak = $3, evaluated_through = $4
+		WHERE id = $1
+	`, g.id, g.currentStreak, g.bestStreak, g.evaluatedThrough)
+	return err
+}
+
+// savingGoalStatus is the API view of a goal as of today
+func savingGoalStatus(g savingGoal, movements []savingsMovement, today time.Time) models.SavingGoal {
+	nextDue := g.dueOnOrAfter(today)
+	status := models.SavingGoal{
+		Amount:          g.amount,
+		Cadence:         g.cadence,
+		DueDay:          g.dueDay,
+		NextDue:         nextDue.Format("2006-01-02"),
+		SavedThisPeriod: g.savedFor(movements, nextDue),
+		CurrentStreak:   g.currentStreak,
+		BestStreak:      g.bestStreak,
+		CreatedAt:       g.createdAt,
+	}
+	status.ID, _ = uuid.Parse(g.id)
+	status.Met = status.SavedThisPeriod >= g.amount
+	if g.snoozedUntil.Valid && g.snoozedUntil.Time.After(time.Now()) {
+		status.SnoozedUntil = &g.snoozedUntil.Time
+	}
+	return status
+}
+
+// loadGoalMovements fetches the savings activity needed to evaluate the goals
+func loadGoalMovements(ctx context.Context, db *sql.DB, userID string, goals []savingGoal, today time.Time) ([]savingsMovement, error) {
+	since := today
+	for _, g := range goals {
+		if start := g.previousDue(g.firstOpenDue()); start.Before(since) {
+			since = start
+		}
+	}
+	return loadSavingsMovements(ctx, db, userID, since)
+}
+
+// GetSavingGoals lists the user's saving goals with progress and streaks
+func (h *SavingGoalsHandler) GetSavingGoals(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	rows, err := h.DB.QueryContext(ctx, "SELECT "+savingGoalColumns+" FROM saving_goals WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch saving goals"})
+		return
+	}
+	var goals []savingGoal
+	for rows.Next() {
+		g, err := scanSavingGoal(rows)
+		if err != nil {
+			continue
+		}
+		goals = append(goals, g)
+	}
+	rows.Close()
+
+	today := localDate(time.Now())
+	movements, err := loadGoalMovements(ctx, h.DB, userID, goals, today)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch savings"})
+		return
+	}
+
+	result := []models.SavingGoal{}
+	for i := range goals {
+		if err := updateStreak(ctx, h.DB, &goals[i], movements, today); err != nil {
+			log.Printf("⚠️ Failed to update saving streak for goal %s: %v", goals[i].id, err)
+		}
+		result = append(result, savingGoalStatus(goals[i], movements, today))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"goals": result})
+}
+
+// CreateSavingGoal sets a recurring saving target
+func (h *SavingGoalsHandler) CreateSavingGoal(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var req struct {
+		Amount  float64 `json:"amount" binding:"required,gt=0"`
+		Cadence string  `json:"cadence" binding:"required,oneof=weekly monthly"`
+		DueDay  *int    `json:"due_day" binding:"required"` // Weekday (0 = Sunday) or day of the month
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateDueDay(req.Cadence, *req.DueDay); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int
+	h.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM saving_goals WHERE user_id = $1", userID).Scan(&count)
+	if count >= maxSavingGoals {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You can have at most %d saving goals", maxSavingGoals)})
+		return
+	}
+
+	g, err := scanSavingGoal(h.DB.QueryRowContext(ctx, `
+		INSERT INTO saving_goals (user_id, amount, cadence, due_day)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+savingGoalColumns,
+		userID, req.Amount, req.Cadence, *req.DueDay,
+	))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create saving goal"})
+		return
+	}
+
+	today := localDate(time.Now())
+	movements, err := loadGoalMovements(ctx, h.DB, userID, []savingGoal{g}, today)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch savings"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, savingGoalStatus(g, movements, today))
+}
+
+// DeleteSavingGoal removes a saving goal
+func (h *SavingGoalsHandler) DeleteSavingGoal(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	result, err := h.DB.Exec("DELETE FROM saving_goals WHERE id = $1 AND user_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete saving goal"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saving goal not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saving goal deleted"})
+}
+
+// SnoozeSavingGoal holds back the goal's reminder for a number of hours
+// (default 24). If the snooze outlasts the due day, that reminder is skipped
+func (h *SavingGoalsHandler) SnoozeSavingGoal(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Hours int `json:"hours"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Hours == 0 {
+		req.Hours = defaultSnoozeHours
+	}
+	if req.Hours < 1 || req.Hours > maxSnoozeHours {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("hours must be between 1 and %d", maxSnoozeHours)})
+		return
+	}
+
+	until := time.Now().Add(time.Duration(req.Hours) * time.Hour)
+	result, err := h.DB.Exec("UPDATE saving_goals SET snoozed_until = $3 WHERE id = $1 AND user_id = $2", c.Param("id"), userID, until)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to snooze saving goal"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saving goal not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"snoozed_until": until})
+}
+
+// SendSavingReminders nudges users whose saving goal is due today and not yet
+// met. Each goal is reminded once per due date, from the hour the user is
+// usually active in the app, unless the reminder is snoozed
+func SendSavingReminders(ctx context.Context, db *sql.DB, notifier *notifications.Service, at time.Time) error {
+	today := localDate(at)
+	rows, err := db.QueryContext(ctx, `
+		SELECT g.id, g.user_id, g.amount, g.cadence, g.due_day, g.current_streak, g.best_streak,
+			g.evaluated_through, g.snoozed_until, g.created_at
+		FROM saving_goals g
+		JOIN users u ON u.id = g.user_id
+		WHERE ((g.cadence = 'weekly' AND g.due_day = $1) OR (g.cadence = 'monthly' AND g.due_day = $2))
+		AND g.reminded_for IS DISTINCT FROM $3
+		AND (g.snoozed_until IS NULL OR g.snoozed_until <= $4)
+		AND COALESCE(u.preferred_push_hour, $5) <= $6
+		ORDER BY g.user_id
+	`, int(today.Weekday()), today.Day(), today, at, savingReminderDefaultHour, at.Hour())
+	if err != nil {
+		return err
+	}
+
+	var goals []savingGoal
+	for rows.Next() {
+		g, err := scanSavingGoal(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		goals = append(goals, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sent := 0
+	for i := 0; i < len(goals); {
+		// Goals are ordered by user, so each user's savings are loaded once
+		j := i
+		for j < len(goals) && goals[j].userID == goals[i].userID {
+			j++
+		}
+		userGoals := goals[i:j]
+		i = j
+
+		movements, err := loadGoalMovements(ctx, db, userGoals[0].userID, userGoals, today)
+		if err != nil {
+			log.Printf("❌ Failed to load savings for user %s: %v", userGoals[0].userID, err)
+			continue
+		}
+		for k := range userGoals {
+			g := &userGoals[k]
+			if err := updateStreak(ctx, db, g, movements, today); err != nil {
+				log.Printf("⚠️ Failed to update saving streak for goal %s: %v", g.id, err)
+			}
+			reminded, err := sendSavingReminder(ctx, db, notifier, *g, g.savedFor(movements, today), today)
+			if err != nil {
+				log.Printf("❌ Failed to send saving reminder for goal %s: %v", g.id, err)
+			}
+			if reminded {
+				sent++
+			}
+		}
+	}
+
+	if sent > 0 {
+		log.Printf("💰 Queued %d saving reminders", sent)
+	}
+	return nil
+}
+
+// sendSavingReminder marks the goal reminded for today and, if it isn't met
+// yet, queues the push in the same transaction
+func sendSavingReminder(ctx context.Context, db *sql.DB, notifier *notifications.Service, g savingGoal, saved float64, today time.Time) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE saving_goals SET reminded_for = $2 WHERE id = $1", g.id, today); err != nil {
+		return false, err
+	}
+
+	remind := saved < g.amount
+	if remind {
+		body := fmt.Sprintf("You planned to save %s today.", services.FormatKwacha(g.amount))
+		if saved > 0 {
+			body += fmt.Sprintf(" You've put away %s so far this %s.", services.FormatKwacha(saved), g.periodUnit())
+		}
+		if g.currentStreak > 0 {
+			body += fmt.Sprintf(" Save now to keep your %d-%s streak going!", g.currentStreak, g.periodUnit())
+		}
+
+		err := notifier.Send(tx, g.userID, models.Notification{
+			Type: models.NotificationReminders,
+			Push: models.PushNotification{
+				Title: "💰 Time to save",
+				Body:  body,
+				Data: map[string]string{
+					"type":    "saving_reminder",
+					"goal_id": g.id,
+				},
+			},
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return remind, tx.Commit()
+}
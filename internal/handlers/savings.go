@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// SavingsHandler reports balances held in operator savings products
+type SavingsHandler struct {
+	DB *sql.DB
+}
+
+// savingsMovement is a transaction classified as savings activity
+type savingsMovement struct {
+	product  string
+	operator string
+	kind     string
+	amount   float64
+	date     time.Time
+}
+
+// loadSavingsMovements classifies the user's transactions since the given time as savings activity
+func loadSavingsMovements(ctx context.Context, db *sql.DB, userID string, since time.Time) ([]savingsMovement, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT operator, type, category, COALESCE(recipient, ''), COALESCE(description, ''), amount, date
+		FROM transactions
+		WHERE user_id = $1 AND date >= $2
+		AND (category = 'SAVINGS' OR COALESCE(recipient, '') || ' ' || COALESCE(description, '') ~* $3)
+		ORDER BY date
+	`, userID, since, services.SavingsCandidatePattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []savingsMovement
+	for rows.Next() {
+		var txType, category, recipient, description string
+		var m savingsMovement
+		if err := rows.Scan(&m.operator, &txType, &category, &recipient, &description, &m.amount, &m.date); err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		m.product, m.kind, ok = services.ClassifySavings(m.operator, txType, category, recipient, description)
+		if ok {
+			movements = append(movements, m)
+		}
+	}
+	return movements, rows.Err()
+}
+
+// savingsInterest sums the interest credited in a set of movements
+func savingsInterest(movements []savingsMovement) float64 {
+	interest := 0.0
+	for _, m := range movements {
+		if m.kind == services.SavingsInterest {
+			interest += m.amount
+		}
+	}
+	return interest
+}
+
+// GetSavings returns deposits, withdrawals, interest and balance per savings product
+func (h *SavingsHandler) GetSavings(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	movements, err := loadSavingsMovements(c.Request.Context(), h.DB, userID, time.Time{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch savings"})
+		return
+	}
+
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	summary := models.SavingsSummary{Products: []models.SavingsProductBalance{}}
+	index := make(map[string]int)
+	for _, m := range movements {
+		i, ok := index[m.product]
+		if !ok {
+			i = len(summary.Products)
+			index[m.product] = i
+			summary.Products = append(summary.Products, models.SavingsProductBalance{Product: m.product, Operator: m.operator})
+		}
+		p := &summary.Products[i]
+
+		switch m.kind {
+		case services.SavingsDeposit:
+			p.Deposits += m.amount
+			p.Balance += m.amount
+		case services.SavingsWithdrawal:
+			p.Withdrawals += m.amount
+			p.Balance -= m.amount
+		case services.SavingsInterest:
+			p.Interest += m.amount
+			p.Balance += m.amount
+			summary.TotalInterest += m.amount
+			if !m.date.Before(monthStart) {
+				summary.InterestThisMonth += m.amount
+			}
+		}
+		p.LastActivity = m.date
+	}
+	for _, p := range summary.Products {
+		summary.TotalBalance += p.Balance
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// JobTypeTransactionEmbeddings embeds a user's transactions that have no vector yet
+const JobTypeTransactionEmbeddings = "transaction_embeddings"
+
+const (
+	embeddingBatchSize = 100
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// SearchHandler serves embedding-based transaction similarity and search
+type SearchHandler struct {
+	DB     *sql.DB
+	Gemini *services.GeminiService
+}
+
+// SimilarTransaction is a transaction with its cosine distance to the query
+type SimilarTransaction struct {
+	models.Transaction
+	Distance float64 `json:"distance"`
+}
+
+// GetSimilar returns the user's transactions closest to the given one
+func (h *SearchHandler) GetSimilar(c *gin.Context) {
+	userID := c.GetString("user_id")
+	limit := searchLimit(c)
+
+	var vector string
+	err := h.DB.QueryRow(`
+		SELECT embedding::text FROM transaction_embeddings
+		WHERE transaction_id = $1 AND user_id = $2
+	`, c.Param("id"), userID).Scan(&vector)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found or not yet indexed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	results, err := h.nearestTransactions(c.Request.Context(), userID, vector, c.Param("id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": results,
+		"count":        len(results),
+	})
+}
+
+// Search finds the user's transactions whose descriptions best match a free-text query
+func (h *SearchHandler) Search(c *gin.Context) {
+	userID := c.GetString("user_id")
+	limit := searchLimit(c)
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	vectors, err := h.Gemini.Embed(aiSearchContext(c.Request.Context(), userID, "search_query"), []string{query})
+	if err == services.ErrAIUnavailable {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI temporarily unavailable", "code": "AI_UNAVAILABLE"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Search embedding failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+		return
+	}
+
+	results, err := h.nearestTransactions(c.Request.Context(), userID, vectorLiteral(vectors[0]), "", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":        query,
+		"transactions": results,
+		"count":        len(results),
+	})
+}
+
+// nearestTransactions orders the user's embedded transactions by cosine distance,
+// optionally excluding one transaction (the one being compared against)
+func (h *SearchHandler) nearestTransactions(ctx context.Context, userID, vector, excludeID string, limit int) ([]SimilarTransaction, error) {
+	rows, err := h.DB.QueryContext(ctx, `
+		SELECT t.id, t.amount, t.type, t.category, t.operator, t.recipient, t.balance,
+		       t.reference, t.description, t.date, t.created_at, e.embedding <=> $2::vector AS distance
+		FROM transaction_embeddings e
+		JOIN transactions t ON t.id = e.transaction_id
+		WHERE e.user_id = $1 AND ($3 = '' OR e.transaction_id::text <> $3)
+		ORDER BY distance
+		LIMIT $4
+	`, userID, vector, excludeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SimilarTransaction{}
+	for rows.Next() {
+		var s SimilarTransaction
+		if err := rows.Scan(&s.ID, &s.Amount, &s.Type, &s.Category, &s.Operator, &s.Recipient, &s.Balance,
+			&s.Reference, &s.Description, &s.Date, &s.CreatedAt, &s.Distance); err != nil {
+			return nil, err
+		}
+		results = append(results, s)
+	}
+	return results, rows.Err()
+}
+
+func searchLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+	if err != nil || limit < 1 {
+		return defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		return maxSearchLimit
+	}
+	return limit
+}
+
+// vectorLiteral renders a vector in pgvector's text format, e.g. [0.1,0.2]
+func vectorLiteral(v []float32) string {
+	parts := make([]string, len(v))
+	for i, f := range v {
+		parts[i] = strconv.FormatFloat(float64(f), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// aiSearchContext attributes embedding calls to the user, noting the fields
+// of theirs the text holds
+func aiSearchContext(ctx context.Context, userID string, fields ...string) context.Context {
+	return services.WithAIFields(services.WithAIUsers(ctx, userID), map[string][]string{userID: fields})
+}
+
+// personalTransferCategories are money moved between people, whose
+// recipient is a person rather than a merchant
+var personalTransferCategories = map[string]bool{"TRANSFER": true, "RECEIVED": true}
+
+// embeddingText is the text embedded for a transaction. A person's name
+// isn't useful for search, so it's never sent
+func embeddingText(category, recipient, description string) string {
+	if personalTransferCategories[category] && recipient != "" {
+		recipient = services.ScrubbedName
+	}
+	return fmt.Sprintf("%s | %s | %s", category, recipient, description)
+}
+
+// TransactionEmbeddingsJob returns the job type that indexes a user's new transactions
+func TransactionEmbeddingsJob(db *sql.DB, gemini *services.GeminiService) services.JobType {
+	return services.JobType{
+		Name: JobTypeTransactionEmbeddings,
+		Run: func(ctx context.Context, job *models.Job) (interface{}, error) {
+			return runTransactionEmbeddings(ctx, db, gemini, job)
+		},
+	}
+}
+
+// runTransactionEmbeddings embeds un-indexed transactions in batches until none are left
+func runTransactionEmbeddings(ctx context.Context, db *sql.DB, gemini *services.GeminiService, job *models.Job) (interface{}, error) {
+	userID := job.UserID.String()
+	embedded := 0
+
+	for {
+		rows, err := db.QueryContext(ctx, `
+			SELECT t.id, COALESCE(t.category, ''), COALESCE(t.recipient, ''), COALESCE(t.description, '')
+			FROM transactions t
+			LEFT JOIN transaction_embeddings e ON e.transaction_id = t.id
+			WHERE t.user_id = $1 AND e.transaction_id IS NULL
+			ORDER BY t.date DESC
+			LIMIT $2
+		`, userID, embeddingBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		var ids, texts []string
+		for rows.Next() {
+			var id, category, recipient, description string
+			if err := rows.Scan(&id, &category, &recipient, &description); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids = append(ids, id)
+			texts = append(texts, embeddingText(category, recipient, description))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		vectors, err := gemini.Embed(aiSearchContext(ctx, userID, "category", "recipient", "description"), texts)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, id := range ids {
+			_, err := db.ExecContext(ctx, `
+				INSERT INTO transaction_embeddings (transaction_id, user_id, embedding, model)
+				VALUES ($1, $2, $3::vector, $4)
+				ON CONFLICT (transaction_id) DO NOTHING
+			`, id, userID, vectorLiteral(vectors[i]), services.EmbeddingModel)
+			if err != nil {
+				return nil, err
+			}
+		}
+		embedded += len(ids)
+
+		if len(ids) < embeddingBatchSize {
+			break
+		}
+	}
+
+	return gin.H{
+		"embedded":    embedded,
+		"finished_at": time.Now().Format(time.RFC3339),
+	}, nil
+}
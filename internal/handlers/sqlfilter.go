@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sqlFilter collects AND-ed WHERE conditions together with their parameters.
+// Placeholders come from arg, which binds the value and returns its $n, so
+// conditions can be added in any order without counting parameters by hand:
+//
+//	f.where("user_id = " + f.arg(userID))
+//
+// Any query whose conditions or parameters vary at runtime is built with
+// one. Hand-numbered placeholders are only for fixed query text
+type sqlFilter struct {
+	conds []string
+	args  []interface{}
+}
+
+// arg binds a parameter and returns its placeholder
+func (f *sqlFilter) arg(v interface{}) string {
+	f.args = append(f.args, v)
+	return "$" + strconv.Itoa(len(f.args))
+}
+
+// argList binds each value and returns the comma-separated placeholders, for IN (...)
+func (f *sqlFilter) argList(values []string) string {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = f.arg(v)
+	}
+	return strings.Join(placeholders, ",")
+}
+
+// where adds a condition; any parameters in it must come from arg
+func (f *sqlFilter) where(cond string) {
+	f.conds = append(f.conds, cond)
+}
+
+// sql renders the conditions as a WHERE clause, or "" when there are none
+func (f *sqlFilter) sql() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+// and renders the conditions to follow a WHERE already in the query, or ""
+// when there are none
+func (f *sqlFilter) and() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(f.conds, " AND ")
+}
+
+// clone returns a copy that can bind more parameters without affecting f
+func (f *sqlFilter) clone() *sqlFilter {
+	return &sqlFilter{
+		conds: append([]string(nil), f.conds...),
+		args:  append([]interface{}(nil), f.args...),
+	}
+}
@@ -1,22 +1,34 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/kwachatracker/backend/internal/database"
 	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
 )
 
 // SyncHandler handles transaction synchronization
-type SyncHandler struct{}
+type SyncHandler struct {
+	DB       *sql.DB
+	Events   *services.EventBus
+	Settings *services.Settings
+}
 
 // Sync receives and stores transactions from the app
 func (h *SyncHandler) Sync(c *gin.Context) {
 	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
 
 	var req models.SyncRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -24,20 +36,18 @@ func (h *SyncHandler) Sync(c *gin.Context) {
 		return
 	}
 
-	// Verify consent before syncing
-	var consentGiven bool
-	err := database.DB.QueryRow(
-		"SELECT consent_given FROM users WHERE id = $1",
-		userID,
-	).Scan(&consentGiven)
+	if !canStoreTransactions(c, h.DB, h.Settings, userID) {
+		return
+	}
 
-	if err != nil || !consentGiven {
-		c.JSON(http.StatusForbidden, gin.H{"error": "User consent required before syncing data"})
+	accounts, err := loadSyncAccounts(ctx, h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
 	// Begin transaction for batch insert
-	tx, err := database.DB.Begin()
+	tx, err := h.DB.BeginTx(ctx, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -46,55 +56,253 @@ func (h *SyncHandler) Sync(c *gin.Context) {
 
 	insertedCount := 0
 	skippedCount := 0
+	results := make([]models.SyncResult, 0, len(req.Transactions))
 
 	for _, t := range req.Transactions {
-		// Use UPSERT to handle duplicates gracefully
-		result, err := tx.Exec(`
-			INSERT INTO transactions (id, user_id, amount, type, category, operator, recipient, balance, reference, description, sms_hash, date)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-			ON CONFLICT (user_id, sms_hash) DO NOTHING
-		`,
-			uuid.New(),
-			userID,
-			t.Amount,
-			t.Type,
-			t.Category,
-			t.Operator,
-			t.Recipient,
-			t.Balance,
-			t.Reference,
-			t.Description,
-			t.SMSHash,
-			time.UnixMilli(t.Date),
-		)
+		result := models.SyncResult{
+			SMSHash:        t.SMSHash,
+			SMSFingerprint: t.SMSFingerprint,
+		}
 
+		fingerprint, err := smsFingerprint(t)
+		if err == nil {
+			err = validateTransactionInput(t)
+		}
+
+		// A hashed recipient is stored with its display alias; the number is
+		// masked wherever the app may have left it in the clear
+		var recipientHash *string
+		if err == nil && t.RecipientHash != "" {
+			var hash string
+			hash, err = validateRecipientHash(t.RecipientHash)
+			recipientHash = &hash
+			t.Recipient = maskPhoneNumbers(t.Recipient)
+			t.Description = maskPhoneNumbers(t.Description)
+		}
+		// Apps that predate kinds send only the type and category
+		if err == nil && t.Kind == "" {
+			t.Kind = services.TransactionKind(t.Type, t.Category)
+		}
+		var accountID *string
+		if err == nil {
+			accountID, err = accounts.resolve(t)
+		}
+		if err != nil {
+			result.Status = models.SyncStatusInvalid
+			result.Reason = err.Error()
+			results = append(results, result)
+			skippedCount++
+			continue
+		}
+
+		inserted, err := storeTransaction(ctx, tx, userID, req.AppVersion, fingerprint, t, recipientHash, accountID)
 		if err != nil {
-			// Log but continue with other transactions
+			// Record but continue with other transactions
+			log.Printf("⚠️ Sync insert failed for user %s: %v", userID, err)
+			result.Status = models.SyncStatusInvalid
+			result.Reason = "Failed to store transaction"
+			results = append(results, result)
 			skippedCount++
 			continue
 		}
 
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected > 0 {
+		if inserted {
+			result.Status = models.SyncStatusInserted
 			insertedCount++
 		} else {
-			skippedCount++ // Duplicate
+			result.Status = models.SyncStatusDuplicate
+			result.Reason = "Transaction already synced"
+			skippedCount++
+		}
+		results = append(results, result)
+	}
+
+	if insertedCount > 0 {
+		if err := recordSyncStats(ctx, tx, userID, insertedCount); err != nil {
+			log.Printf("❌ Failed to update sync stats for user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
 		}
 	}
+	if err := recordParseFailures(ctx, tx, req.AppVersion, req.ParseFailures); err != nil {
+		log.Printf("⚠️ Failed to record parse failures: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
+	// Funnel tracking, indexing and the like happen in event subscribers
+	if insertedCount > 0 {
+		h.Events.Publish(services.EventTransactionsSynced, userID, services.TransactionsSynced{
+			Inserted: insertedCount,
+			Total:    len(req.Transactions),
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "Sync completed",
 		"inserted": insertedCount,
 		"skipped":  skippedCount,
 		"total":    len(req.Transactions),
+		"results":  results,
 	})
 }
 
+// canStoreTransactions verifies the user consented to syncing and isn't in
+// metadata-only mode, answering the request if not
+func canStoreTransactions(c *gin.Context, db *sql.DB, settings *services.Settings, userID string) bool {
+	mode, ok := checkSyncConsent(c, db, settings, userID)
+	if !ok {
+		return false
+	}
+	if mode == models.SyncModeMetadata {
+		c.JSON(http.StatusConflict, gin.H{"error": "Metadata-only mode is on; send daily totals to /sync/aggregates"})
+		return false
+	}
+	return true
+}
+
+// checkSyncConsent verifies the user consented to the current privacy policy,
+// answering the request if not, and returns their sync mode. Consent to an
+// older policy is answered with CONSENT_OUTDATED and the version to accept
+func checkSyncConsent(c *gin.Context, db *sql.DB, settings *services.Settings, userID string) (string, bool) {
+	var consentGiven bool
+	var policyVersion int
+	var mode string
+	err := db.QueryRowContext(c.Request.Context(),
+		"SELECT consent_given, COALESCE(consent_policy_version, 0), sync_mode FROM users WHERE id = $1",
+		userID,
+	).Scan(&consentGiven, &policyVersion, &mode)
+
+	if err != nil || !consentGiven {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User consent required before syncing data"})
+		return "", false
+	}
+	if current := settings.Int(services.SettingConsentPolicyVersion); policyVersion < current {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":          "The privacy policy has changed; consent to the new one before syncing data",
+			"code":           "CONSENT_OUTDATED",
+			"policy_version": current,
+		})
+		return "", false
+	}
+	return mode, true
+}
+
+// storeTransaction inserts one synced transaction under a savepoint, so a
+// row that fails doesn't abort the rest of the batch. It reports false for a
+// transaction already synced
+func storeTransaction(ctx context.Context, tx *sql.Tx, userID, appVersion, fingerprint string, t models.TransactionInput, recipientHash, accountID *string) (bool, error) {
+	tx.ExecContext(ctx, "SAVEPOINT sync_row")
+
+	var smsHash *int
+	if t.SMSHash != 0 {
+		smsHash = &t.SMSHash
+
+		// Upgrade rows synced before the client sent fingerprints so they
+		// dedupe against the new key instead of being inserted twice
+		if t.SMSFingerprint != "" {
+			tx.ExecContext(ctx, `
+				UPDATE transactions SET sms_fingerprint = $1
+				WHERE user_id = $2 AND sms_fingerprint = $3
+				AND NOT EXISTS (SELECT 1 FROM transactions WHERE user_id = $2 AND sms_fingerprint = $1)
+			`, fingerprint, userID, legacyFingerprint(t.SMSHash))
+		}
+	}
+
+	// Use UPSERT to handle duplicates gracefully
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO transactions (id, user_id, amount, type, category, operator, recipient, balance, reference, description, sms_hash, sms_fingerprint, date, recipient_hash, app_version, kind, account_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, ''), $16, $17)
+		ON CONFLICT (user_id, sms_fingerprint) DO NOTHING
+	`,
+		uuid.New(),
+		userID,
+		t.Amount,
+		t.Type,
+		t.Category,
+		t.Operator,
+		t.Recipient,
+		t.Balance,
+		t.Reference,
+		t.Description,
+		smsHash,
+		fingerprint,
+		time.UnixMilli(t.Date),
+		recipientHash,
+		appVersion,
+		strings.ToUpper(t.Kind),
+		accountID,
+	)
+	if err != nil {
+		tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT sync_row")
+		return false, err
+	}
+	tx.ExecContext(ctx, "RELEASE SAVEPOINT sync_row")
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// GetSyncStatus returns what the server holds for the user so the app can
+// detect gaps and re-sync only the months that diverge. Manual entries,
+// which have no SMS on the device, are left out.
+// Each month's checksum is the MD5 of the month's sms_fingerprints sorted
+// ascending and joined with commas.
+func (h *SyncHandler) GetSyncStatus(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var total int
+	var latest sql.NullTime
+	err := h.DB.QueryRowContext(c.Request.Context(),
+		"SELECT COUNT(*), MAX(date) FROM transactions WHERE user_id = $1 AND source = $2",
+		userID, models.TransactionSourceSMS,
+	).Scan(&total, &latest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sync status"})
+		return
+	}
+
+	rows, err := h.DB.QueryContext(c.Request.Context(), `
+		SELECT
+			TO_CHAR(date, 'YYYY-MM') as month,
+			COUNT(*) as count,
+			MD5(STRING_AGG(sms_fingerprint, ',' ORDER BY sms_fingerprint)) as checksum
+		FROM transactions
+		WHERE user_id = $1 AND source = $2
+		GROUP BY TO_CHAR(date, 'YYYY-MM')
+		ORDER BY month ASC
+	`, userID, models.TransactionSourceSMS)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sync status"})
+		return
+	}
+	defer rows.Close()
+
+	months := []models.SyncMonthStatus{}
+	for rows.Next() {
+		var m models.SyncMonthStatus
+		if rows.Scan(&m.Month, &m.Count, &m.Checksum) == nil {
+			months = append(months, m)
+		}
+	}
+
+	status := models.SyncStatus{
+		TotalCount: total,
+		Months:     months,
+	}
+	if latest.Valid {
+		latestMs := latest.Time.UnixMilli()
+		status.LatestDate = &latestMs
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
 // GetTransactions retrieves user's transactions with pagination
 func (h *SyncHandler) GetTransactions(c *gin.Context) {
 	userID := c.GetString("user_id")
@@ -114,13 +322,25 @@ func (h *SyncHandler) GetTransactions(c *gin.Context) {
 		}
 	}
 
-	rows, err := database.DB.Query(`
-		SELECT id, amount, type, category, operator, recipient, balance, reference, description, date
-		FROM transactions
-		WHERE user_id = $1
+	f := &sqlFilter{}
+	f.where("user_id = " + f.arg(userID))
+
+	// Optionally only one account's transactions
+	if a := c.Query("account_id"); a != "" {
+		accountID, err := uuid.Parse(a)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "account_id must be a UUID"})
+			return
+		}
+		f.where("account_id = " + f.arg(accountID))
+	}
+
+	query := `
+		SELECT id, amount, type, category, operator, recipient, balance, reference, description, account_id, source, date
+		FROM transactions` + f.sql() + `
 		ORDER BY date DESC
-		LIMIT $2 OFFSET $3
-	`, userID, limit, offset)
+		LIMIT ` + f.arg(limit) + ` OFFSET ` + f.arg(offset)
+	rows, err := h.DB.QueryContext(c.Request.Context(), query, f.args...)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
@@ -140,11 +360,13 @@ func (h *SyncHandler) GetTransactions(c *gin.Context) {
 			Balance     *float64
 			Reference   *string
 			Description *string
+			AccountID   *uuid.UUID
+			Source      string
 			Date        time.Time
 		}
 
 		if err := rows.Scan(&t.ID, &t.Amount, &t.Type, &t.Category, &t.Operator,
-			&t.Recipient, &t.Balance, &t.Reference, &t.Description, &t.Date); err != nil {
+			&t.Recipient, &t.Balance, &t.Reference, &t.Description, &t.AccountID, &t.Source, &t.Date); err != nil {
 			continue
 		}
 
@@ -158,6 +380,8 @@ func (h *SyncHandler) GetTransactions(c *gin.Context) {
 			"balance":     t.Balance,
 			"reference":   t.Reference,
 			"description": t.Description,
+			"account_id":  t.AccountID,
+			"source":      t.Source,
 			"date":        t.Date.UnixMilli(),
 		})
 	}
@@ -169,6 +393,53 @@ func (h *SyncHandler) GetTransactions(c *gin.Context) {
 	})
 }
 
+// smsFingerprint returns the dedup key for an incoming transaction. Clients
+// should send sms_fingerprint (SHA-256 of the normalized SMS); older app
+// versions only send the 32-bit sms_hash, which is kept as a legacy key.
+func smsFingerprint(t models.TransactionInput) (string, error) {
+	if t.SMSFingerprint != "" {
+		fp := strings.ToLower(strings.TrimSpace(t.SMSFingerprint))
+		if len(fp) != sha256.Size*2 {
+			return "", fmt.Errorf("sms_fingerprint must be a hex-encoded SHA-256")
+		}
+		if _, err := hex.DecodeString(fp); err != nil {
+			return "", fmt.Errorf("sms_fingerprint must be a hex-encoded SHA-256")
+		}
+		return fp, nil
+	}
+
+	if t.SMSHash != 0 {
+		return legacyFingerprint(t.SMSHash), nil
+	}
+
+	return "", fmt.Errorf("sms_fingerprint or sms_hash is required")
+}
+
+// validateTransactionInput rejects transactions the app parsed incorrectly
+func validateTransactionInput(t models.TransactionInput) error {
+	if t.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if t.Type != "INCOME" && t.Type != "EXPENSE" {
+		return fmt.Errorf("type must be INCOME or EXPENSE")
+	}
+	if t.Kind != "" && !services.IsTransactionKind(strings.ToUpper(t.Kind)) {
+		return fmt.Errorf("kind must be one of %s", strings.Join(services.TransactionKinds, ", "))
+	}
+	if t.Date <= 0 {
+		return fmt.Errorf("date is required")
+	}
+	if time.UnixMilli(t.Date).After(time.Now().Add(24 * time.Hour)) {
+		return fmt.Errorf("date is in the future")
+	}
+	return nil
+}
+
+// legacyFingerprint maps an old-style sms_hash onto the fingerprint column
+func legacyFingerprint(smsHash int) string {
+	return "legacy:" + strconv.Itoa(smsHash)
+}
+
 func parseInt(s string) (int, error) {
 	var i int
 	_, err := fmt.Sscanf(s, "%d", &i)
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// tipInterval is how often each user gets a tip from the library
+const tipInterval = 7 * 24 * time.Hour
+
+// libraryTip picks the library tip for a user when their last one is at least
+// a week old, in their language where translated and English otherwise.
+// Tips the user has never seen come first, then the one seen longest ago, so
+// the library rotates before anything repeats. Returns nil when no tip is due
+func libraryTip(db *sql.DB, userID string) (*services.AIInsight, error) {
+	var tipKey, title, message string
+	err := db.QueryRow(`
+		WITH lang AS (
+			SELECT COALESCE(NULLIF(language, ''), 'en') AS code FROM users WHERE id = $1
+		), translations AS (
+			SELECT DISTINCT ON (t.tip_key) t.tip_key, t.title, t.message
+			FROM financial_tips t, lang
+			WHERE t.active AND t.language IN (lang.code, 'en')
+			ORDER BY t.tip_key, t.language = lang.code DESC
+		)
+		SELECT tr.tip_key, tr.title, tr.message
+		FROM translations tr
+		LEFT JOIN user_tips s ON s.user_id = $1 AND s.tip_key = tr.tip_key
+		WHERE NOT EXISTS (SELECT 1 FROM user_tips WHERE user_id = $1 AND shown_at > $2)
+		ORDER BY s.shown_at NULLS FIRST, random()
+		LIMIT 1
+	`, userID, time.Now().Add(-tipInterval)).Scan(&tipKey, &title, &message)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &services.AIInsight{
+		Title:       title,
+		Message:     message,
+		Category:    "tip",
+		Priority:    "low",
+		GeneratedAt: time.Now(),
+		Meta:        &services.GenerationMeta{Source: services.InsightSourceLibrary, TipKey: tipKey},
+	}, nil
+}
+
+// withLibraryTip adds the user's weekly library tip, if one is due, after
+// their generated insights
+func (h *InsightsHandler) withLibraryTip(userID string, insights []services.AIInsight) []services.AIInsight {
+	tip, err := libraryTip(h.db, userID)
+	if err != nil {
+		log.Printf("⚠️ Failed to pick a tip for user %s: %v", userID, err)
+		return insights
+	}
+	if tip == nil {
+		return insights
+	}
+	return append(insights, *tip)
+}
+
+// recordTipsShown marks the library tips among insights as shown, within the
+// transaction that stores them
+func recordTipsShown(tx *sql.Tx, userID string, insights []services.AIInsight) error {
+	for _, insight := range insights {
+		if insight.Meta == nil || insight.Meta.TipKey == "" {
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT INTO user_tips (user_id, tip_key, shown_at) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, tip_key) DO UPDATE SET shown_at = EXCLUDED.shown_at
+		`, userID, insight.Meta.TipKey, insight.GeneratedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTips lists the tip library, optionally for one language (?language=bem)
+func (h *AdminHandler) GetTips(c *gin.Context) {
+	f := &sqlFilter{}
+	if lang := c.Query("language"); lang != "" {
+		f.where("t.language = " + f.arg(strings.ToLower(lang)))
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT t.id, t.tip_key, t.language, t.topic, t.title, t.message, t.active, t.updated_at,
+			(SELECT COUNT(*) FROM user_tips s WHERE s.tip_key = t.tip_key)
+		FROM financial_tips t`+f.sql()+`
+		ORDER BY t.topic, t.tip_key, t.language
+	`, f.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tips"})
+		return
+	}
+	defer rows.Close()
+
+	tips := []models.FinancialTip{}
+	for rows.Next() {
+		var t models.FinancialTip
+		if err := rows.Scan(&t.ID, &t.TipKey, &t.Language, &t.Topic, &t.Title, &t.Message, &t.Active, &t.UpdatedAt, &t.Shown); err != nil {
+			continue
+		}
+		tips = append(tips, t)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tips": tips})
+}
+
+// SaveTip adds a tip, or a translation of one, replacing the existing text
+// for the same tip_key and language. Set active to false to retire a tip
+func (h *AdminHandler) SaveTip(c *gin.Context) {
+	var req models.FinancialTipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := ValidateNotification(models.PushNotification{Title: req.Title, Body: req.Message}); err != nil {
+		// Tips can be pushed as the day's notification, so they must fit one
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	var t models.FinancialTip
+	err := h.DB.QueryRow(`
+		INSERT INTO financial_tips (tip_key, language, topic, title, message, active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tip_key, language) DO UPDATE SET
+			topic = EXCLUDED.topic, title = EXCLUDED.title, message = EXCLUDED.message,
+			active = EXCLUDED.active, updated_at = CURRENT_TIMESTAMP
+		RETURNING id, tip_key, language, topic, title, message, active, updated_at
+	`, strings.ToLower(req.TipKey), strings.ToLower(req.Language), strings.ToLower(req.Topic),
+		req.Title, req.Message, active,
+	).Scan(&t.ID, &t.TipKey, &t.Language, &t.Topic, &t.Title, &t.Message, &t.Active, &t.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tip"})
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// recordSyncStats adds newly inserted transactions to the user's admin list
+// counters. It runs inside the sync transaction so the counts can't drift
+func recordSyncStats(ctx context.Context, tx *sql.Tx, userID string, inserted int) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO user_stats (user_id, last_sync, transaction_count)
+		VALUES ($1, NOW(), $2)
+		ON CONFLICT (user_id) DO UPDATE SET
+			last_sync = EXCLUDED.last_sync,
+			transaction_count = user_stats.transaction_count + EXCLUDED.transaction_count,
+			updated_at = NOW()
+	`, userID, inserted)
+	return err
+}
+
+// recordManualEntryStats counts a transaction the user entered by hand.
+// Unlike a sync it leaves last_sync alone
+func recordManualEntryStats(tx *sql.Tx, userID string) error {
+	_, err := tx.Exec(`
+		INSERT INTO user_stats (user_id, transaction_count)
+		VALUES ($1, 1)
+		ON CONFLICT (user_id) DO UPDATE SET
+			transaction_count = user_stats.transaction_count + 1,
+			updated_at = NOW()
+	`, userID)
+	return err
+}
+
+// clearTransactionStats zeroes the user's transaction count when all their
+// transactions are deleted, inside the transaction deleting them
+func clearTransactionStats(ctx context.Context, tx *sql.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE user_stats SET transaction_count = 0, updated_at = NOW() WHERE user_id = $1",
+		userID,
+	)
+	return err
+}
+
+// recordInsightStats adds stored insights to the user's admin list counters
+func recordInsightStats(db *sql.DB, userID string, stored int) {
+	_, err := db.Exec(`
+		INSERT INTO user_stats (user_id, insights_count)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET
+			insights_count = user_stats.insights_count + EXCLUDED.insights_count,
+			updated_at = NOW()
+	`, userID, stored)
+	if err != nil {
+		log.Printf("⚠️ Failed to update insight stats for user %s: %v", userID, err)
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// ActivityTracker records which hours of the day each user is active in,
+// so insight pushes can be timed to when they actually open the app.
+// Each user is recorded at most once per clock hour, which is also when
+// 7-day retention is checked for the onboarding funnel.
+func ActivityTracker(db *sql.DB, funnel *services.FunnelTracker) gin.HandlerFunc {
+	var mu sync.Mutex
+	lastRecorded := make(map[string]time.Time)
+	lastCleanup := time.Now()
+
+	return func(c *gin.Context) {
+		c.Next()
+
+		userID := c.GetString("user_id")
+		if userID == "" {
+			return
+		}
+
+		now := time.Now()
+		hourStart := now.Truncate(time.Hour)
+
+		mu.Lock()
+		if now.Sub(lastCleanup) > time.Hour {
+			for id, at := range lastRecorded {
+				if at.Before(hourStart) {
+					delete(lastRecorded, id)
+				}
+			}
+			lastCleanup = now
+		}
+		if lastRecorded[userID].Equal(hourStart) {
+			mu.Unlock()
+			return
+		}
+		lastRecorded[userID] = hourStart
+		mu.Unlock()
+
+		_, err := db.Exec(`
+			INSERT INTO user_activity_hours (user_id, hour, hits, last_seen_at)
+			VALUES ($1, $2, 1, $3)
+			ON CONFLICT (user_id, hour) DO UPDATE SET hits = user_activity_hours.hits + 1, last_seen_at = $3
+		`, userID, now.Hour(), now)
+		if err != nil {
+			log.Printf("⚠️ Failed to record activity for user %s: %v", userID, err)
+		}
+
+		funnel.RecordRetention(userID)
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IntegrationKeyHeader carries an integration API key
+const IntegrationKeyHeader = "X-API-Key"
+
+// HashIntegrationKey returns the stored form of an integration key
+func HashIntegrationKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IntegrationKeyAuth authenticates no-code integrations (Zapier, IFTTT) by
+// API key and acts as the key's owner. Keys are sent in the X-API-Key header
+// or, for tools that can only set query strings, the api_key parameter
+func IntegrationKeyAuth(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(IntegrationKeyHeader))
+		if key == "" {
+			key = c.Query("api_key")
+		}
+		if key == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+			c.Abort()
+			return
+		}
+
+		var keyID, userID string
+		err := db.QueryRow(`
+			UPDATE integration_keys SET last_used_at = CURRENT_TIMESTAMP
+			WHERE key_hash = $1
+			RETURNING id, user_id
+		`, HashIntegrationKey(key)).Scan(&keyID, &userID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", userID)
+		c.Set("integration_key_id", keyID)
+		c.Next()
+	}
+}
@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -61,6 +64,40 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	}
 }
 
+// AdminAuthMiddleware validates JWT tokens and requires the admin role
+func AdminAuthMiddleware(jwtSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			c.Abort()
+			return
+		}
+
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(parts[1], claims, func(token *jwt.Token) (interface{}, error) {
+			return []byte(jwtSecret), nil
+		})
+		if err != nil || !token.Valid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		if role, _ := claims["role"].(string); role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+
+		userID, _ := claims["user_id"].(string)
+		c.Set("user_id", userID)
+		c.Set("role", "admin")
+		c.Next()
+	}
+}
+
 // GenerateToken creates a new JWT token
 func GenerateToken(userID, deviceID, jwtSecret string, expirationHours int) (string, error) {
 	claims := JWTClaims{
@@ -79,22 +116,49 @@ func GenerateToken(userID, deviceID, jwtSecret string, expirationHours int) (str
 
 // RateLimiter implements a simple rate limiter
 func RateLimiter(requestsPerMinute int) gin.HandlerFunc {
+	return DynamicRateLimiter(func() int { return requestsPerMinute })
+}
+
+// DynamicRateLimiter is RateLimiter with a limit read on every request, e.g.
+// from a runtime setting. Every response carries the quota headers for the
+// current minute, and a 429 says in Retry-After when the next one starts, so
+// clients can pace a bulk sync instead of retrying blindly
+func DynamicRateLimiter(requestsPerMinute func() int) gin.HandlerFunc {
 	// Using a simple in-memory approach
 	// In production, use Redis for distributed rate limiting
+	var mu sync.Mutex
 	requestCounts := make(map[string]int)
 	lastReset := time.Now()
 
 	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+
+		mu.Lock()
 		// Reset counts every minute
 		if time.Since(lastReset) > time.Minute {
 			requestCounts = make(map[string]int)
 			lastReset = time.Now()
 		}
-
-		clientIP := c.ClientIP()
 		requestCounts[clientIP]++
-
-		if requestCounts[clientIP] > requestsPerMinute {
+		count := requestCounts[clientIP]
+		reset := lastReset.Add(time.Minute)
+		mu.Unlock()
+
+		limit := requestsPerMinute()
+		remaining := limit - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Header(QuotaLimitHeader, strconv.Itoa(limit))
+		c.Header(QuotaRemainingHeader, strconv.Itoa(remaining))
+		c.Header(QuotaResetHeader, strconv.FormatInt(reset.Unix(), 10))
+
+		if count > limit {
+			retryAfter := int(math.Ceil(time.Until(reset).Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
 			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
 			c.Abort()
 			return
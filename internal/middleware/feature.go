@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// Feature answers requests with 503 FEATURE_DISABLED while feature is
+// switched off, in its setting or the config
+func Feature(settings *services.Settings, feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if settings.FeatureEnabled(feature) {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", "300")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "This feature is temporarily unavailable. Please try again later.",
+			"code":    "FEATURE_DISABLED",
+			"feature": feature,
+		})
+		c.Abort()
+	}
+}
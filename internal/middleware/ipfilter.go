@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseCIDRs parses CIDR ranges; bare IPs are treated as single-address ranges
+func ParseCIDRs(entries []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// LoadCIDRFile reads one CIDR per line (# comments allowed), e.g. datacenter
+// ranges exported from an ASN database
+func LoadCIDRFile(path string) ([]*net.IPNet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ParseCIDRs(lines)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPAllowlist rejects requests from addresses outside the allowed ranges.
+// An empty allowlist lets every request through
+func IPAllowlist(allowed []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(allowed) == 0 {
+			c.Next()
+			return
+		}
+
+		ip := net.ParseIP(c.ClientIP())
+		if ip == nil || !containsIP(allowed, ip) {
+			log.Printf("🚫 Blocked admin request from %s", c.ClientIP())
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RegistrationGuard blocks sign-ups from blocked ranges (datacenter ASNs) and,
+// when allowedCountries is set, from countries outside it. The country comes from
+// countryHeader, set by the CDN or load balancer in front of the API, and is only
+// believed from a peer in trustedProxies; other peers are refused
+func RegistrationGuard(blocked, trustedProxies []*net.IPNet, allowedCountries []string, countryHeader string) gin.HandlerFunc {
+	countries := make(map[string]bool, len(allowedCountries))
+	for _, country := range allowedCountries {
+		if country = strings.ToUpper(strings.TrimSpace(country)); country != "" {
+			countries[country] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		if ip := net.ParseIP(c.ClientIP()); ip != nil && containsIP(blocked, ip) {
+			log.Printf("🚫 Blocked registration from datacenter range %s", c.ClientIP())
+			c.JSON(http.StatusForbidden, gin.H{"error": "Registration is not available from this network"})
+			c.Abort()
+			return
+		}
+
+		if len(countries) > 0 && countryHeader != "" {
+			// A request that skipped the proxy could claim any country
+			if peer := net.ParseIP(c.RemoteIP()); peer == nil || !containsIP(trustedProxies, peer) {
+				log.Printf("🚫 Blocked registration from %s, which didn't come through a trusted proxy", c.RemoteIP())
+				c.JSON(http.StatusForbidden, gin.H{"error": "Registration is not available in your region"})
+				c.Abort()
+				return
+			}
+
+			country := strings.ToUpper(c.GetHeader(countryHeader))
+			// A trusted proxy that doesn't send the header is misconfigured; let the
+			// request through rather than locking out users
+			if country != "" && !countries[country] {
+				log.Printf("🚫 Blocked registration from country %s (%s)", country, c.ClientIP())
+				c.JSON(http.StatusForbidden, gin.H{"error": "Registration is not available in your region"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
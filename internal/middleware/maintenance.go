@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwachatracker/backend/internal/services"
+)
+
+// Maintenance answers requests with 503 while the maintenance_mode setting is
+// on. Paths starting with one of skipPrefixes, like health checks and the
+// admin API used to turn it off again, are always served
+func Maintenance(settings *services.Settings, skipPrefixes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !settings.Bool(services.SettingMaintenanceMode) {
+			c.Next()
+			return
+		}
+		for _, prefix := range skipPrefixes {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+
+		c.Header("Retry-After", "300")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": settings.String(services.SettingMaintenanceMessage),
+			"code":  "MAINTENANCE",
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Quota headers sent with every partner API response, and by the rate
+// limiters with every response they let through or turn away
+const (
+	QuotaLimitHeader     = "X-RateLimit-Limit"
+	QuotaRemainingHeader = "X-RateLimit-Remaining"
+	QuotaResetHeader     = "X-RateLimit-Reset" // Unix time the quota resets (next UTC midnight for partners)
+)
+
+// PartnerKeyAuth authenticates data partners by the API key in X-API-Key and
+// meters the request against the daily quota of the key's plan. Requests
+// past the quota get a 429 and are counted as rejected. The plan's fields
+// are stored as partner_fields for the handlers to filter responses with
+func PartnerKeyAuth(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(IntegrationKeyHeader))
+		if key == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+			c.Abort()
+			return
+		}
+
+		var keyID string
+		var limit int
+		var fields pq.StringArray
+		err := db.QueryRow(`
+			UPDATE partner_keys k SET last_used_at = CURRENT_TIMESTAMP
+			FROM partner_plans p
+			WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND p.name = k.plan
+			RETURNING k.id, p.requests_per_day, p.fields
+		`, HashIntegrationKey(key)).Scan(&keyID, &limit, &fields)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+
+		now := time.Now().UTC()
+		day := now.Format("2006-01-02")
+		reset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+
+		var used int
+		err = db.QueryRow(`
+			INSERT INTO partner_usage (key_id, day, requests) VALUES ($1, $2, 1)
+			ON CONFLICT (key_id, day) DO UPDATE SET requests = partner_usage.requests + 1
+			RETURNING requests
+		`, keyID, day).Scan(&used)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to meter request"})
+			c.Abort()
+			return
+		}
+
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Header(QuotaLimitHeader, strconv.Itoa(limit))
+		c.Header(QuotaRemainingHeader, strconv.Itoa(remaining))
+		c.Header(QuotaResetHeader, strconv.FormatInt(reset.Unix(), 10))
+
+		if used > limit {
+			db.Exec("UPDATE partner_usage SET rejected = rejected + 1 WHERE key_id = $1 AND day = $2", keyID, day)
+			c.Header("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Daily request quota exceeded"})
+			c.Abort()
+			return
+		}
+
+		c.Set("partner_key_id", keyID)
+		c.Set("partner_fields", []string(fields))
+		c.Next()
+	}
+}
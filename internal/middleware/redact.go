@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces sensitive values in logs
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are header, query and JSON field names whose values are never logged.
+// Names are compared lowercased with dashes folded to underscores
+var sensitiveKeys = map[string]bool{
+	"authorization":  true,
+	"cookie":         true,
+	"set_cookie":     true,
+	"token":          true,
+	"fcm_token":      true,
+	"refresh_token":  true,
+	"password":       true,
+	"secret":         true,
+	"api_key":        true,
+	"x_api_key":      true,
+	"x_goog_api_key": true,
+	"recipient":      true,
+	"phone":          true,
+	"phone_number":   true,
+	"msisdn":         true,
+}
+
+// phoneNumber matches Zambian mobile numbers in local (0971234567) or international (+260971234567) form
+var phoneNumber = regexp.MustCompile(`(?:\+?260|\b0)[79]\d{8}\b`)
+
+func isSensitiveKey(key string) bool {
+	return sensitiveKeys[strings.ReplaceAll(strings.ToLower(key), "-", "_")]
+}
+
+// RedactString masks phone numbers in free text
+func RedactString(s string) string {
+	return phoneNumber.ReplaceAllString(s, Redacted)
+}
+
+// RedactHeaders returns headers flattened for logging, with credentials removed
+func RedactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for key, values := range h {
+		if isSensitiveKey(key) {
+			out[key] = Redacted
+			continue
+		}
+		out[key] = RedactString(strings.Join(values, ", "))
+	}
+	return out
+}
+
+// RedactQuery returns an encoded query string safe to log
+func RedactQuery(values url.Values) string {
+	if len(values) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range values[key] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			if isSensitiveKey(key) {
+				value = Redacted
+			} else {
+				value = RedactString(value)
+			}
+			b.WriteString(url.QueryEscape(key) + "=" + value)
+		}
+	}
+	return b.String()
+}
+
+// RedactJSON returns a copy of a JSON payload with sensitive fields and phone
+// numbers masked. Payloads that aren't valid JSON are redacted as plain text
+func RedactJSON(payload []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return RedactString(string(payload))
+	}
+
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return Redacted
+	}
+	return string(out)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if isSensitiveKey(key) {
+				if value != nil {
+					v[key] = Redacted
+				}
+				continue
+			}
+			v[key] = redactValue(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+		return v
+	case string:
+		return RedactString(v)
+	default:
+		return v
+	}
+}
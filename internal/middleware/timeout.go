@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutKey holds the request's *timeoutWriter once a Timeout has run
+const timeoutKey = "request_timeout"
+
+// timeoutWriteGrace is how long past its deadline a request's connection
+// still takes writes, so the 504 gets out
+const timeoutWriteGrace = 5 * time.Second
+
+// Timeout gives the request a deadline d from now, 0 for none. Its context is
+// cancelled when the deadline passes, so database and Gemini calls made with
+// it give up, and the client gets a 504 TIMEOUT instead of whatever the
+// handler answers after that. A response already under way, like a streamed
+// export, is left alone. A Timeout on a group or route replaces the one on
+// the router, so routes can have more time than the default as well as less.
+// The connection's write deadline moves with it, past the server's
+// WriteTimeout if need be, so a long export isn't cut off mid-stream
+func Timeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, ok := c.Get(timeoutKey); ok {
+			w := v.(*timeoutWriter)
+			w.setDeadline(c, d)
+			c.Next()
+			return
+		}
+
+		w := &timeoutWriter{ResponseWriter: c.Writer, base: c.Request.Context(), cancel: func() {}}
+		w.setDeadline(c, d)
+		defer func() { w.cancel() }()
+		c.Writer = w
+		c.Set(timeoutKey, w)
+
+		c.Next()
+
+		c.Writer = w.ResponseWriter
+		if w.discarded || (!w.Written() && w.expired()) {
+			c.JSON(http.StatusGatewayTimeout, gin.H{
+				"error": "The request took too long. Please try again.",
+				"code":  "TIMEOUT",
+			})
+			c.Abort()
+		}
+	}
+}
+
+// timeoutWriter holds back a handler's response once the request's deadline
+// has passed, so Timeout can answer 504 in its place
+type timeoutWriter struct {
+	gin.ResponseWriter
+	base      context.Context // The request's context before any deadline
+	ctx       context.Context
+	cancel    context.CancelFunc
+	discarded bool
+}
+
+// setDeadline replaces the request's deadline with one d from now
+func (w *timeoutWriter) setDeadline(c *gin.Context, d time.Duration) {
+	w.cancel()
+	if d > 0 {
+		w.ctx, w.cancel = context.WithTimeout(w.base, d)
+	} else {
+		w.ctx, w.cancel = context.WithCancel(w.base)
+	}
+	c.Request = c.Request.WithContext(w.ctx)
+
+	if d > 0 {
+		// Not every writer supports it (e.g. in tests); the server's timeout applies then
+		http.NewResponseController(w.ResponseWriter).SetWriteDeadline(time.Now().Add(d + timeoutWriteGrace))
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *timeoutWriter) expired() bool {
+	return errors.Is(w.ctx.Err(), context.DeadlineExceeded)
+}
+
+// hold reports whether a write should be dropped: nothing is sent yet and
+// the deadline has passed
+func (w *timeoutWriter) hold() bool {
+	if !w.discarded && !w.Written() && w.expired() {
+		w.discarded = true
+	}
+	return w.discarded
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.hold() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.hold() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if !w.hold() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Flush() {
+	if !w.hold() {
+		w.ResponseWriter.Flush()
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,6 +13,7 @@ type User struct {
 	DeviceID     string    `json:"device_id" db:"device_id"`
 	FCMToken     string    `json:"-" db:"fcm_token"`
 	Operator     string    `json:"operator" db:"operator"`
+	Language     string    `json:"language" db:"language"`
 	IsPremium    bool      `json:"is_premium" db:"is_premium"`
 	ConsentGiven bool      `json:"consent_given" db:"consent_given"`
 	ConsentDate  time.Time `json:"consent_date,omitempty" db:"consent_date"`
@@ -21,40 +23,374 @@ type User struct {
 
 // Transaction represents a mobile money transaction
 type Transaction struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	UserID      uuid.UUID `json:"user_id" db:"user_id"`
-	Amount      float64   `json:"amount" db:"amount"`
-	Type        string    `json:"type" db:"type"`         // INCOME, EXPENSE
-	Category    string    `json:"category" db:"category"` // DATA, AIRTIME, PAYMENT, etc.
-	Operator    string    `json:"operator" db:"operator"` // AIRTEL, MTN, ZAMTEL, ZEDMOBILE
-	Recipient   *string   `json:"recipient,omitempty" db:"recipient"`
-	Balance     *float64  `json:"balance,omitempty" db:"balance"`
-	Reference   *string   `json:"reference,omitempty" db:"reference"`
-	Description *string   `json:"description,omitempty" db:"description"`
-	SMSHash     int       `json:"sms_hash" db:"sms_hash"`
-	Date        time.Time `json:"date" db:"date"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ID             uuid.UUID  `json:"id" db:"id"`
+	UserID         uuid.UUID  `json:"user_id" db:"user_id"`
+	Amount         float64    `json:"amount" db:"amount"`
+	Type           string     `json:"type" db:"type"`         // INCOME, EXPENSE
+	Category       string     `json:"category" db:"category"` // DATA, AIRTIME, PAYMENT, etc.
+	Operator       string     `json:"operator" db:"operator"` // One of the country's, e.g. AIRTEL or MTN in Zambia
+	Recipient      *string    `json:"recipient,omitempty" db:"recipient"`
+	Balance        *float64   `json:"balance,omitempty" db:"balance"`
+	Reference      *string    `json:"reference,omitempty" db:"reference"`
+	Description    *string    `json:"description,omitempty" db:"description"`
+	SMSHash        int        `json:"sms_hash" db:"sms_hash"`
+	SMSFingerprint string     `json:"sms_fingerprint" db:"sms_fingerprint"`
+	AccountID      *uuid.UUID `json:"account_id,omitempty" db:"account_id"`
+	Source         string     `json:"source" db:"source"` // sms, manual
+	Date           time.Time  `json:"date" db:"date"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Transaction sources
+const (
+	TransactionSourceSMS    = "sms"
+	TransactionSourceManual = "manual" // Entered by hand, such as cash spending
+)
+
+// ManualTransactionInput is a transaction the user enters by hand, with no SMS
+type ManualTransactionInput struct {
+	Amount      float64 `json:"amount" binding:"required,gt=0"`
+	Type        string  `json:"type" binding:"required,oneof=INCOME EXPENSE"`
+	Category    string  `json:"category" binding:"required,max=50"`
+	Kind        string  `json:"kind,omitempty"`
+	Recipient   *string `json:"recipient,omitempty" binding:"omitempty,max=100"` // Who was paid or paid the user
+	Description *string `json:"description,omitempty" binding:"omitempty,max=200"`
+	AccountID   *string `json:"account_id,omitempty"` // Defaults to the user's cash account
+	Date        int64   `json:"date,omitempty"`       // Unix milliseconds; defaults to now
+}
+
+// Account types
+const (
+	AccountTypeWallet = "wallet" // Mobile money wallet on an operator
+	AccountTypeBank   = "bank"
+	AccountTypeCash   = "cash"
+)
+
+// Account is where a user's money sits: an operator wallet, a bank account
+// or cash. Transactions point at the account they moved money in or out of
+type Account struct {
+	ID           uuid.UUID `json:"id"`
+	Type         string    `json:"type"`
+	Name         string    `json:"name"`
+	Operator     *string   `json:"operator,omitempty"`      // Wallets only
+	Institution  *string   `json:"institution,omitempty"`   // Bank name, for bank accounts
+	NumberSuffix *string   `json:"number_suffix,omitempty"` // Last 4 digits of a bank account's number
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// AccountSummary is an account's money in and out over a period, with its
+// balance as of the latest SMS that reported one. The summary for
+// transactions in no account has no account_id
+type AccountSummary struct {
+	AccountID    *uuid.UUID `json:"account_id,omitempty"`
+	Type         string     `json:"type,omitempty"`
+	Name         string     `json:"name"`
+	Income       float64    `json:"income"`
+	Expenses     float64    `json:"expenses"`
+	Net          float64    `json:"net"`
+	Transactions int        `json:"transactions"`
+	Balance      *float64   `json:"balance,omitempty"`
+	BalanceAt    *time.Time `json:"balance_at,omitempty"`
 }
 
 // SyncRequest represents a batch of transactions to sync
 type SyncRequest struct {
-	DeviceID     string             `json:"device_id" binding:"required"`
-	Transactions []TransactionInput `json:"transactions" binding:"required"`
-	Timestamp    int64              `json:"timestamp" binding:"required"`
+	DeviceID      string             `json:"device_id" binding:"required"`
+	Transactions  []TransactionInput `json:"transactions" binding:"required"`
+	Timestamp     int64              `json:"timestamp" binding:"required"`
+	AppVersion    string             `json:"app_version,omitempty" binding:"max=30"`
+	ParseFailures map[string]int     `json:"parse_failures,omitempty"` // Operator -> SMS the app couldn't parse since the last sync
+}
+
+// Sync modes. In metadata-only mode the app sends DailyAggregates and
+// individual transactions never leave the device
+const (
+	SyncModeFull     = "full"
+	SyncModeMetadata = "metadata"
+)
+
+// AggregateSyncRequest is a batch of daily totals from a metadata-only device
+type AggregateSyncRequest struct {
+	DeviceID      string           `json:"device_id" binding:"required"`
+	Aggregates    []DailyAggregate `json:"aggregates" binding:"required,max=5000,dive"`
+	AppVersion    string           `json:"app_version,omitempty" binding:"max=30"`
+	ParseFailures map[string]int   `json:"parse_failures,omitempty"`
+}
+
+// DailyAggregate is the total of one day's transactions of a type and category.
+// Sending a day again replaces its total
+type DailyAggregate struct {
+	Day      string  `json:"day" binding:"required"` // YYYY-MM-DD
+	Type     string  `json:"type" binding:"required"`
+	Category string  `json:"category" binding:"required,max=50"`
+	Total    float64 `json:"total" binding:"gte=0"`
+	Count    int     `json:"count" binding:"gte=0"` // Transactions the total covers
 }
 
 // TransactionInput represents incoming transaction data
 type TransactionInput struct {
-	Amount      float64  `json:"amount" binding:"required"`
-	Type        string   `json:"type" binding:"required"`
-	Category    string   `json:"category" binding:"required"`
-	Operator    string   `json:"operator" binding:"required"`
-	Recipient   *string  `json:"recipient,omitempty"`
-	Balance     *float64 `json:"balance,omitempty"`
-	Reference   *string  `json:"reference,omitempty"`
-	Description *string  `json:"description,omitempty"`
-	SMSHash     int      `json:"sms_hash" binding:"required"`
-	Date        int64    `json:"date" binding:"required"` // Unix timestamp
+	Amount         float64  `json:"amount" binding:"required"`
+	Type           string   `json:"type" binding:"required"`
+	Category       string   `json:"category" binding:"required"`
+	Kind           string   `json:"kind,omitempty"` // CASH_IN, P2P_SENT, BILL_PAY...; derived from type and category when unset
+	Operator       string   `json:"operator" binding:"required"`
+	Recipient      *string  `json:"recipient,omitempty"`      // Display alias when recipient_hash is sent
+	RecipientHash  string   `json:"recipient_hash,omitempty"` // HMAC-SHA256 of the number; see /sync/recipient-salt
+	Balance        *float64 `json:"balance,omitempty"`
+	Reference      *string  `json:"reference,omitempty"`
+	Description    *string  `json:"description,omitempty"`
+	SMSHash        int      `json:"sms_hash,omitempty"`        // Legacy 32-bit hashCode
+	SMSFingerprint string   `json:"sms_fingerprint,omitempty"` // SHA-256 hex of normalized SMS
+	AccountID      *string  `json:"account_id,omitempty"`      // Defaults to the user's wallet for the operator
+	Date           int64    `json:"date" binding:"required"`   // Unix timestamp
+}
+
+// Sync result statuses
+const (
+	SyncStatusInserted  = "inserted"
+	SyncStatusDuplicate = "duplicate"
+	SyncStatusInvalid   = "invalid"
+)
+
+// SyncResult reports what happened to a single transaction in a sync batch
+type SyncResult struct {
+	SMSHash        int    `json:"sms_hash,omitempty"`
+	SMSFingerprint string `json:"sms_fingerprint,omitempty"`
+	Status         string `json:"status"` // inserted, duplicate, invalid
+	Reason         string `json:"reason,omitempty"`
+}
+
+// BankSMSRequest is a batch of bank SMS for the server to read. Only what's
+// read from each is stored, never the text
+type BankSMSRequest struct {
+	DeviceID   string         `json:"device_id" binding:"required"`
+	Messages   []BankSMSInput `json:"messages" binding:"required,max=500,dive"`
+	AppVersion string         `json:"app_version,omitempty" binding:"max=30"`
+}
+
+// BankSMSInput is one SMS from a bank
+type BankSMSInput struct {
+	Sender string `json:"sender,omitempty" binding:"max=20"` // Sender ID, e.g. ZANACO
+	Text   string `json:"text" binding:"required,max=640"`
+	Date   int64  `json:"date" binding:"required"` // Unix milliseconds
+}
+
+// SyncStatus summarises the transactions stored for a user
+type SyncStatus struct {
+	LatestDate *int64            `json:"latest_date"` // Unix millis, nil if nothing synced
+	TotalCount int               `json:"total_count"`
+	Months     []SyncMonthStatus `json:"months"`
+}
+
+// SyncMonthStatus holds the count and checksum of one month's transactions
+type SyncMonthStatus struct {
+	Month    string `json:"month"` // YYYY-MM
+	Count    int    `json:"count"`
+	Checksum string `json:"checksum"`
+}
+
+// ReconciliationReport compares a user's SMS balances with their synced
+// transactions to spot SMS the app never picked up
+type ReconciliationReport struct {
+	CoverageScore *float64            `json:"coverage_score"` // Share of balance steps explained by synced transactions, nil if none could be checked
+	CheckedPairs  int                 `json:"checked_pairs"`
+	GapCount      int                 `json:"gap_count"`
+	Gaps          []ReconciliationGap `json:"gaps"` // Most recent first
+	ComputedAt    time.Time           `json:"computed_at"`
+}
+
+// ReconciliationGap is a balance jump that the transactions synced between two SMS don't explain
+type ReconciliationGap struct {
+	Operator        string    `json:"operator"`
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	ExpectedBalance float64   `json:"expected_balance"`
+	ActualBalance   float64   `json:"actual_balance"`
+	Difference      float64   `json:"difference"` // Positive: unsynced income, negative: unsynced spending
+	Message         string    `json:"message"`
+}
+
+// CategoryMapping moves transactions dated before EffectiveFrom from one
+// category to another when the taxonomy changes
+type CategoryMapping struct {
+	ID            int       `json:"id"`
+	FromCategory  string    `json:"from_category"`
+	ToCategory    string    `json:"to_category"`
+	MatchPattern  *string   `json:"match_pattern,omitempty"` // Regex on recipient and description, for splits
+	EffectiveFrom time.Time `json:"effective_from"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SavingsSummary reports a user's operator savings products. Balances are
+// estimated from synced SMS, so they miss activity from before the user installed the app
+type SavingsSummary struct {
+	Products          []SavingsProductBalance `json:"products"`
+	TotalBalance      float64                 `json:"total_balance"`
+	TotalInterest     float64                 `json:"total_interest"`
+	InterestThisMonth float64                 `json:"interest_this_month"`
+}
+
+// SavingsProductBalance totals the movements of one savings product, e.g. MTN MoKash
+type SavingsProductBalance struct {
+	Product      string    `json:"product"`
+	Operator     string    `json:"operator"`
+	Deposits     float64   `json:"deposits"`
+	Withdrawals  float64   `json:"withdrawals"`
+	Interest     float64   `json:"interest"`
+	Balance      float64   `json:"balance"` // Deposits + interest - withdrawals
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// SavingGoal is a recurring saving target, e.g. K100 every Friday. A period
+// runs from the day after one due date up to and including the next
+type SavingGoal struct {
+	ID              uuid.UUID  `json:"id"`
+	Amount          float64    `json:"amount"`
+	Cadence         string     `json:"cadence"`  // weekly or monthly
+	DueDay          int        `json:"due_day"`  // Weekday (0 = Sunday) or day of the month
+	NextDue         string     `json:"next_due"` // YYYY-MM-DD
+	SavedThisPeriod float64    `json:"saved_this_period"`
+	Met             bool       `json:"met"`
+	CurrentStreak   int        `json:"current_streak"` // Periods in a row the target was met
+	BestStreak      int        `json:"best_streak"`
+	SnoozedUntil    *time.Time `json:"snoozed_until,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// RecurringEntry is a template for a transaction the user enters by hand on
+// a schedule, such as rent paid in cash every month. Each due date it
+// creates a PendingEntry for the user to confirm
+type RecurringEntry struct {
+	ID          uuid.UUID  `json:"id"`
+	Amount      float64    `json:"amount"`
+	Type        string     `json:"type"` // INCOME or EXPENSE
+	Category    string     `json:"category"`
+	Kind        string     `json:"kind"`
+	Description *string    `json:"description,omitempty"`
+	AccountID   *uuid.UUID `json:"account_id,omitempty"`
+	Cadence     string     `json:"cadence"`  // weekly or monthly
+	DueDay      int        `json:"due_day"`  // Weekday (0 = Sunday) or day of the month
+	NextDue     string     `json:"next_due"` // YYYY-MM-DD; the next date an entry is created for
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Pending entry statuses
+const (
+	PendingEntryPending   = "pending"
+	PendingEntryConfirmed = "confirmed" // Stored as a manual transaction
+	PendingEntryDismissed = "dismissed"
+)
+
+// PendingEntry is a recurring entry that fell due and waits for the user to
+// confirm it happened, optionally with a different amount
+type PendingEntry struct {
+	ID            uuid.UUID      `json:"id"`
+	RecurringID   uuid.UUID      `json:"recurring_id"`
+	Due           string         `json:"due"` // YYYY-MM-DD
+	Status        string         `json:"status"`
+	TransactionID *uuid.UUID     `json:"transaction_id,omitempty"` // Once confirmed
+	Entry         RecurringEntry `json:"entry"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// SafeToSpend is how much a user can spend per day without eating into
+// upcoming bills or saving goals, based on their average income rather than
+// whatever arrived most recently
+type SafeToSpend struct {
+	DailyAmount        float64        `json:"daily_amount"`
+	SpentToday         float64        `json:"spent_today"`
+	RemainingToday     float64        `json:"remaining_today"`
+	AverageDailyIncome float64        `json:"average_daily_income"` // Conservative rolling average used for DailyAmount
+	IrregularIncome    bool           `json:"irregular_income"`
+	IncomeVariability  float64        `json:"income_variability"` // Month-to-month variation of income
+	BillsPerDay        float64        `json:"bills_per_day"`
+	SavingsPerDay      float64        `json:"savings_per_day"` // Set aside for saving goals
+	UpcomingBills      []UpcomingBill `json:"upcoming_bills"`
+}
+
+// UpcomingBill is a recurring bill expected within the next 30 days
+type UpcomingBill struct {
+	Recipient string  `json:"recipient"`
+	Amount    float64 `json:"amount"`   // Typical monthly amount
+	DueDate   string  `json:"due_date"` // YYYY-MM-DD, estimated from past payment days
+}
+
+// SpendingBenchmark compares a user's weekly spend in a category with
+// other users who opted into analytics
+type SpendingBenchmark struct {
+	Country      string  `json:"-"` // The cohort's; users only see their own country's
+	Category     string  `json:"category"`
+	YourWeekly   float64 `json:"your_weekly"`
+	MedianWeekly float64 `json:"median_weekly"`
+	P25Weekly    float64 `json:"p25_weekly"`
+	P75Weekly    float64 `json:"p75_weekly"`
+	Users        int     `json:"users"`      // Cohort size, never below the k-anonymity minimum
+	Comparison   string  `json:"comparison"` // below, typical or above (outside the middle half)
+}
+
+// Budget is the user's monthly spending limit for a category
+type Budget struct {
+	Category  string    `json:"category" binding:"required,max=50"`
+	Amount    float64   `json:"amount" binding:"required,gt=0"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BudgetVariance compares a category's budget with this month's spending,
+// projected to the month end at the month-to-date daily rate
+type BudgetVariance struct {
+	Category       string  `json:"category"`
+	Budget         float64 `json:"budget"`
+	Spent          float64 `json:"spent"`     // Month to date
+	Remaining      float64 `json:"remaining"` // Negative once over budget
+	PercentUsed    int     `json:"percent_used"`
+	DailyBurnRate  float64 `json:"daily_burn_rate"`
+	ProjectedSpend float64 `json:"projected_spend"`        // By the month end
+	OverrunDate    *string `json:"overrun_date,omitempty"` // YYYY-MM-DD the budget is projected to run out this month
+	Status         string  `json:"status"`                 // on_track, at_risk or over
+	MonthsWithin   int     `json:"months_within"`          // Recent complete months spent within this budget
+	Months         int     `json:"months"`                 // Recent complete months the user was active
+}
+
+// AlertRule is a spending alert the user set, e.g. any expense over K500 or
+// DATA spending this week over K200
+type AlertRule struct {
+	ID          uuid.UUID  `json:"id"`
+	Kind        string     `json:"kind"`               // single_expense or period_spend
+	Category    *string    `json:"category,omitempty"` // Every category when unset
+	Period      *string    `json:"period,omitempty"`   // day, week or month for period_spend
+	Threshold   float64    `json:"threshold"`
+	Description string     `json:"description"`
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ContributionGroup is a chilimba / village banking group the user organizes,
+// with the state of its current cycle
+type ContributionGroup struct {
+	ID                 uuid.UUID           `json:"id"`
+	Name               string              `json:"name"`
+	ContributionAmount float64             `json:"contribution_amount"`
+	Cycle              string              `json:"cycle"`      // weekly or monthly
+	StartDate          string              `json:"start_date"` // YYYY-MM-DD
+	CycleStart         string              `json:"cycle_start"`
+	CycleEnd           string              `json:"cycle_end"` // Last day of the current cycle
+	Expected           float64             `json:"expected"`
+	Collected          float64             `json:"collected"`
+	PaidCount          int                 `json:"paid_count"`
+	Members            []GroupMemberStatus `json:"members"`
+	CreatedAt          time.Time           `json:"created_at"`
+}
+
+// GroupMemberStatus is a group member and what they've paid this cycle
+type GroupMemberStatus struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Phone     *string   `json:"phone,omitempty"`
+	Reference *string   `json:"reference,omitempty"` // Text expected in their payment SMS, for matching
+	Expected  float64   `json:"expected"`
+	Paid      float64   `json:"paid"`
+	PaidUp    bool      `json:"paid_up"`
 }
 
 // AnalyticsSummary represents spending analytics for a user
@@ -63,17 +399,93 @@ type AnalyticsSummary struct {
 	TotalExpenses    float64            `json:"total_expenses"`
 	NetBalance       float64            `json:"net_balance"`
 	ByCategory       map[string]float64 `json:"by_category"`
-	ByOperator       map[string]float64 `json:"by_operator"`
+	ByOperator       map[string]float64 `json:"by_operator"` // Mobile money operators
+	ByBank           map[string]float64 `json:"by_bank"`
+	ByKind           map[string]float64 `json:"by_kind"` // Income and expenses by transaction kind
 	TransactionCount int                `json:"transaction_count"`
 	Period           string             `json:"period"` // "week", "month", "all"
 }
 
+// HighlightTransaction is one of a period's largest transactions
+type HighlightTransaction struct {
+	ID        string    `json:"id"`
+	Amount    float64   `json:"amount"`
+	Category  string    `json:"category"`
+	Recipient string    `json:"recipient,omitempty"`
+	Date      time.Time `json:"date"`
+}
+
+// RecipientHighlight sums a period's payments to one recipient
+type RecipientHighlight struct {
+	Recipient string  `json:"recipient"`
+	Category  string  `json:"category"` // Of the latest payment
+	Count     int     `json:"count"`
+	Total     float64 `json:"total"`
+}
+
+// Highlights are the standout items of a period, for a month in review.
+// Metadata-only users have no individual transactions, so theirs are empty
+type Highlights struct {
+	Period             string                 `json:"period"`
+	LargestExpenses    []HighlightTransaction `json:"largest_expenses"`
+	LargestIncomes     []HighlightTransaction `json:"largest_incomes"`
+	FrequentRecipients []RecipientHighlight   `json:"frequent_recipients"`
+	NewMerchants       []RecipientHighlight   `json:"new_merchants"` // Paid for the first time this period
+}
+
 // PushNotification represents a notification to send
 type PushNotification struct {
 	Title    string            `json:"title"`
 	Body     string            `json:"body"`
 	Data     map[string]string `json:"data,omitempty"`
 	ImageURL string            `json:"image_url,omitempty"`
+	DeepLink string            `json:"deep_link,omitempty"` // e.g. kwachatracker://insights
+}
+
+// Notification types; users can mute each one
+const (
+	NotificationInsights      = "insights"
+	NotificationReminders     = "reminders"     // Group contributions, saving goals, recurring entries, learning streaks
+	NotificationAlerts        = "alerts"        // The user's own spending alert rules
+	NotificationUpdates       = "updates"       // Exports, imports and other work the user asked for
+	NotificationAnnouncements = "announcements" // Admin broadcasts and campaigns
+)
+
+// NotificationTypes lists every notification type
+var NotificationTypes = []string{
+	NotificationInsights, NotificationReminders, NotificationAlerts,
+	NotificationUpdates, NotificationAnnouncements,
+}
+
+// Notification is a message for one user, sent through the notifications service
+type Notification struct {
+	Type   string // One of NotificationTypes
+	Push   PushNotification
+	SendAt time.Time // Not sent before this; zero sends it now
+}
+
+// NotificationPreferences are a user's choices about what they're sent and when
+type NotificationPreferences struct {
+	Muted      []string    `json:"muted"` // Notification types kept out of push; they still reach the in-app inbox
+	QuietHours *QuietHours `json:"quiet_hours"`
+}
+
+// QuietHours is a daily window, in local hours, during which pushes wait until
+// End. Start after End wraps past midnight, e.g. 22 to 6
+type QuietHours struct {
+	Start int `json:"start" binding:"min=0,max=23"`
+	End   int `json:"end" binding:"min=0,max=23"`
+}
+
+// NotificationRecord is a notification in the user's history
+type NotificationRecord struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Body      string            `json:"body"`
+	Data      map[string]string `json:"data,omitempty"`
+	Delivery  string            `json:"delivery"` // push, or muted, capped or inbox (no device to push to) when it wasn't pushed
+	CreatedAt time.Time         `json:"created_at"`
 }
 
 // Admin Models
@@ -115,13 +527,573 @@ type AdminInsight struct {
 	GeneratedAt    time.Time `json:"generated_at"`
 	Delivered      bool      `json:"delivered"`
 	ResponseTimeMs int       `json:"response_time_ms,omitempty"`
+	Source         string    `json:"source,omitempty"` // gemini, rules, fallback
+	Model          string    `json:"model,omitempty"`
+	PromptVersion  string    `json:"prompt_version,omitempty"`
+	FinishReason   string    `json:"finish_reason,omitempty"`
+	PromptTokens   int       `json:"prompt_tokens,omitempty"`
+	OutputTokens   int       `json:"output_tokens,omitempty"`
+
+	ExcludedCategories []string `json:"excluded_categories,omitempty"` // Kept out of the prompt at the user's request
 }
 
 // BroadcastRequest represents a push notification broadcast request
 type BroadcastRequest struct {
-	Title        string     `json:"title" binding:"required"`
-	Body         string     `json:"body" binding:"required"`
-	Target       string     `json:"target"` // "all", "active", "specific"
-	UserIDs      []string   `json:"user_ids,omitempty"`
-	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+	Title        string            `json:"title" binding:"required"`
+	Body         string            `json:"body" binding:"required"`
+	ImageURL     string            `json:"image_url,omitempty"`
+	DeepLink     string            `json:"deep_link,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Target       string            `json:"target"` // "all", "active", "specific"
+	UserIDs      []string          `json:"user_ids,omitempty"`
+	Segment      *BroadcastSegment `json:"segment,omitempty"`
+	ScheduledFor *time.Time        `json:"scheduled_for,omitempty"`
+	DryRun       bool              `json:"dry_run,omitempty"` // Resolve the audience without sending
+}
+
+// Notification returns the push payload described by the broadcast
+func (r BroadcastRequest) Notification() PushNotification {
+	return PushNotification{
+		Title:    r.Title,
+		Body:     r.Body,
+		Data:     r.Data,
+		ImageURL: r.ImageURL,
+		DeepLink: r.DeepLink,
+	}
+}
+
+// BroadcastSegment narrows a broadcast audience; every field set is ANDed together
+type BroadcastSegment struct {
+	Operators        []string `json:"operators,omitempty"` // AIRTEL, MTN, ZAMTEL, ZEDMOBILE
+	Languages        []string `json:"languages,omitempty"` // en, bem, nya, ...
+	IsPremium        *bool    `json:"is_premium,omitempty"`
+	ConsentGiven     *bool    `json:"consent_given,omitempty"`
+	ConsentAnalytics *bool    `json:"consent_analytics,omitempty"`
+	ConsentAI        *bool    `json:"consent_ai,omitempty"`
+	SyncedWithinDays *int     `json:"synced_within_days,omitempty"`
+	NotSyncedForDays *int     `json:"not_synced_for_days,omitempty"`
+	MinSpend30d      *float64 `json:"min_spend_30d,omitempty"` // Expenses over the last 30 days
+	MaxSpend30d      *float64 `json:"max_spend_30d,omitempty"`
+}
+
+// CampaignAudience picks who a notification campaign goes to, as for a broadcast
+type CampaignAudience struct {
+	Target  string            `json:"target"` // "all", "active", "specific"
+	UserIDs []string          `json:"user_ids,omitempty"`
+	Segment *BroadcastSegment `json:"segment,omitempty"`
+}
+
+// NotificationCampaign is a broadcast sent on a recurring cron schedule
+type NotificationCampaign struct {
+	ID             uuid.UUID        `json:"id"`
+	Name           string           `json:"name"`
+	Cron           string           `json:"cron"` // Server local time, e.g. "0 8 * * 1" for Mondays at 08:00
+	Audience       CampaignAudience `json:"audience"`
+	Template       PushNotification `json:"template"`
+	Enabled        bool             `json:"enabled"`
+	NextRunAt      *time.Time       `json:"next_run_at,omitempty"` // Unset while disabled
+	LastRunAt      *time.Time       `json:"last_run_at,omitempty"`
+	LastJobID      *uuid.UUID       `json:"last_job_id,omitempty"`
+	LastRecipients *int             `json:"last_recipients,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// CampaignRequest creates or replaces a notification campaign
+type CampaignRequest struct {
+	Name     string           `json:"name" binding:"required,max=100"`
+	Cron     string           `json:"cron" binding:"required"`
+	Audience CampaignAudience `json:"audience"`
+	Template PushNotification `json:"template"`
+	Enabled  *bool            `json:"enabled"` // Defaults to true
+}
+
+// FinancialTip is one translation of a curated financial literacy tip
+type FinancialTip struct {
+	ID        int       `json:"id"`
+	TipKey    string    `json:"tip_key"` // Shared by a tip's translations
+	Language  string    `json:"language"`
+	Topic     string    `json:"topic"` // e.g. savings, budgeting, fees
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	Active    bool      `json:"active"`
+	Shown     int       `json:"shown"` // Users shown the tip, in any language
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FinancialTipRequest creates or updates a tip translation
+type FinancialTipRequest struct {
+	TipKey   string `json:"tip_key" binding:"required,max=50"`
+	Language string `json:"language" binding:"required,max=10"`
+	Topic    string `json:"topic" binding:"required,max=50"`
+	Title    string `json:"title" binding:"required,max=255"`
+	Message  string `json:"message" binding:"required"`
+	Active   *bool  `json:"active"` // Defaults to true
+}
+
+// Category is a canonical category with how to display it. Name is in the
+// requested language, falling back to English
+type Category struct {
+	Code      string            `json:"code"`
+	Type      string            `json:"type"` // EXPENSE or INCOME
+	Icon      string            `json:"icon"` // Icon key the app maps to its icon set
+	Color     string            `json:"color"`
+	Position  int               `json:"position"`
+	Name      string            `json:"name"`
+	Names     map[string]string `json:"names"` // Language -> name
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Lesson is a learning section lesson; its content ships with the app
+type Lesson struct {
+	ID              string     `json:"id"`
+	Title           string     `json:"title"`
+	Topic           string     `json:"topic"`
+	Position        int        `json:"position"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Published       bool       `json:"published"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"` // For the requesting user
+}
+
+// LearningProgress summarises a user's lesson completions. A streak counts
+// consecutive days with at least one lesson completed
+type LearningProgress struct {
+	Completed       int        `json:"completed"`
+	Total           int        `json:"total"` // Published lessons
+	CurrentStreak   int        `json:"current_streak"`
+	BestStreak      int        `json:"best_streak"`
+	LastCompletedAt *time.Time `json:"last_completed_at,omitempty"`
+}
+
+// UserProfile is the signed-in user's account and progress
+type UserProfile struct {
+	ID           uuid.UUID        `json:"id"`
+	DisplayName  *string          `json:"display_name,omitempty"`
+	Operator     string           `json:"operator"`
+	Language     string           `json:"language"`
+	Country      string           `json:"country"`  // ISO 3166-1 alpha-2, e.g. ZM
+	Currency     string           `json:"currency"` // ISO 4217, from the country
+	IsPremium    bool             `json:"is_premium"`
+	ConsentGiven bool             `json:"consent_given"`
+	BusinessMode bool             `json:"business_mode"`
+	SyncMode     string           `json:"sync_mode"`
+	CreatedAt    time.Time        `json:"created_at"`
+	Learning     LearningProgress `json:"learning"`
+
+	AIExcludedCategories []string `json:"ai_excluded_categories"`
+}
+
+// ProfileUpdate changes the fields it sets and leaves the rest as they are.
+// An empty display_name clears it
+type ProfileUpdate struct {
+	DisplayName      *string `json:"display_name" binding:"omitempty,max=50"`
+	Operator         *string `json:"operator" binding:"omitempty,max=50"`
+	Language         *string `json:"language" binding:"omitempty,min=2,max=10,alpha"`
+	Country          *string `json:"country" binding:"omitempty,len=2"`
+	ConsentAnalytics *bool   `json:"consent_analytics"`
+	ConsentAI        *bool   `json:"consent_ai"`
+}
+
+// AccountState is the signed-in user's whole account in one response, for
+// the app's settings screen
+type AccountState struct {
+	Profile       UserProfile             `json:"profile"`
+	Consent       ConsentState            `json:"consent"`
+	Notifications NotificationPreferences `json:"notifications"`
+	Devices       []LinkedDevice          `json:"devices"`
+	Streaks       AccountStreaks          `json:"streaks"`
+	Quotas        []QuotaUsage            `json:"quotas"`
+}
+
+// ConsentState is each consent the user has given or withheld
+type ConsentState struct {
+	Given             bool       `json:"given"` // Data processing, required to sync
+	GivenAt           *time.Time `json:"given_at,omitempty"`
+	PolicyVersion     int        `json:"policy_version,omitempty"` // Privacy policy version it was given to
+	ReconsentRequired bool       `json:"reconsent_required"`       // The policy changed since; syncing waits for consent to the new one
+	Analytics         bool       `json:"analytics"`
+	AI                bool       `json:"ai"`
+	Scoring           bool       `json:"scoring"` // Affordability score
+	ScoringDate       *time.Time `json:"scoring_date,omitempty"`
+}
+
+// LinkedDevice is a device registered to the account or backing it up
+type LinkedDevice struct {
+	DeviceID     string     `json:"device_id"`
+	Registered   bool       `json:"registered"` // The device the account was registered from
+	PushEnabled  bool       `json:"push_enabled"`
+	LastBackupAt *time.Time `json:"last_backup_at,omitempty"`
+}
+
+// AccountStreaks are the user's learning and saving streaks
+type AccountStreaks struct {
+	LearningCurrent int          `json:"learning_current"`
+	LearningBest    int          `json:"learning_best"`
+	Saving          []GoalStreak `json:"saving"`
+}
+
+// GoalStreak is one saving goal's streak, in its cadence's periods
+type GoalStreak struct {
+	GoalID  string  `json:"goal_id"`
+	Amount  float64 `json:"amount"`
+	Cadence string  `json:"cadence"`
+	Current int     `json:"current"`
+	Best    int     `json:"best"`
+}
+
+// QuotaUsage is how much of a per-user limit is used
+type QuotaUsage struct {
+	Name   string `json:"name"`
+	Used   int    `json:"used"`
+	Limit  *int   `json:"limit"`            // Unset when unlimited
+	Period string `json:"period,omitempty"` // "day" for daily limits
+}
+
+// Job statuses
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+)
+
+// Job represents a background job (export, import, backfill)
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	UserID      *uuid.UUID      `json:"user_id,omitempty"`
+	Type        string          `json:"type"`
+	Status      string          `json:"status"` // pending, running, completed, failed
+	Params      json.RawMessage `json:"-"`
+	Progress    json.RawMessage `json:"progress,omitempty"` // Reported while running
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int             `json:"attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+}
+
+// Receipt statuses
+const (
+	ReceiptStatusProcessing = "processing" // Waiting for extraction
+	ReceiptStatusCompleted  = "completed"
+	ReceiptStatusFailed     = "failed"
+	ReceiptStatusStored     = "stored" // Image kept, extraction unavailable
+)
+
+// ClientBackup is one version of a device's encrypted app backup. The blob
+// itself is opaque to the server
+type ClientBackup struct {
+	DeviceID  string    `json:"device_id"`
+	Version   int       `json:"version"`
+	Size      int       `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Receipt is a photo attached to a transaction and the data read from it
+type Receipt struct {
+	TransactionID uuid.UUID       `json:"transaction_id"`
+	Status        string          `json:"status"`
+	ContentType   string          `json:"content_type"`
+	Merchant      string          `json:"merchant,omitempty"`
+	ReceiptDate   string          `json:"receipt_date,omitempty"`
+	Currency      string          `json:"currency,omitempty"`
+	Total         *float64        `json:"total,omitempty"`
+	Tax           *float64        `json:"tax,omitempty"`
+	LineItems     json.RawMessage `json:"line_items,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// MarketSegment is one anonymized aggregate in the operator market analytics.
+// Segments covering fewer users than the k-anonymity threshold are suppressed
+type MarketSegment struct {
+	Period       string   `json:"period"` // Start of the bucket, YYYY-MM-DD
+	Operator     string   `json:"operator"`
+	Category     string   `json:"category,omitempty"`
+	Users        int      `json:"users"`
+	Transactions int      `json:"transactions"`
+	Volume       float64  `json:"volume"`
+	Share        *float64 `json:"share,omitempty"`       // Fraction of the period's tracked spend
+	AverageFee   *float64 `json:"average_fee,omitempty"` // Per fee transaction
+}
+
+// ReportQuery is an admin report composed from whitelisted dimensions and
+// measures. Dates are YYYY-MM-DD, both inclusive
+type ReportQuery struct {
+	Dimensions []string `json:"dimensions" binding:"max=3,dive,oneof=operator category type kind day week month"`
+	Measures   []string `json:"measures" binding:"required,min=1,max=3,dive,oneof=sum count distinct_users"`
+	DateFrom   string   `json:"date_from" binding:"required"`
+	DateTo     string   `json:"date_to" binding:"required"`
+	Type       string   `json:"type" binding:"omitempty,oneof=INCOME EXPENSE"`
+	Kind       string   `json:"kind" binding:"max=20"`
+	Operator   string   `json:"operator" binding:"max=50"`
+	Category   string   `json:"category" binding:"max=50"`
+	Limit      int      `json:"limit" binding:"min=0,max=1000"`
+}
+
+// ReportRow is one group of a report; only the requested dimensions and measures are set
+type ReportRow struct {
+	Period        *string  `json:"period,omitempty"` // Start of the day, week or month bucket
+	Operator      *string  `json:"operator,omitempty"`
+	Category      *string  `json:"category,omitempty"`
+	Type          *string  `json:"type,omitempty"`
+	Kind          *string  `json:"kind,omitempty"`
+	Sum           *float64 `json:"sum,omitempty"`
+	Count         *int     `json:"count,omitempty"`
+	DistinctUsers *int     `json:"distinct_users,omitempty"`
+}
+
+// PartnerPlan caps a partner API key's daily requests and the aggregate fields it sees
+type PartnerPlan struct {
+	Name           string    `json:"name"`
+	RequestsPerDay int       `json:"requests_per_day"`
+	Fields         []string  `json:"fields"`
+	Keys           int       `json:"keys"` // Active keys on the plan
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// PartnerKey is a data partner's API key, without the secret
+type PartnerKey struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	Plan          string     `json:"plan"`
+	KeyPrefix     string     `json:"key_prefix"`
+	RequestsToday int        `json:"requests_today"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// FinancialPartner is a bank or budgeting tool users can choose to share
+// daily spend summaries with
+type FinancialPartner struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	WebhookURL   string    `json:"webhook_url"`
+	Active       bool      `json:"active"`
+	ActiveGrants int       `json:"active_grants"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SharingPartner is an active financial partner with whether the signed-in
+// user shares with it
+type SharingPartner struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	Granted   bool       `json:"granted"`
+	GrantedAt *time.Time `json:"granted_at,omitempty"`
+	Reference *string    `json:"reference,omitempty"` // The user's customer reference at the partner
+}
+
+// PartnerDelivery is one webhook sent to a financial partner for the user,
+// with exactly what it contained
+type PartnerDelivery struct {
+	ID         int64           `json:"id"`
+	PartnerID  uuid.UUID       `json:"partner_id"`
+	Partner    string          `json:"partner"`
+	DateFrom   string          `json:"date_from"`
+	DateTo     string          `json:"date_to"`
+	Delivered  bool            `json:"delivered"`
+	StatusCode *int            `json:"status_code,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// DailySpendSummary is one day of a user's spending as shared with partners:
+// totals per category, never the transactions themselves
+type DailySpendSummary struct {
+	Date         string             `json:"date"`
+	Income       float64            `json:"income"`
+	Expenses     float64            `json:"expenses"`
+	Transactions int                `json:"transactions"`
+	ByCategory   map[string]float64 `json:"expenses_by_category"`
+}
+
+// PartnerUsage is one key's partner API consumption on a UTC day
+type PartnerUsage struct {
+	KeyID    uuid.UUID `json:"key_id"`
+	Partner  string    `json:"partner"`
+	Plan     string    `json:"plan"` // The key's current plan
+	Day      string    `json:"day"`
+	Requests int       `json:"requests"`
+	Served   int       `json:"served"`
+	Rejected int       `json:"rejected"` // Over quota
+}
+
+// Funnel events, in onboarding order
+const (
+	FunnelRegistered    = "registered"
+	FunnelConsented     = "consented"
+	FunnelFirstSync     = "first_sync"
+	FunnelRetained7d    = "retained_7d"
+	FunnelInsightOpened = "insight_opened"
+)
+
+// FunnelSteps lists the funnel events in the order users reach them
+var FunnelSteps = []string{
+	FunnelRegistered,
+	FunnelConsented,
+	FunnelFirstSync,
+	FunnelRetained7d,
+	FunnelInsightOpened,
+}
+
+// FunnelStep is how many users of a cohort reached one funnel step
+type FunnelStep struct {
+	Event          string  `json:"event"`
+	Users          int     `json:"users"`
+	FromPrevious   float64 `json:"from_previous"` // Conversion from the previous step (0-1)
+	FromRegistered float64 `json:"from_registered"`
+}
+
+// CostSegment is what one segment of users cost to serve over a date range.
+// Users and RowsStored are as of the range's last metered day; the rest are
+// totals over the range
+type CostSegment struct {
+	Segment        string  `json:"segment"` // e.g. free_heavy; unattributed is AI usage for no user
+	Users          int     `json:"users"`
+	RowsStored     int64   `json:"rows_stored"`
+	AIPromptTokens int64   `json:"ai_prompt_tokens"`
+	AIOutputTokens int64   `json:"ai_output_tokens"`
+	AICostUSD      float64 `json:"ai_cost_usd"`
+	Pushes         int     `json:"pushes"`
+
+	RowsPerUser           float64 `json:"rows_per_user"`
+	AITokensPerUserDay    float64 `json:"ai_tokens_per_user_day"`
+	AICostPerUserMonthUSD float64 `json:"ai_cost_per_user_month_usd"` // Over 30 days
+	PushesPerUserDay      float64 `json:"pushes_per_user_day"`
+}
+
+// ParseFailureRequest is a batch of SMS the app couldn't parse, sent with the
+// user's analytics consent. The server redacts the text again before storing it
+type ParseFailureRequest struct {
+	AppVersion string               `json:"app_version,omitempty" binding:"max=30"`
+	Reports    []ParseFailureReport `json:"reports" binding:"required,min=1,max=50,dive"`
+}
+
+// ParseFailureReport is one unparsed SMS, redacted on the device
+type ParseFailureReport struct {
+	Operator string `json:"operator" binding:"required,max=50"`
+	Text     string `json:"text" binding:"required,max=640"`
+}
+
+// SMSTemplate is a cluster of unparsed SMS that share a skeleton
+type SMSTemplate struct {
+	ID        int       `json:"id"`
+	Operator  string    `json:"operator"`
+	Template  string    `json:"template"`
+	Sample    string    `json:"sample"` // The latest redacted report
+	Reports   int       `json:"reports"`
+	Status    string    `json:"status"` // new, reviewing, supported or ignored
+	Notes     *string   `json:"notes,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// InsightReview is an AI insight sampled for an admin to rate. The insight
+// is gone once its user deletes their data; the rating stays
+type InsightReview struct {
+	ID            int64      `json:"id"`
+	InsightID     *string    `json:"insight_id,omitempty"`
+	SampleDate    string     `json:"sample_date"` // YYYY-MM-DD the insight was generated
+	Source        string     `json:"source,omitempty"`
+	Model         string     `json:"model,omitempty"`
+	PromptVersion string     `json:"prompt_version,omitempty"`
+	Title         string     `json:"title,omitempty"`
+	Message       string     `json:"message,omitempty"`
+	Category      string     `json:"category,omitempty"`
+	Rating        *int       `json:"rating,omitempty"` // 1 (poor) to 5 (excellent)
+	Flags         []string   `json:"flags"`            // unsafe (advice that could harm the user) or incorrect (wrong figures or facts)
+	Notes         *string    `json:"notes,omitempty"`
+	ReviewedBy    *string    `json:"reviewed_by,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// PromptQuality is how reviewers rated the insights of one prompt version
+type PromptQuality struct {
+	PromptVersion string   `json:"prompt_version"`
+	Sampled       int      `json:"sampled"`
+	Reviewed      int      `json:"reviewed"`
+	AverageRating *float64 `json:"average_rating,omitempty"`
+	Unsafe        int      `json:"unsafe"`
+	Incorrect     int      `json:"incorrect"`
+	FlaggedRate   float64  `json:"flagged_rate"` // Share of reviewed insights with any flag (0-1)
+}
+
+// InsightBlock is a generated insight the advice guard kept from a user
+type InsightBlock struct {
+	ID            int64     `json:"id"`
+	UserID        *string   `json:"user_id,omitempty"`
+	Title         string    `json:"title"`
+	Message       string    `json:"message"`
+	Reason        string    `json:"reason"`     // guaranteed_return, scam or loan
+	BlockedBy     string    `json:"blocked_by"` // rules or model
+	Model         string    `json:"model,omitempty"`
+	PromptVersion string    `json:"prompt_version,omitempty"`
+	AICallID      *string   `json:"ai_call_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// OperatorNotice is an operator announcement, such as a fee change or a
+// maintenance window, reported by several users
+type OperatorNotice struct {
+	ID        int       `json:"id"`
+	Operator  string    `json:"operator"`
+	Kind      string    `json:"kind"` // fee_change or maintenance
+	Message   string    `json:"message"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// AuditLogEntry records one change an admin made to a user's data
+type AuditLogEntry struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	UserID    *string         `json:"user_id,omitempty"` // Unset once the user deletes their data
+	TargetID  *string         `json:"target_id,omitempty"`
+	Ticket    *string         `json:"ticket,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// UserInsight is a stored insight in the user's history
+type UserInsight struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Message     string    `json:"message"`
+	Category    string    `json:"category"`
+	Priority    string    `json:"priority"`
+	Period      string    `json:"period"` // The period analyzed: daily, weekly or monthly
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// AIActivity is one time the user's data was sent to Gemini, for the user's
+// AI transparency screen
+type AIActivity struct {
+	SentAt             time.Time     `json:"sent_at"`
+	Purpose            string        `json:"purpose"` // spending_analysis, receipt, embedding, ...
+	Model              string        `json:"model"`
+	Fields             []string      `json:"fields"`                        // The fields of the user's data sent, e.g. total_expenses or by_category
+	ExcludedCategories []string      `json:"excluded_categories,omitempty"` // Categories left out at the user's request
+	Insights           []UserInsight `json:"insights"`                      // Insights kept from the response
+}
+
+// DataQuality summarises how well synced transactions were parsed, for one
+// operator, one app version or the whole base. Rates are shares (0-1)
+type DataQuality struct {
+	Group                string  `json:"group"`
+	Transactions         int     `json:"transactions"`
+	NullBalance          int     `json:"null_balance"`
+	NullBalanceRate      float64 `json:"null_balance_rate"`
+	UnknownCategory      int     `json:"unknown_category"`
+	UnknownCategoryRate  float64 `json:"unknown_category_rate"`
+	SuspiciousAmount     int     `json:"suspicious_amount"`
+	SuspiciousAmountRate float64 `json:"suspicious_amount_rate"`
+	ParseFailures        int     `json:"parse_failures"`
+	ParseFailureRate     float64 `json:"parse_failure_rate"` // Of all SMS the app tried to parse
 }
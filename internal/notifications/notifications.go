@@ -0,0 +1,162 @@
+// Package notifications is the one way to notify a user. It applies the
+// user's muted types and quiet hours and the daily push cap, records every
+// notification in the user's in-app inbox, and queues the ones that should
+// be pushed in the outbox
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/kwachatracker/backend/internal/services"
+	"github.com/lib/pq"
+)
+
+// How each notification reached the user
+const (
+	DeliveryPush   = "push"
+	DeliveryMuted  = "muted"  // The user muted its type
+	DeliveryCapped = "capped" // Over the daily_push_cap setting
+	DeliveryInbox  = "inbox"  // No device to push to, or push isn't configured
+)
+
+// historyRetention is how long notifications stay in the inbox
+const historyRetention = 90 * 24 * time.Hour
+
+// Service sends notifications
+type Service struct {
+	db       *sql.DB
+	outbox   *services.NotificationOutbox
+	settings *services.Settings
+}
+
+// NewService creates a notification service pushing through outbox
+func NewService(db *sql.DB, outbox *services.NotificationOutbox, settings *services.Settings) *Service {
+	return &Service{db: db, outbox: outbox, settings: settings}
+}
+
+// Send records n in the user's inbox within tx and queues it as a push,
+// unless the user muted its type, has no device, or was already pushed the
+// day's cap. A push due in the user's quiet hours, in their country's local
+// time, waits until they end
+func (s *Service) Send(tx *sql.Tx, userID string, n models.Notification) error {
+	var token, country string
+	var muted pq.StringArray
+	var quietStart, quietEnd sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT COALESCE(u.fcm_token, ''), u.country, COALESCE(p.muted, '{}'), p.quiet_start, p.quiet_end
+		FROM users u
+		LEFT JOIN notification_preferences p ON p.user_id = u.id
+		WHERE u.id = $1
+	`, userID).Scan(&token, &country, &muted, &quietStart, &quietEnd)
+	if err == sql.ErrNoRows {
+		return nil // Deleted since the notification was triggered
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load notification preferences: %w", err)
+	}
+
+	delivery := DeliveryPush
+	switch {
+	case isMuted(muted, n.Type):
+		delivery = DeliveryMuted
+	case token == "" || !s.outbox.Enabled():
+		delivery = DeliveryInbox
+	default:
+		if limit := s.settings.Int(services.SettingDailyPushCap); limit > 0 {
+			var pushed int
+			err := tx.QueryRow(`
+				SELECT COUNT(*) FROM notifications
+				WHERE user_id = $1 AND delivery = $2 AND created_at >= CURRENT_DATE
+			`, userID, DeliveryPush).Scan(&pushed)
+			if err != nil {
+				return fmt.Errorf("failed to count notifications: %w", err)
+			}
+			if pushed >= limit {
+				log.Printf("⚠️ Daily push cap reached for user %s, keeping %q in the inbox", userID, n.Push.Title)
+				delivery = DeliveryCapped
+			}
+		}
+	}
+
+	notificationJSON, err := json.Marshal(n.Push)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, type, notification, delivery)
+		VALUES ($1, $2, $3, $4)
+	`, userID, n.Type, notificationJSON, delivery)
+	if err != nil {
+		return fmt.Errorf("failed to record notification: %w", err)
+	}
+	if delivery != DeliveryPush {
+		return nil
+	}
+
+	at := n.SendAt
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	if quietStart.Valid && quietEnd.Valid {
+		at = afterQuietHours(at.In(services.CountryFor(country).Location), int(quietStart.Int64), int(quietEnd.Int64))
+	}
+	return s.outbox.EnqueueAt(tx, userID, n.Push, at)
+}
+
+// SendNow sends n to one user in its own transaction, for callers with no
+// write of their own to send it with
+func (s *Service) SendNow(ctx context.Context, userID string, n models.Notification) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.Send(tx, userID, n); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Prune deletes notifications past the inbox retention
+func (s *Service) Prune(ctx context.Context) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM notifications WHERE created_at < $1", time.Now().Add(-historyRetention))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("🗑️ Deleted %d notifications past the inbox retention", n)
+	}
+	return nil
+}
+
+func isMuted(muted []string, notificationType string) bool {
+	for _, t := range muted {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// afterQuietHours moves a push due within the quiet hours from start to end
+// (wrapping past midnight when start > end) to when they end. Hours are
+// read in at's location
+func afterQuietHours(at time.Time, start, end int) time.Time {
+	h := at.Hour()
+	quiet := (start < end && h >= start && h < end) || (start > end && (h >= start || h < end))
+	if !quiet {
+		return at
+	}
+	until := time.Date(at.Year(), at.Month(), at.Day(), end, 0, 0, 0, at.Location())
+	if !until.After(at) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+// Accounting export formats
+const (
+	ExportFormatQuickBooks = "quickbooks"
+	ExportFormatXero       = "xero"
+)
+
+// AccountingProfile maps transactions onto an accounting package's bank
+// statement import layout
+type AccountingProfile struct {
+	Header []string
+	// DefaultAccounts is the account per category when the user hasn't mapped
+	// one: account names for QuickBooks, codes from the default chart for Xero
+	DefaultAccounts map[string]string
+	IncomeAccount   string // For income in unmapped categories
+	ExpenseAccount  string // For expenses in unmapped categories
+	row             func(t models.Transaction, payee, account string) []string
+}
+
+// AccountingProfiles are the supported accounting export formats
+var AccountingProfiles = map[string]AccountingProfile{
+	// QuickBooks Online bank upload; Payee, Account and Reference are mapped during import
+	ExportFormatQuickBooks: {
+		Header: []string{"Date", "Description", "Amount", "Payee", "Account", "Reference"},
+		DefaultAccounts: map[string]string{
+			"AIRTIME":    "Telephone Expense",
+			"DATA":       "Internet Expense",
+			"BILLS":      "Utilities",
+			"FEES":       "Bank Charges",
+			"WITHDRAWAL": "Petty Cash",
+			"TRANSFER":   "Transfers",
+			"SAVINGS":    "Savings",
+		},
+		IncomeAccount:  "Sales",
+		ExpenseAccount: "Uncategorized Expense",
+		row: func(t models.Transaction, payee, account string) []string {
+			return []string{
+				t.Date.Format("01/02/2006"),
+				transactionDescription(t),
+				signedAmount(t),
+				payee,
+				account,
+				stringValue(t.Reference),
+			}
+		},
+	},
+	// Xero precoded bank statement import
+	ExportFormatXero: {
+		Header: []string{"*Date", "*Amount", "Payee", "Description", "Reference", "Account Code"},
+		DefaultAccounts: map[string]string{
+			"AIRTIME": "489", // Telephone & Internet
+			"DATA":    "489",
+			"BILLS":   "445", // Light, Power, Heating
+			"FEES":    "404", // Bank Fees
+		},
+		IncomeAccount:  "200", // Sales
+		ExpenseAccount: "429", // General Expenses
+		row: func(t models.Transaction, payee, account string) []string {
+			return []string{
+				t.Date.Format("02/01/2006"),
+				signedAmount(t),
+				payee,
+				transactionDescription(t),
+				stringValue(t.Reference),
+				account,
+			}
+		},
+	},
+}
+
+// Account returns the account a transaction in category is posted to
+func (p AccountingProfile) Account(category, txType string, mappings map[string]string) string {
+	category = strings.ToUpper(category)
+	if account, ok := mappings[category]; ok {
+		return account
+	}
+	if account, ok := p.DefaultAccounts[category]; ok {
+		return account
+	}
+	if txType == "INCOME" {
+		return p.IncomeAccount
+	}
+	return p.ExpenseAccount
+}
+
+// BuildCSV renders transactions in the profile's layout. Transactions must
+// carry the category they should be posted under
+func (p AccountingProfile) BuildCSV(transactions []models.Transaction, mappings map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(p.Header); err != nil {
+		return nil, err
+	}
+	for _, t := range transactions {
+		payee := stringValue(t.Recipient)
+		if err := w.Write(p.row(t, payee, p.Account(t.Category, t.Type, mappings))); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// ExportFilename names an accounting export file
+func ExportFilename(format string, at time.Time) string {
+	return "kwacha-tracker-" + format + "-" + at.Format("2006-01-02") + ".csv"
+}
+
+// signedAmount is negative for money leaving the wallet, as bank imports expect
+func signedAmount(t models.Transaction) string {
+	amount := t.Amount
+	if t.Type != "INCOME" {
+		amount = -amount
+	}
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+func transactionDescription(t models.Transaction) string {
+	if d := stringValue(t.Description); d != "" {
+		return d
+	}
+	return t.Operator + " " + strings.ToLower(t.Category)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
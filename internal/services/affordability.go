@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"math"
+)
+
+// Affordability score weights; the factors add up to 100
+const (
+	regularityPoints = 40 // Income arriving every month, in similar amounts
+	disciplinePoints = 40 // Spending well inside income
+	bufferPoints     = 20 // Months ending with money left over
+
+	// Income varying this much month to month (coefficient of variation)
+	// scores no regularity points
+	maxScoredVariation = 0.7
+
+	// Spending at or under the first share of income scores full discipline
+	// points, at or over the second none
+	comfortableSpendShare = 0.7
+	overspendShare        = 1.1
+)
+
+// Affordability bands, from the score
+const (
+	AffordabilityStrong   = "strong"   // 70 and over
+	AffordabilityFair     = "fair"     // 45 and over
+	AffordabilityBuilding = "building" // Under 45
+)
+
+// AffordabilityMonth is one complete month's income and spending
+type AffordabilityMonth struct {
+	Income   float64
+	Expenses float64
+}
+
+// AffordabilityFactor explains part of the score
+type AffordabilityFactor struct {
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+	Max    int    `json:"max"`
+	Detail string `json:"detail"`
+}
+
+// AffordabilityScore rates how comfortably a user could repay a small
+// advance. Score is nil until there are enough complete months to judge
+type AffordabilityScore struct {
+	Score   *int                  `json:"score"`
+	Band    string                `json:"band,omitempty"`
+	Months  int                   `json:"months"`
+	Factors []AffordabilityFactor `json:"factors"`
+	Summary string                `json:"summary"`
+}
+
+// ScoreAffordability scores income regularity and expense discipline over
+// complete months, oldest first, starting from the user's first income
+func ScoreAffordability(months []AffordabilityMonth) AffordabilityScore {
+	result := AffordabilityScore{Months: len(months), Factors: []AffordabilityFactor{}}
+	if len(months) < minIncomeMonths {
+		result.Summary = fmt.Sprintf("We need %d complete months of income to work out your score; we have %d so far", minIncomeMonths, len(months))
+		return result
+	}
+
+	incomes := make([]float64, len(months))
+	var income, expenses float64
+	paidMonths, surplusMonths := 0, 0
+	for i, m := range months {
+		incomes[i] = m.Income
+		income += m.Income
+		expenses += m.Expenses
+		if m.Income > 0 {
+			paidMonths++
+		}
+		if m.Income >= m.Expenses {
+			surplusMonths++
+		}
+	}
+	profile := AnalyzeIncome(incomes)
+
+	// Regularity: how many months brought income, and how evenly
+	steadiness := 0.0
+	if profile.AverageMonthly > 0 {
+		steadiness = math.Max(0, 1-profile.Variability/maxScoredVariation)
+	}
+	regularity := int(math.Round(regularityPoints * steadiness * float64(paidMonths) / float64(len(months))))
+	result.Factors = append(result.Factors, AffordabilityFactor{
+		Name:   "income_regularity",
+		Points: regularity,
+		Max:    regularityPoints,
+		Detail: fmt.Sprintf("Income arrived in %d of %d months and varied by about %.0f%% from month to month", paidMonths, len(months), profile.Variability*100),
+	})
+
+	// Discipline: the share of income spent
+	discipline := 0
+	spendShare := math.Inf(1)
+	if income > 0 {
+		spendShare = expenses / income
+		fraction := (overspendShare - spendShare) / (overspendShare - comfortableSpendShare)
+		discipline = int(math.Round(disciplinePoints * math.Min(1, math.Max(0, fraction))))
+	}
+	detail := "No income was recorded to measure spending against"
+	if income > 0 {
+		detail = fmt.Sprintf("You spent about %.0f%% of your income", spendShare*100)
+	}
+	result.Factors = append(result.Factors, AffordabilityFactor{
+		Name:   "expense_discipline",
+		Points: discipline,
+		Max:    disciplinePoints,
+		Detail: detail,
+	})
+
+	// Buffer: months that ended with money left over
+	buffer := int(math.Round(bufferPoints * float64(surplusMonths) / float64(len(months))))
+	result.Factors = append(result.Factors, AffordabilityFactor{
+		Name:   "monthly_buffer",
+		Points: buffer,
+		Max:    bufferPoints,
+		Detail: fmt.Sprintf("%d of %d months ended with money left over", surplusMonths, len(months)),
+	})
+
+	score := regularity + discipline + buffer
+	result.Score = &score
+	switch {
+	case score >= 70:
+		result.Band = AffordabilityStrong
+		result.Summary = "Your income is steady and you spend well within it"
+	case score >= 45:
+		result.Band = AffordabilityFair
+		result.Summary = "You're on track; steadier income or a little less spending would lift your score"
+	default:
+		result.Band = AffordabilityBuilding
+		result.Summary = "Keeping spending under your income each month is the quickest way to build your score"
+	}
+	return result
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrAIUnavailable is returned instead of calling Gemini when the spend budget
+// is exhausted or an admin has switched AI off
+var ErrAIUnavailable = errors.New("AI temporarily unavailable")
+
+// Gemini 2.5 Flash pricing (USD per token)
+const (
+	geminiInputCostPerToken  = 0.30 / 1_000_000
+	geminiOutputCostPerToken = 2.50 / 1_000_000
+)
+
+// AIBudgetStatus describes Gemini spend against the configured budgets
+type AIBudgetStatus struct {
+	DailyBudget        float64    `json:"daily_budget_usd"`   // 0 = unlimited
+	MonthlyBudget      float64    `json:"monthly_budget_usd"` // 0 = unlimited
+	SpentToday         float64    `json:"spent_today_usd"`
+	SpentThisMonth     float64    `json:"spent_this_month_usd"`
+	RemainingToday     *float64   `json:"remaining_today_usd,omitempty"`
+	RemainingThisMonth *float64   `json:"remaining_this_month_usd,omitempty"`
+	RequestsToday      int        `json:"requests_today"`
+	KillSwitch         bool       `json:"kill_switch"`
+	OverrideUntil      *time.Time `json:"override_until,omitempty"`
+	Available          bool       `json:"available"`
+	Reason             string     `json:"reason,omitempty"`
+}
+
+// AIBudgetUpdate changes the admin budget controls; nil fields are left as they are
+type AIBudgetUpdate struct {
+	KillSwitch    *bool      `json:"kill_switch"`
+	OverrideUntil *time.Time `json:"override_until"`
+	ClearOverride bool       `json:"clear_override"`
+	DailyBudget   *float64   `json:"daily_budget_usd"`
+	MonthlyBudget *float64   `json:"monthly_budget_usd"`
+}
+
+// AIUsageTracker records Gemini token usage and enforces the spend budget
+type AIUsageTracker struct {
+	db            *sql.DB
+	dailyBudget   float64
+	monthlyBudget float64
+}
+
+// NewAIUsageTracker creates a tracker with default budgets (0 = unlimited);
+// admins can change them at runtime via UpdateControls
+func NewAIUsageTracker(db *sql.DB, dailyBudget, monthlyBudget float64) *AIUsageTracker {
+	return &AIUsageTracker{
+		db:            db,
+		dailyBudget:   dailyBudget,
+		monthlyBudget: monthlyBudget,
+	}
+}
+
+type aiUsersKey struct{}
+
+// WithAIUsers attributes the Gemini calls made with ctx to the users they
+// were made for, so cost metering can charge them to the users' segments
+func WithAIUsers(ctx context.Context, userIDs ...string) context.Context {
+	return context.WithValue(ctx, aiUsersKey{}, userIDs)
+}
+
+type aiFieldsKey struct{}
+
+// aiPurposeFields are the fields sent by calls whose data doesn't vary
+var aiPurposeFields = map[string][]string{
+	"receipt":           {"receipt_image"},
+	"budget_suggestion": {"monthly_income", "budgets_by_category"},
+}
+
+// WithAIFields notes which of each user's data fields the Gemini calls made
+// with ctx send, keyed by user ID, for the user's AI activity. Calls without
+// them are described by their purpose
+func WithAIFields(ctx context.Context, fields map[string][]string) context.Context {
+	return context.WithValue(ctx, aiFieldsKey{}, fields)
+}
+
+// Record stores the token usage and estimated cost of one Gemini call,
+// identified by callID, with the data fields it sent. A call made for
+// several users is split evenly between them
+func (t *AIUsageTracker) Record(ctx context.Context, callID, purpose, model string, promptTokens, totalTokens int) {
+	outputTokens := totalTokens - promptTokens
+	if outputTokens < 0 {
+		outputTokens = 0
+	}
+	cost := float64(promptTokens)*geminiInputCostPerToken + float64(outputTokens)*geminiOutputCostPerToken
+
+	users, _ := ctx.Value(aiUsersKey{}).([]string)
+	if len(users) == 0 {
+		users = []string{""}
+	}
+	fields, _ := ctx.Value(aiFieldsKey{}).(map[string][]string)
+	n := len(users)
+	for _, userID := range users {
+		var sent interface{}
+		if f, ok := fields[userID]; ok {
+			sent = pq.Array(f)
+		} else if f, ok := aiPurposeFields[purpose]; ok {
+			sent = pq.Array(f)
+		}
+		_, err := t.db.Exec(`
+			INSERT INTO ai_usage (user_id, purpose, model, prompt_tokens, output_tokens, cost_usd, call_id, fields)
+			VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, $6, $7, $8)
+		`, userID, purpose, model, promptTokens/n, outputTokens/n, cost/float64(n), callID, sent)
+		if err != nil {
+			log.Printf("⚠️ Failed to record AI usage: %v", err)
+		}
+	}
+}
+
+// Allow returns ErrAIUnavailable if AI calls should not be made right now
+func (t *AIUsageTracker) Allow(ctx context.Context) error {
+	status, err := t.Status(ctx)
+	if err != nil {
+		// Don't take AI down because the tracker can't read its own tables
+		log.Printf("⚠️ Failed to check AI budget: %v", err)
+		return nil
+	}
+	if !status.Available {
+		return ErrAIUnavailable
+	}
+	return nil
+}
+
+// Status returns current spend, remaining budget and whether AI calls are allowed
+func (t *AIUsageTracker) Status(ctx context.Context) (*AIBudgetStatus, error) {
+	status := &AIBudgetStatus{
+		DailyBudget:   t.dailyBudget,
+		MonthlyBudget: t.monthlyBudget,
+	}
+
+	var overrideUntil sql.NullTime
+	var dailyBudget, monthlyBudget sql.NullFloat64
+	err := t.db.QueryRowContext(ctx, `
+		SELECT kill_switch, override_until, daily_budget_usd, monthly_budget_usd
+		FROM ai_budget_controls WHERE id = 1
+	`).Scan(&status.KillSwitch, &overrideUntil, &dailyBudget, &monthlyBudget)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if overrideUntil.Valid {
+		status.OverrideUntil = &overrideUntil.Time
+	}
+	if dailyBudget.Valid {
+		status.DailyBudget = dailyBudget.Float64
+	}
+	if monthlyBudget.Valid {
+		status.MonthlyBudget = monthlyBudget.Float64
+	}
+
+	now := time.Now()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	err = t.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(CASE WHEN created_at >= $1 THEN cost_usd ELSE 0 END), 0),
+			COALESCE(SUM(cost_usd), 0),
+			COUNT(*) FILTER (WHERE created_at >= $1)
+		FROM ai_usage
+		WHERE created_at >= $2
+	`, todayStart, monthStart).Scan(&status.SpentToday, &status.SpentThisMonth, &status.RequestsToday)
+	if err != nil {
+		return nil, err
+	}
+
+	if status.DailyBudget > 0 {
+		remaining := status.DailyBudget - status.SpentToday
+		status.RemainingToday = &remaining
+	}
+	if status.MonthlyBudget > 0 {
+		remaining := status.MonthlyBudget - status.SpentThisMonth
+		status.RemainingThisMonth = &remaining
+	}
+
+	overridden := status.OverrideUntil != nil && status.OverrideUntil.After(now)
+	switch {
+	case status.KillSwitch:
+		status.Reason = "AI disabled by admin"
+	case overridden:
+		status.Available = true
+		status.Reason = "Budget overridden by admin"
+	case status.RemainingToday != nil && *status.RemainingToday <= 0:
+		status.Reason = "Daily AI budget reached"
+	case status.RemainingThisMonth != nil && *status.RemainingThisMonth <= 0:
+		status.Reason = "Monthly AI budget reached"
+	default:
+		status.Available = true
+	}
+
+	return status, nil
+}
+
+// UpdateControls applies admin changes to the kill switch, override and budgets
+func (t *AIUsageTracker) UpdateControls(ctx context.Context, update AIBudgetUpdate) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if update.KillSwitch != nil {
+		if _, err := tx.Exec("UPDATE ai_budget_controls SET kill_switch = $1 WHERE id = 1", *update.KillSwitch); err != nil {
+			return err
+		}
+	}
+	if update.ClearOverride {
+		if _, err := tx.Exec("UPDATE ai_budget_controls SET override_until = NULL WHERE id = 1"); err != nil {
+			return err
+		}
+	} else if update.OverrideUntil != nil {
+		if _, err := tx.Exec("UPDATE ai_budget_controls SET override_until = $1 WHERE id = 1", *update.OverrideUntil); err != nil {
+			return err
+		}
+	}
+	if update.DailyBudget != nil {
+		if _, err := tx.Exec("UPDATE ai_budget_controls SET daily_budget_usd = $1 WHERE id = 1", *update.DailyBudget); err != nil {
+			return err
+		}
+	}
+	if update.MonthlyBudget != nil {
+		if _, err := tx.Exec("UPDATE ai_budget_controls SET monthly_budget_usd = $1 WHERE id = 1", *update.MonthlyBudget); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE ai_budget_controls SET updated_at = NOW() WHERE id = 1"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Alert rule kinds
+const (
+	AlertSingleExpense = "single_expense" // Any one expense over the threshold
+	AlertPeriodSpend   = "period_spend"   // Spending in a day, week or month over the threshold
+)
+
+// Alert rule periods, for period_spend rules
+const (
+	AlertPeriodDay   = "day"
+	AlertPeriodWeek  = "week"
+	AlertPeriodMonth = "month"
+)
+
+// AlertRule is a user-defined spending alert. An empty category matches every category
+type AlertRule struct {
+	ID        string
+	Kind      string
+	Category  string
+	Period    string
+	Threshold float64
+}
+
+// AlertTransaction is a synced expense as the rules see it
+type AlertTransaction struct {
+	ID        string
+	Amount    float64
+	Category  string // Mapped
+	Recipient string
+	Date      time.Time
+}
+
+// Covers reports whether the rule applies to a transaction's category
+func (r AlertRule) Covers(t AlertTransaction) bool {
+	return r.Category == "" || strings.EqualFold(r.Category, t.Category)
+}
+
+// PeriodStart returns the start of the rule's period containing day; weeks start on Monday
+func (r AlertRule) PeriodStart(day time.Time) time.Time {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	switch r.Period {
+	case AlertPeriodWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case AlertPeriodMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	default:
+		return day
+	}
+}
+
+// periodName is the rule's period for messages, e.g. "this week"
+func (r AlertRule) periodName() string {
+	if r.Period == AlertPeriodDay {
+		return "today"
+	}
+	return "this " + r.Period
+}
+
+// categoryName is the rule's category for messages
+func (r AlertRule) categoryName() string {
+	if r.Category == "" {
+		return "spending"
+	}
+	return strings.ToUpper(r.Category) + " spending"
+}
+
+// Describe puts the rule in words, e.g. "DATA spending this week over K200"
+func (r AlertRule) Describe() string {
+	if r.Kind == AlertSingleExpense {
+		if r.Category == "" {
+			return "Any expense over " + FormatKwacha(r.Threshold)
+		}
+		return fmt.Sprintf("Any %s expense over %s", strings.ToUpper(r.Category), FormatKwacha(r.Threshold))
+	}
+	return fmt.Sprintf("%s %s over %s", r.categoryName(), r.periodName(), FormatKwacha(r.Threshold))
+}
+
+// AlertMessage is the push body for a rule that fired on t; total is the
+// period's spending for period_spend rules
+func (r AlertRule) AlertMessage(t AlertTransaction, total float64) string {
+	payment := FormatKwacha(t.Amount)
+	if t.Recipient != "" {
+		payment += " to " + t.Recipient
+	}
+	if r.Kind == AlertSingleExpense {
+		return fmt.Sprintf("%s is over your %s alert.", payment, FormatKwacha(r.Threshold))
+	}
+	return fmt.Sprintf("After %s, your %s %s is %s, over your %s alert.",
+		payment, r.categoryName(), r.periodName(), FormatKwacha(total), FormatKwacha(r.Threshold))
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Banks whose transaction SMS ParseBankSMS reads. A bank transaction carries
+// its bank as the operator, so analytics can tell it from mobile money
+const (
+	BankZanaco  = "ZANACO"
+	BankFNB     = "FNB"
+	BankStanbic = "STANBIC"
+)
+
+// Banks lists every bank ParseBankSMS understands
+var Banks = []string{BankZanaco, BankFNB, BankStanbic}
+
+// IsBank reports whether an operator label is one of Banks
+func IsBank(operator string) bool {
+	for _, b := range Banks {
+		if b == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// BankOf returns the bank a name, such as an account's institution, refers
+// to, or "" if it's none of Banks
+func BankOf(name string) string {
+	for _, b := range bankNames {
+		if b.pattern.MatchString(name) {
+			return b.bank
+		}
+	}
+	return ""
+}
+
+// BankSMS is a transaction read from a bank SMS
+type BankSMS struct {
+	Bank          string
+	Type          string // INCOME or EXPENSE
+	Category      string
+	Amount        float64
+	Fee           float64 // Charged on top of Amount; 0 when the SMS names none
+	Balance       *float64
+	AccountSuffix string // Last digits of the account number, when shown
+	Reference     string
+	Counterparty  string // Merchant or the other party, when named
+}
+
+var (
+	// Banks are recognized by name in the sender ID or the text
+	bankNames = []struct {
+		bank    string
+		pattern *regexp.Regexp
+	}{
+		{BankZanaco, regexp.MustCompile(`(?i)\bzanaco\b`)},
+		{BankFNB, regexp.MustCompile(`(?i)\bfnb\b|first national bank`)},
+		{BankStanbic, regexp.MustCompile(`(?i)\bstanbic\b`)},
+	}
+
+	bankAmount = regexp.MustCompile(`(?i)\b(?:ZMW|ZK|K)\s?(\d[\d,]*(?:\.\d{1,2})?)\b`)
+
+	// Whichever comes first decides the direction: "debited", "Dr", "paid
+	// from" or "credited", "Cr", "received"
+	bankDebit  = regexp.MustCompile(`(?i)\b(?:debited|debit|dr|paid|purchase|withdrawn|withdrawal|sent|transferred|t/fer to)\b`)
+	bankCredit = regexp.MustCompile(`(?i)\b(?:credited|credit|cr|received|deposited|deposit|reversal|t/fer from)\b`)
+
+	// "a/c ...4567", "Acc 0123****4567", "account no. XXXX4567"
+	bankAccount = regexp.MustCompile(`(?i)\b(?:a/c|acc|acct|account)(?:\s*no)?[\s.:#]*([*xX.\d]*\d{3,})`)
+
+	// A merchant paid at a till or the party money came from or went to
+	bankCounterparty = regexp.MustCompile(`(?:\bat|@|\bfrom|\bto)\s+([A-Z][A-Za-z0-9&'-]*(?:\s+[A-Z][A-Za-z0-9&'-]*){0,3})`)
+
+	bankCategories = []struct {
+		txType   string
+		category string
+		pattern  *regexp.Regexp
+	}{
+		{"EXPENSE", "WITHDRAWAL", regexp.MustCompile(`(?i)\batm\b|cash withdrawal|\bwithdrawn\b`)},
+		{"EXPENSE", "TRANSFER", regexp.MustCompile(`(?i)\btransfer|t/fer|\bsent\b`)},
+		{"INCOME", "SALARY", regexp.MustCompile(`(?i)\bsal(?:ary)?\b|payroll`)},
+		{"INCOME", "TRANSFER", regexp.MustCompile(`(?i)\btransfer|t/fer`)},
+		{"INCOME", "DEPOSIT", regexp.MustCompile(`(?i)\bdeposit`)},
+	}
+)
+
+// Words that, shortly before an amount, make it a balance or a fee rather
+// than the amount moved
+var (
+	balanceWords = []string{"bal", "avail"}
+	feeWords     = []string{"fee", "charge", "commission", "levy"}
+)
+
+// bankAmountContext is how much text before an amount is read to tell what it is
+const bankAmountContext = 25
+
+// ParseBankSMS reads a Zanaco, FNB or Stanbic transaction SMS. sender is the
+// SMS sender ID, if the app has it. It reports false for anything else,
+// including the banks' announcements. A message that only charges a fee is
+// read as a FEES expense
+func ParseBankSMS(sender, text string) (BankSMS, bool) {
+	sms := BankSMS{Bank: BankOf(sender)}
+	if sms.Bank == "" {
+		sms.Bank = BankOf(text)
+	}
+	if sms.Bank == "" {
+		return sms, false
+	}
+
+	debit := bankDebit.FindStringIndex(text)
+	credit := bankCredit.FindStringIndex(text)
+	switch {
+	case debit != nil && (credit == nil || debit[0] < credit[0]):
+		sms.Type = "EXPENSE"
+	case credit != nil:
+		sms.Type = "INCOME"
+	default:
+		return sms, false
+	}
+
+	amountFound := false
+	lower := strings.ToLower(text)
+	for _, m := range bankAmount.FindAllStringSubmatchIndex(text, -1) {
+		value, err := strconv.ParseFloat(strings.ReplaceAll(text[m[2]:m[3]], ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		start := m[0] - bankAmountContext
+		if start < 0 {
+			start = 0
+		}
+		before := lower[start:m[0]]
+		balanceAt, feeAt := lastIndexAny(before, balanceWords), lastIndexAny(before, feeWords)
+		switch {
+		case balanceAt > feeAt:
+			if sms.Balance == nil {
+				sms.Balance = &value
+			}
+		case feeAt > balanceAt:
+			sms.Fee += value
+		case !amountFound:
+			sms.Amount = value
+			amountFound = true
+		}
+	}
+	// Announcements talk of fees and debits too, but never report a balance;
+	// "maintenance fee debited ... Bal" is a transaction
+	if sms.Balance == nil && ClassifyNotice(text) != "" {
+		return sms, false
+	}
+	switch {
+	case amountFound && sms.Amount > 0:
+	case sms.Fee > 0 && sms.Type == "EXPENSE":
+		sms.Amount, sms.Fee, sms.Category = sms.Fee, 0, "FEES"
+	default:
+		return sms, false
+	}
+
+	if sms.Category == "" {
+		sms.Category = "PAYMENT"
+		if sms.Type == "INCOME" {
+			sms.Category = "RECEIVED"
+		}
+		for _, c := range bankCategories {
+			if c.txType == sms.Type && c.pattern.MatchString(text) {
+				sms.Category = c.category
+				break
+			}
+		}
+	}
+
+	if m := bankAccount.FindStringSubmatch(text); m != nil {
+		digits := m[1]
+		if i := strings.LastIndexAny(digits, "*xX."); i >= 0 {
+			digits = digits[i+1:]
+		}
+		if len(digits) > 4 {
+			digits = digits[len(digits)-4:]
+		}
+		sms.AccountSuffix = digits
+	}
+	if m := labelledReference.FindStringSubmatch(text); m != nil && strings.ContainsAny(m[1], "0123456789") {
+		sms.Reference = m[1]
+	}
+	if m := bankCounterparty.FindStringSubmatch(text); m != nil {
+		sms.Counterparty = bankParty(m[1])
+	}
+	return sms, true
+}
+
+// bankParty trims the labels that can follow a name in a bank SMS, "JOHN
+// BANDA Ref 884412", off a counterparty
+func bankParty(match string) string {
+	var words []string
+	for _, w := range strings.Fields(match) {
+		switch strings.ToLower(w) {
+		case "your", "ref", "reference", "bal", "avail", "charges", "fee", "on", "acc", "a/c":
+			return strings.Join(words, " ")
+		}
+		words = append(words, w)
+	}
+	return strings.Join(words, " ")
+}
+
+// lastIndexAny returns where the last of any of words starts in s, or -1
+func lastIndexAny(s string, words []string) int {
+	last := -1
+	for _, w := range words {
+		if i := strings.LastIndex(s, w); i > last {
+			last = i
+		}
+	}
+	return last
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// CircuitBreaker stops calling a failing dependency for a cooldown period after
+// too many consecutive failures, then lets a single trial call through
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu          sync.Mutex
+	failures    int
+	openedAt    time.Time
+	trialActive bool
+	trialAt     time.Time
+}
+
+// NewCircuitBreaker opens after threshold consecutive failures for cooldown
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a call may be made now
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state() {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		// A trial that never reported back doesn't block the breaker forever
+		if b.trialActive && time.Since(b.trialAt) < b.cooldown {
+			return false
+		}
+		b.trialActive = true
+		b.trialAt = time.Now()
+		return true
+	default:
+		return false
+	}
+}
+
+// Success records a successful call and closes the breaker
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trialActive = false
+}
+
+// Failure records a failed call, opening the breaker once the threshold is reached
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trialActive = false
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// State returns closed, open or half_open
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state()
+}
+
+// OpenedAt returns when the breaker last opened (zero if it never has)
+func (b *CircuitBreaker) OpenedAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openedAt
+}
+
+func (b *CircuitBreaker) state() string {
+	if b.failures < b.threshold {
+		return BreakerClosed
+	}
+	if time.Since(b.openedAt) < b.cooldown {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
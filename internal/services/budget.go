@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// budgetPromptVersion identifies the budget refinement prompt; bump it when the prompt changes
+const budgetPromptVersion = "budget-v2"
+
+const (
+	budgetBuffer       = 0.10 // Headroom over the median month
+	budgetRounding     = 10.0 // Budgets are rounded up to whole K10
+	budgetAIMinFactor  = 0.5  // Gemini may move a budget within these bounds of the history-based one
+	budgetAIMaxFactor  = 1.5
+	budgetNoteMaxRunes = 160
+)
+
+// nonBudgetCategories are expense categories that aren't spending to cap
+var nonBudgetCategories = map[string]bool{
+	"SAVINGS": true,
+}
+
+// IsNonBudgetCategory reports whether category is money put aside rather than spending to cap
+func IsNonBudgetCategory(category string) bool {
+	return nonBudgetCategories[strings.ToUpper(category)]
+}
+
+// BudgetSuggestion is a suggested monthly budget for one category
+type BudgetSuggestion struct {
+	Category      string  `json:"category"`
+	Amount        float64 `json:"amount"`
+	MedianMonthly float64 `json:"median_monthly"`
+	Note          string  `json:"note,omitempty"`
+}
+
+// SuggestBudgets turns monthly spend per category (one value per month) into
+// budgets: the median month plus a buffer, rounded up. Categories with no
+// spend in a typical month get no budget. Largest budgets come first
+func SuggestBudgets(monthly map[string][]float64) []BudgetSuggestion {
+	suggestions := []BudgetSuggestion{}
+	for category, months := range monthly {
+		if nonBudgetCategories[strings.ToUpper(category)] {
+			continue
+		}
+		m := median(months)
+		if m <= 0 {
+			continue
+		}
+		suggestions = append(suggestions, BudgetSuggestion{
+			Category:      category,
+			Amount:        roundUpBudget(m * (1 + budgetBuffer)),
+			MedianMonthly: m,
+		})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Amount != suggestions[j].Amount {
+			return suggestions[i].Amount > suggestions[j].Amount
+		}
+		return suggestions[i].Category < suggestions[j].Category
+	})
+	return suggestions
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func roundUpBudget(amount float64) float64 {
+	return math.Ceil(amount/budgetRounding) * budgetRounding
+}
+
+// RefineBudgets asks Gemini to adjust history-based budgets for a household's
+// costs and income in its country. Categories and bounds are kept from the
+// input, so a confused response can't invent or wildly change a budget
+func (s *GeminiService) RefineBudgets(ctx context.Context, country Country, suggestions []BudgetSuggestion, monthlyIncome float64) ([]BudgetSuggestion, *GenerationMeta, error) {
+	var lines strings.Builder
+	for _, b := range suggestions {
+		lines.WriteString(fmt.Sprintf("- %s: typical month %s, suggested %s\n", b.Category, country.Format(b.MedianMonthly), country.Format(b.Amount)))
+	}
+
+	prompt := fmt.Sprintf(`You are a friendly financial advisor for a mobile money tracking app called "Kwacha Tracker".
+
+A user in %s wants monthly budgets. Their typical monthly income is %s. These budgets come from their last 3 months of spending:
+
+%s
+**Instructions:**
+1. Adjust each budget to be realistic for living costs in %s (e.g. %s)
+2. If the budgets add up to more than their income, trim the least essential categories first
+3. Keep every category; don't add new ones
+4. Give each a short, encouraging note (under 20 words) in plain English
+5. Use %s (%s)
+
+**Output Format (JSON array):**
+[
+  {"category": "...", "amount": 0, "note": "..."}
+]
+
+Only output valid JSON, no additional text.`, country.Name, country.Format(monthlyIncome), lines.String(),
+		country.Name, country.LivingCosts, country.CurrencyName, country.Symbol)
+
+	response, meta, err := s.generateContent(ctx, "budget_suggestion", prompt, 800)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta.PromptVersion = budgetPromptVersion
+
+	var refined []BudgetSuggestion
+	if err := json.Unmarshal([]byte(cleanJSONResponse(response)), &refined); err != nil {
+		return nil, meta, fmt.Errorf("failed to parse budgets: %w", err)
+	}
+	byCategory := make(map[string]BudgetSuggestion, len(refined))
+	for _, r := range refined {
+		byCategory[strings.ToUpper(r.Category)] = r
+	}
+
+	result := make([]BudgetSuggestion, len(suggestions))
+	for i, b := range suggestions {
+		result[i] = b
+		r, ok := byCategory[strings.ToUpper(b.Category)]
+		if !ok {
+			continue
+		}
+		amount := math.Min(math.Max(r.Amount, b.Amount*budgetAIMinFactor), b.Amount*budgetAIMaxFactor)
+		result[i].Amount = roundUpBudget(amount)
+		if note := []rune(strings.TrimSpace(r.Note)); len(note) > budgetNoteMaxRunes {
+			result[i].Note = string(note[:budgetNoteMaxRunes])
+		} else {
+			result[i].Note = string(note)
+		}
+	}
+	return result, meta, nil
+}
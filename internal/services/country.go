@@ -0,0 +1,107 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultCountry is the country of users who registered before countries
+// were recorded, or without sending one
+const DefaultCountry = "ZM"
+
+// Country is a market the app serves: its currency, the mobile money
+// operators users pick from and what the AI prompts say about living there
+type Country struct {
+	Code         string   `json:"code"` // ISO 3166-1 alpha-2
+	Name         string   `json:"name"`
+	Currency     string   `json:"currency"` // ISO 4217
+	CurrencyName string   `json:"currency_name"`
+	Symbol       string   `json:"symbol"`
+	Operators    []string `json:"operators"`
+
+	LivingCosts string         `json:"-"` // Everyday costs budget advice should allow for
+	Location    *time.Location `json:"-"` // Local time, for quiet hours
+}
+
+// centralAfricaTime is UTC+2 all year; none of the countries observe
+// daylight saving, and the runtime image ships without tzdata
+var centralAfricaTime = time.FixedZone("CAT", 2*60*60)
+
+var countries = map[string]Country{
+	"ZM": {
+		Code: "ZM", Name: "Zambia", Currency: "ZMW", CurrencyName: "Zambian Kwacha", Symbol: "K",
+		Operators:   []string{"AIRTEL", "MTN", "ZAMTEL", "ZEDMOBILE"},
+		LivingCosts: "mealie meal, transport, ZESCO units, talktime",
+		Location:    centralAfricaTime,
+	},
+	"MW": {
+		Code: "MW", Name: "Malawi", Currency: "MWK", CurrencyName: "Malawian Kwacha", Symbol: "MK",
+		Operators:   []string{"AIRTEL", "TNM"},
+		LivingCosts: "maize flour, minibus fares, ESCOM units, airtime",
+		Location:    centralAfricaTime,
+	},
+	"ZW": {
+		Code: "ZW", Name: "Zimbabwe", Currency: "USD", CurrencyName: "US dollars", Symbol: "US$",
+		Operators:   []string{"ECONET", "NETONE", "TELECEL"},
+		LivingCosts: "mealie meal, kombi fares, ZESA tokens, airtime",
+		Location:    centralAfricaTime,
+	},
+}
+
+// IsSupportedCountry reports whether code is a country the app serves
+func IsSupportedCountry(code string) bool {
+	_, ok := countries[strings.ToUpper(code)]
+	return ok
+}
+
+// CountryFor returns a country by code, falling back to DefaultCountry
+func CountryFor(code string) Country {
+	if c, ok := countries[strings.ToUpper(code)]; ok {
+		return c
+	}
+	return countries[DefaultCountry]
+}
+
+// Countries returns every country the app serves, by code
+func Countries() []Country {
+	list := make([]Country, 0, len(countries))
+	for _, c := range countries {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// CountryCodes returns the codes of the countries the app serves, sorted
+func CountryCodes() []string {
+	codes := make([]string, 0, len(countries))
+	for _, c := range Countries() {
+		codes = append(codes, c.Code)
+	}
+	return codes
+}
+
+// HasOperator reports whether operator is one of the country's
+func (c Country) HasOperator(operator string) bool {
+	for _, o := range c.Operators {
+		if o == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// AmountFormat returns the locale's number conventions with the country's
+// currency symbol
+func (c Country) AmountFormat(locale string) AmountFormat {
+	f := AmountFormatFor(locale)
+	f.Symbol = c.Symbol
+	return f
+}
+
+// Format renders an amount in the country's currency with the default
+// locale, e.g. MK1,250.50, for prompts
+func (c Country) Format(amount float64) string {
+	return c.AmountFormat(DefaultLocale).Format(amount)
+}
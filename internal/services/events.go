@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Domain events published by handlers and consumed by independent subscribers
+const (
+	EventTransactionsSynced = "transactions_synced"
+	EventInsightGenerated   = "insight_generated"
+	EventConsentChanged     = "consent_changed"
+)
+
+// TransactionsSynced is published after a sync stores new transactions, and
+// after the user enters one by hand (Manual)
+type TransactionsSynced struct {
+	Inserted int  `json:"inserted"`
+	Total    int  `json:"total"`
+	Manual   bool `json:"manual,omitempty"`
+}
+
+// InsightGenerated is published for each stored insight
+type InsightGenerated struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Category string `json:"category"`
+	Priority string `json:"priority"`
+}
+
+// ConsentChanged is published when a user gives or withdraws consent
+type ConsentChanged struct {
+	ConsentGiven bool `json:"consent_given"`
+}
+
+const (
+	eventQueueSize     = 1024
+	eventWorkers       = 2
+	eventStream        = "kwacha:events"
+	eventStreamMaxLen  = 100000
+	eventConsumerGroup = "kwacha-backend"
+	eventReadBlock     = 5 * time.Second
+	eventReadCount     = 50
+)
+
+// Event is one published domain event. Payload holds the JSON of the event's payload type
+type Event struct {
+	Name    string          `json:"name"`
+	UserID  string          `json:"user_id"`
+	Payload json.RawMessage `json:"payload"`
+	At      time.Time       `json:"at"`
+}
+
+// Decode unmarshals the payload into v
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// EventHandler reacts to an event. Errors are logged; the event isn't retried
+type EventHandler func(ctx context.Context, event Event) error
+
+type eventSubscriber struct {
+	name   string
+	handle EventHandler
+}
+
+// EventBus decouples side effects (funnel tracking, indexing, realtime pushes)
+// from the request that caused them. Events are dispatched by background
+// workers, so publishing never slows the request down. With Redis, events go
+// through a stream read by a consumer group, so each event is handled by
+// exactly one replica and survives a restart of the publishing one
+type EventBus struct {
+	redis *redis.Client // Nil to dispatch in-process
+	queue chan Event
+
+	mu          sync.RWMutex
+	subscribers map[string][]eventSubscriber
+}
+
+// NewEventBus creates a bus; rdb may be nil to dispatch in-process
+func NewEventBus(rdb *redis.Client) *EventBus {
+	return &EventBus{
+		redis:       rdb,
+		queue:       make(chan Event, eventQueueSize),
+		subscribers: make(map[string][]eventSubscriber),
+	}
+}
+
+// Subscribe registers a named handler for an event. Register before Start
+func (b *EventBus) Subscribe(eventName, subscriber string, handle EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[eventName] = append(b.subscribers[eventName], eventSubscriber{name: subscriber, handle: handle})
+}
+
+// Start runs the dispatch workers, and the stream consumer when Redis is configured
+func (b *EventBus) Start(ctx context.Context) {
+	for i := 0; i < eventWorkers; i++ {
+		Supervise(ctx, fmt.Sprintf("event worker %d", i+1), b.work)
+	}
+	if b.redis != nil {
+		Supervise(ctx, "event stream consumer", b.consume)
+	}
+}
+
+// Publish queues an event for its subscribers
+func (b *EventBus) Publish(eventName, userID string, payload interface{}) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("❌ Failed to encode %s event: %v", eventName, err)
+		return
+	}
+	event := Event{Name: eventName, UserID: userID, Payload: payloadJSON, At: time.Now()}
+
+	if b.redis != nil {
+		eventJSON, _ := json.Marshal(event)
+		err := b.redis.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: eventStream,
+			MaxLen: eventStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"event": string(eventJSON)},
+		}).Err()
+		if err == nil {
+			return
+		}
+		log.Printf("⚠️ Event stream unavailable, dispatching %s in-process: %v", eventName, err)
+	}
+
+	select {
+	case b.queue <- event:
+	default:
+		// Workers are backed up; don't block the request, don't drop the event
+		Go("event "+eventName, func() { b.dispatch(context.Background(), event) })
+	}
+}
+
+func (b *EventBus) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-b.queue:
+			b.dispatch(ctx, event)
+		}
+	}
+}
+
+// dispatch runs every subscriber of the event; one failing or panicking doesn't affect the others
+func (b *EventBus) dispatch(ctx context.Context, event Event) {
+	b.mu.RLock()
+	subscribers := b.subscribers[event.Name]
+	b.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		func() {
+			defer recoverPanic("event subscriber " + sub.name)
+			if err := sub.handle(ctx, event); err != nil {
+				log.Printf("⚠️ Event subscriber %s failed on %s for user %s: %v", sub.name, event.Name, event.UserID, err)
+			}
+		}()
+	}
+}
+
+// consume reads the Redis stream as part of the shared consumer group, reconnecting until ctx is cancelled
+func (b *EventBus) consume(ctx context.Context) {
+	hostname, _ := os.Hostname()
+	consumer := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	for ctx.Err() == nil {
+		if err := b.readStream(ctx, consumer); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️ Event stream consumer disconnected: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(redisRetryDelay):
+		}
+	}
+}
+
+func (b *EventBus) readStream(ctx context.Context, consumer string) error {
+	err := b.redis.XGroupCreateMkStream(ctx, eventStream, eventConsumerGroup, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		streams, err := b.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    eventConsumerGroup,
+			Consumer: consumer,
+			Streams:  []string{eventStream, ">"},
+			Count:    eventReadCount,
+			Block:    eventReadBlock,
+		}).Result()
+		if err == redis.Nil {
+			continue // Nothing arrived within eventReadBlock
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				var event Event
+				if payload, ok := message.Values["event"].(string); ok && json.Unmarshal([]byte(payload), &event) == nil {
+					b.dispatch(ctx, event)
+				}
+				if err := b.redis.XAck(ctx, eventStream, eventConsumerGroup, message.ID).Err(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
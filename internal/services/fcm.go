@@ -3,12 +3,14 @@ package services
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/messaging"
+	"github.com/kwachatracker/backend/internal/models"
 	"google.golang.org/api/option"
 )
 
@@ -57,20 +59,24 @@ func NewFCMService(credentialsPath string) (*FCMService, error) {
 
 // SendNotification sends a push notification to a device
 func (s *FCMService) SendNotification(ctx context.Context, token, title, body string, data map[string]string) error {
+	return s.Send(ctx, token, models.PushNotification{
+		Title: title,
+		Body:  body,
+		Data:  data,
+	})
+}
+
+// fcmBatchLimit is the most messages FCM accepts in one batch send
+const fcmBatchLimit = 500
+
+// Send sends a rich push notification (image, deep link, data payload) to a device
+func (s *FCMService) Send(ctx context.Context, token string, n models.PushNotification) error {
+	notification, android := notificationConfig(n)
 	message := &messaging.Message{
-		Token: token,
-		Notification: &messaging.Notification{
-			Title: title,
-			Body:  body,
-		},
-		Data: data,
-		Android: &messaging.AndroidConfig{
-			Priority: "high",
-			Notification: &messaging.AndroidNotification{
-				ClickAction: "OPEN_MAIN_ACTIVITY",
-				ChannelID:   "kwachatracker_channel",
-			},
-		},
+		Token:        token,
+		Notification: notification,
+		Data:         notificationData(n),
+		Android:      android,
 	}
 
 	response, err := s.client.Send(ctx, message)
@@ -83,6 +89,123 @@ func (s *FCMService) SendNotification(ctx context.Context, token, title, body st
 	return nil
 }
 
+// SendBatch sends notifications[i] to tokens[i] in batches of up to 500,
+// returning each send's error in the same order. Notifications several
+// devices share (campaigns) go out through one multicast per batch; the
+// rest are sent together with SendEach
+func (s *FCMService) SendBatch(ctx context.Context, tokens []string, notifications []models.PushNotification) []error {
+	errs := make([]error, len(tokens))
+
+	var keys []string
+	groups := make(map[string][]int)
+	for i, n := range notifications {
+		key, _ := json.Marshal(n)
+		if _, ok := groups[string(key)]; !ok {
+			keys = append(keys, string(key))
+		}
+		groups[string(key)] = append(groups[string(key)], i)
+	}
+
+	var singles []int
+	for _, key := range keys {
+		indexes := groups[key]
+		if len(indexes) == 1 {
+			singles = append(singles, indexes[0])
+			continue
+		}
+		n := notifications[indexes[0]]
+		notification, android := notificationConfig(n)
+		for _, chunk := range fcmChunks(indexes) {
+			message := &messaging.MulticastMessage{
+				Notification: notification,
+				Data:         notificationData(n),
+				Android:      android,
+			}
+			for _, i := range chunk {
+				message.Tokens = append(message.Tokens, tokens[i])
+			}
+			response, err := s.client.SendEachForMulticast(ctx, message)
+			batchErrors(errs, chunk, response, err)
+		}
+	}
+
+	for _, chunk := range fcmChunks(singles) {
+		messages := make([]*messaging.Message, len(chunk))
+		for j, i := range chunk {
+			notification, android := notificationConfig(notifications[i])
+			messages[j] = &messaging.Message{
+				Token:        tokens[i],
+				Notification: notification,
+				Data:         notificationData(notifications[i]),
+				Android:      android,
+			}
+		}
+		response, err := s.client.SendEach(ctx, messages)
+		batchErrors(errs, chunk, response, err)
+	}
+
+	return errs
+}
+
+// fcmChunks splits indexes into batches FCM accepts
+func fcmChunks(indexes []int) [][]int {
+	var chunks [][]int
+	for len(indexes) > fcmBatchLimit {
+		chunks = append(chunks, indexes[:fcmBatchLimit])
+		indexes = indexes[fcmBatchLimit:]
+	}
+	if len(indexes) > 0 {
+		chunks = append(chunks, indexes)
+	}
+	return chunks
+}
+
+// batchErrors files a batch's per-message errors, or the whole batch's
+// error against every message in it
+func batchErrors(errs []error, chunk []int, response *messaging.BatchResponse, err error) {
+	for j, i := range chunk {
+		switch {
+		case err != nil:
+			errs[i] = err
+		case j < len(response.Responses):
+			errs[i] = response.Responses[j].Error
+		default:
+			errs[i] = fmt.Errorf("no response from FCM")
+		}
+	}
+}
+
+// notificationConfig is the visible part of a push, shared by single and batch sends
+func notificationConfig(n models.PushNotification) (*messaging.Notification, *messaging.AndroidConfig) {
+	notification := &messaging.Notification{
+		Title:    n.Title,
+		Body:     n.Body,
+		ImageURL: n.ImageURL,
+	}
+	android := &messaging.AndroidConfig{
+		Priority: "high",
+		Notification: &messaging.AndroidNotification{
+			ClickAction: "OPEN_MAIN_ACTIVITY",
+			ChannelID:   "kwachatracker_channel",
+			ImageURL:    n.ImageURL,
+		},
+	}
+	return notification, android
+}
+
+// notificationData merges the deep link into the data payload the app receives
+func notificationData(n models.PushNotification) map[string]string {
+	if n.DeepLink == "" {
+		return n.Data
+	}
+	data := make(map[string]string, len(n.Data)+1)
+	for k, v := range n.Data {
+		data[k] = v
+	}
+	data["deep_link"] = n.DeepLink
+	return data
+}
+
 // SendToMultiple sends notifications to multiple devices
 func (s *FCMService) SendToMultiple(ctx context.Context, tokens []string, title, body string, data map[string]string) (int, int) {
 	message := &messaging.MulticastMessage{
@@ -114,7 +237,7 @@ func (s *FCMService) SendWeeklySummary(ctx context.Context, token string, income
 	}
 
 	title := fmt.Sprintf("%s Weekly Summary", emoji)
-	body := fmt.Sprintf("Income: K%.0f | Expenses: K%.0f | Net: K%.0f", income, expenses, net)
+	body := fmt.Sprintf("Income: %s | Expenses: %s | Net: %s", FormatKwacha(income), FormatKwacha(expenses), FormatKwacha(net))
 
 	return s.SendNotification(ctx, token, title, body, map[string]string{
 		"type": "weekly_summary",
@@ -124,7 +247,7 @@ func (s *FCMService) SendWeeklySummary(ctx context.Context, token string, income
 // SendBudgetAlert sends budget warning notifications
 func (s *FCMService) SendBudgetAlert(ctx context.Context, token string, percentUsed int, budget float64) error {
 	title := "⚠️ Budget Alert"
-	body := fmt.Sprintf("You've used %d%% of your K%.0f monthly budget", percentUsed, budget)
+	body := fmt.Sprintf("You've used %d%% of your %s monthly budget", percentUsed, FormatKwacha(budget))
 
 	return s.SendNotification(ctx, token, title, body, map[string]string{
 		"type": "budget_alert",
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AmountFormat holds the currency and number conventions for a locale
+type AmountFormat struct {
+	Symbol       string
+	ThousandsSep string
+	DecimalSep   string
+}
+
+// DefaultLocale is used when a user has no (or an unknown) language set
+const DefaultLocale = "en"
+
+// amountFormats maps app languages to number conventions.
+// Zambian languages follow English conventions: K1,250.50
+var amountFormats = map[string]AmountFormat{
+	"en":  {Symbol: "K", ThousandsSep: ",", DecimalSep: "."},
+	"bem": {Symbol: "K", ThousandsSep: ",", DecimalSep: "."},
+	"nya": {Symbol: "K", ThousandsSep: ",", DecimalSep: "."},
+	"toi": {Symbol: "K", ThousandsSep: ",", DecimalSep: "."},
+	"loz": {Symbol: "K", ThousandsSep: ",", DecimalSep: "."},
+	"fr":  {Symbol: "K", ThousandsSep: " ", DecimalSep: ","},
+}
+
+// IsSupportedLocale reports whether locale is one of the app's languages
+func IsSupportedLocale(locale string) bool {
+	_, ok := amountFormats[strings.ToLower(locale)]
+	return ok
+}
+
+// AmountFormatFor returns the conventions for a locale, falling back to DefaultLocale
+func AmountFormatFor(locale string) AmountFormat {
+	if f, ok := amountFormats[strings.ToLower(locale)]; ok {
+		return f
+	}
+	return amountFormats[DefaultLocale]
+}
+
+// FormatKwacha renders an amount with the default locale, e.g. K1,250.50
+func FormatKwacha(amount float64) string {
+	return AmountFormatFor(DefaultLocale).Format(amount)
+}
+
+// Format renders an amount with two decimal places, e.g. K1,250.50 or -K40.00
+func (f AmountFormat) Format(amount float64) string {
+	return f.format(amount, 2)
+}
+
+// FormatWhole renders an amount rounded to whole units, e.g. K1,251
+func (f AmountFormat) FormatWhole(amount float64) string {
+	return f.format(amount, 0)
+}
+
+func (f AmountFormat) format(amount float64, decimals int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.FormatFloat(amount, 'f', decimals, 64)
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+
+	var grouped strings.Builder
+	for i, d := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			grouped.WriteString(f.ThousandsSep)
+		}
+		grouped.WriteRune(d)
+	}
+
+	result := sign + f.Symbol + grouped.String()
+	if fracPart != "" {
+		result += f.DecimalSep + fracPart
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+// retentionDays is how long after registration a user counts as retained
+const retentionDays = 7
+
+// FunnelTracker records onboarding funnel events
+type FunnelTracker struct {
+	db *sql.DB
+}
+
+// NewFunnelTracker creates a funnel tracker
+func NewFunnelTracker(db *sql.DB) *FunnelTracker {
+	return &FunnelTracker{db: db}
+}
+
+// Record records that a user reached a funnel step; only the first time counts
+func (f *FunnelTracker) Record(userID, event string) {
+	_, err := f.db.Exec(`
+		INSERT INTO funnel_events (user_id, event) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, event)
+	if err != nil {
+		log.Printf("⚠️ Failed to record funnel event %s for user %s: %v", event, userID, err)
+	}
+}
+
+// RecordRetention marks the user as retained if they are active a week or more after registering
+func (f *FunnelTracker) RecordRetention(userID string) {
+	_, err := f.db.Exec(`
+		INSERT INTO funnel_events (user_id, event)
+		SELECT id, $2 FROM users
+		WHERE id = $1 AND created_at <= NOW() - make_interval(days => $3)
+		ON CONFLICT DO NOTHING
+	`, userID, models.FunnelRetained7d, retentionDays)
+	if err != nil {
+		log.Printf("⚠️ Failed to record retention for user %s: %v", userID, err)
+	}
+}
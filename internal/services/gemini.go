@@ -9,8 +9,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // GeminiService handles AI-powered transaction analysis
@@ -19,8 +22,17 @@ type GeminiService struct {
 	apiKey     string
 	httpClient *http.Client
 	modelName  string
+	usage      *AIUsageTracker
+	breaker    *CircuitBreaker
+	guard      *AdviceGuard
 }
 
+// Gemini circuit breaker: after this many consecutive failures, stop calling for the cooldown
+const (
+	geminiBreakerThreshold = 5
+	geminiBreakerCooldown  = time.Minute
+)
+
 // GeminiRequest represents a request to the Gemini API
 type GeminiRequest struct {
 	Contents         []Content         `json:"contents"`
@@ -34,7 +46,14 @@ type Content struct {
 }
 
 type Part struct {
-	Text string `json:"text"`
+	Text       string      `json:"text,omitempty"`
+	InlineData *InlineData `json:"inline_data,omitempty"`
+}
+
+// InlineData is a base64-encoded file (e.g. an image) sent alongside the prompt
+type InlineData struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"`
 }
 
 type GenerationConfig struct {
@@ -76,7 +95,50 @@ type SpendingData struct {
 	TopMerchants     []string           `json:"top_merchants"`
 	TransactionCount int                `json:"transaction_count"`
 	SavingsDeposits  float64            `json:"savings_deposits"`
+	InterestEarned   float64            `json:"interest_earned"`  // Credited to savings products (MoKash etc.)
+	IrregularIncome  bool               `json:"irregular_income"` // Income varies a lot month to month (gig work, trading)
+	AverageIncome    float64            `json:"average_income"`   // Average monthly income over recent complete months
 	PreviousPeriod   *SpendingData      `json:"previous_period,omitempty"`
+
+	// Standout payments; only users syncing full transactions have them
+	LargestExpenses []SpendingHighlight `json:"largest_expenses,omitempty"`
+	NewMerchants    []SpendingHighlight `json:"new_merchants,omitempty"` // Paid for the first time this period
+
+	// The user's own budgets, so insights can refer to them
+	Budgets []BudgetStatus `json:"budgets,omitempty"`
+
+	// Context for rule-based insights (not sent to Gemini)
+	CategoryDailyAverage map[string]float64 `json:"-"` // Average daily spend per category over the last 30 days
+	DaysSinceIncome      int                `json:"-"` // -1 if the user has never received income
+	MonthIncome          float64            `json:"-"` // Month-to-date
+	MonthExpenses        float64            `json:"-"`
+	Locale               string             `json:"-"` // User's language, for amount formatting
+	Country              string             `json:"-"` // User's country, for its currency and prompt wording
+	ExcludedCategories   []string           `json:"-"` // Categories the user doesn't want sent to Gemini
+}
+
+// AmountFormat returns how amounts are shown to the user: their country's
+// currency with their language's conventions
+func (d SpendingData) AmountFormat() AmountFormat {
+	return CountryFor(d.Country).AmountFormat(d.Locale)
+}
+
+// SpendingHighlight is a standout payment in the prompt. Recipients who are
+// people are given as ScrubbedName
+type SpendingHighlight struct {
+	Recipient string  `json:"recipient"`
+	Category  string  `json:"category"`
+	Amount    float64 `json:"amount"`
+}
+
+// BudgetStatus is a budget's month to date and how often the user kept to it
+type BudgetStatus struct {
+	Category     string  `json:"category"`
+	Budget       float64 `json:"budget"`
+	Spent        float64 `json:"spent"`         // Month to date
+	Projected    float64 `json:"projected"`     // By the month end at the current rate
+	MonthsWithin int     `json:"months_within"` // Recent complete months within budget
+	Months       int     `json:"months"`
 }
 
 // AIInsight represents generated insight for a user
@@ -86,10 +148,41 @@ type AIInsight struct {
 	Category    string    `json:"category"` // "spending", "savings", "anomaly", "tip"
 	Priority    string    `json:"priority"` // "high", "medium", "low"
 	GeneratedAt time.Time `json:"generated_at"`
+
+	Meta *GenerationMeta `json:"-"` // How the insight was produced (admin only)
 }
 
-// NewGeminiService creates a new Gemini service
-func NewGeminiService() (*GeminiService, error) {
+// Insight sources
+const (
+	InsightSourceGemini   = "gemini"
+	InsightSourceRules    = "rules"
+	InsightSourceFallback = "fallback" // Gemini answered but the output couldn't be parsed or was blocked as harmful
+	InsightSourceLibrary  = "library"  // Curated financial_tips entry
+	InsightSourceNotice   = "notice"   // Operator announcement (operator_notices)
+)
+
+// GenerationMeta records how an insight was generated, for debugging low-quality output
+type GenerationMeta struct {
+	Source        string `json:"source"`
+	Model         string `json:"model,omitempty"`
+	PromptVersion string `json:"prompt_version,omitempty"`
+	FinishReason  string `json:"finish_reason,omitempty"`
+	LatencyMs     int    `json:"latency_ms,omitempty"`
+	PromptTokens  int    `json:"prompt_tokens,omitempty"`
+	OutputTokens  int    `json:"output_tokens,omitempty"`
+	TipKey        string `json:"tip_key,omitempty"`   // Library tip, recorded for rotation
+	NoticeID      int    `json:"notice_id,omitempty"` // Operator notice, recorded so it's shown once
+	CallID        string `json:"call_id,omitempty"`   // The Gemini call, as recorded in ai_usage
+
+	ExcludedCategories []string `json:"excluded_categories,omitempty"` // Left out of the prompt at the user's request
+}
+
+// analysisPromptVersion identifies buildAnalysisPrompt's wording; bump it when the prompt changes
+const analysisPromptVersion = "spending-v5"
+
+// NewGeminiService creates a new Gemini service; usage may be nil to skip
+// budget tracking and guard nil to show insights unchecked
+func NewGeminiService(usage *AIUsageTracker, guard *AdviceGuard) (*GeminiService, error) {
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
 		return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set")
@@ -101,91 +194,379 @@ func NewGeminiService() (*GeminiService, error) {
 			Timeout: 30 * time.Second,
 		},
 		modelName: "gemini-2.5-flash", // Fast and cost-effective
+		usage:     usage,
+		breaker:   NewCircuitBreaker(geminiBreakerThreshold, geminiBreakerCooldown),
+		guard:     guard,
 	}, nil
 }
 
+// withoutExcluded returns data with the categories the user excluded from
+// AI analysis removed, their spend taken out of the totals, and the
+// excluded categories that were present
+func withoutExcluded(data SpendingData) (SpendingData, []string) {
+	if len(data.ExcludedCategories) == 0 {
+		return data, nil
+	}
+	excluded := make(map[string]bool, len(data.ExcludedCategories))
+	for _, cat := range data.ExcludedCategories {
+		excluded[strings.ToUpper(cat)] = true
+	}
+
+	var removed []string
+	byCategory := make(map[string]float64, len(data.ByCategory))
+	for cat, amount := range data.ByCategory {
+		if excluded[strings.ToUpper(cat)] {
+			removed = append(removed, cat)
+			data.TotalExpenses -= amount
+			continue
+		}
+		byCategory[cat] = amount
+	}
+	sort.Strings(removed)
+	data.ByCategory = byCategory
+	data.LargestExpenses = highlightsWithout(data.LargestExpenses, excluded)
+	data.NewMerchants = highlightsWithout(data.NewMerchants, excluded)
+	var budgets []BudgetStatus
+	for _, b := range data.Budgets {
+		if !excluded[strings.ToUpper(b.Category)] {
+			budgets = append(budgets, b)
+		}
+	}
+	data.Budgets = budgets
+	data.NetBalance = data.TotalIncome - data.TotalExpenses
+	if excluded["SAVINGS"] {
+		data.SavingsDeposits = 0
+		data.InterestEarned = 0
+	}
+	if data.PreviousPeriod != nil {
+		previous, _ := withoutExcluded(*data.PreviousPeriod)
+		data.PreviousPeriod = &previous
+	}
+	return data, removed
+}
+
+// highlightsWithout drops the highlights in excluded categories
+func highlightsWithout(highlights []SpendingHighlight, excluded map[string]bool) []SpendingHighlight {
+	var kept []SpendingHighlight
+	for _, h := range highlights {
+		if !excluded[strings.ToUpper(h.Category)] {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
 // AnalyzeSpending generates AI insights from spending data
 func (s *GeminiService) AnalyzeSpending(ctx context.Context, data SpendingData) ([]AIInsight, error) {
+	data, excluded := withoutExcluded(data)
 	prompt := s.buildAnalysisPrompt(data)
 
-	response, err := s.generateContent(ctx, prompt)
+	ctx = WithAIFields(WithAIUsers(ctx, data.UserID), map[string][]string{data.UserID: aiFields(data, true)})
+	response, meta, err := s.generateContent(ctx, "spending_analysis", prompt, 500)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate content: %w", err)
 	}
+	meta.PromptVersion = analysisPromptVersion
+	meta.ExcludedCategories = excluded
 
 	insights, err := s.parseInsights(response)
 	if err != nil {
 		// Fallback to basic insight if parsing fails
 		log.Printf("Failed to parse AI response, using fallback: %v", err)
-		return s.fallbackInsights(data), nil
+		insights = s.fallbackInsights(data)
+		meta.Source = InsightSourceFallback
 	}
 
-	return insights, nil
+	for i := range insights {
+		insights[i].Meta = meta
+	}
+
+	results := map[string][]AIInsight{data.UserID: insights}
+	s.screen(ctx, results, map[string]SpendingData{data.UserID: data})
+	return results[data.UserID], nil
+}
+
+// batchPromptVersion identifies buildBatchPrompt's wording; bump it when the prompt changes
+const batchPromptVersion = "spending-batch-v4"
+
+// AnalyzeSpendingBatch analyzes several small accounts in a single Gemini call.
+// Users are sent under anonymous keys (u1, u2, ...) rather than their IDs and the
+// result is keyed by UserID; users missing from the response are omitted so the
+// caller can fall back to per-user or rule-based analysis for them.
+func (s *GeminiService) AnalyzeSpendingBatch(ctx context.Context, batch []SpendingData) (map[string][]AIInsight, error) {
+	keys := make(map[string]string, len(batch))
+	userIDs := make([]string, len(batch))
+	excluded := make(map[string][]string)
+	fields := make(map[string][]string, len(batch))
+	shared := make([]SpendingData, len(batch))
+	for i, data := range batch {
+		keys[fmt.Sprintf("u%d", i+1)] = data.UserID
+		userIDs[i] = data.UserID
+		shared[i], excluded[data.UserID] = withoutExcluded(data)
+		fields[data.UserID] = aiFields(shared[i], false)
+	}
+	batch = shared
+
+	ctx = WithAIFields(WithAIUsers(ctx, userIDs...), fields)
+	response, meta, err := s.generateContent(ctx, "spending_analysis_batch", s.buildBatchPrompt(batch), 400*len(batch))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	meta.PromptVersion = batchPromptVersion
+
+	// Attribute the call's latency and tokens evenly across the batch
+	meta.PromptTokens /= len(batch)
+	meta.OutputTokens /= len(batch)
+
+	var rawResults map[string][]rawInsight
+	if err := json.Unmarshal([]byte(cleanJSONResponse(response)), &rawResults); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal batch insights: %w", err)
+	}
+
+	results := make(map[string][]AIInsight, len(rawResults))
+	for key, raw := range rawResults {
+		userID, ok := keys[key]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		userMeta := *meta
+		userMeta.ExcludedCategories = excluded[userID]
+		insights := toInsights(raw)
+		for i := range insights {
+			insights[i].Meta = &userMeta
+		}
+		results[userID] = insights
+	}
+
+	dataByUser := make(map[string]SpendingData, len(batch))
+	for _, data := range batch {
+		dataByUser[data.UserID] = data
+	}
+	s.screen(ctx, results, dataByUser)
+	return results, nil
+}
+
+// buildBatchPrompt creates one prompt covering several anonymized users
+func (s *GeminiService) buildBatchPrompt(batch []SpendingData) string {
+	var users strings.Builder
+	for i, data := range batch {
+		country := CountryFor(data.Country)
+		money := country.Format
+		users.WriteString(fmt.Sprintf("### u%d (%s, %s)\n", i+1, data.Period, country.Name))
+		users.WriteString(fmt.Sprintf("- Total Income: %s\n", money(data.TotalIncome)))
+		users.WriteString(fmt.Sprintf("- Total Expenses: %s\n", money(data.TotalExpenses)))
+		users.WriteString(fmt.Sprintf("- Net Balance: %s\n", money(data.NetBalance)))
+		users.WriteString(fmt.Sprintf("- Savings Deposits: %s\n", money(data.SavingsDeposits)))
+		users.WriteString(fmt.Sprintf("- Savings Interest Earned: %s\n", money(data.InterestEarned)))
+		users.WriteString(fmt.Sprintf("- Transaction Count: %d\n", data.TransactionCount))
+		users.WriteString(fmt.Sprintf("- Income Pattern: %s\n", incomePattern(data)))
+		for cat, amount := range data.ByCategory {
+			users.WriteString(fmt.Sprintf("- %s: %s\n", cat, money(amount)))
+		}
+		users.WriteString(budgetLines(data))
+		users.WriteString("\n")
+	}
+
+	return fmt.Sprintf(`You are a friendly financial advisor for a mobile money tracking app called "Kwacha Tracker", used in Southern Africa.
+
+Below is spending data for %d different users, each identified by a key and the country they live in. Analyze each user separately and generate 1-2 personalized insights per user.
+
+%s
+**Instructions:**
+1. Be encouraging and positive, especially about savings
+2. Give amounts in each user's own currency, with the symbol their data uses
+3. Keep each insight under 50 words
+4. Focus on actionable tips
+5. If savings > 10%% of income, congratulate them
+6. Never mix up data between users
+7. For users with irregular income, %s
+8. For users with budgets: %s
+
+**Output Format (JSON object keyed by user key):**
+{
+  "u1": [{"title": "...", "message": "...", "category": "spending|savings|tip", "priority": "high|medium|low"}]
+}
+
+Only output valid JSON, no additional text.`, len(batch), users.String(), irregularIncomeAdvice, budgetAdvice)
+}
+
+// aiFields names the fields of data a spending prompt includes, for the
+// user's AI activity. Only the single-user prompt has the highlights
+func aiFields(data SpendingData, highlights bool) []string {
+	fields := []string{"country", "total_income", "total_expenses", "net_balance", "savings_deposits", "interest_earned", "transaction_count"}
+	if data.IrregularIncome {
+		fields = append(fields, "irregular_income", "average_income")
+	}
+	if len(data.ByCategory) > 0 {
+		fields = append(fields, "by_category")
+	}
+	if highlights && len(data.LargestExpenses) > 0 {
+		fields = append(fields, "largest_expenses")
+	}
+	if highlights && len(data.NewMerchants) > 0 {
+		fields = append(fields, "new_merchants")
+	}
+	if len(data.Budgets) > 0 {
+		fields = append(fields, "budgets")
+	}
+	return fields
+}
+
+// budgetAdvice steers insights towards the budgets the user set themselves
+const budgetAdvice = "Refer to the user's own budgets by category: praise budgets they keep to and warn early about ones heading over"
+
+// irregularIncomeAdvice steers advice for users whose income comes in bursts
+const irregularIncomeAdvice = "don't assume a monthly salary. Suggest smoothing income: keeping part of good weeks aside for slow ones, building a small buffer, and spending a steady daily amount"
+
+// incomePattern describes a user's income for the prompts
+func incomePattern(data SpendingData) string {
+	if data.IrregularIncome {
+		return fmt.Sprintf("irregular (varies a lot month to month, averages %s a month)", CountryFor(data.Country).Format(data.AverageIncome))
+	}
+	return "steady"
+}
+
+// budgetLines describes the user's budgets for the prompts
+func budgetLines(data SpendingData) string {
+	money := CountryFor(data.Country).Format
+	var lines strings.Builder
+	for _, b := range data.Budgets {
+		line := fmt.Sprintf("- Budget %s: %s of %s spent this month, heading for %s", b.Category, money(b.Spent), money(b.Budget), money(b.Projected))
+		if b.Months > 0 {
+			line += fmt.Sprintf("; kept to it %d of the last %d months", b.MonthsWithin, b.Months)
+		}
+		lines.WriteString(line + "\n")
+	}
+	return lines.String()
 }
 
 // buildAnalysisPrompt creates a structured prompt for spending analysis
 func (s *GeminiService) buildAnalysisPrompt(data SpendingData) string {
+	country := CountryFor(data.Country)
+	money := country.Format
+
 	var categoryBreakdown strings.Builder
 	for cat, amount := range data.ByCategory {
-		categoryBreakdown.WriteString(fmt.Sprintf("- %s: K%.2f\n", cat, amount))
+		categoryBreakdown.WriteString(fmt.Sprintf("- %s: %s\n", cat, money(amount)))
 	}
 
-	prompt := fmt.Sprintf(`You are a friendly financial advisor for a Zambian mobile money tracking app called "Kwacha Tracker".
+	var highlights strings.Builder
+	for _, h := range data.LargestExpenses {
+		line := fmt.Sprintf("- Large expense: %s on %s", money(h.Amount), h.Category)
+		if h.Recipient != "" {
+			line += " (" + h.Recipient + ")"
+		}
+		highlights.WriteString(line + "\n")
+	}
+	for _, h := range data.NewMerchants {
+		highlights.WriteString(fmt.Sprintf("- New merchant: %s, %s spent on %s\n", h.Recipient, money(h.Amount), h.Category))
+	}
+	if highlights.Len() == 0 {
+		highlights.WriteString("- None\n")
+	}
+
+	budgets := budgetLines(data)
+	if budgets == "" {
+		budgets = "- None set\n"
+	}
 
-Analyze this user's spending data and generate 2-3 personalized insights.
+	extraInstructions := ""
+	step := 6
+	if data.IrregularIncome {
+		extraInstructions += fmt.Sprintf("%d. This user's income is irregular: %s\n", step, irregularIncomeAdvice)
+		step++
+	}
+	if len(data.Budgets) > 0 {
+		extraInstructions += fmt.Sprintf("%d. %s\n", step, budgetAdvice)
+	}
+
+	prompt := fmt.Sprintf(`You are a friendly financial advisor for a mobile money tracking app called "Kwacha Tracker".
+
+Analyze the spending data of this user in %s and generate 2-3 personalized insights.
 
 **Spending Data (%s):**
-- Total Income: K%.2f
-- Total Expenses: K%.2f
-- Net Balance: K%.2f
-- Savings Deposits: K%.2f
+- Total Income: %s
+- Total Expenses: %s
+- Net Balance: %s
+- Savings Deposits: %s
+- Savings Interest Earned: %s
 - Transaction Count: %d
+- Income Pattern: %s
 
 **Category Breakdown:**
 %s
-
+**Highlights:**
+%s
+**Budgets:**
+%s
 **Instructions:**
 1. Be encouraging and positive, especially about savings
-2. Use Zambian Kwacha (K) for amounts
+2. Use %s (%s) for amounts
 3. Keep each insight under 50 words
 4. Focus on actionable tips
 5. If savings > 10%% of income, congratulate them
-
+%s
 **Output Format (JSON array):**
 [
   {"title": "...", "message": "...", "category": "spending|savings|tip", "priority": "high|medium|low"}
 ]
 
 Only output valid JSON, no additional text.`,
+		country.Name,
 		data.Period,
-		data.TotalIncome,
-		data.TotalExpenses,
-		data.NetBalance,
-		data.SavingsDeposits,
+		money(data.TotalIncome),
+		money(data.TotalExpenses),
+		money(data.NetBalance),
+		money(data.SavingsDeposits),
+		money(data.InterestEarned),
 		data.TransactionCount,
+		incomePattern(data),
 		categoryBreakdown.String(),
+		highlights.String(),
+		budgets,
+		country.CurrencyName, country.Symbol,
+		extraInstructions,
 	)
 
 	return prompt
 }
 
-// generateContent calls the Gemini API
-func (s *GeminiService) generateContent(ctx context.Context, prompt string) (string, error) {
+// generateContent calls the Gemini API, enforcing the spend budget and recording usage
+func (s *GeminiService) generateContent(ctx context.Context, purpose, prompt string, maxOutputTokens int) (string, *GenerationMeta, error) {
+	return s.generate(ctx, purpose, []Part{{Text: prompt}}, maxOutputTokens)
+}
+
+// generate sends a multi-part prompt (text and inline files) to Gemini
+func (s *GeminiService) generate(ctx context.Context, purpose string, parts []Part, maxOutputTokens int) (string, *GenerationMeta, error) {
+	return s.generateWith(ctx, s.modelName, purpose, parts, maxOutputTokens)
+}
+
+// generateWith is generate with a model other than the service's
+func (s *GeminiService) generateWith(ctx context.Context, model, purpose string, parts []Part, maxOutputTokens int) (string, *GenerationMeta, error) {
+	if s.usage != nil {
+		if err := s.usage.Allow(ctx); err != nil {
+			return "", nil, err
+		}
+	}
+	if !s.breaker.Allow() {
+		return "", nil, ErrAIUnavailable
+	}
+
 	url := fmt.Sprintf(
 		"https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s",
-		s.modelName,
+		model,
 		s.apiKey,
 	)
 
 	reqBody := GeminiRequest{
 		Contents: []Content{
 			{
-				Parts: []Part{{Text: prompt}},
+				Parts: parts,
 			},
 		},
 		GenerationConfig: &GenerationConfig{
 			Temperature:     0.7,
-			MaxOutputTokens: 500,
+			MaxOutputTokens: maxOutputTokens,
 		},
 		SafetySettings: []SafetySetting{
 			{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "BLOCK_ONLY_HIGH"},
@@ -195,62 +576,112 @@ func (s *GeminiService) generateContent(ctx context.Context, prompt string) (str
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return "", nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
+	start := time.Now()
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("API request failed: %w", err)
+		s.breaker.Failure()
+		return "", nil, fmt.Errorf("API request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", nil, fmt.Errorf("failed to read response: %w", err)
 	}
+	latency := time.Since(start)
 
+	s.recordOutcome(resp.StatusCode)
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return "", nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
 	}
 
 	var geminiResp GeminiResponse
 	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return "", nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	promptTokens := geminiResp.UsageMetadata.PromptTokenCount
+	totalTokens := geminiResp.UsageMetadata.TotalTokenCount
+	callID := uuid.NewString()
+	if s.usage != nil {
+		s.usage.Record(ctx, callID, purpose, model, promptTokens, totalTokens)
 	}
 
 	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no content in response")
+		return "", nil, fmt.Errorf("no content in response")
+	}
+
+	meta := &GenerationMeta{
+		Source:       InsightSourceGemini,
+		Model:        model,
+		FinishReason: geminiResp.Candidates[0].FinishReason,
+		LatencyMs:    int(latency.Milliseconds()),
+		PromptTokens: promptTokens,
+		OutputTokens: totalTokens - promptTokens,
+		CallID:       callID,
 	}
 
-	return geminiResp.Candidates[0].Content.Parts[0].Text, nil
+	return geminiResp.Candidates[0].Content.Parts[0].Text, meta, nil
 }
 
-// parseInsights extracts structured insights from AI response
-func (s *GeminiService) parseInsights(response string) ([]AIInsight, error) {
-	// Clean up response (remove markdown code blocks if present)
-	response = strings.TrimSpace(response)
-	response = strings.TrimPrefix(response, "```json")
-	response = strings.TrimPrefix(response, "```")
-	response = strings.TrimSuffix(response, "```")
-	response = strings.TrimSpace(response)
+// recordOutcome feeds the circuit breaker; only outages and rate limits count as
+// failures, since a 4xx for a bad request says nothing about Gemini's health
+func (s *GeminiService) recordOutcome(statusCode int) {
+	if statusCode >= 500 || statusCode == http.StatusTooManyRequests {
+		s.breaker.Failure()
+		return
+	}
+	s.breaker.Success()
+}
 
-	var rawInsights []struct {
-		Title    string `json:"title"`
-		Message  string `json:"message"`
-		Category string `json:"category"`
-		Priority string `json:"priority"`
+// Available returns ErrAIUnavailable when a call made now would be refused,
+// because the spend budget is used up or the circuit breaker is open
+func (s *GeminiService) Available(ctx context.Context) error {
+	if s.usage != nil {
+		if err := s.usage.Allow(ctx); err != nil {
+			return err
+		}
+	}
+	if s.breaker.State() == BreakerOpen {
+		return ErrAIUnavailable
 	}
+	return nil
+}
+
+// Breaker exposes the Gemini circuit breaker for status reporting
+func (s *GeminiService) Breaker() *CircuitBreaker {
+	return s.breaker
+}
+
+// parseInsights extracts structured insights from AI response
+func (s *GeminiService) parseInsights(response string) ([]AIInsight, error) {
+	var rawInsights []rawInsight
 
-	if err := json.Unmarshal([]byte(response), &rawInsights); err != nil {
+	if err := json.Unmarshal([]byte(cleanJSONResponse(response)), &rawInsights); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal insights: %w", err)
 	}
 
+	return toInsights(rawInsights), nil
+}
+
+// rawInsight is a single insight as written by the model
+type rawInsight struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Category string `json:"category"`
+	Priority string `json:"priority"`
+}
+
+func toInsights(rawInsights []rawInsight) []AIInsight {
 	insights := make([]AIInsight, len(rawInsights))
 	for i, raw := range rawInsights {
 		insights[i] = AIInsight{
@@ -261,45 +692,21 @@ func (s *GeminiService) parseInsights(response string) ([]AIInsight, error) {
 			GeneratedAt: time.Now(),
 		}
 	}
+	return insights
+}
 
-	return insights, nil
+// cleanJSONResponse removes markdown code fences the model sometimes wraps JSON in
+func cleanJSONResponse(response string) string {
+	response = strings.TrimSpace(response)
+	response = strings.TrimPrefix(response, "```json")
+	response = strings.TrimPrefix(response, "```")
+	response = strings.TrimSuffix(response, "```")
+	return strings.TrimSpace(response)
 }
 
-// fallbackInsights returns pre-written insights when AI fails
+// fallbackInsights returns rule-based insights when AI output can't be used
 func (s *GeminiService) fallbackInsights(data SpendingData) []AIInsight {
-	insights := []AIInsight{}
-
-	// Savings insight
-	if data.SavingsDeposits > 0 {
-		insights = append(insights, AIInsight{
-			Title:       "💰 Great Saving Habit!",
-			Message:     fmt.Sprintf("You've saved K%.0f this period. Keep it up!", data.SavingsDeposits),
-			Category:    "savings",
-			Priority:    "high",
-			GeneratedAt: time.Now(),
-		})
-	}
-
-	// Balance insight
-	if data.NetBalance > 0 {
-		insights = append(insights, AIInsight{
-			Title:       "📈 Positive Balance",
-			Message:     fmt.Sprintf("Your income exceeds expenses by K%.0f. Consider saving the surplus!", data.NetBalance),
-			Category:    "tip",
-			Priority:    "medium",
-			GeneratedAt: time.Now(),
-		})
-	} else if data.NetBalance < 0 {
-		insights = append(insights, AIInsight{
-			Title:       "⚠️ Spending Alert",
-			Message:     fmt.Sprintf("You've spent K%.0f more than earned. Review your expenses.", -data.NetBalance),
-			Category:    "spending",
-			Priority:    "high",
-			GeneratedAt: time.Now(),
-		})
-	}
-
-	return insights
+	return RuleBasedInsights(data)
 }
 
 // GenerateNotificationText creates a push notification from insights
@@ -318,3 +725,94 @@ func (s *GeminiService) GenerateNotificationText(insights []AIInsight) (title, b
 
 	return best.Title, best.Message
 }
+
+// Embedding model used for transaction similarity and semantic search
+const (
+	EmbeddingModel      = "text-embedding-004"
+	EmbeddingDimensions = 768
+)
+
+// Embed returns one embedding vector per text, in order. Texts are free
+// text from SMS or the user, so they're scrubbed of PII before being sent
+func (s *GeminiService) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if s.usage != nil {
+		if err := s.usage.Allow(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if !s.breaker.Allow() {
+		return nil, ErrAIUnavailable
+	}
+
+	type embedRequest struct {
+		Model   string  `json:"model"`
+		Content Content `json:"content"`
+	}
+	reqBody := struct {
+		Requests []embedRequest `json:"requests"`
+	}{}
+	estimatedTokens := 0
+	for _, text := range texts {
+		reqBody.Requests = append(reqBody.Requests, embedRequest{
+			Model:   "models/" + EmbeddingModel,
+			Content: Content{Parts: []Part{{Text: ScrubPII(text)}}},
+		})
+		estimatedTokens += len(text) / 4
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf(
+		"https://generativelanguage.googleapis.com/v1beta/models/%s:batchEmbedContents?key=%s",
+		EmbeddingModel,
+		s.apiKey,
+	)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		s.breaker.Failure()
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	s.recordOutcome(resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var embedResp struct {
+		Embeddings []struct {
+			Values []float32 `json:"values"`
+		} `json:"embeddings"`
+	}
+	if err := json.Unmarshal(body, &embedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embedResp.Embeddings))
+	}
+
+	// The embeddings API doesn't report usage, so record an estimate
+	if s.usage != nil {
+		s.usage.Record(ctx, uuid.NewString(), "embedding", EmbeddingModel, estimatedTokens, estimatedTokens)
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, e := range embedResp.Embeddings {
+		vectors[i] = e.Values
+	}
+	return vectors, nil
+}
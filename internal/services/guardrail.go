@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Why an insight was blocked
+const (
+	blockGuaranteedReturn = "guaranteed_return"
+	blockScam             = "scam"
+	blockLoan             = "loan"
+)
+
+// Who blocked an insight: the patterns below or the safety model
+const (
+	blockedByRules = "rules"
+	blockedByModel = "model"
+)
+
+// harmfulAdvicePatterns catch advice we never want to give, whatever the
+// prompt said: promises of returns, scam schemes and pushing users to borrow
+var harmfulAdvicePatterns = []struct {
+	reason  string
+	pattern *regexp.Regexp
+}{
+	{blockGuaranteedReturn, regexp.MustCompile(`(?i)\b(guaranteed?|assured|certain)\s+(returns?|profits?|income|interest|gains?)\b|\brisk[- ]free\b|\bdoubl(e|es|ing)\s+(your|their)\s+money\b|\b\d{2,}\s*%\s+(returns?|profits?|interest)\s+(a|per|every)\s+(day|week|month)\b`)},
+	{blockScam, regexp.MustCompile(`(?i)\b(pyramid|ponzi)\b|\bget[- ]rich[- ]quick\b|\bforex\s+signals?\b|\bsend\s+(money|\S+)\s+to\s+(receive|get)\b|\binvestment\s+(club|scheme)s?\b|\bmoney\s+(doubling|multiplication)\b`)},
+	{blockLoan, regexp.MustCompile(`(?i)\b(take|taking|get|getting)\s+(out\s+)?(a\s+|an\s+|another\s+)?(\w+\s+)?(loan|kaloba|advance)s?\b|\bborrow(ing)?\s+(money|from|to)\b|\b(moneylender|loan\s+shark)s?\b`)},
+}
+
+// adviceNegation, ahead of a match in the same sentence, makes it a warning
+// rather than advice, e.g. "avoid taking a loan"
+var adviceNegation = regexp.MustCompile(`(?i)\b(avoid|avoiding|don't|do not|never|instead of|rather than|without|beware|stay away|watch out|no such thing)\b`)
+
+var sentenceEnd = regexp.MustCompile(`[.!?]+\s+`)
+
+// harmfulAdvice returns why text reads as harmful financial advice, or ""
+func harmfulAdvice(text string) string {
+	for _, sentence := range sentenceEnd.Split(text, -1) {
+		for _, p := range harmfulAdvicePatterns {
+			loc := p.pattern.FindStringIndex(sentence)
+			if loc == nil || adviceNegation.MatchString(sentence[:loc[0]]) {
+				continue
+			}
+			return p.reason
+		}
+	}
+	return ""
+}
+
+// AdviceGuard blocks generated insights that read as harmful financial
+// advice before they reach users, and logs each block for review. Patterns
+// are always checked; with a safety model, insights they pass are also sent
+// to it in one cheap call
+type AdviceGuard struct {
+	db    *sql.DB
+	model string // Empty to check with the patterns alone
+}
+
+// NewAdviceGuard creates a guard; model is the Gemini model for the second
+// check, empty for none
+func NewAdviceGuard(db *sql.DB, model string) *AdviceGuard {
+	return &AdviceGuard{db: db, model: model}
+}
+
+// screenedInsight is an insight awaiting the guard's verdict
+type screenedInsight struct {
+	userID    string
+	index     int
+	text      string
+	reason    string
+	blockedBy string
+}
+
+// screen replaces insights that read as harmful advice with a rule-based
+// insight for the same user, or drops them when there's none left. data
+// holds what was sent for each user. A failed model check lets through what
+// the patterns passed
+func (s *GeminiService) screen(ctx context.Context, results map[string][]AIInsight, data map[string]SpendingData) {
+	if s.guard == nil {
+		return
+	}
+
+	var items []*screenedInsight
+	var unflagged []*screenedInsight
+	for userID, insights := range results {
+		for i, insight := range insights {
+			item := &screenedInsight{userID: userID, index: i, text: insight.Title + ". " + insight.Message}
+			if item.reason = harmfulAdvice(item.text); item.reason != "" {
+				item.blockedBy = blockedByRules
+			} else {
+				unflagged = append(unflagged, item)
+			}
+			items = append(items, item)
+		}
+	}
+
+	if s.guard.model != "" && len(unflagged) > 0 {
+		flagged, err := s.checkAdviceSafety(ctx, unflagged)
+		if err != nil {
+			log.Printf("⚠️ Advice safety check failed, using patterns only: %v", err)
+		}
+		for i, reason := range flagged {
+			unflagged[i].reason, unflagged[i].blockedBy = reason, blockedByModel
+		}
+	}
+
+	blocked := make(map[string]map[int]*screenedInsight)
+	for _, item := range items {
+		if item.reason == "" {
+			continue
+		}
+		if blocked[item.userID] == nil {
+			blocked[item.userID] = make(map[int]*screenedInsight)
+		}
+		blocked[item.userID][item.index] = item
+	}
+
+	for userID, byIndex := range blocked {
+		insights := results[userID]
+		shown := make(map[string]bool, len(insights))
+		for _, insight := range insights {
+			shown[insight.Title] = true
+		}
+		replacements := RuleBasedInsights(data[userID])
+
+		kept := make([]AIInsight, 0, len(insights))
+		for i, insight := range insights {
+			item, ok := byIndex[i]
+			if !ok {
+				kept = append(kept, insight)
+				continue
+			}
+			s.guard.record(ctx, userID, insight, item)
+
+			for len(replacements) > 0 && shown[replacements[0].Title] {
+				replacements = replacements[1:]
+			}
+			if len(replacements) == 0 {
+				continue
+			}
+			replacement := replacements[0]
+			replacements = replacements[1:]
+			shown[replacement.Title] = true
+			if insight.Meta != nil {
+				meta := *insight.Meta
+				meta.Source = InsightSourceFallback
+				replacement.Meta = &meta
+			}
+			kept = append(kept, replacement)
+		}
+		results[userID] = kept
+	}
+}
+
+// safetyCheckPrompt asks the safety model which tips to block
+const safetyCheckPrompt = `You check money tips before they are shown to users of a mobile money app in Southern Africa.
+
+Flag any tip that:
+- promises or implies guaranteed, risk-free or unusually high returns (guaranteed_return)
+- promotes or reads like an investment scam, such as a pyramid or Ponzi scheme or sending money to get more back (scam)
+- advises taking a loan, borrowing money or using a moneylender (loan)
+Tips that warn against these are fine.
+
+**Tips:**
+%s
+**Output Format (JSON array of flagged tips, [] if none):**
+[{"tip": 1, "reason": "guaranteed_return|scam|loan"}]
+
+Only output valid JSON, no additional text.`
+
+// checkAdviceSafety asks the safety model about the insights in one call and
+// returns the reason for each it flags, by position
+func (s *GeminiService) checkAdviceSafety(ctx context.Context, items []*screenedInsight) (map[int]string, error) {
+	var tips strings.Builder
+	fields := make(map[string][]string)
+	for i, item := range items {
+		tips.WriteString(fmt.Sprintf("%d. %s\n", i+1, item.text))
+		fields[item.userID] = []string{"generated_insights"}
+	}
+
+	ctx = WithAIFields(ctx, fields)
+	parts := []Part{{Text: fmt.Sprintf(safetyCheckPrompt, tips.String())}}
+	response, _, err := s.generateWith(ctx, s.guard.model, "advice_safety_check", parts, 50+20*len(items))
+	if err != nil {
+		return nil, err
+	}
+
+	var verdicts []struct {
+		Tip    int    `json:"tip"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(cleanJSONResponse(response)), &verdicts); err != nil {
+		return nil, fmt.Errorf("failed to parse safety check: %w", err)
+	}
+
+	flagged := make(map[int]string, len(verdicts))
+	for _, v := range verdicts {
+		if v.Tip < 1 || v.Tip > len(items) {
+			continue
+		}
+		switch v.Reason {
+		case blockGuaranteedReturn, blockScam, blockLoan:
+			flagged[v.Tip-1] = v.Reason
+		default:
+			flagged[v.Tip-1] = blockScam
+		}
+	}
+	return flagged, nil
+}
+
+// record logs a blocked insight for review
+func (g *AdviceGuard) record(ctx context.Context, userID string, insight AIInsight, item *screenedInsight) {
+	meta := insight.Meta
+	if meta == nil {
+		meta = &GenerationMeta{}
+	}
+	log.Printf("⚠️ Blocked insight for user %s (%s, by %s): %q", userID, item.reason, item.blockedBy, insight.Title)
+
+	_, err := g.db.ExecContext(ctx, `
+		INSERT INTO insight_blocks (user_id, title, message, reason, blocked_by, model, prompt_version, ai_call_id)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, '')::uuid)
+	`, userID, insight.Title, insight.Message, item.reason, item.blockedBy,
+		meta.Model, meta.PromptVersion, meta.CallID)
+	if err != nil {
+		log.Printf("⚠️ Failed to record blocked insight: %v", err)
+	}
+}
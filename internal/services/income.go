@@ -0,0 +1,47 @@
+package services
+
+import "math"
+
+const (
+	// Income is irregular when monthly totals typically stray further than
+	// this share from their mean (coefficient of variation). A steady salary
+	// sits well under it; gig work and trading usually don't
+	irregularIncomeVariation = 0.35
+	minIncomeMonths          = 3 // Fewer complete months can't tell bursty from steady
+)
+
+// IncomeProfile describes how steady a user's income is from month to month
+type IncomeProfile struct {
+	Irregular      bool    `json:"irregular"`
+	Variability    float64 `json:"variability"` // Coefficient of variation of monthly income
+	AverageMonthly float64 `json:"average_monthly"`
+	Months         int     `json:"months"` // Complete months considered
+}
+
+// AnalyzeIncome profiles income from monthly totals, oldest first. Months
+// without income count as zero, so callers should leave out the months
+// before the user's history starts
+func AnalyzeIncome(monthly []float64) IncomeProfile {
+	profile := IncomeProfile{Months: len(monthly)}
+	if len(monthly) == 0 {
+		return profile
+	}
+
+	sum := 0.0
+	for _, m := range monthly {
+		sum += m
+	}
+	mean := sum / float64(len(monthly))
+	profile.AverageMonthly = mean
+	if mean <= 0 {
+		return profile
+	}
+
+	variance := 0.0
+	for _, m := range monthly {
+		variance += (m - mean) * (m - mean)
+	}
+	profile.Variability = math.Sqrt(variance/float64(len(monthly))) / mean
+	profile.Irregular = len(monthly) >= minIncomeMonths && profile.Variability > irregularIncomeVariation
+	return profile
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// InsightRule turns spending data into at most one insight
+type InsightRule struct {
+	Name string
+	Eval func(data SpendingData) *AIInsight
+}
+
+// Thresholds for the rule-based insight engine
+const (
+	categorySpikeMultiplier = 2.0  // spend vs 30-day daily average
+	categorySpikeMinAmount  = 50.0 // ignore spikes on tiny amounts
+	noIncomeStreakDays      = 14
+	monthlyPaceWarnRatio    = 0.8 // month-to-date expenses vs income
+	maxRuleInsights         = 3
+)
+
+// feeCategories are the categories operators' transaction charges are filed under
+var feeCategories = map[string]bool{
+	"FEES":    true,
+	"FEE":     true,
+	"CHARGES": true,
+}
+
+// DefaultInsightRules is the rule set used when Gemini is unavailable
+var DefaultInsightRules = []InsightRule{
+	{Name: "monthly_pace", Eval: monthlyPaceRule},
+	{Name: "category_spike", Eval: categorySpikeRule},
+	{Name: "no_income_streak", Eval: noIncomeStreakRule},
+	{Name: "fees", Eval: feesRule},
+	{Name: "savings", Eval: savingsRule},
+	{Name: "savings_interest", Eval: savingsInterestRule},
+	{Name: "net_balance", Eval: netBalanceRule},
+}
+
+var priorityRank = map[string]int{"high": 0, "medium": 1, "low": 2}
+
+// RuleBasedInsights evaluates the default rules and returns the most important insights
+func RuleBasedInsights(data SpendingData) []AIInsight {
+	meta := &GenerationMeta{Source: InsightSourceRules}
+	insights := []AIInsight{}
+	for _, rule := range DefaultInsightRules {
+		if insight := rule.Eval(data); insight != nil {
+			insight.GeneratedAt = time.Now()
+			insight.Meta = meta
+			insights = append(insights, *insight)
+		}
+	}
+
+	// Rules are listed in tie-break order, so a stable sort keeps it within a priority
+	sort.SliceStable(insights, func(i, j int) bool {
+		return priorityRank[insights[i].Priority] < priorityRank[insights[j].Priority]
+	})
+	if len(insights) > maxRuleInsights {
+		insights = insights[:maxRuleInsights]
+	}
+
+	return insights
+}
+
+// monthlyPaceRule warns when this month's spending is catching up with income
+func monthlyPaceRule(data SpendingData) *AIInsight {
+	if data.MonthIncome <= 0 || data.MonthExpenses < data.MonthIncome*monthlyPaceWarnRatio {
+		return nil
+	}
+
+	percent := data.MonthExpenses / data.MonthIncome * 100
+	if percent >= 100 {
+		return &AIInsight{
+			Title:    "🚨 Over This Month's Income",
+			Message:  fmt.Sprintf("You've spent %.0f%% of what came in this month. Pause non-essential spending until your next income.", percent),
+			Category: "spending",
+			Priority: "high",
+		}
+	}
+	return &AIInsight{
+		Title:    "⚠️ Monthly Budget Check",
+		Message:  fmt.Sprintf("You've already spent %.0f%% of this month's income. Plan the rest of the month carefully.", percent),
+		Category: "spending",
+		Priority: "high",
+	}
+}
+
+// categorySpikeRule flags the category with the biggest jump over its usual daily spend
+func categorySpikeRule(data SpendingData) *AIInsight {
+	var spikeCategory string
+	var spikeRatio float64
+
+	for category, amount := range data.ByCategory {
+		average := data.CategoryDailyAverage[category]
+		if average <= 0 || amount < categorySpikeMinAmount {
+			continue
+		}
+		ratio := amount / average
+		if ratio >= categorySpikeMultiplier && ratio > spikeRatio {
+			spikeCategory, spikeRatio = category, ratio
+		}
+	}
+
+	if spikeCategory == "" {
+		return nil
+	}
+
+	return &AIInsight{
+		Title: "📊 Unusual " + spikeCategory + " Spending",
+		Message: fmt.Sprintf("You spent %s on %s, about %.0fx your usual daily amount. Check this was planned.",
+			data.AmountFormat().Format(data.ByCategory[spikeCategory]), spikeCategory, spikeRatio),
+		Category: "anomaly",
+		Priority: "medium",
+	}
+}
+
+// noIncomeStreakRule notices when no income has arrived for a while
+func noIncomeStreakRule(data SpendingData) *AIInsight {
+	if data.DaysSinceIncome < noIncomeStreakDays {
+		return nil
+	}
+
+	return &AIInsight{
+		Title:    "⏳ No Income Recently",
+		Message:  fmt.Sprintf("No income has come in for %d days. Keep spending to essentials until money comes in.", data.DaysSinceIncome),
+		Category: "spending",
+		Priority: "medium",
+	}
+}
+
+// feesRule totals transaction charges for the period
+func feesRule(data SpendingData) *AIInsight {
+	var fees float64
+	for category, amount := range data.ByCategory {
+		if feeCategories[category] {
+			fees += amount
+		}
+	}
+	if fees <= 0 {
+		return nil
+	}
+
+	return &AIInsight{
+		Title:    "💸 Transaction Fees",
+		Message:  fmt.Sprintf("You paid %s in fees this period. Fewer, larger transfers usually cost less in charges.", data.AmountFormat().Format(fees)),
+		Category: "tip",
+		Priority: "low",
+	}
+}
+
+// savingsRule praises savings deposits
+func savingsRule(data SpendingData) *AIInsight {
+	if data.SavingsDeposits <= 0 {
+		return nil
+	}
+
+	return &AIInsight{
+		Title:    "💰 Great Saving Habit!",
+		Message:  fmt.Sprintf("You've saved %s this period. Keep it up!", data.AmountFormat().Format(data.SavingsDeposits)),
+		Category: "savings",
+		Priority: "high",
+	}
+}
+
+// savingsInterestRule reports interest earned on savings products
+func savingsInterestRule(data SpendingData) *AIInsight {
+	if data.InterestEarned <= 0 {
+		return nil
+	}
+
+	return &AIInsight{
+		Title:    "🌱 Interest Earned",
+		Message:  fmt.Sprintf("Your savings earned %s in interest this period. Money you leave saved keeps growing!", data.AmountFormat().Format(data.InterestEarned)),
+		Category: "savings",
+		Priority: "low",
+	}
+}
+
+// netBalanceRule comments on income vs expenses for the period
+func netBalanceRule(data SpendingData) *AIInsight {
+	if data.NetBalance > 0 {
+		return &AIInsight{
+			Title:    "📈 Positive Balance",
+			Message:  fmt.Sprintf("Your income exceeds expenses by %s. Consider saving the surplus!", data.AmountFormat().Format(data.NetBalance)),
+			Category: "tip",
+			Priority: "medium",
+		}
+	}
+	if data.NetBalance < 0 {
+		return &AIInsight{
+			Title:    "⚠️ Spending Alert",
+			Message:  fmt.Sprintf("You've spent %s more than earned. Review your expenses.", data.AmountFormat().Format(-data.NetBalance)),
+			Category: "spending",
+			Priority: "high",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+// JobFunc does the work for a background job and returns a JSON-serializable result
+type JobFunc func(ctx context.Context, job *models.Job) (interface{}, error)
+
+// JobType describes a kind of background job and how users are told it finished
+type JobType struct {
+	Name      string
+	Run       JobFunc
+	DoneTitle string
+	DoneBody  string
+}
+
+// Notifier sends a notification to a user within tx. It's implemented by the
+// notifications package, which can't be imported here
+type Notifier interface {
+	Send(tx *sql.Tx, userID string, n models.Notification) error
+}
+
+// JobService runs background jobs (exports, imports, backfills) from the jobs table
+// Jobs are claimed with FOR UPDATE SKIP LOCKED so several instances can share the queue
+type JobService struct {
+	db       *sql.DB
+	notifier Notifier
+	realtime *RealtimeHub
+	workers  int
+
+	mu    sync.RWMutex
+	types map[string]JobType
+	wake  chan struct{}
+}
+
+const (
+	jobPollInterval = 5 * time.Second
+	jobStaleAfter   = 30 * time.Minute
+	jobMaxAttempts  = 3
+)
+
+// NewJobService creates a job service with the given worker pool size
+func NewJobService(db *sql.DB, notifier Notifier, realtime *RealtimeHub, workers int) *JobService {
+	if workers < 1 {
+		workers = 1
+	}
+	return &JobService{
+		db:       db,
+		notifier: notifier,
+		realtime: realtime,
+		workers:  workers,
+		types:    make(map[string]JobType),
+		wake:     make(chan struct{}, workers),
+	}
+}
+
+// Register adds a job type the workers can process
+func (s *JobService) Register(jobType JobType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.types[jobType.Name] = jobType
+}
+
+// Enqueue stores a pending job and wakes a worker. userID may be empty for system jobs
+func (s *JobService) Enqueue(userID, jobType string, params interface{}) (uuid.UUID, error) {
+	s.mu.RLock()
+	_, ok := s.types[jobType]
+	s.mu.RUnlock()
+	if !ok {
+		return uuid.Nil, fmt.Errorf("unknown job type %q", jobType)
+	}
+
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to marshal job params: %w", err)
+	}
+
+	id := uuid.New()
+	_, err = s.db.Exec(`
+		INSERT INTO jobs (id, user_id, type, status, params)
+		VALUES ($1, $2, $3, $4, $5)
+	`, id, nullableString(userID), jobType, models.JobStatusPending, paramsJSON)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return id, nil
+}
+
+// EnqueueUnique enqueues a job unless the user already has one of the same type
+// waiting to run, in which case the existing job's ID is returned
+func (s *JobService) EnqueueUnique(userID, jobType string, params interface{}) (uuid.UUID, error) {
+	var existing uuid.UUID
+	err := s.db.QueryRow(`
+		SELECT id FROM jobs
+		WHERE user_id IS NOT DISTINCT FROM $1 AND type = $2 AND status = $3
+		LIMIT 1
+	`, nullableString(userID), jobType, models.JobStatusPending).Scan(&existing)
+	if err == nil {
+		return existing, nil
+	}
+	if err != sql.ErrNoRows {
+		return uuid.Nil, fmt.Errorf("failed to check pending jobs: %w", err)
+	}
+
+	return s.Enqueue(userID, jobType, params)
+}
+
+// Registered reports whether a job type has been registered
+func (s *JobService) Registered(jobType string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.types[jobType]
+	return ok
+}
+
+// Get loads a job by ID
+func (s *JobService) Get(id string) (*models.Job, error) {
+	var job models.Job
+	var userID uuid.NullUUID
+	var progress, result []byte
+	var errMsg sql.NullString
+	var startedAt, completedAt sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT id, user_id, type, status, params, progress, result, error, attempts, created_at, started_at, completed_at
+		FROM jobs
+		WHERE id = $1
+	`, id).Scan(&job.ID, &userID, &job.Type, &job.Status, &job.Params, &progress, &result, &errMsg,
+		&job.Attempts, &job.CreatedAt, &startedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID.Valid {
+		job.UserID = &userID.UUID
+	}
+	if len(progress) > 0 {
+		job.Progress = progress
+	}
+	if len(result) > 0 {
+		job.Result = result
+	}
+	job.Error = errMsg.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+
+	return &job, nil
+}
+
+// ReportProgress records how far a running job has got. Jobs that run longer
+// than jobStaleAfter must report at least that often, or they're reclaimed
+func (s *JobService) ReportProgress(jobID uuid.UUID, progress interface{}) error {
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		"UPDATE jobs SET progress = $1, progress_at = NOW() WHERE id = $2",
+		progressJSON, jobID,
+	)
+	return err
+}
+
+// Start launches the worker pool; workers stop when ctx is cancelled
+func (s *JobService) Start(ctx context.Context) {
+	log.Printf("⚙️ Job workers started (%d)", s.workers)
+	for i := 0; i < s.workers; i++ {
+		Supervise(ctx, fmt.Sprintf("job worker %d", i+1), s.worker)
+	}
+}
+
+func (s *JobService) worker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before waiting again
+		for s.runNext(ctx) {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext claims and runs one job, returning false when the queue is empty
+func (s *JobService) runNext(ctx context.Context) bool {
+	job, err := s.claim()
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Printf("❌ Failed to claim job: %v", err)
+		return false
+	}
+
+	s.mu.RLock()
+	jobType, ok := s.types[job.Type]
+	s.mu.RUnlock()
+
+	var result interface{}
+	if !ok {
+		err = fmt.Errorf("no handler registered for job type %q", job.Type)
+	} else {
+		result, err = s.run(ctx, jobType, job)
+	}
+
+	s.finish(job, jobType, result, err)
+	return true
+}
+
+// claim marks the oldest pending job (or a stale running one, which hasn't
+// started or reported progress for jobStaleAfter) as running
+func (s *JobService) claim() (*models.Job, error) {
+	var job models.Job
+	var userID uuid.NullUUID
+
+	err := s.db.QueryRow(`
+		UPDATE jobs
+		SET status = $1, started_at = NOW(), progress_at = NULL, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = $2 OR (status = $1 AND COALESCE(progress_at, started_at) < $3))
+			AND attempts < $4
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, type, params, attempts, created_at
+	`, models.JobStatusRunning, models.JobStatusPending, time.Now().Add(-jobStaleAfter), jobMaxAttempts,
+	).Scan(&job.ID, &userID, &job.Type, &job.Params, &job.Attempts, &job.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID.Valid {
+		job.UserID = &userID.UUID
+	}
+	job.Status = models.JobStatusRunning
+	return &job, nil
+}
+
+// run executes a job, converting panics into job failures
+func (s *JobService) run(ctx context.Context, jobType JobType, job *models.Job) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportPanic("job "+job.Type, r)
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return jobType.Run(ctx, job)
+}
+
+// finish records the outcome and notifies the job owner
+func (s *JobService) finish(job *models.Job, jobType JobType, result interface{}, runErr error) {
+	status := models.JobStatusCompleted
+	var resultJSON []byte
+	var errMsg interface{}
+
+	if runErr == nil {
+		var err error
+		if resultJSON, err = json.Marshal(result); err != nil {
+			runErr = fmt.Errorf("failed to marshal job result: %w", err)
+		}
+	}
+	if runErr != nil {
+		status = models.JobStatusFailed
+		resultJSON = nil
+		errMsg = runErr.Error()
+		log.Printf("❌ Job %s (%s) failed: %v", job.ID, job.Type, runErr)
+	} else {
+		log.Printf("✅ Job %s (%s) completed", job.ID, job.Type)
+	}
+
+	// The owner's notification is queued with the result, so a crash can't lose it
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("❌ Failed to record job %s result: %v", job.ID, err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE jobs SET status = $1, result = $2, error = $3, completed_at = NOW()
+		WHERE id = $4
+	`, status, resultJSON, errMsg, job.ID)
+	if err == nil && job.UserID != nil && jobType.DoneTitle != "" {
+		err = s.notifier.Send(tx, job.UserID.String(), models.Notification{
+			Type: models.NotificationUpdates,
+			Push: ownerNotification(job, jobType, status),
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Failed to record job %s result: %v", job.ID, err)
+		return
+	}
+
+	if job.UserID != nil && s.realtime != nil {
+		s.realtime.Publish(job.UserID.String(), RealtimeJobCompleted, map[string]string{
+			"job_id": job.ID.String(),
+			"type":   job.Type,
+			"status": status,
+		})
+	}
+}
+
+// ownerNotification is the completion notification for the user who requested the job
+func ownerNotification(job *models.Job, jobType JobType, status string) models.PushNotification {
+	title, body := jobType.DoneTitle, jobType.DoneBody
+	if status == models.JobStatusFailed {
+		title = "⚠️ Something went wrong"
+		body = "We couldn't finish your request. Please try again later."
+	}
+
+	return models.PushNotification{
+		Title: title,
+		Body:  body,
+		Data: map[string]string{
+			"type":   "job_complete",
+			"job_id": job.ID.String(),
+			"status": status,
+		},
+	}
+}
+
+// nullableString maps "" to NULL for optional columns
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"time"
+)
+
+const (
+	leaderRetryInterval = 15 * time.Second // How often a follower tries to take over
+	leaderCheckInterval = 10 * time.Second // How often the leader checks it still holds the lock
+)
+
+// RunAsLeader runs fn only on the one instance holding the named leader lock,
+// so scheduled work isn't repeated by every replica. Other instances wait and
+// take over within leaderRetryInterval if the leader goes away. The lock is a
+// session-level Postgres advisory lock held on a dedicated connection, so it
+// is released by the database if the leader dies. fn's context is cancelled
+// if the connection, and with it the lock, is lost. Blocks until ctx is cancelled
+func RunAsLeader(ctx context.Context, db *sql.DB, name string, fn func(ctx context.Context)) {
+	key := leaderLockKey(name)
+	following := false
+
+	for ctx.Err() == nil {
+		led, err := lead(ctx, db, key, name, fn)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("⚠️ Leader lock for %s: %v", name, err)
+		}
+		if !led && !following {
+			log.Printf("⏳ Another instance runs the %s, standing by", name)
+		}
+		following = !led
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(leaderRetryInterval):
+		}
+	}
+}
+
+// lead tries to take the lock and, if it does, runs fn until fn returns or the lock is lost
+func lead(ctx context.Context, db *sql.DB, key int64, name string, fn func(ctx context.Context)) (bool, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		return false, err
+	}
+	if !acquired {
+		return false, nil
+	}
+	defer releaseLeaderLock(conn, key)
+
+	log.Printf("👑 This instance now runs the %s", name)
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer recoverPanic(name)
+		fn(leaderCtx)
+	}()
+
+	ticker := time.NewTicker(leaderCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return true, nil
+		case <-ticker.C:
+			if err := conn.PingContext(ctx); err != nil && ctx.Err() == nil {
+				cancel()
+				<-done
+				return true, fmt.Errorf("lost the lock: %w", err)
+			}
+		}
+	}
+}
+
+// releaseLeaderLock unlocks before the connection goes back to the pool. If
+// that fails the connection is discarded, which releases the lock too
+func releaseLeaderLock(conn *sql.Conn, key int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key); err != nil {
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+}
+
+// leaderLockKey maps a lock name to an advisory lock key
+func leaderLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("kwacha:leader:" + name))
+	return int64(h.Sum64())
+}
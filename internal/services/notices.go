@@ -0,0 +1,34 @@
+package services
+
+import "regexp"
+
+// Kinds of operator notice: SMS operators broadcast that aren't transactions
+const (
+	NoticeFeeChange   = "fee_change"
+	NoticeMaintenance = "maintenance"
+)
+
+var (
+	// Wording only transaction confirmations use; a message with any of it
+	// is never a notice, however much it talks about fees
+	transactionWording = regexp.MustCompile(`(?i)\b(?:you have (?:sent|received|paid|withdrawn|bought|deposited)|txn\s*id|trans(?:action)?\s*id|new balance|avail(?:able)?\s*bal)`)
+
+	feeChangeNotice = regexp.MustCompile(`(?i)\b(?:fees?|charges?|tariffs?|levy)\b.{0,80}\b(?:chang\w*|revis\w*|increas\w*|reduc\w*|adjust\w*|new|effective)\b` +
+		`|\b(?:new|revised|reduced|increased)\s+(?:\w+\s+){0,2}(?:fees?|charges?|tariffs?)\b`)
+	maintenanceNotice = regexp.MustCompile(`(?i)\b(?:maintenance|system upgrade|downtime|service (?:interruption|disruption|outage)|(?:temporarily |will be )unavailable)\b`)
+)
+
+// ClassifyNotice recognizes operator announcements of fee changes or
+// maintenance windows, returning the notice kind or "" for anything else
+func ClassifyNotice(text string) string {
+	if transactionWording.MatchString(text) {
+		return ""
+	}
+	switch {
+	case maintenanceNotice.MatchString(text):
+		return NoticeMaintenance
+	case feeChangeNotice.MatchString(text):
+		return NoticeFeeChange
+	}
+	return ""
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"firebase.google.com/go/v4/messaging"
+	"github.com/google/uuid"
+	"github.com/kwachatracker/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	outboxStatusPending = "pending"
+	outboxStatusSent    = "sent"
+	outboxStatusFailed  = "failed"
+)
+
+const (
+	outboxPollInterval = 5 * time.Second
+	outboxBatchSize    = fcmBatchLimit   // Claimed and sent together in one FCM batch
+	outboxLease        = 5 * time.Minute // A claimed row is retried after this if its sender died
+	outboxMaxAttempts  = 5
+	outboxRetention    = 7 * 24 * time.Hour // Sent rows are kept this long for debugging
+)
+
+// NotificationOutbox makes push notifications survive a crash between the
+// database write that triggers them and the FCM send. Notifications are
+// written in the caller's transaction and sent by a dispatcher, so each is
+// delivered at least once. Rows are claimed with FOR UPDATE SKIP LOCKED so
+// several instances can share the outbox
+type NotificationOutbox struct {
+	db       *sql.DB
+	fcm      *FCMService
+	settings *Settings
+}
+
+// NewNotificationOutbox creates an outbox; with fcm nil nothing is queued.
+// Sending pauses while the notifications feature is switched off
+func NewNotificationOutbox(db *sql.DB, fcm *FCMService, settings *Settings) *NotificationOutbox {
+	return &NotificationOutbox{db: db, fcm: fcm, settings: settings}
+}
+
+// Enabled reports whether pushes are sent at all
+func (o *NotificationOutbox) Enabled() bool {
+	return o.fcm != nil
+}
+
+// EnqueueAt queues a push for a user within tx, to be sent no earlier than
+// at. Users without an FCM token are skipped; the token is read again when
+// the notification is sent. Send through the notifications package instead,
+// which applies the user's preferences and records the notification
+func (o *NotificationOutbox) EnqueueAt(tx *sql.Tx, userID string, n models.PushNotification, at time.Time) error {
+	if o.fcm == nil {
+		return nil
+	}
+
+	notificationJSON, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO notification_outbox (user_id, notification, next_attempt_at)
+		SELECT id, $2, $3 FROM users
+		WHERE id = $1 AND fcm_token IS NOT NULL AND fcm_token <> ''
+	`, userID, notificationJSON, at)
+	if err != nil {
+		return fmt.Errorf("failed to queue notification: %w", err)
+	}
+	return nil
+}
+
+// Start runs the dispatcher until ctx is cancelled. It does nothing without FCM
+func (o *NotificationOutbox) Start(ctx context.Context) {
+	if o.fcm == nil {
+		return
+	}
+	Supervise(ctx, "notification outbox", o.dispatch)
+}
+
+func (o *NotificationOutbox) dispatch(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		// Drain due notifications before waiting again; while notifications
+		// are switched off they stay queued
+		for ctx.Err() == nil && o.settings.FeatureEnabled(FeatureNotifications) {
+			if o.sendBatch(ctx) < outboxBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastPrune) > time.Hour {
+			o.prune()
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// outboxEntry is a claimed notification
+type outboxEntry struct {
+	id           uuid.UUID
+	userID       string
+	notification models.PushNotification
+	attempts     int
+	fcmToken     sql.NullString
+}
+
+// sendBatch claims due notifications and sends them in one FCM batch,
+// returning how many were claimed
+func (o *NotificationOutbox) sendBatch(ctx context.Context) int {
+	entries, err := o.claim()
+	if err != nil {
+		log.Printf("❌ Failed to claim outbox notifications: %v", err)
+		return 0
+	}
+
+	var sendable []outboxEntry
+	var tokens []string
+	var notifications []models.PushNotification
+	for _, e := range entries {
+		if !e.fcmToken.Valid || e.fcmToken.String == "" {
+			o.markFailed(e, fmt.Errorf("user has no FCM token"))
+			continue
+		}
+		sendable = append(sendable, e)
+		tokens = append(tokens, e.fcmToken.String)
+		notifications = append(notifications, e.notification)
+	}
+	if len(sendable) == 0 || ctx.Err() != nil {
+		// Unsent rows are picked up again once their lease expires
+		return len(entries)
+	}
+
+	start := time.Now()
+	errs := o.fcm.SendBatch(ctx, tokens, notifications)
+	elapsed := time.Since(start)
+
+	var sent []string
+	failed, retrying := 0, 0
+	for i, e := range sendable {
+		if errs[i] == nil {
+			sent = append(sent, e.id.String())
+		} else if o.settle(e, errs[i]) {
+			retrying++
+		} else {
+			failed++
+		}
+	}
+	if len(sent) > 0 {
+		_, err = o.db.Exec(`
+			UPDATE notification_outbox SET status = $1, sent_at = NOW(), last_error = NULL
+			WHERE id = ANY($2)
+		`, outboxStatusSent, pq.Array(sent))
+		if err != nil {
+			// The rows are sent again after their lease; at-least-once allows the duplicates
+			log.Printf("❌ Failed to mark %d outbox notifications sent: %v", len(sent), err)
+		}
+	}
+
+	log.Printf("📤 Push batch: %d sent, %d failed, %d retrying in %s (%.0f/s)",
+		len(sent), failed, retrying, elapsed.Round(time.Millisecond), float64(len(sendable))/elapsed.Seconds())
+	return len(entries)
+}
+
+// claim leases a batch of due notifications by pushing their next attempt past the lease
+func (o *NotificationOutbox) claim() ([]outboxEntry, error) {
+	now := time.Now()
+	rows, err := o.db.Query(`
+		UPDATE notification_outbox o
+		SET attempts = o.attempts + 1, next_attempt_at = $1
+		FROM users u
+		WHERE u.id = o.user_id AND o.id IN (
+			SELECT id FROM notification_outbox
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING o.id, o.user_id, o.notification, o.attempts, u.fcm_token
+	`, now.Add(outboxLease), outboxStatusPending, now, outboxBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []outboxEntry
+	for rows.Next() {
+		var e outboxEntry
+		var notificationJSON []byte
+		if err := rows.Scan(&e.id, &e.userID, &notificationJSON, &e.attempts, &e.fcmToken); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(notificationJSON, &e.notification); err != nil {
+			o.markFailed(e, fmt.Errorf("invalid notification: %w", err))
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// settle handles a failed send: it's retried with backoff unless the error
+// is permanent or the attempts are used up. Returns whether it will be retried
+func (o *NotificationOutbox) settle(e outboxEntry, sendErr error) bool {
+	if messaging.IsUnregistered(sendErr) || messaging.IsInvalidArgument(sendErr) || e.attempts >= outboxMaxAttempts {
+		o.markFailed(e, sendErr)
+		return false
+	}
+
+	backoff := time.Duration(e.attempts*e.attempts) * 30 * time.Second
+	_, err := o.db.Exec(`
+		UPDATE notification_outbox SET next_attempt_at = $1, last_error = $2
+		WHERE id = $3
+	`, time.Now().Add(backoff), sendErr.Error(), e.id)
+	if err != nil {
+		log.Printf("❌ Failed to reschedule outbox notification %s: %v", e.id, err)
+	}
+	return true
+}
+
+func (o *NotificationOutbox) markFailed(e outboxEntry, cause error) {
+	log.Printf("⚠️ Giving up on notification %s for user %s after %d attempts: %v", e.id, e.userID, e.attempts, cause)
+	_, err := o.db.Exec(`
+		UPDATE notification_outbox SET status = $1, last_error = $2
+		WHERE id = $3
+	`, outboxStatusFailed, cause.Error(), e.id)
+	if err != nil {
+		log.Printf("❌ Failed to mark outbox notification %s failed: %v", e.id, err)
+	}
+}
+
+// prune deletes sent notifications past the retention window
+func (o *NotificationOutbox) prune() {
+	_, err := o.db.Exec(`
+		DELETE FROM notification_outbox WHERE status = $1 AND sent_at < $2
+	`, outboxStatusSent, time.Now().Add(-outboxRetention))
+	if err != nil {
+		log.Printf("⚠️ Failed to prune notification outbox: %v", err)
+	}
+}
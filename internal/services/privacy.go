@@ -0,0 +1,68 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"strings"
+)
+
+// PrivacyPolicy calibrates the differential-privacy noise added to
+// aggregates released outside the company: the partner API and spending
+// benchmarks. Every released figure gets Laplace noise scaled to how much
+// one user can change it, so a figure reveals little about whether any one
+// user is in it. Callers clamp each user's contribution to MaxTransactions
+// and MaxVolume so that change is bounded.
+//
+// Noise is derived from Key and the figure's identity rather than drawn
+// fresh, so asking for the same figure again returns the same noise instead
+// of samples that could be averaged away
+type PrivacyPolicy struct {
+	Key             []byte
+	Epsilon         float64 // Privacy loss per released figure; lower is noisier
+	MaxTransactions int     // Transactions one user can add to a figure
+	MaxVolume       float64 // Kwacha one user can add to a figure
+}
+
+// NewPrivacyPolicy returns a policy keyed by key
+func NewPrivacyPolicy(key string, epsilon float64, maxTransactions int, maxVolume float64) *PrivacyPolicy {
+	return &PrivacyPolicy{
+		Key:             []byte(key),
+		Epsilon:         epsilon,
+		MaxTransactions: maxTransactions,
+		MaxVolume:       maxVolume,
+	}
+}
+
+// laplace returns Laplace(0, scale) noise for the figure identified by id
+func (p *PrivacyPolicy) laplace(scale float64, id []string) float64 {
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte(strings.Join(id, "\x00")))
+	sum := mac.Sum(nil)
+
+	// Uniform in (-0.5, 0.5) from the top 53 bits, never reaching either end
+	u := (float64(binary.BigEndian.Uint64(sum[:8])>>11)+0.5)/(1<<53) - 0.5
+	if u < 0 {
+		return scale * math.Log(1+2*u)
+	}
+	return -scale * math.Log(1-2*u)
+}
+
+// Count releases a count one user can change by at most sensitivity
+func (p *PrivacyPolicy) Count(n int, sensitivity float64, id ...string) int {
+	noisy := math.Round(float64(n) + p.laplace(sensitivity/p.Epsilon, id))
+	if noisy < 0 {
+		return 0
+	}
+	return int(noisy)
+}
+
+// Amount releases a kwacha figure one user can change by at most sensitivity
+func (p *PrivacyPolicy) Amount(v, sensitivity float64, id ...string) float64 {
+	noisy := v + p.laplace(sensitivity/p.Epsilon, id)
+	if noisy < 0 {
+		return 0
+	}
+	return math.Round(noisy*100) / 100
+}
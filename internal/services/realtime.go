@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Realtime event types pushed to the app over WebSocket
+const (
+	RealtimeConnected      = "connected"
+	RealtimePing           = "ping"
+	RealtimeInsightCreated = "insight_created"
+	RealtimeJobCompleted   = "job_completed"
+)
+
+const (
+	realtimeChannel            = "kwacha:realtime"
+	realtimeBuffer             = 16 // Events queued per session before new ones are dropped
+	realtimeMaxSessionsPerUser = 5
+)
+
+// ErrTooManySessions is returned when a user already has the maximum number of open sessions
+var ErrTooManySessions = errors.New("too many realtime sessions")
+
+// RealtimeEvent is one message pushed to a user's app sessions
+type RealtimeEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+	At   time.Time   `json:"at"`
+}
+
+// realtimeEnvelope carries an event between instances over Redis
+type realtimeEnvelope struct {
+	UserID string          `json:"user_id"`
+	Event  json.RawMessage `json:"event"`
+}
+
+// RealtimeHub delivers events to the connected sessions of each user.
+// Without Redis it only reaches sessions on this instance; with Redis every
+// event goes through a pub/sub channel so sessions on any replica get it
+type RealtimeHub struct {
+	redis *redis.Client // Nil for a single instance
+
+	mu       sync.RWMutex
+	sessions map[string]map[chan RealtimeEvent]struct{}
+}
+
+// NewRealtimeHub creates a hub; rdb may be nil for a single instance
+func NewRealtimeHub(rdb *redis.Client) *RealtimeHub {
+	return &RealtimeHub{
+		redis:    rdb,
+		sessions: make(map[string]map[chan RealtimeEvent]struct{}),
+	}
+}
+
+// Start subscribes to the Redis channel until ctx is cancelled. It does nothing without Redis
+func (h *RealtimeHub) Start(ctx context.Context) {
+	if h.redis == nil {
+		log.Println("📡 Realtime events are in-process only (REDIS_URL not set)")
+		return
+	}
+	Supervise(ctx, "realtime subscriber", h.subscribe)
+}
+
+// Subscribe registers a session for a user. Call the returned function when the session ends
+func (h *RealtimeHub) Subscribe(userID string) (<-chan RealtimeEvent, func(), error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.sessions[userID]) >= realtimeMaxSessionsPerUser {
+		return nil, nil, ErrTooManySessions
+	}
+	if h.sessions[userID] == nil {
+		h.sessions[userID] = make(map[chan RealtimeEvent]struct{})
+	}
+	ch := make(chan RealtimeEvent, realtimeBuffer)
+	h.sessions[userID][ch] = struct{}{}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.sessions[userID], ch)
+		if len(h.sessions[userID]) == 0 {
+			delete(h.sessions, userID)
+		}
+	}
+	return ch, unsubscribe, nil
+}
+
+// Publish sends an event to every session of a user. Delivery is best-effort:
+// the app still fetches state on launch, this only saves it from polling
+func (h *RealtimeHub) Publish(userID, eventType string, data interface{}) {
+	event := RealtimeEvent{Type: eventType, Data: data, At: time.Now()}
+	if h.redis == nil {
+		h.deliver(userID, event)
+		return
+	}
+
+	if err := h.publishRedis(userID, event); err != nil {
+		// Sessions on this instance still get it
+		log.Printf("⚠️ Realtime publish via Redis failed: %v", err)
+		h.deliver(userID, event)
+	}
+}
+
+// deliver hands an event to this instance's sessions for the user, dropping it for any that are backed up
+func (h *RealtimeHub) deliver(userID string, event RealtimeEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.sessions[userID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (h *RealtimeHub) publishRedis(userID string, event RealtimeEvent) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(realtimeEnvelope{UserID: userID, Event: eventJSON})
+	if err != nil {
+		return err
+	}
+
+	return h.redis.Publish(context.Background(), realtimeChannel, payload).Err()
+}
+
+// subscribe listens on the Redis channel, reconnecting until ctx is cancelled
+func (h *RealtimeHub) subscribe(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := h.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️ Realtime subscriber disconnected: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(redisRetryDelay):
+		}
+	}
+}
+
+func (h *RealtimeHub) listen(ctx context.Context) error {
+	pubsub := h.redis.Subscribe(ctx, realtimeChannel)
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	log.Println("📡 Realtime events fanned out via Redis")
+
+	for {
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+
+		var envelope realtimeEnvelope
+		var event RealtimeEvent
+		if json.Unmarshal([]byte(msg.Payload), &envelope) != nil || json.Unmarshal(envelope.Event, &event) != nil {
+			continue
+		}
+		h.deliver(envelope.UserID, event)
+	}
+}
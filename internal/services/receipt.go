@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// receiptPromptVersion identifies the receipt extraction prompt; bump it when the prompt changes
+const receiptPromptVersion = "receipt-v2"
+
+// ReceiptLineItem is one line on a scanned receipt
+type ReceiptLineItem struct {
+	Description string   `json:"description"`
+	Quantity    float64  `json:"quantity,omitempty"`
+	UnitPrice   *float64 `json:"unit_price,omitempty"`
+	Amount      float64  `json:"amount"`
+}
+
+// ReceiptData is the structured content Gemini extracts from a receipt photo
+type ReceiptData struct {
+	Merchant  string            `json:"merchant"`
+	Date      string            `json:"date,omitempty"` // YYYY-MM-DD as printed
+	Currency  string            `json:"currency,omitempty"`
+	Total     *float64          `json:"total,omitempty"`
+	Tax       *float64          `json:"tax,omitempty"`
+	LineItems []ReceiptLineItem `json:"line_items"`
+}
+
+// ExtractReceipt reads a receipt photo from a shop in country and returns
+// its merchant, totals and line items
+func (s *GeminiService) ExtractReceipt(ctx context.Context, country Country, image []byte, mimeType string) (*ReceiptData, *GenerationMeta, error) {
+	prompt := fmt.Sprintf(`You are reading a photo of a shop receipt from %s (amounts usually in %s, %s or %s).
+
+Extract the receipt as JSON with this exact shape:
+{"merchant": "...", "date": "YYYY-MM-DD", "currency": "%s", "total": 0.00, "tax": 0.00,
+ "line_items": [{"description": "...", "quantity": 1, "unit_price": 0.00, "amount": 0.00}]}
+
+Rules:
+- Use null for anything you cannot read; never guess amounts
+- "amount" is the line total after quantity
+- Leave out subtotal, change and payment lines from line_items
+- If the image is not a receipt, return {"merchant": "", "line_items": []}
+
+Return ONLY the JSON, no other text.`, country.Name, country.CurrencyName, country.Symbol, country.Currency, country.Currency)
+
+	parts := []Part{
+		{Text: prompt},
+		{InlineData: &InlineData{
+			MimeType: mimeType,
+			Data:     base64.StdEncoding.EncodeToString(image),
+		}},
+	}
+
+	response, meta, err := s.generate(ctx, "receipt", parts, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta.PromptVersion = receiptPromptVersion
+
+	var receipt ReceiptData
+	if err := json.Unmarshal([]byte(cleanJSONResponse(response)), &receipt); err != nil {
+		return nil, meta, fmt.Errorf("failed to parse receipt: %w", err)
+	}
+	// Keep what Gemini read within the column sizes
+	if _, err := time.Parse("2006-01-02", receipt.Date); err != nil {
+		receipt.Date = ""
+	}
+	if len(receipt.Currency) > 10 {
+		receipt.Currency = ""
+	}
+	if r := []rune(receipt.Merchant); len(r) > 255 {
+		receipt.Merchant = string(r[:255])
+	}
+	if receipt.LineItems == nil {
+		receipt.LineItems = []ReceiptLineItem{}
+	}
+
+	return &receipt, meta, nil
+}
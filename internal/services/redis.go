@@ -0,0 +1,30 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisTimeout    = 5 * time.Second // Dial and command timeout
+	redisRetryDelay = 5 * time.Second // Before reconnecting a subscriber or consumer
+)
+
+// NewRedisClient connects to a redis:// or rediss:// URL, with the user,
+// password and database it gives. It returns nil for an empty URL, which
+// keeps realtime events and the event bus in-process
+func NewRedisClient(rawURL string) (*redis.Client, error) {
+	if rawURL == "" {
+		return nil, nil
+	}
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	opts.DialTimeout = redisTimeout
+	opts.ReadTimeout = redisTimeout
+	opts.WriteTimeout = redisTimeout
+	return redis.NewClient(opts), nil
+}
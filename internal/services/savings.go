@@ -0,0 +1,64 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Kinds of savings movement, as seen from the savings product
+const (
+	SavingsDeposit    = "deposit"
+	SavingsWithdrawal = "withdrawal"
+	SavingsInterest   = "interest"
+)
+
+// savingsProduct recognizes an operator's savings product from SMS text
+type savingsProduct struct {
+	name     string
+	operator string
+	pattern  *regexp.Regexp
+}
+
+var savingsProducts = []savingsProduct{
+	{name: "MTN MoKash", operator: "MTN", pattern: regexp.MustCompile(`(?i)mo\s?kash`)},
+	{name: "Airtel Money Savings", operator: "AIRTEL", pattern: regexp.MustCompile(`(?i)\bsav(e|ings?)\b`)},
+}
+
+// SavingsCandidatePattern is a Postgres regex matching any transaction text
+// that may belong to a savings product; ClassifySavings decides
+const SavingsCandidatePattern = `mo ?kash|sav(e|ing)|interest`
+
+var interestPattern = regexp.MustCompile(`(?i)\binterest\b`)
+
+// ClassifySavings works out whether a transaction moved money into, out of
+// or within a savings product. Deposits leave the wallet as expenses and
+// withdrawals come back as income; interest is credited to the product.
+// Transactions filed under SAVINGS that match no known product count towards
+// a generic "<operator> Savings" product
+func ClassifySavings(operator, txType, category, recipient, description string) (product, kind string, ok bool) {
+	text := recipient + " " + description
+	operator = strings.ToUpper(operator)
+
+	for _, p := range savingsProducts {
+		if p.operator == operator && p.pattern.MatchString(text) {
+			product = p.name
+			break
+		}
+	}
+	if product == "" {
+		if !strings.EqualFold(category, "SAVINGS") {
+			return "", "", false
+		}
+		product = operator + " Savings"
+	}
+
+	switch {
+	case interestPattern.MatchString(text):
+		kind = SavingsInterest
+	case txType == "INCOME":
+		kind = SavingsWithdrawal
+	default:
+		kind = SavingsDeposit
+	}
+	return product, kind, true
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrUnknownScheduledJob is returned for a job name that was never registered
+var ErrUnknownScheduledJob = errors.New("unknown scheduled job")
+
+// Scheduled job states reported to admins
+const (
+	ScheduledJobIdle    = "idle"
+	ScheduledJobRunning = "running"
+	ScheduledJobPaused  = "paused"
+)
+
+const schedulerPollInterval = 15 * time.Second // How often the leader checks for run-now requests
+
+// ScheduledJob is recurring work, like the hourly insight analysis
+type ScheduledJob struct {
+	Name     string
+	Schedule string                          // Shown to admins, e.g. "hourly"
+	Next     func(after time.Time) time.Time // When the job is next due after a time
+	Run      func(ctx context.Context, at time.Time) error
+
+	// Overlap lets a run start while earlier ones are still going, for jobs
+	// whose runs cover different work, like each hour's delivery window.
+	// Other jobs skip a run that comes due while the last is still going
+	Overlap bool
+
+	// After names a job that, when due at the same time, finishes first
+	After string
+}
+
+// ScheduledJobStatus describes a scheduled job for the admin dashboard
+type ScheduledJobStatus struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Status         string     `json:"status"`
+	RunRequested   bool       `json:"run_requested"`
+	RunningSince   *time.Time `json:"running_since,omitempty"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastStatus     string     `json:"last_status,omitempty"` // completed or failed
+	LastError      string     `json:"last_error,omitempty"`
+	LastDurationMs *int64     `json:"last_duration_ms,omitempty"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"` // Unset while paused
+}
+
+// Hourly schedules a job at the top of every hour
+func Hourly(after time.Time) time.Time {
+	return after.Truncate(time.Hour).Add(time.Hour)
+}
+
+// Every schedules a job at each multiple of d, e.g. every minute
+func Every(d time.Duration) func(after time.Time) time.Time {
+	return func(after time.Time) time.Time {
+		return after.Truncate(d).Add(d)
+	}
+}
+
+// DailyAt schedules a job once a day at the given hour
+func DailyAt(hour int) func(after time.Time) time.Time {
+	return func(after time.Time) time.Time {
+		next := time.Date(after.Year(), after.Month(), after.Day(), hour, 0, 0, 0, after.Location())
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+}
+
+// Scheduler runs scheduled jobs on the leader instance only (see RunAsLeader),
+// so replicas don't repeat them. Pause and run-now requests are stored in the
+// scheduled_jobs table, so an admin can send them to any instance
+type Scheduler struct {
+	db   *sql.DB
+	wake chan struct{}
+
+	mu   sync.RWMutex
+	jobs []ScheduledJob
+}
+
+// NewScheduler creates a scheduler; register jobs before Start
+func NewScheduler(db *sql.DB) *Scheduler {
+	return &Scheduler{db: db, wake: make(chan struct{}, 1)}
+}
+
+// Register adds a scheduled job
+func (s *Scheduler) Register(job ScheduledJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+}
+
+// Start runs the scheduler until ctx is cancelled, on whichever instance wins the leader lock
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.registered() {
+		_, err := s.db.Exec("INSERT INTO scheduled_jobs (name) VALUES ($1) ON CONFLICT DO NOTHING", job.Name)
+		if err != nil {
+			log.Printf("⚠️ Failed to register scheduled job %s: %v", job.Name, err)
+		}
+	}
+
+	Supervise(ctx, "scheduler", func(ctx context.Context) {
+		RunAsLeader(ctx, s.db, "scheduler", s.loop)
+	})
+}
+
+// Pause stops a job from running on schedule until it is resumed. A run in progress finishes
+func (s *Scheduler) Pause(name string) error {
+	return s.update(name, "paused = TRUE")
+}
+
+// Resume lets a paused job run on schedule again
+func (s *Scheduler) Resume(name string) error {
+	return s.update(name, "paused = FALSE")
+}
+
+// RunNow asks the leader to run a job as soon as it is not already running
+// (straight away for Overlap jobs), even if it is paused
+func (s *Scheduler) RunNow(name string) error {
+	if err := s.update(name, "run_requested_at = NOW()"); err != nil {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Scheduler) update(name, set string) error {
+	if _, ok := s.job(name); !ok {
+		return ErrUnknownScheduledJob
+	}
+	_, err := s.db.Exec("UPDATE scheduled_jobs SET "+set+", updated_at = NOW() WHERE name = $1", name)
+	return err
+}
+
+// Status reports one job
+func (s *Scheduler) Status(ctx context.Context, name string) (*ScheduledJobStatus, error) {
+	if _, ok := s.job(name); !ok {
+		return nil, ErrUnknownScheduledJob
+	}
+	statuses, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		if status.Name == name {
+			return &status, nil
+		}
+	}
+	return nil, fmt.Errorf("scheduled job %s has no state row", name)
+}
+
+// List reports every registered job, in registration order
+func (s *Scheduler) List(ctx context.Context) ([]ScheduledJobStatus, error) {
+	states, err := s.states(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	statuses := []ScheduledJobStatus{}
+	for _, job := range s.registered() {
+		state, ok := states[job.Name]
+		if !ok {
+			continue
+		}
+
+		status := ScheduledJobStatus{
+			Name:           job.Name,
+			Schedule:       job.Schedule,
+			Status:         ScheduledJobIdle,
+			RunRequested:   state.runRequested,
+			RunningSince:   state.runningSince,
+			LastRunAt:      state.lastRunAt,
+			LastStatus:     state.lastStatus.String,
+			LastError:      state.lastError.String,
+			LastDurationMs: state.lastDurationMs,
+		}
+		switch {
+		case state.runningSince != nil:
+			status.Status = ScheduledJobRunning
+		case state.paused:
+			status.Status = ScheduledJobPaused
+		}
+		if !state.paused {
+			next := job.Next(now)
+			status.NextRunAt = &next
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// scheduledJobState is a row of scheduled_jobs
+type scheduledJobState struct {
+	paused         bool
+	runRequested   bool
+	runningSince   *time.Time
+	lastRunAt      *time.Time
+	lastStatus     sql.NullString
+	lastError      sql.NullString
+	lastDurationMs *int64
+}
+
+func (s *Scheduler) states(ctx context.Context) (map[string]scheduledJobState, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, paused, run_requested_at IS NOT NULL, running_since, last_run_at,
+			last_status, last_error, last_duration_ms
+		FROM scheduled_jobs
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]scheduledJobState)
+	for rows.Next() {
+		var name string
+		var st scheduledJobState
+		var runningSince, lastRunAt sql.NullTime
+		var lastDurationMs sql.NullInt64
+		err := rows.Scan(&name, &st.paused, &st.runRequested, &runningSince, &lastRunAt,
+			&st.lastStatus, &st.lastError, &lastDurationMs)
+		if err != nil {
+			return nil, err
+		}
+		if runningSince.Valid {
+			st.runningSince = &runningSince.Time
+		}
+		if lastRunAt.Valid {
+			st.lastRunAt = &lastRunAt.Time
+		}
+		if lastDurationMs.Valid {
+			st.lastDurationMs = &lastDurationMs.Int64
+		}
+		states[name] = st
+	}
+	return states, rows.Err()
+}
+
+// loop runs jobs as they come due, or when an admin asks, while this instance is leader
+func (s *Scheduler) loop(ctx context.Context) {
+	jobs := s.registered()
+	log.Printf("📅 Scheduler started (%d jobs)", len(jobs))
+
+	// A previous leader may have died mid-run; nothing is running here yet
+	if _, err := s.db.ExecContext(ctx, "UPDATE scheduled_jobs SET running_since = NULL, runs_in_progress = 0 WHERE running_since IS NOT NULL"); err != nil {
+		log.Printf("⚠️ Failed to reset scheduled job state: %v", err)
+	}
+
+	started := time.Now()
+	next := make(map[string]time.Time, len(jobs))
+	for _, job := range jobs {
+		next[job.Name] = job.Next(started)
+	}
+
+	for {
+		wait := schedulerPollInterval
+		if states, err := s.states(ctx); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("❌ Failed to load scheduled job state: %v", err)
+			}
+		} else {
+			now := time.Now()
+			started := make(map[string]<-chan struct{})
+			for _, job := range jobs {
+				state := states[job.Name]
+				if due := next[job.Name]; !now.Before(due) {
+					next[job.Name] = job.Next(now)
+					if state.paused {
+						log.Printf("⏸️ Skipping paused scheduled job %s", job.Name)
+					} else {
+						started[job.Name] = s.start(ctx, job, due, started[job.After])
+					}
+				} else {
+					// Recomputed so a schedule read from settings changes without a restart
+					next[job.Name] = job.Next(now)
+					if state.runRequested {
+						started[job.Name] = s.start(ctx, job, now, started[job.After])
+					}
+				}
+
+				if until := time.Until(next[job.Name]); until < wait {
+					wait = until
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// start runs a job in the background, once after has closed if it isn't
+// nil, unless it is still running from before and can't overlap. The
+// returned channel closes when the run is over, or straight away if it
+// didn't start
+func (s *Scheduler) start(ctx context.Context, job ScheduledJob, at time.Time, after <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE scheduled_jobs SET running_since = COALESCE(running_since, NOW()),
+			runs_in_progress = runs_in_progress + 1, run_requested_at = NULL
+		WHERE name = $1 AND (running_since IS NULL OR $2)
+	`, job.Name, job.Overlap)
+	if err != nil {
+		log.Printf("❌ Failed to start scheduled job %s: %v", job.Name, err)
+		close(done)
+		return done
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		log.Printf("⏭️ Scheduled job %s is still running, skipping this run", job.Name)
+		close(done)
+		return done
+	}
+
+	log.Printf("▶️ Running scheduled job %s", job.Name)
+	Go("scheduled job "+job.Name, func() {
+		defer close(done)
+		if after != nil {
+			select {
+			case <-after:
+			case <-ctx.Done():
+			}
+		}
+		started := time.Now()
+		runErr := s.run(ctx, job, at)
+		s.finish(job.Name, started, runErr)
+	})
+	return done
+}
+
+// run executes a job, converting panics into failures
+func (s *Scheduler) run(ctx context.Context, job ScheduledJob, at time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportPanic("scheduled job "+job.Name, r)
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return job.Run(ctx, at)
+}
+
+func (s *Scheduler) finish(name string, started time.Time, runErr error) {
+	status := "completed"
+	var errMsg interface{}
+	if runErr != nil {
+		status = "failed"
+		errMsg = runErr.Error()
+		log.Printf("❌ Scheduled job %s failed: %v", name, runErr)
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE scheduled_jobs SET
+			running_since = CASE WHEN runs_in_progress > 1 THEN running_since END,
+			runs_in_progress = GREATEST(runs_in_progress - 1, 0),
+			last_run_at = $1, last_status = $2, last_error = $3, last_duration_ms = $4, updated_at = NOW()
+		WHERE name = $5
+	`, started, status, errMsg, time.Since(started).Milliseconds(), name)
+	if err != nil {
+		log.Printf("❌ Failed to record scheduled job %s result: %v", name, err)
+	}
+}
+
+func (s *Scheduler) registered() []ScheduledJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]ScheduledJob(nil), s.jobs...)
+}
+
+func (s *Scheduler) job(name string) (ScheduledJob, bool) {
+	for _, job := range s.registered() {
+		if job.Name == name {
+			return job, true
+		}
+	}
+	return ScheduledJob{}, false
+}
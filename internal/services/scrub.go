@@ -0,0 +1,104 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Placeholders left where ScrubPII removed something
+const (
+	ScrubbedPhone     = "[PHONE]"
+	ScrubbedName      = "[NAME]"
+	ScrubbedReference = "[REF]"
+)
+
+var (
+	// Zambian mobile (095-097, 075-077) and Lusaka-style landline (021x)
+	// numbers, local or with the 260 country code, optionally split by
+	// spaces or dashes: 0971234567, +260 97 123 4567, 260-211-123456
+	zambianPhone = regexp.MustCompile(`(?:\+?\b260[\s-]?|\b0)(?:9[5-7]|7[5-7]|21)(?:[\s-]?\d){7}\b`)
+
+	// A name follows the person-to-person phrases in operator SMS, "sent
+	// K150.00 to JOHN BANDA" or "received from Mary Phiri". Merchant
+	// payments ("Payment to SHOPRITE") are left alone: the merchant is what
+	// makes them useful to the AI
+	personName = regexp.MustCompile(`(?i:\b(?:sent|transferred|transfer|received|receive)(?:\s+\S+){0,2}?\s+(?:to|from)\s+)([A-Z][A-Za-z'-]+(?:\s+[A-Z][A-Za-z'-]+){0,2})`)
+
+	// A labelled reference: "Ref: MP240115.1234", "TID 8812345", "Txn ID: ABC123"
+	labelledReference = regexp.MustCompile(`(?i)\b(?:ref(?:erence)?|txn(?:\s*id)?|trans(?:action)?\s*id|tid)\s*[:#.]?\s*([A-Za-z0-9][A-Za-z0-9.\-]{2,}[A-Za-z0-9])`)
+
+	// An unlabelled token long enough to be a reference code
+	codeToken = regexp.MustCompile(`\b[A-Za-z0-9][A-Za-z0-9.\-]{6,}[A-Za-z0-9]\b`)
+)
+
+// ScrubPII strips phone numbers, names of people money was sent to or
+// received from, and transaction references from free text before it's sent
+// to Gemini. Each is replaced with a placeholder so the text still reads
+// naturally
+func ScrubPII(text string) string {
+	if text == "" {
+		return text
+	}
+	text = zambianPhone.ReplaceAllString(text, ScrubbedPhone)
+	text = labelledReference.ReplaceAllStringFunc(text, func(match string) string {
+		value := labelledReference.FindStringSubmatch(match)[1]
+		if !strings.ContainsAny(value, "0123456789") {
+			return match // "Reference number", not a reference
+		}
+		return strings.TrimSuffix(match, value) + ScrubbedReference
+	})
+	text = codeToken.ReplaceAllStringFunc(text, func(token string) string {
+		if isReferenceCode(token) {
+			return ScrubbedReference
+		}
+		return token
+	})
+	return personName.ReplaceAllStringFunc(text, func(match string) string {
+		name := personName.FindStringSubmatch(match)[1]
+		return strings.TrimSuffix(match, name) + ScrubbedName
+	})
+}
+
+// isReferenceCode reports whether a token mixes letters with at least three
+// digits, as operator transaction IDs do, rather than being a word or an amount
+func isReferenceCode(token string) bool {
+	letters, digits := 0, 0
+	for _, r := range token {
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+		case unicode.IsDigit(r):
+			digits++
+		}
+	}
+	return letters > 0 && digits >= 3
+}
+
+// Placeholders SMSTemplate leaves for the parts of an SMS that vary between messages
+const (
+	TemplateAmount = "[AMOUNT]"
+	TemplateDate   = "[DATE]"
+	TemplateTime   = "[TIME]"
+	TemplateNumber = "[N]"
+)
+
+var (
+	templateAmount = regexp.MustCompile(`(?i)\b(?:ZMW|K)\s?\d[\d,]*(?:\.\d+)?`)
+	templateDate   = regexp.MustCompile(`\b\d{1,4}[/-]\d{1,2}[/-]\d{1,4}\b`)
+	templateTime   = regexp.MustCompile(`(?i)\b\d{1,2}:\d{2}(?::\d{2})?(?:\s?[AP]M)?`)
+	templateNumber = regexp.MustCompile(`\d(?:[\d,.]*\d)?`)
+	whitespace     = regexp.MustCompile(`\s+`)
+)
+
+// SMSTemplate reduces an SMS to its skeleton: ScrubPII, then amounts, dates,
+// times and any other numbers replaced with placeholders. Messages sent from
+// the same operator template reduce to the same skeleton
+func SMSTemplate(text string) string {
+	text = ScrubPII(text)
+	text = templateAmount.ReplaceAllString(text, TemplateAmount)
+	text = templateDate.ReplaceAllString(text, TemplateDate)
+	text = templateTime.ReplaceAllString(text, TemplateTime)
+	text = templateNumber.ReplaceAllString(text, TemplateNumber)
+	return strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+}
@@ -0,0 +1,60 @@
+package services
+
+import "testing"
+
+func TestScrubPII(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		// Mobile prefixes
+		{"airtel 097", "Call 0971234567 now", "Call [PHONE] now"},
+		{"mtn 096", "0961234567", "[PHONE]"},
+		{"mtn 076", "0761234567", "[PHONE]"},
+		{"zamtel 095", "0951234567", "[PHONE]"},
+		{"airtel 077", "0771234567", "[PHONE]"},
+		{"zedmobile 075", "0751234567", "[PHONE]"},
+
+		// Landlines
+		{"landline", "0211234567", "[PHONE]"},
+		{"spaced landline", "0212 123456", "[PHONE]"},
+		{"dashed landline with country code", "260-211-123456", "[PHONE]"},
+
+		// Country code and separators
+		{"plus 260", "+260971234567", "[PHONE]"},
+		{"bare 260", "260971234567", "[PHONE]"},
+		{"spaced plus 260", "+260 97 123 4567", "[PHONE]"},
+		{"dashed", "097-123-4567", "[PHONE]"},
+		{"spaced", "097 123 4567", "[PHONE]"},
+		{"in an SMS", "You have sent K50.00 to 0977123456.", "You have sent K50.00 to [PHONE]."},
+
+		// Names
+		{"sent to", "You have sent K150.00 to JOHN BANDA.", "You have sent K150.00 to [NAME]."},
+		{"received from", "Received K200 from Mary Phiri on 12/01", "Received K200 from [NAME] on 12/01"},
+
+		// References
+		{"ref label", "Ref: MP240115.1234", "Ref: [REF]"},
+		{"tid label", "TID 8812345", "TID [REF]"},
+		{"txn id label", "Txn ID: ABC123", "Txn ID: [REF]"},
+		{"unlabelled code", "Transaction ID MP2401151234 done", "Transaction ID [REF] done"},
+
+		// Left alone
+		{"merchant payment", "Payment of K1,250.00 to SHOPRITE", "Payment of K1,250.00 to SHOPRITE"},
+		{"balance", "Your balance is K12,345.67", "Your balance is K12,345.67"},
+		{"currency code amount", "Amount ZMW 2500.00", "Amount ZMW 2500.00"},
+		{"reference without a value", "Reference number invalid", "Reference number invalid"},
+		{"plain number", "Paid 1234567 units", "Paid 1234567 units"},
+		{"unknown prefix", "0981234567", "0981234567"},
+		{"too short", "0971234", "0971234"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ScrubPII(tt.in); got != tt.want {
+				t.Errorf("ScrubPII(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
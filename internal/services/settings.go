@@ -0,0 +1,458 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrInvalidSetting is returned for an unknown setting or a value it can't take
+var ErrInvalidSetting = errors.New("invalid setting")
+
+// Runtime settings
+const (
+	SettingRateLimit            = "rate_limit_per_minute"
+	SettingAdminRateLimit       = "admin_rate_limit_per_minute"
+	SettingAdminLoginRateLimit  = "admin_login_rate_limit_per_minute"
+	SettingDailyPushCap         = "daily_push_cap"
+	SettingMaintenanceMode      = "maintenance_mode"
+	SettingMaintenanceMessage   = "maintenance_message"
+	SettingGroupRemindersHour   = "group_reminders_hour"
+	SettingBenchmarksHour       = "spending_benchmarks_hour"
+	SettingDeliveryWindowsHour  = "delivery_windows_hour"
+	SettingConsentPolicyVersion = "consent_policy_version"
+
+	SettingSyncEnabled          = "sync_enabled"
+	SettingInsightsEnabled      = "insights_enabled"
+	SettingNotificationsEnabled = "notifications_enabled"
+)
+
+// Features with a kill switch, to contain an incident in one subsystem
+// without taking the whole API down
+const (
+	FeatureSync          = "sync"
+	FeatureInsights      = "insights"
+	FeatureNotifications = "notifications"
+)
+
+// featureSettings maps each feature to the setting switching it
+var featureSettings = map[string]string{
+	FeatureSync:          SettingSyncEnabled,
+	FeatureInsights:      SettingInsightsEnabled,
+	FeatureNotifications: SettingNotificationsEnabled,
+}
+
+// Setting value kinds
+const (
+	SettingKindInt    = "int"
+	SettingKindBool   = "bool"
+	SettingKindString = "string"
+)
+
+const settingsReloadInterval = 30 * time.Second // How soon other replicas see a change
+
+// settingDef is a setting's kind, default and range. For strings, max is the
+// longest value allowed
+type settingDef struct {
+	key         string
+	kind        string
+	def         interface{}
+	min, max    int
+	description string
+}
+
+var settingDefs = []settingDef{
+	{SettingRateLimit, SettingKindInt, 100, 1, 100000, "Requests per minute per IP on the public API"},
+	{SettingAdminRateLimit, SettingKindInt, 60, 1, 100000, "Requests per minute per IP on the admin API"},
+	{SettingAdminLoginRateLimit, SettingKindInt, 10, 1, 1000, "Admin login attempts per minute per IP"},
+	{SettingDailyPushCap, SettingKindInt, 0, 0, 1000, "Pushes per user per day, beyond which notifications only reach the inbox; 0 is unlimited"},
+	{SettingMaintenanceMode, SettingKindBool, false, 0, 0, "Answer app requests with 503 while the service is under maintenance"},
+	{SettingMaintenanceMessage, SettingKindString, "KwachaTracker is down for maintenance. Please try again shortly.", 0, 500, "Error shown to users during maintenance"},
+	{SettingGroupRemindersHour, SettingKindInt, 17, 0, 23, "Hour of the day group contribution reminders are sent"},
+	{SettingBenchmarksHour, SettingKindInt, 2, 0, 23, "Hour of the day spending benchmarks are recomputed"},
+	{SettingDeliveryWindowsHour, SettingKindInt, 0, 0, 23, "Hour of the day insight delivery windows are recomputed"},
+	{SettingConsentPolicyVersion, SettingKindInt, 1, 1, 10000, "Version of the privacy policy users consent to; raising it makes every user consent again before they can sync"},
+	{SettingSyncEnabled, SettingKindBool, true, 0, 0, "Accept transaction syncs; off answers the sync routes with 503"},
+	{SettingInsightsEnabled, SettingKindBool, true, 0, 0, "Serve and generate insights; off also stops the scheduled analysis and its Gemini calls"},
+	{SettingNotificationsEnabled, SettingKindBool, true, 0, 0, "Serve the notification routes and send pushes; off holds pushes in the outbox until it's back on"},
+}
+
+// Setting is a runtime setting's current value for the admin dashboard
+type Setting struct {
+	Key         string      `json:"key"`
+	Kind        string      `json:"kind"`
+	Value       interface{} `json:"value"`
+	Default     interface{} `json:"default"`
+	Min         *int        `json:"min,omitempty"`
+	Max         *int        `json:"max,omitempty"`
+	Description string      `json:"description"`
+	UpdatedBy   string      `json:"updated_by,omitempty"`
+	UpdatedAt   *time.Time  `json:"updated_at,omitempty"` // Unset while the default applies
+
+	DisabledByConfig bool `json:"disabled_by_config,omitempty"` // A feature off through DISABLED_FEATURES, whatever the value
+}
+
+// SettingChange is one entry in the settings history. OldValue is null when
+// the setting was at its default
+type SettingChange struct {
+	ID        int64           `json:"id"`
+	Key       string          `json:"key"`
+	OldValue  json.RawMessage `json:"old_value"`
+	NewValue  json.RawMessage `json:"new_value"`
+	ChangedBy string          `json:"changed_by"`
+	ChangedAt time.Time       `json:"changed_at"`
+}
+
+// storedSetting is a value saved in the settings table
+type storedSetting struct {
+	value     interface{}
+	updatedBy string
+	updatedAt time.Time
+}
+
+// Settings holds runtime-tunable settings like rate limits and maintenance
+// mode. Values live in the settings table and are cached in memory; each
+// instance reloads them every settingsReloadInterval, so a change made on
+// one replica reaches the others without a restart
+type Settings struct {
+	db       *sql.DB
+	disabled map[string]bool // Features switched off in the config
+
+	mu     sync.RWMutex
+	stored map[string]storedSetting
+}
+
+// NewSettings creates settings at their defaults until Load is called
+func NewSettings(db *sql.DB) *Settings {
+	return &Settings{db: db, disabled: make(map[string]bool), stored: make(map[string]storedSetting)}
+}
+
+// DisableFeatures switches features off for this process whatever their
+// settings say, for when the settings table itself can't be relied on.
+// Call it before the settings are used
+func (s *Settings) DisableFeatures(features []string) error {
+	for _, feature := range features {
+		if _, ok := featureSettings[feature]; !ok {
+			return fmt.Errorf("%w: unknown feature %q", ErrInvalidSetting, feature)
+		}
+		s.disabled[feature] = true
+	}
+	return nil
+}
+
+// FeatureEnabled reports whether a feature is neither disabled in the config
+// nor switched off by its setting
+func (s *Settings) FeatureEnabled(feature string) bool {
+	return !s.disabled[feature] && s.Bool(featureSettings[feature])
+}
+
+// Features returns whether each feature is enabled
+func (s *Settings) Features() map[string]bool {
+	features := make(map[string]bool, len(featureSettings))
+	for feature := range featureSettings {
+		features[feature] = s.FeatureEnabled(feature)
+	}
+	return features
+}
+
+func findSettingDef(key string) (settingDef, bool) {
+	for _, d := range settingDefs {
+		if d.key == key {
+			return d, true
+		}
+	}
+	return settingDef{}, false
+}
+
+// decode parses and range-checks a JSON value for the setting
+func (d settingDef) decode(raw json.RawMessage) (interface{}, error) {
+	switch d.kind {
+	case SettingKindInt:
+		var n int
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, fmt.Errorf("%w: %s must be a whole number", ErrInvalidSetting, d.key)
+		}
+		if n < d.min || n > d.max {
+			return nil, fmt.Errorf("%w: %s must be between %d and %d", ErrInvalidSetting, d.key, d.min, d.max)
+		}
+		return n, nil
+	case SettingKindBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, fmt.Errorf("%w: %s must be true or false", ErrInvalidSetting, d.key)
+		}
+		return b, nil
+	default:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("%w: %s must be a string", ErrInvalidSetting, d.key)
+		}
+		if len(s) > d.max {
+			return nil, fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidSetting, d.key, d.max)
+		}
+		return s, nil
+	}
+}
+
+// Load reads the stored settings. Unknown keys and values a setting can no
+// longer take are ignored, leaving its default
+func (s *Settings) Load(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT key, value, COALESCE(updated_by, ''), updated_at FROM settings")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]storedSetting)
+	for rows.Next() {
+		var key string
+		var raw json.RawMessage
+		var st storedSetting
+		if err := rows.Scan(&key, &raw, &st.updatedBy, &st.updatedAt); err != nil {
+			return err
+		}
+		def, ok := findSettingDef(key)
+		if !ok {
+			continue
+		}
+		if st.value, err = def.decode(raw); err != nil {
+			log.Printf("⚠️ Ignoring stored setting: %v", err)
+			continue
+		}
+		stored[key] = st
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.stored = stored
+	s.mu.Unlock()
+	return nil
+}
+
+// Start reloads the settings periodically until ctx is cancelled
+func (s *Settings) Start(ctx context.Context) {
+	Supervise(ctx, "settings reload", func(ctx context.Context) {
+		ticker := time.NewTicker(settingsReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Load(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("❌ Failed to reload settings: %v", err)
+				}
+			}
+		}
+	})
+}
+
+func (s *Settings) value(key string) interface{} {
+	s.mu.RLock()
+	st, ok := s.stored[key]
+	s.mu.RUnlock()
+	if ok {
+		return st.value
+	}
+	def, _ := findSettingDef(key)
+	return def.def
+}
+
+// Int returns an int setting
+func (s *Settings) Int(key string) int {
+	n, _ := s.value(key).(int)
+	return n
+}
+
+// Bool returns a bool setting
+func (s *Settings) Bool(key string) bool {
+	b, _ := s.value(key).(bool)
+	return b
+}
+
+// String returns a string setting
+func (s *Settings) String(key string) string {
+	str, _ := s.value(key).(string)
+	return str
+}
+
+// DailyAt schedules a job once a day at the hour in an int setting, read
+// each time so a change applies to the next run
+func (s *Settings) DailyAt(key string) func(after time.Time) time.Time {
+	return func(after time.Time) time.Time {
+		return DailyAt(s.Int(key))(after)
+	}
+}
+
+// List returns every setting with its current value
+func (s *Settings) List() []Setting {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings := make([]Setting, 0, len(settingDefs))
+	for _, d := range settingDefs {
+		setting := Setting{
+			Key:         d.key,
+			Kind:        d.kind,
+			Value:       d.def,
+			Default:     d.def,
+			Description: d.description,
+		}
+		if d.kind != SettingKindBool {
+			max := d.max
+			setting.Max = &max
+		}
+		if d.kind == SettingKindInt {
+			min := d.min
+			setting.Min = &min
+		}
+		if st, ok := s.stored[d.key]; ok {
+			updatedAt := st.updatedAt
+			setting.Value = st.value
+			setting.UpdatedBy = st.updatedBy
+			setting.UpdatedAt = &updatedAt
+		}
+		for feature, key := range featureSettings {
+			if key == d.key && s.disabled[feature] {
+				setting.DisabledByConfig = true
+			}
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// Update validates and saves changed settings in one transaction, recording
+// each change in the history, then reloads them. Values equal to the current
+// one are skipped
+func (s *Settings) Update(ctx context.Context, changes map[string]json.RawMessage, actor string) error {
+	values := make(map[string]interface{}, len(changes))
+	for key, raw := range changes {
+		def, ok := findSettingDef(key)
+		if !ok {
+			return fmt.Errorf("%w: unknown setting %s", ErrInvalidSetting, key)
+		}
+		v, err := def.decode(raw)
+		if err != nil {
+			return err
+		}
+		values[key] = v
+	}
+
+	// A stable order so concurrent updates lock rows in the same order
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, key := range keys {
+		newValue, err := json.Marshal(values[key])
+		if err != nil {
+			return err
+		}
+
+		var oldValue []byte
+		err = tx.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = $1 FOR UPDATE", key).Scan(&oldValue)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		def, _ := findSettingDef(key)
+		current := def.def
+		if oldValue != nil {
+			if v, err := def.decode(oldValue); err == nil {
+				current = v
+			}
+		}
+		if current == values[key] {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO settings (key, value, updated_by, updated_at)
+			VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+			ON CONFLICT (key) DO UPDATE SET
+				value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+		`, key, newValue, actor); err != nil {
+			return err
+		}
+		if err := recordSettingChange(ctx, tx, key, oldValue, newValue, actor); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return s.Load(ctx)
+}
+
+// RecordChange adds a change made outside the settings table, like the AI
+// budget controls, to the settings history
+func (s *Settings) RecordChange(ctx context.Context, key string, oldValue, newValue interface{}, actor string) error {
+	oldJSON, err := json.Marshal(oldValue)
+	if err != nil {
+		return err
+	}
+	newJSON, err := json.Marshal(newValue)
+	if err != nil {
+		return err
+	}
+	return recordSettingChange(ctx, s.db, key, oldJSON, newJSON, actor)
+}
+
+func recordSettingChange(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}, key string, oldValue, newValue []byte, actor string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO settings_history (key, old_value, new_value, changed_by)
+		VALUES ($1, $2, $3, $4)
+	`, key, oldValue, newValue, actor)
+	return err
+}
+
+// History returns the most recent changes, newest first, for one key or all
+// when key is empty
+func (s *Settings) History(ctx context.Context, key string, limit int) ([]SettingChange, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, key, old_value, new_value, COALESCE(changed_by, ''), changed_at
+		FROM settings_history
+		WHERE $1 = '' OR key = $1
+		ORDER BY changed_at DESC, id DESC
+		LIMIT $2
+	`, key, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []SettingChange{}
+	for rows.Next() {
+		var ch SettingChange
+		var oldValue []byte
+		if err := rows.Scan(&ch.ID, &ch.Key, &oldValue, &ch.NewValue, &ch.ChangedBy, &ch.ChangedAt); err != nil {
+			return nil, err
+		}
+		if oldValue != nil {
+			ch.OldValue = oldValue
+		} else {
+			ch.OldValue = json.RawMessage("null")
+		}
+		changes = append(changes, ch)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+// Component statuses reported by the status endpoint
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusDisabled    = "disabled"
+)
+
+const (
+	statusCheckInterval = 30 * time.Second
+	statusWindow        = 24 * time.Hour
+
+	// poolSaturatedWait is the average wait for a free connection, since the
+	// last check, above which the database is reported degraded
+	poolSaturatedWait = 500 * time.Millisecond
+)
+
+// ComponentStatus is the current state and recent uptime of one dependency
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	Message   string  `json:"message,omitempty"`
+	Uptime24h float64 `json:"uptime_24h"` // Fraction of checks that were operational
+}
+
+// Incident is an ongoing problem with a dependency
+type Incident struct {
+	Component string    `json:"component"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	Since     time.Time `json:"since"`
+}
+
+// StatusFlags are the booleans the app uses to decide which banners to show
+type StatusFlags struct {
+	DBDegraded      bool `json:"db_degraded"`
+	AIDisabled      bool `json:"ai_disabled"`
+	PushDisabled    bool `json:"push_disabled"`
+	InsightsDelayed bool `json:"insights_delayed"`
+}
+
+// StatusReport is the public service status
+type StatusReport struct {
+	Status     string                     `json:"status"`
+	CheckedAt  time.Time                  `json:"checked_at"`
+	Components map[string]ComponentStatus `json:"components"`
+	Incidents  []Incident                 `json:"incidents"`
+	Flags      StatusFlags                `json:"flags"`
+}
+
+type statusSample struct {
+	at time.Time
+	ok bool
+}
+
+// StatusMonitor periodically checks the database, Gemini and FCM and keeps
+// 24 hours of results in memory for the public status endpoint
+type StatusMonitor struct {
+	db     *sql.DB
+	gemini *GeminiService
+	fcm    *FCMService
+	usage  *AIUsageTracker
+
+	// Pool counters at the previous check; only touched by check
+	lastWaitCount    int64
+	lastWaitDuration time.Duration
+
+	mu        sync.RWMutex
+	current   map[string]ComponentStatus
+	samples   map[string][]statusSample
+	incidents map[string]*Incident
+	checkedAt time.Time
+}
+
+// NewStatusMonitor creates a monitor; gemini and fcm may be nil when those services are disabled
+func NewStatusMonitor(db *sql.DB, gemini *GeminiService, fcm *FCMService, usage *AIUsageTracker) *StatusMonitor {
+	return &StatusMonitor{
+		db:        db,
+		gemini:    gemini,
+		fcm:       fcm,
+		usage:     usage,
+		current:   make(map[string]ComponentStatus),
+		samples:   make(map[string][]statusSample),
+		incidents: make(map[string]*Incident),
+	}
+}
+
+// Start runs the checks immediately and then every 30 seconds until ctx is cancelled
+func (m *StatusMonitor) Start(ctx context.Context) {
+	m.check(ctx)
+	Supervise(ctx, "status monitor", func(ctx context.Context) {
+		ticker := time.NewTicker(statusCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.check(ctx)
+			}
+		}
+	})
+}
+
+// check probes every dependency and updates incidents
+func (m *StatusMonitor) check(ctx context.Context) {
+	results := map[string]ComponentStatus{
+		"database": m.checkDatabase(ctx),
+		"ai":       m.checkAI(ctx),
+		"push":     m.checkPush(),
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checkedAt = now
+	for name, result := range results {
+		samples := append(m.samples[name], statusSample{at: now, ok: result.Status == StatusOperational})
+		for len(samples) > 0 && now.Sub(samples[0].at) > statusWindow {
+			samples = samples[1:]
+		}
+		m.samples[name] = samples
+		m.current[name] = result
+
+		incident := m.incidents[name]
+		switch {
+		case result.Status == StatusOperational && incident != nil:
+			log.Printf("✅ %s recovered after %s", name, now.Sub(incident.Since).Round(time.Second))
+			delete(m.incidents, name)
+		case result.Status != StatusOperational && incident == nil:
+			log.Printf("⚠️ %s is %s: %s", name, result.Status, result.Message)
+			m.incidents[name] = &Incident{Component: name, Status: result.Status, Message: result.Message, Since: now}
+		case result.Status != StatusOperational:
+			incident.Status = result.Status
+			incident.Message = result.Message
+		}
+	}
+}
+
+func (m *StatusMonitor) checkDatabase(ctx context.Context) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := m.db.PingContext(ctx); err != nil {
+		return ComponentStatus{Status: StatusDegraded, Message: "Database unreachable"}
+	}
+	if time.Since(start) > 2*time.Second {
+		return ComponentStatus{Status: StatusDegraded, Message: "Database responding slowly"}
+	}
+
+	// Requests queueing for a connection means the pool is too small for the load
+	stats := m.db.Stats()
+	waits := stats.WaitCount - m.lastWaitCount
+	waited := stats.WaitDuration - m.lastWaitDuration
+	m.lastWaitCount, m.lastWaitDuration = stats.WaitCount, stats.WaitDuration
+	if waits > 0 && waited/time.Duration(waits) > poolSaturatedWait {
+		return ComponentStatus{Status: StatusDegraded, Message: "Database connection pool saturated"}
+	}
+	return ComponentStatus{Status: StatusOperational}
+}
+
+func (m *StatusMonitor) checkAI(ctx context.Context) ComponentStatus {
+	if m.gemini == nil {
+		return ComponentStatus{Status: StatusDisabled, Message: "AI insights are not configured"}
+	}
+	if m.gemini.Breaker().State() == BreakerOpen {
+		return ComponentStatus{Status: StatusDegraded, Message: "AI provider is failing; insights are delayed"}
+	}
+	if m.usage != nil {
+		if status, err := m.usage.Status(ctx); err == nil && !status.Available {
+			return ComponentStatus{Status: StatusDisabled, Message: status.Reason}
+		}
+	}
+	return ComponentStatus{Status: StatusOperational}
+}
+
+func (m *StatusMonitor) checkPush() ComponentStatus {
+	if m.fcm == nil {
+		return ComponentStatus{Status: StatusDisabled, Message: "Push notifications are not configured"}
+	}
+	return ComponentStatus{Status: StatusOperational}
+}
+
+// Report returns the latest status with 24-hour uptime per component
+func (m *StatusMonitor) Report() StatusReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	report := StatusReport{
+		Status:     StatusOperational,
+		CheckedAt:  m.checkedAt,
+		Components: make(map[string]ComponentStatus, len(m.current)),
+		Incidents:  []Incident{},
+	}
+
+	for name, component := range m.current {
+		samples := m.samples[name]
+		ok := 0
+		for _, sample := range samples {
+			if sample.ok {
+				ok++
+			}
+		}
+		if len(samples) > 0 {
+			component.Uptime24h = float64(ok) / float64(len(samples))
+		}
+		report.Components[name] = component
+	}
+
+	// A switched-off feature is reported as an incident but isn't an outage
+	for _, incident := range m.incidents {
+		report.Incidents = append(report.Incidents, *incident)
+		if incident.Status == StatusDegraded {
+			report.Status = StatusDegraded
+		}
+	}
+
+	report.Flags = StatusFlags{
+		DBDegraded:   m.current["database"].Status != StatusOperational,
+		AIDisabled:   m.current["ai"].Status != StatusOperational,
+		PushDisabled: m.current["push"].Status != StatusOperational,
+	}
+	report.Flags.InsightsDelayed = report.Flags.AIDisabled || report.Flags.DBDegraded
+
+	return report
+}
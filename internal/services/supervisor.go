@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// PanicReporter is called with every recovered panic, e.g. to forward it to an
+// error tracker. It is nil (log only) until one is configured
+var PanicReporter func(name string, recovered interface{}, stack []byte)
+
+// Restart backoff for supervised goroutines
+const (
+	superviseMinBackoff = time.Second
+	superviseMaxBackoff = 5 * time.Minute
+	superviseHealthyRun = 10 * time.Minute // A run this long resets the backoff
+)
+
+// Go runs fn in a goroutine, logging and reporting a panic instead of crashing
+// the process. Use it for one-off background work like broadcasts
+func Go(name string, fn func()) {
+	go func() {
+		defer recoverPanic(name)
+		fn()
+	}()
+}
+
+// Supervise runs a long-lived loop in a goroutine and restarts it with
+// exponential backoff if it panics, until ctx is cancelled. A loop that
+// returns normally is not restarted
+func Supervise(ctx context.Context, name string, fn func(ctx context.Context)) {
+	go func() {
+		backoff := superviseMinBackoff
+		for {
+			started := time.Now()
+			if !runRecovered(ctx, name, fn) {
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			if time.Since(started) > superviseHealthyRun {
+				backoff = superviseMinBackoff
+			}
+			log.Printf("🔁 Restarting %s in %s", name, backoff)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > superviseMaxBackoff {
+				backoff = superviseMaxBackoff
+			}
+		}
+	}()
+}
+
+// runRecovered runs fn and reports whether it panicked
+func runRecovered(ctx context.Context, name string, fn func(ctx context.Context)) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportPanic(name, r)
+			panicked = true
+		}
+	}()
+	fn(ctx)
+	return false
+}
+
+func recoverPanic(name string) {
+	if r := recover(); r != nil {
+		reportPanic(name, r)
+	}
+}
+
+func reportPanic(name string, recovered interface{}) {
+	stack := debug.Stack()
+	log.Printf("💥 Panic in %s: %v\n%s", name, recovered, stack)
+	if PanicReporter != nil {
+		func() {
+			// A broken reporter must not take the process down either
+			defer func() { recover() }()
+			PanicReporter(name, recovered, stack)
+		}()
+	}
+}
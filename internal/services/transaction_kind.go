@@ -0,0 +1,107 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Transaction kinds refine the INCOME / EXPENSE type into what the money
+// movement was. The app may send one; otherwise it's derived from the type
+// and category the app has always sent
+const (
+	KindCashIn      = "CASH_IN"
+	KindCashOut     = "CASH_OUT"
+	KindP2PSent     = "P2P_SENT"
+	KindP2PReceived = "P2P_RECEIVED"
+	KindBillPay     = "BILL_PAY"
+	KindAirtime     = "AIRTIME"
+	KindBundle      = "BUNDLE"
+	KindFee         = "FEE"
+	KindLoan        = "LOAN"
+	KindSavings     = "SAVINGS"
+	KindOther       = "OTHER"
+)
+
+// TransactionKinds lists every kind
+var TransactionKinds = []string{
+	KindCashIn, KindCashOut, KindP2PSent, KindP2PReceived, KindBillPay,
+	KindAirtime, KindBundle, KindFee, KindLoan, KindSavings, KindOther,
+}
+
+// IsTransactionKind reports whether kind is one of TransactionKinds
+func IsTransactionKind(kind string) bool {
+	for _, k := range TransactionKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// expenseKinds and incomeKinds map legacy categories to kinds. The
+// transaction_kind SQL function is generated from them by
+// TransactionKindFunctionSQL
+var (
+	expenseKinds = map[string]string{
+		"TRANSFER":   KindP2PSent,
+		"WITHDRAWAL": KindCashOut,
+		"BILLS":      KindBillPay,
+		"AIRTIME":    KindAirtime,
+		"DATA":       KindBundle,
+		"FEES":       KindFee,
+		"FEE":        KindFee,
+		"CHARGES":    KindFee,
+		"LOAN":       KindLoan,
+		"SAVINGS":    KindSavings,
+	}
+	incomeKinds = map[string]string{
+		"RECEIVED": KindP2PReceived,
+		"TRANSFER": KindP2PReceived,
+		"DEPOSIT":  KindCashIn,
+		"LOAN":     KindLoan,
+		"SAVINGS":  KindSavings,
+	}
+)
+
+// TransactionKind derives a kind from a legacy type and category
+func TransactionKind(txType, category string) string {
+	kinds := expenseKinds
+	if txType == "INCOME" {
+		kinds = incomeKinds
+	}
+	if kind, ok := kinds[strings.ToUpper(category)]; ok {
+		return kind
+	}
+	return KindOther
+}
+
+// TransactionKindFunctionSQL creates the transaction_kind(type, category) SQL
+// function, TransactionKind for rows stored before kinds existed and for
+// daily totals
+func TransactionKindFunctionSQL() string {
+	return fmt.Sprintf(`CREATE OR REPLACE FUNCTION transaction_kind(tx_type TEXT, category TEXT)
+		RETURNS TEXT AS $$
+			SELECT CASE
+				WHEN $1 = 'INCOME' THEN %s
+				ELSE %s
+			END
+		$$ LANGUAGE sql IMMUTABLE`, kindCaseSQL(incomeKinds), kindCaseSQL(expenseKinds))
+}
+
+// kindCaseSQL renders a category mapping as a CASE on the category, $2
+func kindCaseSQL(kinds map[string]string) string {
+	categories := make([]string, 0, len(kinds))
+	for category := range kinds {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	var b strings.Builder
+	b.WriteString("CASE UPPER($2)")
+	for _, category := range categories {
+		fmt.Fprintf(&b, " WHEN '%s' THEN '%s'", category, kinds[category])
+	}
+	fmt.Fprintf(&b, " ELSE '%s' END", KindOther)
+	return b.String()
+}
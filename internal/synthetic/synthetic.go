@@ -0,0 +1,192 @@
+// Package synthetic generates realistic Zambian mobile-money transactions for
+// load tests, seed data and demos. Nothing it produces comes from real users.
+package synthetic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/kwachatracker/backend/internal/models"
+)
+
+// Operators are the mobile-money operators the app parses SMS from
+var Operators = []string{"AIRTEL", "MTN", "ZAMTEL"}
+
+// Languages are the app languages synthetic users are spread across
+var Languages = []string{"en", "en", "en", "bem", "nya", "toi", "loz"}
+
+type pattern struct {
+	category    string
+	txType      string
+	weight      int     // Relative frequency
+	minAmount   float64 // Kwacha
+	maxAmount   float64
+	recipients  []string
+	description string
+}
+
+// Spending patterns roughly matching what the app sees: frequent small airtime
+// and data bundles, occasional larger transfers and bills, a monthly salary
+var patterns = []pattern{
+	{category: "AIRTIME", txType: "EXPENSE", weight: 20, minAmount: 5, maxAmount: 50, description: "Airtime purchase"},
+	{category: "DATA", txType: "EXPENSE", weight: 18, minAmount: 10, maxAmount: 150, description: "Data bundle"},
+	{category: "PAYMENT", txType: "EXPENSE", weight: 15, minAmount: 20, maxAmount: 600,
+		recipients:  []string{"SHOPRITE", "PICK N PAY", "CHOPPIES", "MEGA MARKET", "HUNGRY LION", "PUMA FILLING STATION"},
+		description: "Merchant payment"},
+	{category: "TRANSFER", txType: "EXPENSE", weight: 12, minAmount: 50, maxAmount: 1500,
+		recipients: []string{"0971234567", "0962345678", "0953456789", "0774567890"}, description: "Money sent"},
+	{category: "WITHDRAWAL", txType: "EXPENSE", weight: 6, minAmount: 100, maxAmount: 2000, description: "Cash out at agent"},
+	{category: "BILLS", txType: "EXPENSE", weight: 4, minAmount: 100, maxAmount: 900,
+		recipients: []string{"ZESCO", "LUSAKA WATER", "DSTV", "GOTV"}, description: "Bill payment"},
+	{category: "SAVINGS", txType: "EXPENSE", weight: 2, minAmount: 50, maxAmount: 1000, description: "Savings deposit"},
+	{category: "FEES", txType: "EXPENSE", weight: 10, minAmount: 0.5, maxAmount: 25, description: "Transaction fee"},
+	{category: "RECEIVED", txType: "INCOME", weight: 10, minAmount: 50, maxAmount: 2000,
+		recipients: []string{"0971112233", "0962223344", "0955556677"}, description: "Money received"},
+}
+
+var totalWeight = func() int {
+	total := 0
+	for _, p := range patterns {
+		total += p.weight
+	}
+	return total
+}()
+
+// Generator produces a plausible transaction history for one synthetic user
+type Generator struct {
+	rng      *rand.Rand
+	device   string
+	operator string
+	salary   float64
+	balance  float64
+	counter  int
+}
+
+// NewGenerator creates a generator for a device; the same seed always yields the same history
+func NewGenerator(seed int64, deviceID string) *Generator {
+	rng := rand.New(rand.NewSource(seed))
+	salary := 1500 + math.Round(rng.Float64()*8500) // K1,500 - K10,000 a month
+	return &Generator{
+		rng:      rng,
+		device:   deviceID,
+		operator: Operators[rng.Intn(len(Operators))],
+		salary:   salary,
+		balance:  salary * rng.Float64(),
+	}
+}
+
+// Operator is the user's mobile-money operator
+func (g *Generator) Operator() string {
+	return g.operator
+}
+
+// Language picks an app language for the user
+func (g *Generator) Language() string {
+	return Languages[g.rng.Intn(len(Languages))]
+}
+
+// History returns transactions spread over the days before now, including a salary each month
+func (g *Generator) History(days, perDay int) []models.TransactionInput {
+	now := time.Now()
+	start := now.AddDate(0, 0, -days)
+	var txns []models.TransactionInput
+
+	for day := 0; day < days; day++ {
+		date := start.AddDate(0, 0, day)
+		if date.Day() == 25 {
+			txns = append(txns, g.salaryAt(date.Add(9*time.Hour)))
+		}
+
+		// Busier on Fridays and month end
+		n := g.rng.Intn(perDay*2 + 1)
+		if date.Weekday() == time.Friday || date.Day() >= 25 {
+			n += perDay / 2
+		}
+		for i := 0; i < n; i++ {
+			at := date.Add(time.Duration(6*60+g.rng.Intn(16*60)) * time.Minute)
+			if at.After(now) {
+				continue
+			}
+			txns = append(txns, g.At(at))
+		}
+	}
+
+	return txns
+}
+
+// Batch returns n new transactions dated within the last hour, as a live sync would send
+func (g *Generator) Batch(n int) []models.TransactionInput {
+	now := time.Now()
+	txns := make([]models.TransactionInput, n)
+	for i := range txns {
+		txns[i] = g.At(now.Add(-time.Duration(g.rng.Intn(3600)) * time.Second))
+	}
+	return txns
+}
+
+// At returns one random transaction at the given time
+func (g *Generator) At(at time.Time) models.TransactionInput {
+	pick := g.rng.Intn(totalWeight)
+	var p pattern
+	for _, candidate := range patterns {
+		if pick < candidate.weight {
+			p = candidate
+			break
+		}
+		pick -= candidate.weight
+	}
+
+	// Amounts skew small: most purchases sit near the bottom of the range
+	amount := p.minAmount + (p.maxAmount-p.minAmount)*math.Pow(g.rng.Float64(), 2)
+	if amount >= 10 {
+		amount = math.Round(amount)
+	} else {
+		amount = math.Round(amount*100) / 100
+	}
+
+	var recipient *string
+	if len(p.recipients) > 0 {
+		r := p.recipients[g.rng.Intn(len(p.recipients))]
+		recipient = &r
+	}
+
+	return g.build(p.category, p.txType, amount, recipient, p.description, at)
+}
+
+func (g *Generator) salaryAt(at time.Time) models.TransactionInput {
+	employer := "EMPLOYER PAYROLL"
+	return g.build("SALARY", "INCOME", g.salary, &employer, "Salary", at)
+}
+
+func (g *Generator) build(category, txType string, amount float64, recipient *string, description string, at time.Time) models.TransactionInput {
+	if txType == "INCOME" {
+		g.balance += amount
+	} else {
+		g.balance = math.Max(0, g.balance-amount)
+	}
+	balance := math.Round(g.balance*100) / 100
+
+	g.counter++
+	reference := fmt.Sprintf("%s%010d", g.operator[:2], g.rng.Int63n(1e10))
+	desc := description
+
+	// Fingerprint as the app would: hash of the (synthetic) SMS text
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%.2f|%d", g.device, g.counter, category, amount, at.UnixNano())))
+
+	return models.TransactionInput{
+		Amount:         amount,
+		Type:           txType,
+		Category:       category,
+		Operator:       g.operator,
+		Recipient:      recipient,
+		Balance:        &balance,
+		Reference:      &reference,
+		Description:    &desc,
+		SMSFingerprint: hex.EncodeToString(sum[:]),
+		Date:           at.UnixMilli(),
+	}
+}